@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Activity is only as current as live ingestion, so users chatting in channels that aren't being ingested won't show up
+
+const _MaxActiveNowUsers = 20
+
+type _ActiveNowArgs struct {
+	Channel string `default:"" description:"Channel to show active users of. Defaults to the current channel."`
+	Guild   bool   `default:"false" description:"Show active users across the whole server instead of one channel."`
+	Minutes int    `default:"0" description:"How many minutes back to look. Defaults to ACTIVE_NOW_WINDOW."`
+}
+
+func _ActiveNowHandler(message *discordgo.MessageCreate, args _ActiveNowArgs) {
+	window := config.ActiveNowWindow
+	if args.Minutes > 0 {
+		window = time.Duration(args.Minutes) * time.Minute
+	}
+
+	index := _GuildReadIndex("messages", message.GuildID)
+	var scopeFilter map[string]interface{}
+	var routing []string
+	scope := "the server"
+	if args.Guild {
+		var err error
+		scopeFilter, err = _GuildMessagesFilter(message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	} else {
+		if args.Channel == "" {
+			args.Channel = message.ChannelID
+		}
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		index = _ChannelReadIndex("messages", channel.ID)
+		scopeFilter = map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+		routing = _ChannelRouting(channel.ID)
+		scope = "#" + channel.Name
+	}
+
+	resp, err := _SearchRouted([]string{index}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					scopeFilter,
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": time.Now().Add(-window).UTC().Format(time.RFC3339)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"authors": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "author_id", "size": _MaxActiveNowUsers},
+			},
+		},
+	}, routing)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating active users")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var authors _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["authors"], &authors)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding active users")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, len(authors.Buckets))
+	for _, bucket := range authors.Buckets {
+		authorID := fmt.Sprint(bucket.Key)
+		name, err := _CurrentDisplayName(message.GuildID, authorID)
+		if err != nil {
+			name = fmt.Sprintf("<@%s>", authorID)
+		}
+		lines = append(lines, fmt.Sprintf("%s - %d messages", name, bucket.DocCount))
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Active in %s", scope))
+	embed.Description = strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		embed.Description = "Nobody has sent a message recently."
+	}
+	embed.Footer = _EmbedFooter(fmt.Sprintf("Messages from the last %s", window))
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
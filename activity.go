@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _ActivityBarWidth = 30
+const _MaxActivityChannels = 10
+
+// _GuildMessagesFilter builds a filter restricting messages to a guild. Messages ingested before guild IDs were stored
+// are matched by the guild's current channels instead.
+func _GuildMessagesFilter(guildID string) (map[string]interface{}, error) {
+	channelFilter, err := _GuildChannelFilter(guildID, "")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"guild_id": guildID}},
+				channelFilter,
+			},
+			"minimum_should_match": 1,
+		},
+	}, nil
+}
+
+// _ActivityChart renders a bar for each bucket, scaled to the busiest one
+func _ActivityChart(buckets []_StatsBucket, dateLength int) string {
+	busiest := 0
+	for _, bucket := range buckets {
+		if bucket.DocCount > busiest {
+			busiest = bucket.DocCount
+		}
+	}
+
+	var chart strings.Builder
+	for _, bucket := range buckets {
+		width := 0
+		if busiest > 0 {
+			width = bucket.DocCount * _ActivityBarWidth / busiest
+		}
+		date := bucket.KeyAsString
+		if len(date) > dateLength {
+			date = date[:dateLength]
+		}
+		bar := strings.Repeat("█", width) + strings.Repeat(" ", _ActivityBarWidth-width)
+		fmt.Fprintf(&chart, "%s %s %d\n", date, bar, bucket.DocCount)
+	}
+	return chart.String()
+}
+
+type _ServerActivityArgs struct {
+	Days     int    `default:"90" description:"Number of days of activity to show."`
+	By       string `default:"week" description:"Whether to group messages by day or week."`
+	Channels int    `default:"0" description:"Number of the busiest channels to list alongside the trend."`
+}
+
+func _ServerActivityHandler(message *discordgo.MessageCreate, args _ServerActivityArgs) {
+	if args.By != "day" && args.By != "week" {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown grouping %q, expected day or week.", args.By))
+		return
+	}
+	if args.Days < 1 {
+		args.Days = 1
+	}
+	if args.Channels < 0 || args.Channels > _MaxActivityChannels {
+		args.Channels = _MaxActivityChannels
+	}
+
+	guildFilter, err := _GuildMessagesFilter(message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	aggs := map[string]interface{}{
+		"activity": map[string]interface{}{
+			"date_histogram": map[string]interface{}{
+				"field":             "timestamp",
+				"calendar_interval": args.By,
+				"format":            "yyyy-MM-dd",
+				"min_doc_count":     0,
+				"extended_bounds":   map[string]interface{}{"min": fmt.Sprintf("now-%dd/d", args.Days), "max": "now/d"},
+			},
+		},
+	}
+	if args.Channels > 0 {
+		aggs["channels"] = map[string]interface{}{
+			"terms": map[string]interface{}{"field": "channel_id", "size": args.Channels},
+		}
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("messages", message.GuildID)}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					guildFilter,
+					_NotDeletedFilter,
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd/d", args.Days)}}},
+				},
+			},
+		},
+		"aggs": aggs,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating server activity")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var activity _StatsAggregation
+	err = json.Unmarshal(resp.Aggregations["activity"], &activity)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding activity aggregation")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	header := fmt.Sprintf("Messages per %s over the last %d days (%d total):", args.By, args.Days, resp.Hits.Total.Value)
+	chart := _ActivityChart(activity.Buckets, len("2006-01-02"))
+	if len(header)+len(chart)+len("\n```\n```") > _MaxMessageLength {
+		_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+			Content: header,
+			Files: []*discordgo.File{{
+				Name:        fmt.Sprintf("activity-by-%s.txt", args.By),
+				ContentType: "text/plain",
+				Reader:      strings.NewReader(chart),
+			}},
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error uploading server activity")
+		}
+	} else {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%s\n```\n%s```", header, chart))
+	}
+
+	if args.Channels == 0 {
+		return
+	}
+	var channels _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["channels"], &channels)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding channel aggregation")
+		return
+	}
+	lines := []string{"Busiest channels:"}
+	for index, bucket := range channels.Buckets {
+		lines = append(lines, fmt.Sprintf("%d. <#%v> - %d messages", index+1, bucket.Key, bucket.DocCount))
+	}
+	_SendLines(message.ChannelID, lines)
+}
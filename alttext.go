@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// discordgo doesn't decode attachment descriptions, which hold an attachment's alt text, so they are read from the raw
+// message JSON as it's received and looked up again when the attachment is indexed.
+// Descriptions of attachments that are never indexed, such as ones not matching the type allowlist, are forgotten after a while.
+
+const _AttachmentDescriptionLifetime = 10 * time.Minute
+
+type _StoredAttachmentDescription struct {
+	Description string
+	Stored      time.Time
+}
+
+// _RawMessageAttachments represents the parts of a raw message that discordgo doesn't decode
+type _RawMessageAttachments struct {
+	Attachments []struct {
+		ID          string `json:"id"`
+		Description string `json:"description"`
+	} `json:"attachments"`
+}
+
+var _AttachmentDescriptions = make(map[string]_StoredAttachmentDescription)
+var _AttachmentDescriptionsLock sync.Mutex
+
+// _StoreAttachmentDescriptions remembers the descriptions of the attachments in raw messages
+func _StoreAttachmentDescriptions(messages []_RawMessageAttachments) {
+	_AttachmentDescriptionsLock.Lock()
+	defer _AttachmentDescriptionsLock.Unlock()
+
+	now := time.Now()
+	for id, stored := range _AttachmentDescriptions {
+		if now.Sub(stored.Stored) > _AttachmentDescriptionLifetime {
+			delete(_AttachmentDescriptions, id)
+		}
+	}
+	for _, message := range messages {
+		for _, attachment := range message.Attachments {
+			if attachment.Description != "" {
+				_AttachmentDescriptions[attachment.ID] = _StoredAttachmentDescription{Description: attachment.Description, Stored: now}
+			}
+		}
+	}
+}
+
+// _TakeAttachmentDescription returns the description of an attachment, if it had one, and forgets it
+func _TakeAttachmentDescription(attachmentID string) string {
+	_AttachmentDescriptionsLock.Lock()
+	defer _AttachmentDescriptionsLock.Unlock()
+
+	stored := _AttachmentDescriptions[attachmentID]
+	delete(_AttachmentDescriptions, attachmentID)
+	return stored.Description
+}
+
+// _FetchChannelMessages fetches a page of messages like session.ChannelMessages, also storing their attachment descriptions
+func _FetchChannelMessages(channelID string, limit int, beforeID string, afterID string) ([]*discordgo.Message, error) {
+	uri := discordgo.EndpointChannelMessages(channelID)
+	values := url.Values{}
+	values.Set("limit", strconv.Itoa(limit))
+	if beforeID != "" {
+		values.Set("before", beforeID)
+	}
+	if afterID != "" {
+		values.Set("after", afterID)
+	}
+
+	body, err := session.RequestWithBucketID("GET", uri+"?"+values.Encode(), nil, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*discordgo.Message
+	err = json.Unmarshal(body, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", discordgo.ErrJSONUnmarshal, err.Error())
+	}
+	var raw []_RawMessageAttachments
+	if json.Unmarshal(body, &raw) == nil {
+		_StoreAttachmentDescriptions(raw)
+	}
+	return messages, nil
+}
+
+// _LiveIngestEventHandler stores the attachment descriptions of newly sent messages before ingesting them
+func _LiveIngestEventHandler(s *discordgo.Session, event *discordgo.Event) {
+	created, ok := event.Struct.(*discordgo.MessageCreate)
+	if !ok {
+		return
+	}
+
+	var raw _RawMessageAttachments
+	if json.Unmarshal(event.RawData, &raw) == nil {
+		_StoreAttachmentDescriptions([]_RawMessageAttachments{raw})
+	}
+	_LiveIngestHandler(s, created)
+}
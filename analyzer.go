@@ -0,0 +1,56 @@
+package main
+
+// The analyzer used for message content decides how it is split into searchable terms. The standard analyzer works
+// poorly for many languages, so a built-in language analyzer can be configured instead, and with per-guild indices each
+// guild can use its own. Elasticsearch can't change the analyzer of an existing field, so changing either setting only
+// affects newly created indices, and existing channels must be re-ingested into a new index to use it.
+
+var _BuiltInAnalyzers = map[string]bool{
+	"standard": true, "simple": true, "whitespace": true, "stop": true,
+	"arabic": true, "armenian": true, "basque": true, "bengali": true, "brazilian": true, "bulgarian": true,
+	"catalan": true, "cjk": true, "czech": true, "danish": true, "dutch": true, "english": true, "estonian": true,
+	"finnish": true, "french": true, "galician": true, "german": true, "greek": true, "hindi": true,
+	"hungarian": true, "indonesian": true, "irish": true, "italian": true, "latvian": true, "lithuanian": true,
+	"norwegian": true, "persian": true, "portuguese": true, "romanian": true, "russian": true, "sorani": true,
+	"spanish": true, "swedish": true, "thai": true, "turkish": true,
+}
+
+// _ContentAnalyzer returns the analyzer a guild's message content should be indexed with
+func _ContentAnalyzer(guildID string) string {
+	if analyzer, ok := config.GuildContentAnalyzers[guildID]; ok && config.PerGuildIndices {
+		return analyzer
+	}
+	return config.ContentAnalyzer
+}
+
+// _ContentMapping returns the mapping of the content field when indexed with an analyzer
+func _ContentMapping(analyzer string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "text",
+		"analyzer": analyzer,
+		"fields": map[string]interface{}{
+			"keyword": map[string]interface{}{"type": "keyword", "ignore_above": _ContentKeywordMaxLength},
+			"words":   map[string]interface{}{"type": "text", "analyzer": "elkbot_words", "fielddata": true},
+		},
+	}
+}
+
+// _MessageMappingWithAnalyzer returns the message mapping with its content field indexed using an analyzer
+func _MessageMappingWithAnalyzer(analyzer string) map[string]interface{} {
+	properties := _MessageMappingWithoutContent()["properties"].(map[string]interface{})
+	properties["content"] = _ContentMapping(analyzer)
+	properties["content_searchable"] = map[string]interface{}{"type": "text", "analyzer": analyzer}
+	return map[string]interface{}{"properties": properties}
+}
+
+// _MessageMappingWithoutContent returns the message mapping without its analyzed content fields, for updating existing
+// indices whose content was indexed with a different analyzer
+func _MessageMappingWithoutContent() map[string]interface{} {
+	properties := make(map[string]interface{}, len(_MessageMapping["properties"].(map[string]interface{})))
+	for field, mapping := range _MessageMapping["properties"].(map[string]interface{}) {
+		if field != "content" && field != "content_searchable" {
+			properties[field] = mapping
+		}
+	}
+	return map[string]interface{}{"properties": properties}
+}
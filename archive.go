@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Archiving closes time-based indices that have been rolled over, so that they stop using memory and are skipped by searches
+// while their data stays on disk. Restoring an index reopens it, making its messages searchable again.
+// Only rolled over indices can be archived, as the index being written to must stay open.
+
+const _ArchiveCheckInterval = time.Hour
+
+var _ArchivableBases = []string{"messages", "attachments"}
+
+type _CatIndexCreation struct {
+	Index        string `json:"index"`
+	Status       string `json:"status"`
+	CreationDate string `json:"creation.date"`
+}
+
+// _CurrentWriteIndices returns the indices the time-based write aliases currently point to
+func _CurrentWriteIndices() (map[string]bool, error) {
+	aliases := make([]string, 0, len(_ArchivableBases))
+	for _, base := range _ArchivableBases {
+		aliases = append(aliases, _WriteIndex(base))
+	}
+
+	req := esapi.IndicesGetAliasRequest{Name: aliases}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var indices map[string]struct {
+		Aliases map[string]struct {
+			IsWriteIndex bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	err = _DecodeResponse(resp, &indices)
+	if err != nil {
+		return nil, err
+	}
+
+	writeIndices := make(map[string]bool)
+	for index, info := range indices {
+		for _, alias := range info.Aliases {
+			if alias.IsWriteIndex {
+				writeIndices[index] = true
+			}
+		}
+	}
+	return writeIndices, nil
+}
+
+// _ValidateArchivableIndex checks that an index is one of Elkbot's time-based indices and isn't being written to
+func _ValidateArchivableIndex(index string) error {
+	if !config.UseTimeBasedIndices {
+		return fmt.Errorf("archiving indices requires time-based indices to be enabled")
+	}
+
+	isElkbotIndex := false
+	for _, base := range _ArchivableBases {
+		if strings.HasPrefix(index, base+"-") && index != _WriteIndex(base) {
+			isElkbotIndex = true
+		}
+	}
+	if !isElkbotIndex {
+		return fmt.Errorf("%s is not one of Elkbot's time-based indices", index)
+	}
+
+	writeIndices, err := _CurrentWriteIndices()
+	if err != nil {
+		return err
+	}
+	if writeIndices[index] {
+		return fmt.Errorf("%s is currently being written to and can't be archived until it's rolled over", index)
+	}
+	return nil
+}
+
+// _SetIndexOpen opens or closes an index
+func _SetIndexOpen(index string, open bool) error {
+	var resp *esapi.Response
+	var err error
+	if open {
+		resp, err = esapi.IndicesOpenRequest{Index: []string{index}}.Do(context.Background(), esClient)
+	} else {
+		resp, err = esapi.IndicesCloseRequest{Index: []string{index}}.Do(context.Background(), esClient)
+	}
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+// _ArchiveOldIndices closes every rolled over index created longer ago than the configured threshold
+func _ArchiveOldIndices() error {
+	patterns := make([]string, 0, len(_ArchivableBases))
+	for _, base := range _ArchivableBases {
+		patterns = append(patterns, _ReadIndex(base))
+	}
+	req := esapi.CatIndicesRequest{
+		Index:  patterns,
+		Format: "json",
+		H:      []string{"index", "status", "creation.date"},
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	var indices []_CatIndexCreation
+	err = _DecodeResponse(resp, &indices)
+	if err != nil {
+		return err
+	}
+
+	writeIndices, err := _CurrentWriteIndices()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-config.ArchiveIndicesAfter)
+	for _, index := range indices {
+		if index.Status != "open" || writeIndices[index.Index] {
+			continue
+		}
+		createdMs, err := strconv.ParseInt(index.CreationDate, 10, 64)
+		if err != nil || time.Unix(0, createdMs*int64(time.Millisecond)).After(cutoff) {
+			continue
+		}
+
+		err = _SetIndexOpen(index.Index, false)
+		if err != nil {
+			log.Error().Err(err).Str("index", index.Index).Msg("Error archiving index")
+			continue
+		}
+		log.Info().Str("index", index.Index).Msg("Archived index")
+	}
+	return nil
+}
+
+// _ArchiveLoop periodically archives indices older than the configured threshold
+func _ArchiveLoop() {
+	ticker := time.NewTicker(_ArchiveCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := _ArchiveOldIndices()
+		if err != nil {
+			log.Error().Err(err).Msg("Error archiving old indices")
+		}
+	}
+}
+
+type _ArchiveIndexArgs struct {
+	Name string `description:"Name of the index to archive or restore."`
+}
+
+func _ArchiveIndexHandler(message *discordgo.MessageCreate, args _ArchiveIndexArgs) {
+	err := _ValidateArchivableIndex(args.Name)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	confirmed, err := _Confirm(message, fmt.Sprintf("This will close `%s`, hiding its documents from searches until it's restored.", args.Name))
+	if err != nil {
+		log.Error().Err(err).Msg("Error confirming archival")
+		return
+	}
+	if !confirmed {
+		session.ChannelMessageSend(message.ChannelID, "Archival cancelled.")
+		return
+	}
+
+	err = _SetIndexOpen(args.Name, false)
+	if err != nil {
+		log.Error().Err(err).Str("index", args.Name).Msg("Error archiving index")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	log.Info().Str("index", args.Name).Str("author_id", message.Author.ID).Msg("Archived index")
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Archived `%s`. Its messages won't appear in searches until it's restored.", args.Name))
+}
+
+func _RestoreIndexHandler(message *discordgo.MessageCreate, args _ArchiveIndexArgs) {
+	err := _ValidateArchivableIndex(args.Name)
+	if err == nil {
+		err = _SetIndexOpen(args.Name, true)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("index", args.Name).Msg("Error restoring index")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	log.Info().Str("index", args.Name).Str("author_id", message.Author.ID).Msg("Restored index")
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Restored `%s`.", args.Name))
+}
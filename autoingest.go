@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord sends a guild create event for every guild when connecting, so only guilds joined within this window
+// are treated as new
+const _NewGuildWindow = 5 * time.Minute
+
+const _AutoIngestQueueSize = 1000
+
+// _AutoIngestJob represents a channel queued to be ingested after joining its guild
+type _AutoIngestJob struct {
+	GuildID   string
+	ChannelID string
+}
+
+var _AutoIngestQueue = make(chan _AutoIngestJob, _AutoIngestQueueSize)
+
+// _AutoIngestWorker ingests queued channels one at a time, waiting between channels so that joining a large guild
+// doesn't flood Discord with history requests
+func _AutoIngestWorker() {
+	for job := range _AutoIngestQueue {
+		stats, err := _IngestChannel(job.ChannelID)
+		if err != nil {
+			log.Error().Err(err).Str("guild_id", job.GuildID).Str("channel_id", job.ChannelID).Msg("Error automatically ingesting channel")
+		} else {
+			log.Info().Str("guild_id", job.GuildID).Str("channel_id", job.ChannelID).Int("indexed", stats.Indexed).Msg("Automatically ingested channel")
+		}
+		time.Sleep(config.AutoIngestChannelDelay)
+	}
+}
+
+// _AutoIngestGuild queues every readable text channel of a newly joined guild to be ingested
+func _AutoIngestGuild(guild *discordgo.GuildCreate) {
+	if guild.JoinedAt.IsZero() || time.Since(guild.JoinedAt) > _NewGuildWindow {
+		return
+	}
+
+	channels := _ReadableTextChannels(guild.ID)
+	queued := 0
+	for _, channel := range channels {
+		select {
+		case _AutoIngestQueue <- _AutoIngestJob{GuildID: guild.ID, ChannelID: channel.ID}:
+			queued++
+		default:
+			log.Warn().Str("guild_id", guild.ID).Str("channel_id", channel.ID).Msg("Automatic ingest queue is full, skipping channel")
+		}
+	}
+	log.Info().Str("guild_id", guild.ID).Str("guild_name", guild.Name).Int("channels", queued).Msg("Queued channels of new guild for ingestion")
+
+	if queued > 0 && guild.SystemChannelID != "" {
+		_, err := session.ChannelMessageSend(guild.SystemChannelID, fmt.Sprintf("Elkbot has started ingesting the history of %d channels in this server.", queued))
+		if err != nil {
+			log.Debug().Err(err).Str("guild_id", guild.ID).Msg("Unable to send ingestion notice")
+		}
+	}
+}
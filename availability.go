@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// If Elasticsearch can't be reached at startup, Elkbot still connects to Discord rather than exiting, which would otherwise
+// crash-loop the bot while Elasticsearch restarts. Ingestion and commands that need Elasticsearch are unavailable until it
+// can be reached and its indices have been set up.
+
+var _ESAvailable int32
+
+var _ErrESUnavailable = errors.New("elasticsearch is unavailable")
+
+const _ESUnavailableMessage = "Elasticsearch is currently unavailable, try again once it has recovered."
+
+// _CommandsWithoutES lists the commands that still work before Elasticsearch has become available
+var _CommandsWithoutES = map[string]bool{
+	"ping":     true,
+	"loglevel": true,
+	"commands": true,
+	"status":   true,
+}
+
+// _IsESAvailable returns whether Elasticsearch was reachable and its indices have been set up
+func _IsESAvailable() bool {
+	return atomic.LoadInt32(&_ESAvailable) == 1
+}
+
+// _SetupElasticsearch creates the indices, templates and pipelines Elkbot relies on, and loads the state stored in them
+func _SetupElasticsearch() error {
+	if config.ReadOnly {
+		log.Info().Msg("Running in read-only mode, skipping index setup")
+	} else {
+		log.Debug().Msg("Ensuring Elasticsearch indices exist")
+		err := _EnsureIndices()
+		if err != nil {
+			return fmt.Errorf("error creating Elasticsearch indices: %w", err)
+		}
+		log.Debug().Msg("Elasticsearch indices ready")
+	}
+
+	err := _LoadBlocklist()
+	if err != nil {
+		return fmt.Errorf("error loading blocklist: %w", err)
+	}
+	err = _LoadExclusions()
+	if err != nil {
+		return fmt.Errorf("error loading archiving exclusions: %w", err)
+	}
+
+	if !config.ReadOnly {
+		err = _EnsureStandaloneIndex(_DeadLetterIndex, _DeadLetterMapping)
+		if err != nil {
+			return fmt.Errorf("error creating dead letter index: %w", err)
+		}
+		if config.IngestEvents {
+			err = _EnsureStandaloneIndex(_EventsIndex, _EventsMapping)
+			if err != nil {
+				return fmt.Errorf("error creating events index: %w", err)
+			}
+		}
+	}
+	if config.SnapshotRepository != "" {
+		err = _CheckSnapshotRepository()
+		if err != nil {
+			return err
+		}
+	}
+	if config.CreateDefaultPipeline {
+		err = _EnsureDefaultPipeline()
+		if err != nil {
+			return err
+		}
+	}
+
+	atomic.StoreInt32(&_ESAvailable, 1)
+	return nil
+}
+
+// _WaitForElasticsearch retries setting up Elasticsearch until it succeeds
+func _WaitForElasticsearch() {
+	ticker := time.NewTicker(config.ESRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := _CheckESReachable()
+		if err != nil {
+			log.Debug().Err(err).Msg("Elasticsearch is still unreachable")
+			continue
+		}
+		err = _SetupElasticsearch()
+		if err != nil {
+			log.Error().Err(err).Msg("Error setting up Elasticsearch")
+			continue
+		}
+		log.Info().Msg("Elasticsearch is now available, enabling ingestion")
+		return
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Documents ingested before a field was added to the schema don't have it. Fields that can be derived from what is
+// already stored, or from the channel a message was sent in, are filled in place with update_by_query. Any other field
+// needs the original message, so messages missing it are fetched from Discord again and re-indexed.
+
+const _BackfillRequestsPerSecond = 500
+const _MaxBackfillFetches = 5000
+const _BackfillBatchSize = 100
+
+var _errBackfillLimitReached = errors.New("reached the maximum number of messages to fetch")
+
+// _ComputedFields lists the fields that can be backfilled without fetching messages from Discord.
+// Each builds the script and params used to fill in the field for the messages of one channel.
+var _ComputedFields = map[string]func(channel *discordgo.Channel) (string, map[string]interface{}){
+	"content_length": func(_ *discordgo.Channel) (string, map[string]interface{}) {
+		return "String content = ctx._source.content == null ? '' : ctx._source.content; ctx._source.content_length = content.codePointCount(0, content.length())", nil
+	},
+	"guild_id": func(channel *discordgo.Channel) (string, map[string]interface{}) {
+		return "ctx._source.guild_id = params.guild_id", map[string]interface{}{"guild_id": channel.GuildID}
+	},
+	"channel_type": func(channel *discordgo.Channel) (string, map[string]interface{}) {
+		name, ok := _ChannelTypeNames[channel.Type]
+		if !ok {
+			return "", nil
+		}
+		return "ctx._source.channel_type = params.channel_type", map[string]interface{}{"channel_type": name}
+	},
+}
+
+// _MissingFieldQuery matches the messages in a set of channel filters that don't have a field yet
+func _MissingFieldQuery(field string, filters ...interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter":   filters,
+			"must_not": map[string]interface{}{"exists": map[string]interface{}{"field": field}},
+		},
+	}
+}
+
+// _BackfillComputedField fills in a computed field on every message in a guild that is missing it
+func _BackfillComputedField(field string, guildID string) (int, error) {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return 0, fmt.Errorf("error looking up guild: %w", err)
+	}
+
+	channels := append(append([]*discordgo.Channel{}, guild.Channels...), guild.Threads...)
+	updated := 0
+	for _, channel := range channels {
+		script, params := _ComputedFields[field](channel)
+		if script == "" {
+			continue
+		}
+		count, err := _UpdateByQuery(
+			[]string{_ChannelReadIndex("messages", channel.ID)},
+			_MissingFieldQuery(field, map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}),
+			script,
+			params,
+			_BackfillRequestsPerSecond,
+		)
+		if err != nil {
+			return updated, fmt.Errorf("error backfilling %s in channel %s: %w", field, channel.ID, err)
+		}
+		updated += count
+	}
+	return updated, nil
+}
+
+// _BackfillFetchedField re-ingests messages in a guild that are missing a field by fetching them from Discord again.
+// It returns how many messages were re-indexed, how many could no longer be fetched, and whether it stopped early.
+func _BackfillFetchedField(field string, guildID string) (*_IngestStats, int, bool, error) {
+	channelFilter, err := _GuildDiscordChannelFilter(guildID, "")
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	missing := make(map[string][]string)
+	fetches := 0
+	err = _ScanAll([]string{_GuildReadIndex("messages", guildID)}, map[string]interface{}{
+		"_source": []string{"channel_id"},
+		"query":   _MissingFieldQuery(field, channelFilter, _NotDeletedFilter),
+	}, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _MessageDocument
+			if err := json.Unmarshal(hit.Source, &document); err != nil || document.ChannelID == "" {
+				continue
+			}
+			missing[document.ChannelID] = append(missing[document.ChannelID], hit.ID)
+			fetches++
+			if fetches >= _MaxBackfillFetches {
+				return _errBackfillLimitReached
+			}
+		}
+		return nil
+	})
+	limited := errors.Is(err, _errBackfillLimitReached)
+	if err != nil && !limited {
+		return nil, 0, false, err
+	}
+
+	stats := &_IngestStats{}
+	unavailable := 0
+	for channelID, messageIDs := range missing {
+		batch := make([]*discordgo.Message, 0, _BackfillBatchSize)
+		for _, messageID := range messageIDs {
+			fetched, err := session.ChannelMessage(channelID, messageID)
+			if err != nil {
+				log.Debug().Err(err).Str("message_id", messageID).Msg("Unable to fetch message for backfill")
+				unavailable++
+				continue
+			}
+			if fetched.GuildID == "" {
+				fetched.GuildID = guildID
+			}
+			batch = append(batch, fetched)
+			if len(batch) == _BackfillBatchSize {
+				err = _IngestMessageArray(batch, stats)
+				if err != nil {
+					return stats, unavailable, limited, err
+				}
+				batch = batch[:0]
+			}
+		}
+		if len(batch) > 0 {
+			err = _IngestMessageArray(batch, stats)
+			if err != nil {
+				return stats, unavailable, limited, err
+			}
+		}
+	}
+	return stats, unavailable, limited, nil
+}
+
+type _BackfillFieldArgs struct {
+	Field string `description:"Name of the field to fill in on messages that don't have it yet."`
+}
+
+func _BackfillFieldHandler(message *discordgo.MessageCreate, args _BackfillFieldArgs) {
+	field := strings.TrimSpace(args.Field)
+	if _, ok := _MessageMapping["properties"].(map[string]interface{})[field]; !ok {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%q is not a field of message documents, see the schema command for the list.", field))
+		return
+	}
+
+	if _, ok := _ComputedFields[field]; ok {
+		updated, err := _BackfillComputedField(field, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Str("field", field).Msg("Error backfilling field")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Updated %d messages before stopping:\n```\n%s\n```", updated, err.Error()))
+			return
+		}
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Filled in `%s` on %d messages from their stored data.", field, updated))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("`%s` can't be computed from stored data, re-fetching messages that are missing it from Discord...", field))
+	stats, unavailable, limited, err := _BackfillFetchedField(field, message.GuildID)
+	if err != nil {
+		log.Error().Err(err).Str("field", field).Msg("Error backfilling field")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	reply := fmt.Sprintf("Re-ingested messages missing `%s`. %s", field, stats.Summary())
+	if unavailable > 0 {
+		reply += fmt.Sprintf(" %d messages could no longer be fetched from Discord.", unavailable)
+	}
+	if limited {
+		reply += fmt.Sprintf(" Stopped after %d messages, run the command again to continue.", _MaxBackfillFetches)
+	}
+	session.ChannelMessageSend(message.ChannelID, reply)
+}
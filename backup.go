@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Backups hold the settings, mappings and aliases of every index Elkbot uses, but none of their documents.
+// Applying a backup creates any of its indices that don't exist yet, so the same configuration can be recreated on another cluster.
+
+// Settings Elasticsearch assigns to an index itself, which are rejected when creating an index
+var _GeneratedIndexSettings = []string{
+	"index.uuid",
+	"index.creation_date",
+	"index.provided_name",
+	"index.version.",
+	"index.resize.",
+	"index.routing.allocation.initial_recovery.",
+	"index.lifecycle.indexing_complete",
+}
+
+// _IndexBackup represents the configuration of a single index within a backup
+type _IndexBackup struct {
+	Settings map[string]interface{} `json:"settings"`
+	Mappings map[string]interface{} `json:"mappings"`
+	Aliases  map[string]interface{} `json:"aliases"`
+}
+
+// _MappingsBackup represents a backup of the configuration of Elkbot's indices
+type _MappingsBackup struct {
+	TemplateVersion int                     `json:"template_version"`
+	CreatedAt       time.Time               `json:"created_at"`
+	Indices         map[string]_IndexBackup `json:"indices"`
+}
+
+// _BackupIndexPatterns returns patterns matching every index Elkbot uses, including time-based and per-guild indices
+func _BackupIndexPatterns() []string {
+	return []string{"messages*", "attachments*", _BlocklistIndex, _ExclusionsIndex, _CheckpointsIndex, _DeadLetterIndex, _EventsIndex}
+}
+
+// _IsGeneratedSetting returns whether a setting is assigned by Elasticsearch rather than chosen when creating an index
+func _IsGeneratedSetting(setting string) bool {
+	for _, generated := range _GeneratedIndexSettings {
+		if setting == generated || (strings.HasSuffix(generated, ".") && strings.HasPrefix(setting, generated)) {
+			return true
+		}
+	}
+	return false
+}
+
+// _BackupMappings fetches the configuration of every one of Elkbot's indices that currently exists
+func _BackupMappings() (*_MappingsBackup, error) {
+	flatSettings := true
+	allowNoIndices := true
+	req := esapi.IndicesGetRequest{
+		Index:             _BackupIndexPatterns(),
+		FlatSettings:      &flatSettings,
+		AllowNoIndices:    &allowNoIndices,
+		IgnoreUnavailable: &allowNoIndices,
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var indices map[string]_IndexBackup
+	err = _DecodeResponse(resp, &indices)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indices {
+		for setting := range index.Settings {
+			if _IsGeneratedSetting(setting) {
+				delete(index.Settings, setting)
+			}
+		}
+	}
+
+	return &_MappingsBackup{
+		TemplateVersion: _TemplateVersion,
+		CreatedAt:       time.Now().UTC(),
+		Indices:         indices,
+	}, nil
+}
+
+// _IndexExists returns whether an index or alias with the given name exists
+func _IndexExists(index string) (bool, error) {
+	req := esapi.IndicesExistsRequest{Index: []string{index}}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return false, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// _ApplyIndexBackup creates an index with the configuration stored in a backup.
+// Generated settings are dropped so that backups written by hand or by other tools can still be applied.
+func _ApplyIndexBackup(index string, backup _IndexBackup) error {
+	settings := make(map[string]interface{}, len(backup.Settings))
+	for setting, value := range backup.Settings {
+		if !_IsGeneratedSetting(setting) {
+			settings[setting] = value
+		}
+	}
+
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"settings": settings,
+		"mappings": backup.Mappings,
+		"aliases":  backup.Aliases,
+	})
+	req := esapi.IndicesCreateRequest{
+		Index: index,
+		Body:  bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+func _BackupMappingsHandler(message *discordgo.MessageCreate, args struct{}) {
+	backup, err := _BackupMappings()
+	if err != nil {
+		log.Error().Err(err).Msg("Error backing up index mappings")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	data, _ := json.MarshalIndent(backup, "", "  ")
+	filename := fmt.Sprintf("elkbot-mappings-%s.json", backup.CreatedAt.Format("20060102-150405"))
+	summary := fmt.Sprintf("Backed up the settings and mappings of %d indices.", len(backup.Indices))
+
+	if config.BackupPath != "" {
+		path := filepath.Join(config.BackupPath, filename)
+		err = os.WriteFile(path, data, 0o600)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Error writing mappings backup")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		log.Info().Str("path", path).Int("indices", len(backup.Indices)).Msg("Wrote mappings backup")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%s Saved to `%s`.", summary, path))
+		return
+	}
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: summary,
+		Files: []*discordgo.File{{
+			Name:        filename,
+			ContentType: "application/json",
+			Reader:      bytes.NewReader(data),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading mappings backup")
+	}
+}
+
+func _ApplyMappingsHandler(message *discordgo.MessageCreate, args struct{}) {
+	if len(message.Attachments) != 1 {
+		session.ChannelMessageSend(message.ChannelID, "Please attach a single backup file created by backup-mappings.")
+		return
+	}
+
+	data, err := _Download(message.Attachments[0].URL)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var backup _MappingsBackup
+	err = json.Unmarshal(data, &backup)
+	if err != nil || len(backup.Indices) == 0 {
+		session.ChannelMessageSend(message.ChannelID, "That file isn't a backup created by backup-mappings.")
+		return
+	}
+
+	names := make([]string, 0, len(backup.Indices))
+	for name := range backup.Indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	confirmed, err := _Confirm(message, fmt.Sprintf("This will create %d indices from the backup: %s", len(names), strings.Join(names, ", ")))
+	if err != nil {
+		log.Error().Err(err).Msg("Error confirming mappings restore")
+		return
+	}
+	if !confirmed {
+		session.ChannelMessageSend(message.ChannelID, "Restore cancelled.")
+		return
+	}
+
+	var created, existing []string
+	var failed []string
+	for _, name := range names {
+		exists, err := _IndexExists(name)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		if exists {
+			existing = append(existing, name)
+			continue
+		}
+
+		err = _ApplyIndexBackup(name, backup.Indices[name])
+		if err != nil {
+			log.Error().Err(err).Str("index", name).Msg("Error creating index from backup")
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		log.Info().Str("index", name).Msg("Created index from backup")
+		created = append(created, name)
+	}
+
+	var reply strings.Builder
+	fmt.Fprintf(&reply, "Created %d indices from the backup.", len(created))
+	if backup.TemplateVersion != _TemplateVersion {
+		fmt.Fprintf(&reply, " The backup was made with template version %d, but this version of Elkbot uses %d.", backup.TemplateVersion, _TemplateVersion)
+	}
+	if len(existing) > 0 {
+		fmt.Fprintf(&reply, "\nSkipped indices that already exist: %s", strings.Join(existing, ", "))
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&reply, "\n```\n%s\n```", strings.Join(failed, "\n"))
+	}
+	session.ChannelMessageSend(message.ChannelID, reply.String())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Benchmarks run sequentially and are capped at a small number of iterations, so they don't put noticeable load on the cluster
+const _MaxBenchmarkIterations = 20
+
+// _SearchBenchmark contains the timings of repeatedly running a search
+type _SearchBenchmark struct {
+	Latencies []time.Duration
+	Took      []time.Duration
+	Shards    int
+	Hits      int
+}
+
+// _BenchmarkSearch runs the same search a number of times against a guild's read index,
+// recording both the round trip latency and the time Elasticsearch reports spending on it.
+// Searches scoped to a channel are routed to its shards, the same way as regular searches.
+func _BenchmarkSearch(guildID string, args _SearchArgs, iterations int) (*_SearchBenchmark, error) {
+	var channelFilter map[string]interface{}
+	var routing []string
+	if args.Channel != "" {
+		channelFilter = map[string]interface{}{"term": map[string]interface{}{"channel_id": args.Channel}}
+		routing = _ChannelRouting(args.Channel)
+	} else {
+		var err error
+		channelFilter, err = _GuildChannelFilter(guildID, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	body := map[string]interface{}{
+		"size": args.Limit,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   _SearchTextQuery(args),
+				"filter": []interface{}{channelFilter, _NotDeletedFilter},
+			},
+		},
+	}
+
+	benchmark := &_SearchBenchmark{
+		Latencies: make([]time.Duration, 0, iterations),
+		Took:      make([]time.Duration, 0, iterations),
+	}
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		resp, err := _SearchRouted([]string{_GuildReadIndex("messages", guildID)}, body, routing)
+		if err != nil {
+			return nil, err
+		}
+		benchmark.Latencies = append(benchmark.Latencies, time.Since(start))
+		benchmark.Took = append(benchmark.Took, time.Duration(resp.Took)*time.Millisecond)
+		benchmark.Shards = resp.Shards.Total
+		benchmark.Hits = resp.Hits.Total.Value
+	}
+
+	sort.Slice(benchmark.Latencies, func(i, j int) bool { return benchmark.Latencies[i] < benchmark.Latencies[j] })
+	sort.Slice(benchmark.Took, func(i, j int) bool { return benchmark.Took[i] < benchmark.Took[j] })
+	return benchmark, nil
+}
+
+// _FormatLatencies summarizes sorted durations as their minimum, median and 95th percentile
+func _FormatLatencies(sorted []time.Duration) string {
+	return fmt.Sprintf(
+		"Min: %s\nMedian: %s\n95th percentile: %s",
+		sorted[0].Round(time.Millisecond),
+		_Percentile(sorted, 50).Round(time.Millisecond),
+		_Percentile(sorted, 95).Round(time.Millisecond),
+	)
+}
+
+type _BenchmarkSearchArgs struct {
+	Query      string `description:"Text to search for."`
+	Iterations int    `default:"10" description:"Number of times to run the search."`
+	Channel    string `default:"" description:"Only search messages from this channel, routing the search to its shards."`
+}
+
+func _BenchmarkSearchHandler(message *discordgo.MessageCreate, args _BenchmarkSearchArgs) {
+	if args.Iterations < 1 || args.Iterations > _MaxBenchmarkIterations {
+		args.Iterations = _MaxBenchmarkIterations
+	}
+
+	searchArgs := _SearchArgs{Query: args.Query, Limit: 5}
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		searchArgs.Channel = channel.ID
+	}
+
+	benchmark, err := _BenchmarkSearch(message.GuildID, searchArgs, args.Iterations)
+	if err != nil {
+		log.Error().Err(err).Msg("Error benchmarking search")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Search benchmark for \"%s\"", _Snippet(args.Query, 100)))
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Round trip", Value: _FormatLatencies(benchmark.Latencies), Inline: true},
+		{Name: "Elasticsearch took", Value: _FormatLatencies(benchmark.Took), Inline: true},
+		{Name: "Shards searched", Value: fmt.Sprint(benchmark.Shards), Inline: true},
+	}
+	embed.Footer = _EmbedFooter(fmt.Sprintf("%d runs against %s, matching %d messages", args.Iterations, _GuildReadIndex("messages", message.GuildID), benchmark.Hits))
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
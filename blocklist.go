@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Users blocked at runtime are stored in their own index, so that the list survives restarts
+const _BlocklistIndex = "blocked-users"
+
+var _BlocklistMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"user_id":    map[string]interface{}{"type": "keyword"},
+		"blocked_by": map[string]interface{}{"type": "keyword"},
+		"timestamp":  map[string]interface{}{"type": "date"},
+	},
+}
+
+var _BlockedUsers = map[string]bool{}
+var _BlockedUsersLock sync.RWMutex
+
+// _LoadBlocklist combines the users blocked through the config with the ones blocked at runtime
+func _LoadBlocklist() error {
+	err := _EnsureStandaloneIndex(_BlocklistIndex, _BlocklistMapping)
+	if err != nil {
+		return err
+	}
+
+	blocked := map[string]bool{}
+	for _, userID := range config.IngestBlockedUsers {
+		blocked[userID] = true
+	}
+
+	err = _ScanAll([]string{_BlocklistIndex}, map[string]interface{}{"_source": false}, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			blocked[hit.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error loading blocked users: %w", err)
+	}
+
+	_BlockedUsersLock.Lock()
+	_BlockedUsers = blocked
+	_BlockedUsersLock.Unlock()
+
+	log.Debug().Int("count", len(blocked)).Msg("Loaded blocked users")
+	return nil
+}
+
+// _IsBlocked returns whether a user has asked for their messages not to be ingested
+func _IsBlocked(userID string) bool {
+	_BlockedUsersLock.RLock()
+	defer _BlockedUsersLock.RUnlock()
+	return _BlockedUsers[userID]
+}
+
+func _BlockUser(userID string, blockedBy string) error {
+	now := time.Now()
+	err := _InsertIndex(map[string]interface{}{
+		"user_id":    userID,
+		"blocked_by": blockedBy,
+		"timestamp":  _FormatTimestamp(now),
+	}, _BlocklistIndex, userID, int(now.UnixNano()/int64(time.Millisecond)), "")
+	if err != nil {
+		return fmt.Errorf("error storing blocked user: %w", err)
+	}
+
+	_BlockedUsersLock.Lock()
+	_BlockedUsers[userID] = true
+	_BlockedUsersLock.Unlock()
+	return nil
+}
+
+func _UnblockUser(userID string) error {
+	req := esapi.DeleteRequest{
+		Index:      _BlocklistIndex,
+		DocumentID: userID,
+		Refresh:    "true",
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		err = _DecodeResponse(resp, nil)
+		if err != nil {
+			return fmt.Errorf("error removing blocked user: %w", err)
+		}
+	} else {
+		resp.Body.Close()
+	}
+
+	_BlockedUsersLock.Lock()
+	delete(_BlockedUsers, userID)
+	_BlockedUsersLock.Unlock()
+	return nil
+}
+
+type _BlocklistArgs struct {
+	Action string `default:"list" description:"Action to perform. One of list, add or remove."`
+	User   string `default:"" description:"Mention or ID of the user to add or remove."`
+	Purge  bool   `default:"false" description:"When adding a user, also delete all of their existing data."`
+}
+
+func _BlocklistHandler(message *discordgo.MessageCreate, args _BlocklistArgs) {
+	if args.Action == "list" {
+		_BlockedUsersLock.RLock()
+		mentions := make([]string, 0, len(_BlockedUsers))
+		for userID := range _BlockedUsers {
+			mentions = append(mentions, fmt.Sprintf("<@%s>", userID))
+		}
+		_BlockedUsersLock.RUnlock()
+
+		if len(mentions) == 0 {
+			session.ChannelMessageSend(message.ChannelID, "No users are blocked from ingestion.")
+			return
+		}
+		sort.Strings(mentions)
+		session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+			Content:         "Users blocked from ingestion: " + strings.Join(mentions, ", "),
+			AllowedMentions: &discordgo.MessageAllowedMentions{},
+		})
+		return
+	}
+
+	userID := _ParseUserID(args.User)
+	if userID == "" {
+		session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+		return
+	}
+
+	switch args.Action {
+	case "add":
+		if args.Purge && !_CanRunCommand(message.Author.ID, "purge-user") {
+			log.Warn().Str("author_id", message.Author.ID).Msg("User does not have access to purge user data")
+			return
+		}
+		if args.Purge {
+			confirmed, err := _Confirm(message, fmt.Sprintf("This will block <@%s> and permanently delete all of their messages and attachments.", userID))
+			if err != nil {
+				log.Error().Err(err).Msg("Error confirming purge")
+				return
+			}
+			if !confirmed {
+				session.ChannelMessageSend(message.ChannelID, "Purge cancelled.")
+				return
+			}
+		}
+
+		err := _BlockUser(userID, message.Author.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error blocking user")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		log.Info().Str("user_id", userID).Msg("Blocked user from ingestion")
+
+		if !args.Purge {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Messages from <@%s> will no longer be ingested.", userID))
+			return
+		}
+
+		deletedMessages, deletedAttachments, err := _PurgeUser(userID, "", config.PurgeRequestsPerSecond, nil)
+		if err != nil {
+			log.Error().Err(err).Msg("Error purging user data")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		session.ChannelMessageSend(
+			message.ChannelID,
+			fmt.Sprintf("Messages from <@%s> will no longer be ingested. Deleted %d messages and %d attachments.", userID, deletedMessages, deletedAttachments),
+		)
+	case "remove":
+		for _, configured := range config.IngestBlockedUsers {
+			if configured == userID {
+				session.ChannelMessageSend(message.ChannelID, "This user is blocked through the config, and must be removed from it there.")
+				return
+			}
+		}
+
+		err := _UnblockUser(userID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error unblocking user")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		log.Info().Str("user_id", userID).Msg("Unblocked user from ingestion")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Messages from <@%s> will be ingested again.", userID))
+	default:
+		session.ChannelMessageSend(message.ChannelID, "Unknown action. Valid actions are list, add and remove.")
+	}
+}
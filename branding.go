@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Every embed Elkbot sends is created through _NewEmbed, so that replies share the same color and footer branding.
+// Commands with a footer of their own build it with _EmbedFooter, which keeps the configured icon and footer text alongside it.
+
+// Used when no embed color is configured
+const _DefaultEmbedColor = 0x3B82F6
+
+// _ParseEmbedColor parses a hex color such as #3B82F6, returning false if it isn't valid
+func _ParseEmbedColor(value string) (int, bool) {
+	color, err := strconv.ParseUint(strings.TrimPrefix(value, "#"), 16, 32)
+	if err != nil || color > 0xFFFFFF {
+		return 0, false
+	}
+	return int(color), true
+}
+
+// _EmbedColor returns the configured embed color, or the default color when none is set
+func _EmbedColor() int {
+	if color, ok := _ParseEmbedColor(config.EmbedColor); ok {
+		return color
+	}
+	return _DefaultEmbedColor
+}
+
+// _EmbedFooter builds an embed footer with the given text followed by the configured footer text
+func _EmbedFooter(text string) *discordgo.MessageEmbedFooter {
+	parts := make([]string, 0, 2)
+	if text != "" {
+		parts = append(parts, text)
+	}
+	if config.EmbedFooterText != "" {
+		parts = append(parts, config.EmbedFooterText)
+	}
+	if len(parts) == 0 && config.EmbedFooterIcon == "" {
+		return nil
+	}
+	return &discordgo.MessageEmbedFooter{
+		Text:    strings.Join(parts, " • "),
+		IconURL: config.EmbedFooterIcon,
+	}
+}
+
+// _NewEmbed creates an embed with the given title and the configured color and footer
+func _NewEmbed(title string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:  title,
+		Color:  _EmbedColor(),
+		Footer: _EmbedFooter(""),
+	}
+}
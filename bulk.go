@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+const _BulkMaxAttempts = 3
+
+var _BulkRetryDelay = 2 * time.Second
+
+// _BulkItem represents a single document to be written as part of a bulk request
+type _BulkItem struct {
+	Index      string
+	DocumentID string
+	Version    int
+	Routing    string
+	Body       map[string]interface{}
+}
+
+// _BulkFailure represents a document that could not be indexed, along with the reason why
+type _BulkFailure struct {
+	Item   _BulkItem
+	Reason string
+}
+
+type _BulkItemResult struct {
+	Index  string `json:"_index"`
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+type _BulkResponse struct {
+	Errors bool                         `json:"errors"`
+	Items  []map[string]_BulkItemResult `json:"items"`
+}
+
+// _BuildBulkItems builds the bulk items for a message and all of its attachments
+func _BuildBulkItems(message *discordgo.Message) []_BulkItem {
+	version := _DocumentVersion(message)
+
+	items := []_BulkItem{{
+		Index:      _ChannelWriteIndex("messages", message.ChannelID),
+		DocumentID: message.ID,
+		Version:    version,
+		Routing:    _DocumentRouting(message.ChannelID),
+		Body:       _BuildMessageDocument(message),
+	}}
+	return append(items, _BuildAttachmentItems(message)...)
+}
+
+// _BuildAttachmentItems builds the bulk items for the attachments of a message that should be indexed
+func _BuildAttachmentItems(message *discordgo.Message) []_BulkItem {
+	version := _DocumentVersion(message)
+
+	attachments := _IndexedAttachments(message)
+	items := make([]_BulkItem, 0, len(attachments))
+	for _, attachment := range attachments {
+		items = append(items, _BulkItem{
+			Index:      _ChannelWriteIndex("attachments", message.ChannelID),
+			DocumentID: attachment.ID,
+			Version:    version,
+			Routing:    _DocumentRouting(message.ChannelID),
+			Body:       _BuildAttachmentDocument(attachment, message),
+		})
+	}
+
+	return items
+}
+
+func _EncodeBulkBody(items []_BulkItem) (*bytes.Buffer, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+
+	for _, item := range items {
+		metadata := map[string]interface{}{
+			"_index":       item.Index,
+			"_id":          item.DocumentID,
+			"version":      item.Version,
+			"version_type": "external_gte",
+		}
+		if item.Routing != "" {
+			metadata["routing"] = item.Routing
+		}
+		if pipeline := _IndexPipeline(item.Index); pipeline != "" {
+			metadata["pipeline"] = pipeline
+		}
+		err := encoder.Encode(map[string]interface{}{"index": metadata})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding bulk action: %w", err)
+		}
+		err = encoder.Encode(item.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding document %s: %w", item.DocumentID, err)
+		}
+	}
+
+	return &body, nil
+}
+
+// _BulkAttempt sends a single bulk request, returning the items that should be retried and the items that failed permanently
+func _BulkAttempt(items []_BulkItem) ([]_BulkItem, []_BulkFailure, error) {
+	return _BulkAttemptContext(context.Background(), items)
+}
+
+// _BulkAttemptContext sends a single bulk request that is abandoned once the context is done
+func _BulkAttemptContext(ctx context.Context, items []_BulkItem) ([]_BulkItem, []_BulkFailure, error) {
+	items, err := _ResolveExistingIndices(items)
+	if err != nil {
+		return items, nil, err
+	}
+	body, err := _EncodeBulkBody(items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req := esapi.BulkRequest{
+		Body: body,
+	}
+
+	_RecordMetric(_MetricBulkRequests, 1)
+	_RecordMetric(_MetricBulkDocuments, len(items))
+
+	resp, err := req.Do(ctx, esClient)
+	if err != nil {
+		_RecordMetric(_MetricESErrors, 1)
+		return items, nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		_RecordMetric(_MetricESErrors, 1)
+		return items, nil, fmt.Errorf("got status code %s", resp.Status())
+	}
+
+	var bulkResp _BulkResponse
+	err = json.NewDecoder(resp.Body).Decode(&bulkResp)
+	if err != nil {
+		_RecordMetric(_MetricESErrors, 1)
+		return items, nil, fmt.Errorf("error decoding bulk response: %w", err)
+	}
+
+	if !bulkResp.Errors {
+		_RecordMetric(_MetricDocumentsIndexed, len(items))
+		return nil, nil, nil
+	}
+
+	retry := make([]_BulkItem, 0)
+	failed := make([]_BulkFailure, 0)
+	indexed := 0
+	for index, resultItem := range bulkResp.Items {
+		for _, result := range resultItem {
+			if result.Error == nil {
+				indexed++
+				continue
+			}
+
+			switch {
+			case result.Status == http.StatusConflict:
+				log.Debug().Str("index", result.Index).Str("document_id", result.ID).Msg("Skipping document, a newer version is already indexed")
+			case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+				retry = append(retry, items[index])
+			default:
+				failed = append(failed, _BulkFailure{
+					Item:   items[index],
+					Reason: fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason),
+				})
+			}
+		}
+	}
+	_RecordMetric(_MetricDocumentsIndexed, indexed)
+	if len(retry) > 0 || len(failed) > 0 {
+		_RecordMetric(_MetricESErrors, 1)
+	}
+
+	return retry, failed, nil
+}
+
+// _BulkIndex indexes a batch of documents, retrying those that fail for transient reasons, and returns the documents that
+// could not be indexed. Documents are versioned, so retrying the whole batch or a subset of it is always safe.
+func _BulkIndex(items []_BulkItem) ([]_BulkFailure, error) {
+	return _BulkIndexContext(context.Background(), items)
+}
+
+// _BulkIndexContext indexes a batch of documents, giving up on retrying once the context is done
+func _BulkIndexContext(ctx context.Context, items []_BulkItem) ([]_BulkFailure, error) {
+	failed := make([]_BulkFailure, 0)
+	var lastErr error
+	for attempt := 1; attempt <= _BulkMaxAttempts && len(items) > 0; attempt++ {
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
+		}
+		if attempt > 1 {
+			log.Warn().Int("attempt", attempt).Int("count", len(items)).Msg("Retrying bulk request")
+			_RecordMetric(_MetricBulkRetries, 1)
+			time.Sleep(_BulkRetryDelay * time.Duration(attempt-1))
+		}
+
+		var attemptFailed []_BulkFailure
+		items, attemptFailed, lastErr = _BulkAttemptContext(ctx, items)
+		failed = append(failed, attemptFailed...)
+	}
+
+	reason := "retries exhausted"
+	if lastErr != nil {
+		reason = lastErr.Error()
+	}
+	for _, item := range items {
+		failed = append(failed, _BulkFailure{Item: item, Reason: reason})
+	}
+
+	if len(items) > 0 && ctx.Err() != nil {
+		return failed, fmt.Errorf("bulk request timed out: %w", ctx.Err())
+	}
+	if len(items) > 0 && lastErr != nil {
+		return failed, fmt.Errorf("bulk request failed after %d attempts: %w", _BulkMaxAttempts, lastErr)
+	}
+	return failed, nil
+}
+
+// _BulkInsert indexes a batch of documents using the Elasticsearch bulk API.
+// Documents that still fail after retrying are written to the dead letter index so that they can be replayed later.
+func _BulkInsert(items []_BulkItem) error {
+	return _BulkInsertContext(context.Background(), items)
+}
+
+// _BulkInsertContext indexes a batch of documents, dead lettering any that haven't been indexed once the context is done
+func _BulkInsertContext(ctx context.Context, items []_BulkItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	failed, err := _BulkIndexContext(ctx, items)
+	return _HandleBulkFailures(failed, err)
+}
+
+// _HandleBulkFailures dead letters the documents from a bulk request that failed to index, summarizing them as an error
+func _HandleBulkFailures(failed []_BulkFailure, err error) error {
+	if len(failed) > 0 {
+		_DeadLetter(failed)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		reasons := make([]string, 0, len(failed))
+		for _, failure := range failed {
+			reasons = append(reasons, fmt.Sprintf("%s/%s: %s", failure.Item.Index, failure.Item.DocumentID, failure.Reason))
+		}
+		return fmt.Errorf("%d documents failed to index:\n%s", len(failed), strings.Join(reasons, "\n"))
+	}
+
+	return nil
+}
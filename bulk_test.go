@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBulkRetryWithConflicts(t *testing.T) {
+	previousDelay := _BulkRetryDelay
+	_BulkRetryDelay = 0
+	t.Cleanup(func() { _BulkRetryDelay = previousDelay })
+
+	attempts := 0
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		attempts++
+		if attempts == 1 {
+			return http.StatusOK, `{"errors": true, "items": [
+				{"index": {"_index": "messages", "_id": "1", "status": 201}},
+				{"index": {"_index": "messages", "_id": "2", "status": 409, "error": {"type": "version_conflict_engine_exception", "reason": "newer"}}},
+				{"index": {"_index": "messages", "_id": "3", "status": 503, "error": {"type": "unavailable_shards_exception", "reason": "busy"}}}
+			]}`
+		}
+		// The retried document was indexed by the first attempt before its shard timed out
+		return http.StatusOK, `{"errors": true, "items": [
+			{"index": {"_index": "messages", "_id": "3", "status": 409, "error": {"type": "version_conflict_engine_exception", "reason": "same"}}}
+		]}`
+	})
+
+	items := []_BulkItem{
+		{Index: "messages", DocumentID: "1", Version: 10, Body: map[string]interface{}{"content": "new"}},
+		{Index: "messages", DocumentID: "2", Version: 20, Body: map[string]interface{}{"content": "older edit"}},
+		{Index: "messages", DocumentID: "3", Version: 30, Body: map[string]interface{}{"content": "retried"}},
+	}
+	failed, err := _BulkIndex(items)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(failed) != 0 {
+		t.Fatalf("got failures %+v, want conflicts to be ignored", failed)
+	}
+
+	requests := transport.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want the batch and one retry", len(requests))
+	}
+	for _, req := range requests {
+		lines := req.BulkLines(t)
+		for i := 0; i < len(lines); i += 2 {
+			action := lines[i]["index"].(map[string]interface{})
+			if action["version_type"] != "external_gte" {
+				t.Errorf("got action %v, want external_gte versioning", action)
+			}
+		}
+	}
+	retried := requests[1].BulkLines(t)
+	if len(retried) != 2 || retried[0]["index"].(map[string]interface{})["version"] != float64(30) {
+		t.Errorf("got retried lines %v, want document 3 with its original version", retried)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Disabling refreshes while a large backlog is ingested lets Elasticsearch build fewer, larger segments, which makes
+// indexing much faster. The trade-off is that nothing written to the affected indices, including live messages,
+// becomes searchable until the ingest finishes and the original refresh interval is restored.
+// If Elkbot exits mid-ingest the interval stays disabled until the next tuned ingest of the index finishes.
+
+// Ingests with a limit below this aren't large enough to benefit from disabling refreshes
+const _TuneRefreshMinMessages = 5000
+
+var _PausedRefreshLock sync.Mutex
+
+// _PausedRefreshUsers counts the running ingests that have disabled refreshes on each concrete index,
+// so that overlapping ingests only restore the interval once the last of them finishes
+var _PausedRefreshUsers = map[string]int{}
+
+// _PausedRefreshIntervals holds the refresh interval each paused index had before it was disabled.
+// A nil interval restores the Elasticsearch default.
+var _PausedRefreshIntervals = map[string]interface{}{}
+
+// _ShouldTuneRefresh returns whether an ingest of up to limit messages should disable refreshes while it runs
+func _ShouldTuneRefresh(limit int) bool {
+	return config.TuneRefreshForBulk && (limit == 0 || limit >= _TuneRefreshMinMessages)
+}
+
+// _GetRefreshIntervals returns the refresh interval configured on each concrete index behind the given indices or aliases
+func _GetRefreshIntervals(indices []string) (map[string]interface{}, error) {
+	req := esapi.IndicesGetSettingsRequest{
+		Index: indices,
+		Name:  []string{"index.refresh_interval"},
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var settings map[string]struct {
+		Settings struct {
+			Index struct {
+				RefreshInterval interface{} `json:"refresh_interval"`
+			} `json:"index"`
+		} `json:"settings"`
+	}
+	err = _DecodeResponse(resp, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals := make(map[string]interface{}, len(settings))
+	for index, setting := range settings {
+		intervals[index] = setting.Settings.Index.RefreshInterval
+	}
+	return intervals, nil
+}
+
+// _SetRefreshInterval sets the refresh interval of a set of indices, with nil resetting it to the default
+func _SetRefreshInterval(indices []string, interval interface{}) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"index": map[string]interface{}{"refresh_interval": interval},
+	})
+
+	req := esapi.IndicesPutSettingsRequest{
+		Index: indices,
+		Body:  bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+// _PauseRefresh disables refreshes on the concrete indices behind the given indices or aliases,
+// returning the indices that must be passed to _ResumeRefresh once the ingest finishes
+func _PauseRefresh(indices []string) ([]string, error) {
+	_PausedRefreshLock.Lock()
+	defer _PausedRefreshLock.Unlock()
+
+	intervals, err := _GetRefreshIntervals(indices)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching refresh intervals: %w", err)
+	}
+
+	paused := make([]string, 0, len(intervals))
+	toPause := make([]string, 0, len(intervals))
+	for index, interval := range intervals {
+		paused = append(paused, index)
+		if _PausedRefreshUsers[index] == 0 {
+			_PausedRefreshIntervals[index] = interval
+			toPause = append(toPause, index)
+		}
+		_PausedRefreshUsers[index]++
+	}
+
+	if len(toPause) > 0 {
+		err = _SetRefreshInterval(toPause, "-1")
+		if err != nil {
+			for _, index := range paused {
+				if _ReleasePausedRefresh(index) {
+					delete(_PausedRefreshIntervals, index)
+				}
+			}
+			return nil, fmt.Errorf("error disabling refreshes: %w", err)
+		}
+		log.Debug().Strs("indices", toPause).Msg("Disabled refreshes for bulk ingest")
+	}
+	return paused, nil
+}
+
+// _ReleasePausedRefresh drops an ingest's hold on a paused index, returning whether it was the last one.
+// The lock must already be held.
+func _ReleasePausedRefresh(index string) bool {
+	_PausedRefreshUsers[index]--
+	if _PausedRefreshUsers[index] > 0 {
+		return false
+	}
+	delete(_PausedRefreshUsers, index)
+	return true
+}
+
+// _ResumeRefresh restores the original refresh interval of indices paused by _PauseRefresh once no other ingest
+// still needs them paused, then refreshes them so everything ingested in the meantime becomes searchable
+func _ResumeRefresh(indices []string) error {
+	_PausedRefreshLock.Lock()
+	defer _PausedRefreshLock.Unlock()
+
+	restored := make([]string, 0, len(indices))
+	var restoreErr error
+	for _, index := range indices {
+		if !_ReleasePausedRefresh(index) {
+			continue
+		}
+		interval := _PausedRefreshIntervals[index]
+		delete(_PausedRefreshIntervals, index)
+
+		err := _SetRefreshInterval([]string{index}, interval)
+		if err != nil {
+			restoreErr = fmt.Errorf("error restoring refresh interval of %s: %w", index, err)
+			continue
+		}
+		restored = append(restored, index)
+	}
+	if len(restored) == 0 {
+		return restoreErr
+	}
+
+	err := _RefreshIndex(restored)
+	if err != nil {
+		return fmt.Errorf("error refreshing indices: %w", err)
+	}
+	log.Debug().Strs("indices", restored).Msg("Restored refreshes after bulk ingest")
+	return restoreErr
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Cards are drawn with the Go fonts embedded in the binary, so they render the same wherever Elkbot runs.
+// The fonts only cover Latin, Greek and Cyrillic, so other characters in names render as boxes, and custom emojis are
+// shown by name as images can't embed them.
+
+const _CardWidth = 800
+const _CardHeight = 420
+const _CardPadding = 40
+const _CardTopEntries = 3
+
+// Below this many messages there isn't enough to say about top channels, emojis or hours
+const _MinCardMessages = 10
+
+var _CardBackground = color.RGBA{0x1E, 0x1F, 0x22, 0xFF}
+var _CardText = color.RGBA{0xF2, 0xF3, 0xF5, 0xFF}
+var _CardMutedText = color.RGBA{0xB5, 0xBA, 0xC1, 0xFF}
+
+var _CardFaces struct {
+	Title   font.Face
+	Heading font.Face
+	Body    font.Face
+}
+var _CardFacesOnce sync.Once
+var _CardFacesErr error
+
+// _CardEntry is a ranked item shown on a card, such as a channel or emoji
+type _CardEntry struct {
+	Name  string
+	Count int
+}
+
+// _UserCardStats holds the aggregated activity of a user shown on their card
+type _UserCardStats struct {
+	Total    int
+	Channels []_CardEntry
+	Emojis   []_CardEntry
+	Hours    [24]int
+}
+
+// _LoadCardFaces parses the embedded fonts the first time a card is drawn
+func _LoadCardFaces() error {
+	_CardFacesOnce.Do(func() {
+		regular, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			_CardFacesErr = fmt.Errorf("error parsing regular font: %w", err)
+			return
+		}
+		bold, err := opentype.Parse(gobold.TTF)
+		if err != nil {
+			_CardFacesErr = fmt.Errorf("error parsing bold font: %w", err)
+			return
+		}
+
+		faces := []struct {
+			face *font.Face
+			font *opentype.Font
+			size float64
+		}{
+			{&_CardFaces.Title, bold, 36},
+			{&_CardFaces.Heading, bold, 20},
+			{&_CardFaces.Body, regular, 18},
+		}
+		for _, entry := range faces {
+			*entry.face, err = opentype.NewFace(entry.font, &opentype.FaceOptions{Size: entry.size, DPI: 72, Hinting: font.HintingFull})
+			if err != nil {
+				_CardFacesErr = fmt.Errorf("error creating font face: %w", err)
+				return
+			}
+		}
+	})
+	return _CardFacesErr
+}
+
+// _FetchUserCardStats aggregates a user's messages in a guild into the stats shown on their card
+func _FetchUserCardStats(userID string, guildID string) (*_UserCardStats, error) {
+	query, err := _UserQuery(userID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	query["bool"].(map[string]interface{})["filter"] = append(query["bool"].(map[string]interface{})["filter"].([]interface{}), _NotDeletedFilter)
+
+	resp, err := _Search([]string{_GuildReadIndex("messages", guildID)}, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query":            query,
+		"aggs": map[string]interface{}{
+			"channels": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "channel_id", "size": _CardTopEntries},
+			},
+			"emojis": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "used_emoji_ids", "size": _CardTopEntries},
+			},
+			"hours": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"script": map[string]interface{}{
+						"source": _HourlyScript,
+						"lang":   "painless",
+						"params": map[string]interface{}{"zone": config.Timezone},
+					},
+					"size": 24,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &_UserCardStats{Total: resp.Hits.Total.Value}
+	var channels, emojis, hours _TermsAggregation
+	for name, aggregation := range map[string]*_TermsAggregation{"channels": &channels, "emojis": &emojis, "hours": &hours} {
+		err = json.Unmarshal(resp.Aggregations[name], aggregation)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s aggregation: %w", name, err)
+		}
+	}
+
+	for _, bucket := range channels.Buckets {
+		name := fmt.Sprint(bucket.Key)
+		if channel, err := session.State.Channel(name); err == nil {
+			name = "#" + channel.Name
+		}
+		stats.Channels = append(stats.Channels, _CardEntry{Name: name, Count: bucket.DocCount})
+	}
+	for _, bucket := range emojis.Buckets {
+		name := fmt.Sprint(bucket.Key)
+		if emoji, err := session.State.Emoji(guildID, name); err == nil {
+			name = ":" + emoji.Name + ":"
+		}
+		stats.Emojis = append(stats.Emojis, _CardEntry{Name: name, Count: bucket.DocCount})
+	}
+	for _, bucket := range hours.Buckets {
+		if hour, ok := bucket.Key.(float64); ok && hour >= 0 && hour < 24 {
+			stats.Hours[int(hour)] = bucket.DocCount
+		}
+	}
+	return stats, nil
+}
+
+// _DrawText draws a line of text with its baseline at the given point
+func _DrawText(img draw.Image, face font.Face, textColor color.Color, x int, y int, text string) {
+	drawer := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	drawer.DrawString(text)
+}
+
+// _DrawCardList draws a heading followed by a ranked list of entries, or a placeholder if there are none
+func _DrawCardList(img draw.Image, x int, y int, heading string, entries []_CardEntry) {
+	_DrawText(img, _CardFaces.Heading, _CardText, x, y, heading)
+	if len(entries) == 0 {
+		_DrawText(img, _CardFaces.Body, _CardMutedText, x, y+30, "None yet")
+		return
+	}
+	for index, entry := range entries {
+		_DrawText(img, _CardFaces.Body, _CardMutedText, x, y+30*(index+1), fmt.Sprintf("%d. %s (%d)", index+1, _Snippet(entry.Name, 24), entry.Count))
+	}
+}
+
+// _DrawCardHours draws a bar for each hour of the day, scaled to the busiest hour
+func _DrawCardHours(img draw.Image, accent color.Color, x int, y int, width int, height int, hours [24]int) {
+	busiest := 0
+	for _, count := range hours {
+		if count > busiest {
+			busiest = count
+		}
+	}
+	barWidth := width / 24
+	for hour, count := range hours {
+		barHeight := 2
+		if busiest > 0 {
+			barHeight += count * (height - 2) / busiest
+		}
+		bar := image.Rect(x+hour*barWidth+2, y+height-barHeight, x+(hour+1)*barWidth-2, y+height)
+		draw.Draw(img, bar, image.NewUniform(accent), image.Point{}, draw.Src)
+	}
+	for _, hour := range []int{0, 6, 12, 18} {
+		_DrawText(img, _CardFaces.Body, _CardMutedText, x+hour*barWidth, y+height+22, fmt.Sprintf("%02d:00", hour))
+	}
+}
+
+// _RenderUserCard draws a user's stats as a PNG card. Users with few messages get a card with just their total.
+func _RenderUserCard(name string, stats *_UserCardStats) ([]byte, error) {
+	err := _LoadCardFaces()
+	if err != nil {
+		return nil, err
+	}
+
+	accentValue := _EmbedColor()
+	accent := color.RGBA{uint8(accentValue >> 16), uint8(accentValue >> 8), uint8(accentValue), 0xFF}
+
+	img := image.NewRGBA(image.Rect(0, 0, _CardWidth, _CardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(_CardBackground), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, _CardWidth, 8), image.NewUniform(accent), image.Point{}, draw.Src)
+
+	_DrawText(img, _CardFaces.Title, _CardText, _CardPadding, 70, _Snippet(name, 32))
+	_DrawText(img, _CardFaces.Body, _CardMutedText, _CardPadding, 104, fmt.Sprintf("%d messages", stats.Total))
+
+	if stats.Total < _MinCardMessages {
+		_DrawText(img, _CardFaces.Body, _CardMutedText, _CardPadding, 160, "Not enough messages yet for more stats. Check back later!")
+	} else {
+		_DrawCardList(img, _CardPadding, 160, "Top channels", stats.Channels)
+		_DrawCardList(img, _CardWidth/2, 160, "Top emojis", stats.Emojis)
+		_DrawText(img, _CardFaces.Heading, _CardText, _CardPadding, 290, fmt.Sprintf("Active hours (%s)", config.Timezone))
+		_DrawCardHours(img, accent, _CardPadding, 300, _CardWidth-2*_CardPadding, 70, stats.Hours)
+	}
+
+	var output bytes.Buffer
+	err = png.Encode(&output, img)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding card: %w", err)
+	}
+	return output.Bytes(), nil
+}
+
+type _CardArgs struct {
+	User string `description:"Mention or ID of the user to make a card for."`
+}
+
+func _CardHandler(message *discordgo.MessageCreate, args _CardArgs) {
+	userID := _ParseUserID(args.User)
+	if userID == "" {
+		session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+		return
+	}
+
+	stats, err := _FetchUserCardStats(userID, message.GuildID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating user stats")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	name, err := _CurrentDisplayName(message.GuildID, userID)
+	if err != nil {
+		name = userID
+	}
+	card, err := _RenderUserCard(name, stats)
+	if err != nil {
+		log.Error().Err(err).Msg("Error rendering user card")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("card-%s.png", userID),
+			ContentType: "image/png",
+			Reader:      bytes.NewReader(card),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading user card")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Channel context is copied onto each message, so that searches can match messages by what their channel is about.
+// Topics and categories change rarely, so when they do every ingested message from the channel is updated in place.
+
+const _RefreshChannelContextScript = "ctx._source.channel_topic = params.topic; ctx._source.channel_category = params.category"
+const _RefreshChannelContextRequestsPerSecond = 500
+
+// _ChannelContext returns the topic and category name of a channel from the state cache
+func _ChannelContext(channel *discordgo.Channel) (string, string) {
+	category := ""
+	if channel.ParentID != "" {
+		parent, err := session.State.Channel(channel.ParentID)
+		if err == nil {
+			category = parent.Name
+		}
+	}
+	return channel.Topic, category
+}
+
+// _AddChannelContextFields adds the topic and category of a message's channel to its document, if enabled
+func _AddChannelContextFields(message *discordgo.Message, document map[string]interface{}) {
+	if !config.IncludeChannelContext {
+		return
+	}
+	channel, err := session.State.Channel(message.ChannelID)
+	if err != nil {
+		return
+	}
+
+	topic, category := _ChannelContext(channel)
+	if topic != "" {
+		document["channel_topic"] = topic
+	}
+	if category != "" {
+		document["channel_category"] = category
+	}
+}
+
+// _ChannelUpdateHandler updates the channel context stored on a channel's messages when its topic or category changes
+func _ChannelUpdateHandler(_ *discordgo.Session, update *discordgo.ChannelUpdate) {
+	if !config.IncludeChannelContext || !_IsAllowedGuild(update.GuildID) {
+		return
+	}
+	if update.BeforeUpdate != nil && update.BeforeUpdate.Topic == update.Topic && update.BeforeUpdate.ParentID == update.ParentID {
+		return
+	}
+
+	topic, category := _ChannelContext(update.Channel)
+	updated, err := _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", update.ID)},
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": update.ID}},
+		_RefreshChannelContextScript,
+		map[string]interface{}{"topic": topic, "category": category},
+		_RefreshChannelContextRequestsPerSecond,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("channel_id", update.ID).Msg("Error refreshing channel context")
+		return
+	}
+	log.Debug().Str("channel_id", update.ID).Int("updated", updated).Msg("Refreshed channel context")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _ChannelAggregationPageSize = 500
+
+// Discord rejects messages longer than this
+const _MaxMessageLength = 2000
+
+type _ChannelCount struct {
+	ChannelID string
+	Count     int
+}
+
+type _ChannelCompositeAggregation struct {
+	AfterKey map[string]interface{} `json:"after_key"`
+	Buckets  []struct {
+		Key struct {
+			ChannelID string `json:"channel_id"`
+		} `json:"key"`
+		DocCount int `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+// _IndexedChannels returns every channel that has indexed messages, along with the number of messages in each.
+// A composite aggregation is used so that any number of channels can be paged through.
+func _IndexedChannels() ([]_ChannelCount, error) {
+	counts := make([]_ChannelCount, 0)
+	var afterKey map[string]interface{}
+
+	for {
+		composite := map[string]interface{}{
+			"size": _ChannelAggregationPageSize,
+			"sources": []interface{}{
+				map[string]interface{}{"channel_id": map[string]interface{}{"terms": map[string]interface{}{"field": "channel_id"}}},
+			},
+		}
+		if afterKey != nil {
+			composite["after"] = afterKey
+		}
+
+		resp, err := _Search([]string{_ReadIndex("messages")}, map[string]interface{}{
+			"size": 0,
+			"aggs": map[string]interface{}{
+				"channels": map[string]interface{}{"composite": composite},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var channels _ChannelCompositeAggregation
+		err = json.Unmarshal(resp.Aggregations["channels"], &channels)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding channel aggregation: %w", err)
+		}
+
+		for _, bucket := range channels.Buckets {
+			counts = append(counts, _ChannelCount{ChannelID: bucket.Key.ChannelID, Count: bucket.DocCount})
+		}
+
+		if len(channels.Buckets) < _ChannelAggregationPageSize || channels.AfterKey == nil {
+			return counts, nil
+		}
+		afterKey = channels.AfterKey
+	}
+}
+
+// _ChannelDisplayName returns a readable name for a channel, falling back to its ID if it can't be fetched
+func _ChannelDisplayName(channelID string) string {
+	channel, err := session.State.Channel(channelID)
+	if err != nil {
+		channel, err = session.Channel(channelID)
+		if err != nil {
+			return fmt.Sprintf("Unknown channel (%s)", channelID)
+		}
+	}
+	return fmt.Sprintf("#%s (%s)", channel.Name, channelID)
+}
+
+// _SendLines sends a list of lines, split across as many messages as needed to stay under Discord's length limit
+func _SendLines(channelID string, lines []string) {
+	var chunk strings.Builder
+	for _, line := range lines {
+		if chunk.Len() > 0 && chunk.Len()+len(line)+1 > _MaxMessageLength {
+			session.ChannelMessageSend(channelID, chunk.String())
+			chunk.Reset()
+		}
+		if chunk.Len() > 0 {
+			chunk.WriteString("\n")
+		}
+		chunk.WriteString(line)
+	}
+	if chunk.Len() > 0 {
+		session.ChannelMessageSend(channelID, chunk.String())
+	}
+}
+
+func _IndexedChannelsHandler(message *discordgo.MessageCreate, args struct{}) {
+	counts, err := _IndexedChannels()
+	if err != nil {
+		log.Error().Err(err).Msg("Error listing indexed channels")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if len(counts) == 0 {
+		session.ChannelMessageSend(message.ChannelID, "No channels have been indexed.")
+		return
+	}
+
+	lines := make([]string, 0, len(counts)+1)
+	lines = append(lines, fmt.Sprintf("%d channels have indexed messages:", len(counts)))
+	for _, count := range counts {
+		lines = append(lines, fmt.Sprintf("%s: %d messages", _ChannelDisplayName(count.ChannelID), count.Count))
+	}
+	_SendLines(message.ChannelID, lines)
+}
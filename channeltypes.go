@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages are tagged with the type of channel they were sent in, so that searches can tell text chat in stage channels
+// and scheduled event announcements apart from regular channels.
+// Scheduled events aren't messages, but are indexed alongside them so that they can be found by the same searches.
+// Their documents use the event's ID prefixed with event-, and are replaced whenever the event changes.
+
+const _ScheduledEventChannelType = "scheduled_event"
+
+var _ChannelTypeNames = map[discordgo.ChannelType]string{
+	discordgo.ChannelTypeGuildText:          "text",
+	discordgo.ChannelTypeGuildNews:          "news",
+	discordgo.ChannelTypeGuildVoice:         "voice",
+	discordgo.ChannelTypeGuildStageVoice:    "stage",
+	discordgo.ChannelTypeGuildForum:         "forum",
+	discordgo.ChannelTypeGuildNewsThread:    "thread",
+	discordgo.ChannelTypeGuildPublicThread:  "thread",
+	discordgo.ChannelTypeGuildPrivateThread: "thread",
+}
+
+// _IsIngestableChannelType returns whether channels of a type are included when ingesting every channel in a guild
+func _IsIngestableChannelType(channelType discordgo.ChannelType) bool {
+	switch channelType {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews:
+		return true
+	case discordgo.ChannelTypeGuildStageVoice:
+		return config.IncludeStageChannels
+	}
+	return false
+}
+
+// _AddChannelTypeField tags a message document with the type of the channel it was sent in
+func _AddChannelTypeField(message *discordgo.Message, document map[string]interface{}) {
+	channel, err := session.State.Channel(message.ChannelID)
+	if err != nil {
+		return
+	}
+	if name, ok := _ChannelTypeNames[channel.Type]; ok {
+		document["channel_type"] = name
+	}
+}
+
+// _BuildScheduledEventDocument builds the document a scheduled event is indexed as
+func _BuildScheduledEventDocument(event *discordgo.GuildScheduledEvent) map[string]interface{} {
+	content := event.Name
+	if event.Description != "" {
+		content += "\n" + event.Description
+	}
+
+	scheduledEvent := map[string]interface{}{
+		"id":     event.ID,
+		"name":   event.Name,
+		"start":  event.ScheduledStartTime,
+		"status": int(event.Status),
+	}
+	if event.ScheduledEndTime != nil {
+		scheduledEvent["end"] = *event.ScheduledEndTime
+	}
+	if event.EntityMetadata.Location != "" {
+		scheduledEvent["location"] = event.EntityMetadata.Location
+	}
+
+	document := map[string]interface{}{
+		"content":         _NormalizeText(content),
+		"content_length":  utf8.RuneCountInString(content),
+		"guild_id":        event.GuildID,
+		"author_id":       event.CreatorID,
+		"timestamp":       event.ScheduledStartTime,
+		"channel_type":    _ScheduledEventChannelType,
+		"scheduled_event": scheduledEvent,
+	}
+	if event.ChannelID != "" {
+		document["channel_id"] = event.ChannelID
+	}
+	if event.Creator != nil {
+		document["author_name"] = event.Creator.Username
+	}
+	return document
+}
+
+// _IndexScheduledEvent indexes a scheduled event, replacing any earlier version of it
+func _IndexScheduledEvent(event *discordgo.GuildScheduledEvent) error {
+	if config.PerGuildIndices {
+		_EnsureGuildIndices(event.GuildID)
+	}
+	index := _WriteIndex(_GuildBase("messages", event.GuildID))
+	version := int(time.Now().UnixNano() / int64(time.Millisecond))
+
+	err := _InsertIndex(_BuildScheduledEventDocument(event), index, "event-"+event.ID, version, _DocumentRouting(event.ChannelID))
+	if err != nil {
+		return fmt.Errorf("error indexing scheduled event: %w", err)
+	}
+	return nil
+}
+
+// _ScheduledEventCreateHandler indexes newly scheduled events
+func _ScheduledEventCreateHandler(_ *discordgo.Session, event *discordgo.GuildScheduledEventCreate) {
+	if !_IsAllowedGuild(event.GuildID) {
+		return
+	}
+	err := _IndexScheduledEvent(event.GuildScheduledEvent)
+	if err != nil {
+		log.Error().Err(err).Str("event_id", event.ID).Msg("Error indexing scheduled event")
+	}
+}
+
+// _ScheduledEventUpdateHandler re-indexes scheduled events when their details or status change
+func _ScheduledEventUpdateHandler(_ *discordgo.Session, event *discordgo.GuildScheduledEventUpdate) {
+	if !_IsAllowedGuild(event.GuildID) {
+		return
+	}
+	err := _IndexScheduledEvent(event.GuildScheduledEvent)
+	if err != nil {
+		log.Error().Err(err).Str("event_id", event.ID).Msg("Error indexing scheduled event")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+var _HealthEmoji = map[string]string{
+	"green":  "🟢",
+	"yellow": "🟡",
+	"red":    "🔴",
+}
+
+type _ClusterHealth struct {
+	ClusterName         string  `json:"cluster_name"`
+	Status              string  `json:"status"`
+	NumberOfNodes       int     `json:"number_of_nodes"`
+	ActiveShards        int     `json:"active_shards"`
+	RelocatingShards    int     `json:"relocating_shards"`
+	InitializingShards  int     `json:"initializing_shards"`
+	UnassignedShards    int     `json:"unassigned_shards"`
+	ActiveShardsPercent float64 `json:"active_shards_percent_as_number"`
+}
+
+type _CatIndex struct {
+	Health    string `json:"health"`
+	Index     string `json:"index"`
+	DocsCount string `json:"docs.count"`
+	StoreSize string `json:"store.size"`
+}
+
+// _ElkbotIndices returns the patterns matching every index Elkbot stores data in
+func _ElkbotIndices() []string {
+	return []string{_ReadIndex("messages"), _ReadIndex("attachments"), _BlocklistIndex, _ExclusionsIndex, _CheckpointsIndex, _DeadLetterIndex}
+}
+
+func _FetchClusterHealth() (*_ClusterHealth, error) {
+	req := esapi.ClusterHealthRequest{}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var health _ClusterHealth
+	err = _DecodeResponse(resp, &health)
+	if err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+func _FetchIndexStats() ([]_CatIndex, error) {
+	req := esapi.CatIndicesRequest{
+		Index:  _ElkbotIndices(),
+		Format: "json",
+		S:      []string{"index"},
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var indices []_CatIndex
+	err = _DecodeResponse(resp, &indices)
+	if err != nil {
+		return nil, err
+	}
+	return indices, nil
+}
+
+func _ClusterHandler(message *discordgo.MessageCreate, args struct{}) {
+	health, err := _FetchClusterHealth()
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching cluster health")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	indices, err := _FetchIndexStats()
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching index statistics")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, len(indices))
+	for _, index := range indices {
+		lines = append(lines, fmt.Sprintf("%s `%s`: %s docs, %s", _HealthEmoji[index.Health], index.Index, index.DocsCount, index.StoreSize))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No indices found.")
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("%s Cluster %s is %s", _HealthEmoji[health.Status], health.ClusterName, health.Status))
+	embed.Description = strings.Join(lines, "\n")
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Nodes", Value: fmt.Sprint(health.NumberOfNodes), Inline: true},
+		{Name: "Active shards", Value: fmt.Sprintf("%d (%.1f%%)", health.ActiveShards, health.ActiveShardsPercent), Inline: true},
+		{
+			Name:   "Other shards",
+			Value:  fmt.Sprintf("%d relocating, %d initializing, %d unassigned", health.RelocatingShards, health.InitializingShards, health.UnassignedShards),
+			Inline: true,
+		},
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
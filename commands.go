@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Elkbot only registers its slash commands globally, so syncing a guild's commands removes any left over from when they were
+// registered per guild. Syncing global commands without slash commands enabled removes every registration.
+
+// _CommandChanges records the changes applied when syncing application commands
+type _CommandChanges struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+// _DesiredCommands returns the application commands that should be registered in a scope
+func _DesiredCommands(guildID string) []*discordgo.ApplicationCommand {
+	if guildID != "" || !config.EnableSlashCommands {
+		return nil
+	}
+	return _SlashCommands
+}
+
+// _CommandDefinition returns a representation of a command that can be compared against another, ignoring the fields
+// Discord fills in when registering it
+func _CommandDefinition(command *discordgo.ApplicationCommand) string {
+	definition, _ := json.Marshal(map[string]interface{}{
+		"description": command.Description,
+		"options":     command.Options,
+	})
+	return string(definition)
+}
+
+// _SyncApplicationCommands reconciles the application commands registered in a scope with the ones Elkbot supports.
+// An empty guild ID syncs global commands.
+func _SyncApplicationCommands(guildID string) (*_CommandChanges, error) {
+	appID := session.State.User.ID
+	registered, err := session.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching registered commands: %w", err)
+	}
+	registeredByName := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, command := range registered {
+		registeredByName[command.Name] = command
+	}
+
+	changes := &_CommandChanges{}
+	for _, command := range _DesiredCommands(guildID) {
+		existing, ok := registeredByName[command.Name]
+		delete(registeredByName, command.Name)
+		switch {
+		case !ok:
+			_, err = session.ApplicationCommandCreate(appID, guildID, command)
+			if err != nil {
+				return changes, fmt.Errorf("error creating command %s: %w", command.Name, err)
+			}
+			changes.Created = append(changes.Created, command.Name)
+		case _CommandDefinition(existing) != _CommandDefinition(command):
+			_, err = session.ApplicationCommandEdit(appID, guildID, existing.ID, command)
+			if err != nil {
+				return changes, fmt.Errorf("error updating command %s: %w", command.Name, err)
+			}
+			changes.Updated = append(changes.Updated, command.Name)
+		}
+	}
+
+	for name, command := range registeredByName {
+		err = session.ApplicationCommandDelete(appID, guildID, command.ID)
+		if err != nil {
+			return changes, fmt.Errorf("error deleting command %s: %w", name, err)
+		}
+		changes.Deleted = append(changes.Deleted, name)
+	}
+	sort.Strings(changes.Deleted)
+
+	return changes, nil
+}
+
+// _FormatCommandNames lists command names for an embed field
+func _FormatCommandNames(names []string) string {
+	if len(names) == 0 {
+		return "None"
+	}
+	value := ""
+	for _, name := range names {
+		value += "`/" + name + "`\n"
+	}
+	return value
+}
+
+type _CommandsArgs struct {
+	Action string `default:"list" description:"Action to perform. One of list or sync."`
+	Scope  string `default:"global" description:"Whether to manage global commands or this guild's commands. One of global or guild."`
+}
+
+func _CommandsHandler(message *discordgo.MessageCreate, args _CommandsArgs) {
+	guildID := ""
+	switch args.Scope {
+	case "global":
+	case "guild":
+		guildID = message.GuildID
+	default:
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown scope %q, expected global or guild.", args.Scope))
+		return
+	}
+
+	switch args.Action {
+	case "list":
+		registered, err := session.ApplicationCommands(session.State.User.ID, guildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error fetching registered commands")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+
+		embed := _NewEmbed(fmt.Sprintf("Registered %s commands", args.Scope))
+		embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(registered))
+		if len(registered) == 0 {
+			embed.Description = "No commands are registered."
+		}
+		for _, command := range registered {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "/" + command.Name,
+				Value: fmt.Sprintf("%s\nID: %s", command.Description, command.ID),
+			})
+		}
+		session.ChannelMessageSendEmbed(message.ChannelID, embed)
+	case "sync":
+		if config.ReadOnly {
+			session.ChannelMessageSend(message.ChannelID, _ReadOnlyMessage("commands sync"))
+			return
+		}
+		changes, err := _SyncApplicationCommands(guildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error syncing commands")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		}
+		if changes == nil {
+			return
+		}
+
+		log.Info().Str("scope", args.Scope).Strs("created", changes.Created).Strs("updated", changes.Updated).Strs("deleted", changes.Deleted).Msg("Synced application commands")
+		embed := _NewEmbed(fmt.Sprintf("Synced %s commands", args.Scope))
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{Name: "Created", Value: _FormatCommandNames(changes.Created), Inline: true},
+			{Name: "Updated", Value: _FormatCommandNames(changes.Updated), Inline: true},
+			{Name: "Deleted", Value: _FormatCommandNames(changes.Deleted), Inline: true},
+		}
+		session.ChannelMessageSendEmbed(message.ChannelID, embed)
+	default:
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown action %q, expected list or sync.", args.Action))
+	}
+}
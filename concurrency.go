@@ -0,0 +1,67 @@
+package main
+
+import (
+	"expvar"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// _ESRequestCounters publishes the number of Elasticsearch requests currently running and waiting to run
+var _ESRequestCounters = expvar.NewMap("elasticsearch")
+
+// _LimitedTransport caps the number of concurrent Elasticsearch requests, queueing any beyond the limit.
+// A request holds its slot until its response body is closed, so that reading large responses counts towards the limit.
+type _LimitedTransport struct {
+	Transport http.RoundTripper
+	Slots     chan struct{}
+}
+
+// _NewLimitedTransport wraps a transport so that at most limit requests are running through it at once
+func _NewLimitedTransport(transport http.RoundTripper, limit int) *_LimitedTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &_LimitedTransport{
+		Transport: transport,
+		Slots:     make(chan struct{}, limit),
+	}
+}
+
+func (transport *_LimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_ESRequestCounters.Add("queued", 1)
+	select {
+	case transport.Slots <- struct{}{}:
+	case <-req.Context().Done():
+		_ESRequestCounters.Add("queued", -1)
+		return nil, req.Context().Err()
+	}
+	_ESRequestCounters.Add("queued", -1)
+	_ESRequestCounters.Add("in_flight", 1)
+
+	release := func() {
+		_ESRequestCounters.Add("in_flight", -1)
+		<-transport.Slots
+	}
+
+	resp, err := transport.Transport.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &_ReleasingBody{ReadCloser: resp.Body, Release: release}
+	return resp, nil
+}
+
+// _ReleasingBody frees a request's concurrency slot the first time its response body is closed
+type _ReleasingBody struct {
+	io.ReadCloser
+	Release func()
+	once    sync.Once
+}
+
+func (body *_ReleasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.Release)
+	return err
+}
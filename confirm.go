@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _ConfirmEmoji = "✅"
+const _CancelEmoji = "❌"
+const _ConfirmPollInterval = 2 * time.Second
+
+// _HasReacted returns whether a user has reacted to a message with an emoji
+func _HasReacted(channelID string, messageID string, emoji string, userID string) bool {
+	users, err := session.MessageReactions(channelID, messageID, emoji, 100, "", "")
+	if err != nil {
+		return false
+	}
+	for _, user := range users {
+		if user.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// _Confirm asks the user who ran a command to confirm an action, returning whether they did.
+// The user can react to the prompt or reply with yes or no, for when they're unable to add reactions.
+// Reactions are polled for rather than received as events, so that the reactions intent isn't required.
+// If the user doesn't respond before the confirmation timeout, the action is cancelled.
+func _Confirm(message *discordgo.MessageCreate, prompt string) (bool, error) {
+	promptMessage, err := session.ChannelMessageSend(message.ChannelID, fmt.Sprintf(
+		"%s\nReact with %s to confirm or %s to cancel, or reply `yes` or `no`. This expires in %s.",
+		prompt, _ConfirmEmoji, _CancelEmoji, config.ConfirmationTimeout,
+	))
+	if err != nil {
+		return false, fmt.Errorf("error sending confirmation prompt: %w", err)
+	}
+	for _, emoji := range []string{_ConfirmEmoji, _CancelEmoji} {
+		err = session.MessageReactionAdd(message.ChannelID, promptMessage.ID, emoji)
+		if err != nil {
+			log.Debug().Err(err).Msg("Unable to add confirmation reaction")
+		}
+	}
+
+	replies := make(chan bool, 1)
+	removeHandler := session.AddHandler(func(_ *discordgo.Session, reply *discordgo.MessageCreate) {
+		if reply.ChannelID != message.ChannelID || reply.Author.ID != message.Author.ID {
+			return
+		}
+		var decision bool
+		switch strings.ToLower(strings.TrimSpace(reply.Content)) {
+		case "yes", "y", "confirm":
+			decision = true
+		case "no", "n", "cancel":
+			decision = false
+		default:
+			return
+		}
+		select {
+		case replies <- decision:
+		default:
+		}
+	})
+	defer removeHandler()
+
+	ticker := time.NewTicker(_ConfirmPollInterval)
+	defer ticker.Stop()
+	timeout := time.After(config.ConfirmationTimeout)
+	for {
+		select {
+		case decision := <-replies:
+			return decision, nil
+		case <-timeout:
+			session.ChannelMessageSend(message.ChannelID, "Confirmation timed out, cancelling.")
+			return false, nil
+		case <-ticker.C:
+			if _HasReacted(message.ChannelID, promptMessage.ID, _CancelEmoji, message.Author.ID) {
+				return false, nil
+			}
+			if _HasReacted(message.ChannelID, promptMessage.ID, _ConfirmEmoji, message.Author.ID) {
+				return true, nil
+			}
+		}
+	}
+}
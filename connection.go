@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord snowflakes store the number of milliseconds since this point in their upper bits
+const _DiscordEpoch = 1420070400000
+
+const _ConnectionConnecting = "connecting"
+const _ConnectionConnected = "connected"
+const _ConnectionDisconnected = "disconnected"
+
+// _ConnectionStatus represents the current state of the connection to the Discord gateway
+type _ConnectionStatus struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+}
+
+var _Connection = _ConnectionStatus{State: _ConnectionConnecting, Since: time.Now()}
+var _ConnectionLock sync.RWMutex
+
+func _SetConnectionState(state string) {
+	_ConnectionLock.Lock()
+	defer _ConnectionLock.Unlock()
+
+	if _Connection.State == state {
+		return
+	}
+	log.Info().Str("from", _Connection.State).Str("to", state).Dur("after", time.Since(_Connection.Since)).Msg("Discord connection state changed")
+	_Connection = _ConnectionStatus{State: state, Since: time.Now()}
+}
+
+// _CurrentConnection returns the current state of the connection to the Discord gateway
+func _CurrentConnection() _ConnectionStatus {
+	_ConnectionLock.RLock()
+	defer _ConnectionLock.RUnlock()
+	return _Connection
+}
+
+// _IsConnected returns whether the bot is currently connected to the Discord gateway
+func _IsConnected() bool {
+	return _CurrentConnection().State == _ConnectionConnected
+}
+
+// _SnowflakeAt returns the smallest snowflake that could have been created at a given time
+func _SnowflakeAt(timestamp time.Time) string {
+	ms := timestamp.UnixNano()/int64(time.Millisecond) - _DiscordEpoch
+	return strconv.FormatInt(ms<<22, 10)
+}
+
+// _BackfillGuild ingests messages sent since the newest indexed message in each of a guild's ingested channels,
+// up to a single page per channel
+func _BackfillGuild(guildID string) {
+	channels := _ReadableTextChannels(guildID)
+	channelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	if len(channelIDs) == 0 {
+		return
+	}
+
+	latest, err := _LatestIndexedTimestamps(channelIDs)
+	if err != nil {
+		log.Error().Err(err).Str("guild_id", guildID).Msg("Error fetching latest indexed timestamps")
+		return
+	}
+
+	for channelID, indexed := range latest {
+		if !_IsConnected() {
+			log.Debug().Msg("Connection lost, stopping backfill")
+			return
+		}
+
+		messages, err := _ChannelMessages(channelID, 100, "", _SnowflakeAt(indexed))
+		if err != nil {
+			log.Error().Err(err).Str("channel_id", channelID).Msg("Error fetching missed messages")
+			continue
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		stats := &_IngestStats{}
+		err = _IngestMessageArray(messages, stats)
+		if err != nil {
+			log.Error().Err(err).Str("channel_id", channelID).Msg("Error ingesting missed messages")
+			continue
+		}
+		log.Debug().Str("channel_id", channelID).Int("indexed", stats.Indexed).Msg("Backfilled missed messages")
+	}
+}
+
+func _ConnectHandler(_ *discordgo.Session, _ *discordgo.Connect) {
+	_SetConnectionState(_ConnectionConnected)
+}
+
+func _DisconnectHandler(_ *discordgo.Session, _ *discordgo.Disconnect) {
+	_SetConnectionState(_ConnectionDisconnected)
+}
+
+func _ResumedHandler(_ *discordgo.Session, _ *discordgo.Resumed) {
+	_SetConnectionState(_ConnectionConnected)
+
+	if !config.ResumeBackfill {
+		return
+	}
+	go func() {
+		for _, guild := range session.State.Guilds {
+			if !_IsAllowedGuild(guild.ID) {
+				continue
+			}
+			_BackfillGuild(guild.ID)
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Without the privileged message content intent, Discord sends messages with their content, embeds, attachments and
+// components stripped, unless they mention the bot or were sent by it. Those messages are still indexed for their
+// metadata, but are marked as lacking content instead of being stored as if they were empty.
+
+var _ContentWithheldGuilds sync.Map
+
+// _IsContentWithheld returns whether Discord has stripped a message's content. Messages can't be sent without any content,
+// so a regular message with nothing in it must have had its content withheld.
+func _IsContentWithheld(message *discordgo.Message) bool {
+	if message.Type != discordgo.MessageTypeDefault && message.Type != discordgo.MessageTypeReply {
+		return false
+	}
+	if message.Author != nil && session != nil && session.State.User != nil && message.Author.ID == session.State.User.ID {
+		return false
+	}
+	return message.Content == "" &&
+		len(message.Attachments) == 0 &&
+		len(message.Embeds) == 0 &&
+		len(message.Components) == 0 &&
+		len(message.StickerItems) == 0 &&
+		message.Poll == nil
+}
+
+// _AddContentAvailability marks whether a message's content was available to index, removing the content fields
+// of messages that had it withheld
+func _AddContentAvailability(message *discordgo.Message, document map[string]interface{}) {
+	withheld := _IsContentWithheld(message)
+	document["content_available"] = !withheld
+	if !withheld {
+		return
+	}
+
+	delete(document, "content")
+	delete(document, "content_searchable")
+	delete(document, "content_length")
+	delete(document, "used_emoji_ids")
+
+	guildID := _MessageGuildID(message)
+	if _, warned := _ContentWithheldGuilds.LoadOrStore(guildID, true); !warned {
+		log.Warn().Str("guild_id", guildID).Msg("Message content is unavailable, only metadata will be indexed. Check that the message content intent is enabled.")
+	}
+}
+
+// _ContentAvailability counts the messages in a guild that were indexed without their content
+func _ContentAvailability(guildID string) (withheld int, total int, err error) {
+	guildFilter, err := _GuildMessagesFilter(guildID)
+	if err != nil {
+		return 0, 0, err
+	}
+	index := []string{_GuildReadIndex("messages", guildID)}
+
+	total, err = _Count(index, guildFilter)
+	if err != nil {
+		return 0, 0, err
+	}
+	withheld, err = _Count(index, map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				guildFilter,
+				map[string]interface{}{"term": map[string]interface{}{"content_available": false}},
+			},
+		},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return withheld, total, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Documents that fail to index after every retry are stored here, along with why they failed
+const _DeadLetterIndex = "dead-letter"
+const _DeadLetterReplayPageSize = 500
+
+var _DeadLetterMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"index":       map[string]interface{}{"type": "keyword"},
+		"document_id": map[string]interface{}{"type": "keyword"},
+		"version":     map[string]interface{}{"type": "long"},
+		"routing":     map[string]interface{}{"type": "keyword"},
+		"document":    map[string]interface{}{"type": "object", "enabled": false},
+		"error":       map[string]interface{}{"type": "text"},
+		"timestamp":   map[string]interface{}{"type": "date"},
+	},
+}
+
+// _DeadLetterDocument represents a document that failed to index, as stored in the dead letter index
+type _DeadLetterDocument struct {
+	Index      string                 `json:"index"`
+	DocumentID string                 `json:"document_id"`
+	Version    int                    `json:"version"`
+	Routing    string                 `json:"routing"`
+	Document   map[string]interface{} `json:"document"`
+	Error      string                 `json:"error"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// _IsDroppedDeadLetter returns whether a dead lettered document shouldn't be indexed anymore, because its author was
+// blocked or the channel it came from was excluded since it failed
+func _IsDroppedDeadLetter(document map[string]interface{}) bool {
+	if authorID, ok := document["author_id"].(string); ok && _IsBlocked(authorID) {
+		return true
+	}
+	channelID, ok := document["channel_id"].(string)
+	return ok && _IsExcludedChannel(channelID)
+}
+
+// _PurgeDeadLetters deletes the dead lettered documents written by a user, optionally restricted to a guild's channels.
+// The stored documents aren't indexed, so they are scanned for the author instead of queried.
+func _PurgeDeadLetters(userID string, guildID string) (int, error) {
+	var channelIDs map[string]bool
+	if guildID != "" {
+		channels, err := session.GuildChannels(guildID)
+		if err != nil {
+			return 0, fmt.Errorf("error fetching guild channels: %w", err)
+		}
+		channelIDs = make(map[string]bool, len(channels))
+		for _, channel := range channels {
+			channelIDs[channel.ID] = true
+		}
+	}
+
+	matching := make([]string, 0)
+	err := _ScanAll([]string{_DeadLetterIndex}, map[string]interface{}{
+		"_source": []string{"document.author_id", "document.channel_id"},
+	}, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var deadLetter struct {
+				Document struct {
+					AuthorID  string `json:"author_id"`
+					ChannelID string `json:"channel_id"`
+				} `json:"document"`
+			}
+			err := json.Unmarshal(hit.Source, &deadLetter)
+			if err != nil {
+				return fmt.Errorf("error decoding dead letter document: %w", err)
+			}
+			if deadLetter.Document.AuthorID == userID && (channelIDs == nil || channelIDs[deadLetter.Document.ChannelID]) {
+				matching = append(matching, hit.ID)
+			}
+		}
+		return nil
+	})
+	var responseErr *_ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if err != nil || len(matching) == 0 {
+		return 0, err
+	}
+
+	return _DeleteByQuery([]string{_DeadLetterIndex}, map[string]interface{}{"ids": map[string]interface{}{"values": matching}})
+}
+
+func _DeadLetterID(item _BulkItem) string {
+	return item.Index + ":" + item.DocumentID
+}
+
+// _DeadLetter stores documents that failed to index. This is best-effort, as the failure may have been caused by
+// Elasticsearch being unavailable, in which case the documents are only logged.
+func _DeadLetter(failures []_BulkFailure) {
+	now := time.Now()
+	items := make([]_BulkItem, 0, len(failures))
+	for _, failure := range failures {
+		items = append(items, _BulkItem{
+			Index:      _DeadLetterIndex,
+			DocumentID: _DeadLetterID(failure.Item),
+			Version:    int(now.UnixNano() / int64(time.Millisecond)),
+			Body: map[string]interface{}{
+				"index":       failure.Item.Index,
+				"document_id": failure.Item.DocumentID,
+				"version":     failure.Item.Version,
+				"routing":     failure.Item.Routing,
+				"document":    failure.Item.Body,
+				"error":       failure.Reason,
+				"timestamp":   _FormatTimestamp(now),
+			},
+		})
+	}
+
+	retry, failed, err := _BulkAttempt(items)
+	if err == nil && len(retry) == 0 && len(failed) == 0 {
+		log.Warn().Int("count", len(failures)).Msg("Stored documents that failed to index in the dead letter index")
+		return
+	}
+
+	for _, failure := range failures {
+		log.Error().Str("index", failure.Item.Index).Str("document_id", failure.Item.DocumentID).Str("reason", failure.Reason).Msg("Document failed to index and could not be dead lettered")
+	}
+}
+
+// _ReplayDeadLetters attempts to index every dead lettered document again, removing the ones that succeed
+func _ReplayDeadLetters() (int, int, error) {
+	replayed := 0
+	remaining := 0
+
+	err := _ScanAll([]string{_DeadLetterIndex}, map[string]interface{}{"size": _DeadLetterReplayPageSize}, func(hits []_SearchHit) error {
+		items := make([]_BulkItem, 0, len(hits))
+		dropped := make([]string, 0)
+		for _, hit := range hits {
+			var document _DeadLetterDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding dead letter document: %w", err)
+			}
+			if _IsDroppedDeadLetter(document.Document) {
+				dropped = append(dropped, hit.ID)
+				continue
+			}
+			items = append(items, _BulkItem{
+				Index:      document.Index,
+				DocumentID: document.DocumentID,
+				Version:    document.Version,
+				Routing:    document.Routing,
+				Body:       document.Document,
+			})
+		}
+
+		failed, err := _BulkIndex(items)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			_DeadLetter(failed)
+		}
+
+		stillFailing := make(map[string]bool, len(failed))
+		for _, failure := range failed {
+			stillFailing[_DeadLetterID(failure.Item)] = true
+		}
+		succeeded := make([]string, 0, len(items))
+		removed := append([]string{}, dropped...)
+		for _, item := range items {
+			if !stillFailing[_DeadLetterID(item)] {
+				succeeded = append(succeeded, _DeadLetterID(item))
+			}
+		}
+		removed = append(removed, succeeded...)
+
+		if len(removed) > 0 {
+			_, err = _DeleteByQuery([]string{_DeadLetterIndex}, map[string]interface{}{
+				"ids": map[string]interface{}{"values": removed},
+			})
+			if err != nil {
+				return fmt.Errorf("error removing replayed documents: %w", err)
+			}
+		}
+
+		replayed += len(succeeded)
+		remaining += len(failed)
+		return nil
+	})
+
+	return replayed, remaining, err
+}
+
+func _ReplayDLQHandler(message *discordgo.MessageCreate, args struct{}) {
+	replayed, remaining, err := _ReplayDeadLetters()
+	if err != nil {
+		log.Error().Err(err).Msg("Error replaying dead lettered documents")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Replayed %d documents, %d are still failing.", replayed, remaining))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Discord can deliver the same MESSAGE_CREATE event more than once, especially while resuming after a reconnect.
+// Indexing a duplicate is harmless as documents are keyed by message ID, but wastes a request and inflates the
+// ingest metrics, so the IDs of recently seen messages are remembered and repeats are skipped.
+
+var _SeenMessagesLock sync.Mutex
+
+// _SeenMessageOrder holds recently seen message IDs from most to least recent
+var _SeenMessageOrder = list.New()
+var _SeenMessages = map[string]*list.Element{}
+
+// _IsDuplicateLiveMessage records a message as seen, returning whether it was already among the most recent
+// LIVE_DEDUPE_CACHE_SIZE messages. A cache size of 0 disables suppression.
+func _IsDuplicateLiveMessage(messageID string) bool {
+	if config.LiveDedupeCacheSize == 0 {
+		return false
+	}
+
+	_SeenMessagesLock.Lock()
+	defer _SeenMessagesLock.Unlock()
+
+	if element, ok := _SeenMessages[messageID]; ok {
+		_SeenMessageOrder.MoveToFront(element)
+		return true
+	}
+
+	_SeenMessages[messageID] = _SeenMessageOrder.PushFront(messageID)
+	for _SeenMessageOrder.Len() > config.LiveDedupeCacheSize {
+		oldest := _SeenMessageOrder.Back()
+		_SeenMessageOrder.Remove(oldest)
+		delete(_SeenMessages, oldest.Value.(string))
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"container/list"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// resetSeenMessages clears the duplicate suppression cache before and after a test
+func resetSeenMessages(t *testing.T) {
+	reset := func() {
+		_SeenMessagesLock.Lock()
+		_SeenMessageOrder = list.New()
+		_SeenMessages = map[string]*list.Element{}
+		_SeenMessagesLock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestIsDuplicateLiveMessage(t *testing.T) {
+	resetSeenMessages(t)
+	setTestConfig(t, func(cfg *Config) { cfg.LiveDedupeCacheSize = 2 })
+
+	steps := []struct {
+		messageID string
+		want      bool
+	}{
+		{"1", false},
+		{"1", true},
+		{"2", false},
+		// Seeing 1 again makes it the most recent, so 2 is evicted once 3 is seen
+		{"1", true},
+		{"3", false},
+		{"2", false},
+		{"3", true},
+	}
+	for i, step := range steps {
+		if got := _IsDuplicateLiveMessage(step.messageID); got != step.want {
+			t.Fatalf("step %d: got duplicate %t for message %s, want %t", i, got, step.messageID, step.want)
+		}
+	}
+}
+
+func TestIsDuplicateLiveMessageDisabled(t *testing.T) {
+	resetSeenMessages(t)
+	setTestConfig(t, func(cfg *Config) { cfg.LiveDedupeCacheSize = 0 })
+
+	if _IsDuplicateLiveMessage("1") || _IsDuplicateLiveMessage("1") {
+		t.Error("got a duplicate, want suppression disabled")
+	}
+}
+
+func TestLiveIngestSuppressesDuplicateEvent(t *testing.T) {
+	resetSeenMessages(t)
+	setTestSession(t)
+	setTestConfig(t, func(cfg *Config) {
+		cfg.LiveDedupeCacheSize = 10
+		cfg.AllowedGuilds = nil
+		cfg.PausedIngestMode = _PausedModeBuffer
+		cfg.MaxPausedBuffer = 10
+	})
+
+	// Pausing ingestion holds live messages in the buffer, where what the handler let through can be inspected
+	atomic.StoreInt32(&_IngestPaused, 1)
+	t.Cleanup(func() {
+		atomic.StoreInt32(&_IngestPaused, 0)
+		_PausedLock.Lock()
+		_PausedBuffer = make([]*discordgo.Message, 0)
+		_PausedLock.Unlock()
+	})
+
+	duplicatesBefore := _MetricsSince(time.Hour)[_MetricLiveDuplicates]
+	event := &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        "42",
+		ChannelID: "7",
+		GuildID:   "1",
+		Content:   "hello",
+		Author:    &discordgo.User{ID: "5"},
+	}}
+	_LiveIngestHandler(nil, event)
+	_LiveIngestHandler(nil, event)
+
+	_PausedLock.Lock()
+	buffered := len(_PausedBuffer)
+	_PausedLock.Unlock()
+	if buffered != 1 {
+		t.Errorf("got %d buffered messages, want the duplicate event suppressed", buffered)
+	}
+	if got := _MetricsSince(time.Hour)[_MetricLiveDuplicates] - duplicatesBefore; got != 1 {
+		t.Errorf("got %d duplicates recorded, want 1", got)
+	}
+}
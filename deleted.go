@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages deleted on Discord are kept in the index with a deleted flag instead of being forgotten, unless
+// FLAG_DELETED_MESSAGES is disabled. They are hidden from every search and statistic, but admins can review them with
+// the deleted command. This keeps content that its authors chose to remove, so operators should make sure their community
+// knows about it and that it's allowed where they are, or disable flagging. Purging a user still removes their deleted
+// messages too.
+
+const _FlagDeletedScript = `ctx._source.deleted = true;
+ctx._source.deleted_at = params.deleted_at;
+if (params.deleted_by != null) { ctx._source.deleted_by = params.deleted_by; }`
+
+// Audit log entries older than this are assumed to be about an earlier deletion
+const _DeleterLookupWindow = 5 * time.Minute
+
+const _MaxDeletedResults = 10
+
+// _FindDeleter looks through a guild's audit log for a moderator deleting messages matching a target, returning an empty string
+// if there is none. Authors deleting their own messages aren't logged, so no entry usually means the author deleted it.
+func _FindDeleter(guildID string, action discordgo.AuditLogAction, targetID string, channelID string) string {
+	auditLog, err := session.GuildAuditLog(guildID, "", "", int(action), 10)
+	if err != nil {
+		log.Debug().Err(err).Str("guild_id", guildID).Msg("Unable to fetch audit log")
+		return ""
+	}
+
+	for _, entry := range auditLog.AuditLogEntries {
+		if entry.TargetID != targetID {
+			continue
+		}
+		if entry.Options != nil && entry.Options.ChannelID != "" && entry.Options.ChannelID != channelID {
+			continue
+		}
+		created, err := discordgo.SnowflakeTimestamp(entry.ID)
+		if err != nil || time.Since(created) > _DeleterLookupWindow {
+			continue
+		}
+		return entry.UserID
+	}
+	return ""
+}
+
+// _DeletedMessageAuthor returns the author of a deleted message, from Discord's cache if it was still there
+// or otherwise from its indexed document
+func _DeletedMessageAuthor(deleted *discordgo.MessageDelete) string {
+	if deleted.BeforeDelete != nil && deleted.BeforeDelete.Author != nil {
+		return deleted.BeforeDelete.Author.ID
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", deleted.ChannelID)}, map[string]interface{}{
+		"size":    1,
+		"query":   map[string]interface{}{"ids": map[string]interface{}{"values": []string{deleted.ID}}},
+		"_source": []string{"author_id"},
+	}, _ChannelRouting(deleted.ChannelID))
+	if err != nil || len(resp.Hits.Hits) == 0 {
+		return ""
+	}
+	var document _MessageDocument
+	json.Unmarshal(resp.Hits.Hits[0].Source, &document)
+	return document.AuthorID
+}
+
+// _FlagDeleted marks messages as deleted, recording who deleted them if known
+func _FlagDeleted(channelID string, messageIDs []string, deletedBy string) (int, error) {
+	params := map[string]interface{}{
+		"deleted_at": _FormatTimestamp(time.Now()),
+		"deleted_by": nil,
+	}
+	if deletedBy != "" {
+		params["deleted_by"] = deletedBy
+	}
+
+	return _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", channelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": messageIDs}},
+		_FlagDeletedScript,
+		params,
+		0,
+	)
+}
+
+func _MessageDeleteFlagHandler(_ *discordgo.Session, deleted *discordgo.MessageDelete) {
+	if !_IsAllowedGuild(deleted.GuildID) {
+		return
+	}
+
+	deletedBy := ""
+	if authorID := _DeletedMessageAuthor(deleted); authorID != "" {
+		deletedBy = _FindDeleter(deleted.GuildID, discordgo.AuditLogActionMessageDelete, authorID, deleted.ChannelID)
+	}
+
+	_, err := _FlagDeleted(deleted.ChannelID, []string{deleted.ID}, deletedBy)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", deleted.ID).Msg("Error flagging deleted message")
+	}
+}
+
+func _MessageDeleteBulkFlagHandler(_ *discordgo.Session, deleted *discordgo.MessageDeleteBulk) {
+	if !_IsAllowedGuild(deleted.GuildID) || len(deleted.Messages) == 0 {
+		return
+	}
+
+	deletedBy := _FindDeleter(deleted.GuildID, discordgo.AuditLogActionMessageBulkDelete, deleted.ChannelID, deleted.ChannelID)
+	_, err := _FlagDeleted(deleted.ChannelID, deleted.Messages, deletedBy)
+	if err != nil {
+		log.Error().Err(err).Str("channel_id", deleted.ChannelID).Int("count", len(deleted.Messages)).Msg("Error flagging deleted messages")
+	}
+}
+
+type _DeletedArgs struct {
+	Channel string `description:"Channel to list deleted messages from."`
+	Hours   int    `default:"24" description:"How many hours back to look for deletions."`
+	Limit   int    `default:"10" description:"Number of messages to show."`
+}
+
+func _DeletedHandler(message *discordgo.MessageCreate, args _DeletedArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if args.Hours < 1 {
+		args.Hours = 1
+	}
+	if args.Limit < 1 || args.Limit > _MaxDeletedResults {
+		args.Limit = _MaxDeletedResults
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size": args.Limit,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+					map[string]interface{}{"term": map[string]interface{}{"deleted": true}},
+					map[string]interface{}{"range": map[string]interface{}{"deleted_at": map[string]interface{}{"gte": fmt.Sprintf("now-%dh", args.Hours)}}},
+				},
+			},
+		},
+		"sort": []interface{}{map[string]interface{}{"deleted_at": "desc"}},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for deleted messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Messages deleted from #%s", channel.Name))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	embed.Footer = _EmbedFooter(fmt.Sprintf("Deleted in the last %d hours, newest first", args.Hours))
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No deleted messages found."
+		if !config.FlagDeletedMessages {
+			embed.Description += " Deleted messages are only kept when FLAG_DELETED_MESSAGES is enabled."
+		}
+	}
+	for _, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+
+		var deletion struct {
+			DeletedAt time.Time `json:"deleted_at"`
+			DeletedBy string    `json:"deleted_by"`
+		}
+		json.Unmarshal(hit.Source, &deletion)
+		deletedBy := "the author or an unknown user"
+		if deletion.DeletedBy != "" {
+			deletedBy = fmt.Sprintf("<@%s>", deletion.DeletedBy)
+		}
+		field.Value += fmt.Sprintf("\nDeleted <t:%d:R> by %s", deletion.DeletedAt.Unix(), deletedBy)
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _IsRetryableDiscordError returns whether a failed Discord request is worth retrying.
+// Client errors such as missing permissions or unknown channels will fail the same way again, so they are not retried.
+// Rate limits are already waited out and retried by discordgo before an error is returned.
+func _IsRetryableDiscordError(err error) bool {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) {
+		return restErr.Response != nil && restErr.Response.StatusCode >= 500
+	}
+	if errors.Is(err, discordgo.ErrJSONUnmarshal) {
+		return false
+	}
+	return true
+}
+
+// _ChannelMessages fetches a page of messages from a channel, retrying transient failures with exponential backoff
+func _ChannelMessages(channelID string, limit int, beforeID string, afterID string) ([]*discordgo.Message, error) {
+	var err error
+	for attempt := 1; attempt <= config.DiscordFetchMaxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := config.DiscordFetchRetryDelay * time.Duration(1<<(attempt-2))
+			log.Warn().Err(err).Str("channel_id", channelID).Int("attempt", attempt).Dur("delay", delay).Msg("Retrying Discord message fetch")
+			time.Sleep(delay)
+		}
+
+		var messages []*discordgo.Message
+		messages, err = _FetchChannelMessages(channelID, limit, beforeID, afterID)
+		if err == nil {
+			return messages, nil
+		}
+		if !_IsRetryableDiscordError(err) {
+			return nil, fmt.Errorf("error fetching messages from Discord: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("error fetching messages from Discord after %d attempts: %w", config.DiscordFetchMaxAttempts, err)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestChannelMessagesRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantRequests int
+	}{
+		{"succeeds", []int{http.StatusOK}, false, 1},
+		{"fails then succeeds", []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK}, false, 3},
+		{"retries exhausted", []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}, true, 3},
+		{"missing permissions", []int{http.StatusForbidden}, true, 1},
+		{"unknown channel", []int{http.StatusNotFound}, true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *Config) {
+				cfg.DiscordFetchMaxAttempts = 3
+				cfg.DiscordFetchRetryDelay = 0
+			})
+			transport := newTestDiscordAPI(setTestSession(t), func(req testRequest) (int, string) {
+				status := test.statuses[0]
+				test.statuses = test.statuses[1:]
+				if status != http.StatusOK {
+					return status, `{"message": "error", "code": 0}`
+				}
+				return status, `[{"id": "2", "channel_id": "7", "content": "hello"}]`
+			})
+
+			messages, err := _ChannelMessages("7", 100, "3", "")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if !test.wantErr && (len(messages) != 1 || messages[0].ID != "2") {
+				t.Errorf("got messages %v, want the page Discord returned", messages)
+			}
+
+			requests := transport.Requests()
+			if len(requests) != test.wantRequests {
+				t.Fatalf("got %d requests, want %d", len(requests), test.wantRequests)
+			}
+			if requests[0].Path != "/api/v9/channels/7/messages" || requests[0].Query["before"] != "3" {
+				t.Errorf("got request for %s?before=%s", requests[0].Path, requests[0].Query["before"])
+			}
+		})
+	}
+}
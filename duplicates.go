@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Near-duplicates are found with MinHash: each message is split into overlapping shingles, and a signature is built
+// from the smallest hash of its shingles under several hash functions. Messages whose signatures share a band are
+// compared, and those estimated to share enough of their shingles are clustered together.
+// Signatures aren't stored in the index, so each run scans and hashes every message it covers. This costs a scroll
+// over the channel plus a few hundred hashes per message, so runs are capped and the command is opt-in.
+
+const _MinHashFunctions = 64
+const _MinHashBands = 16
+const _MinHashRows = _MinHashFunctions / _MinHashBands
+const _WordShingleSize = 3
+const _CharacterShingleSize = 5
+const _MinDuplicateContentLength = 20
+const _MaxNearDuplicateMessages = 10000
+const _MaxNearDuplicateClusters = 10
+
+var _errNearDuplicateLimitReached = errors.New("reached the maximum number of messages to compare")
+
+type _MinHashSignature [_MinHashFunctions]uint64
+
+// Seeds for the hash functions, derived from a fixed generator so that signatures are stable between runs
+var _MinHashSeeds = func() [_MinHashFunctions][2]uint64 {
+	var seeds [_MinHashFunctions][2]uint64
+	state := uint64(0x9E3779B97F4A7C15)
+	for i := range seeds {
+		for j := range seeds[i] {
+			state ^= state << 13
+			state ^= state >> 7
+			state ^= state << 17
+			seeds[i][j] = state
+		}
+		seeds[i][0] |= 1
+	}
+	return seeds
+}()
+
+// _Shingles splits content into overlapping word shingles, or character shingles for content with too few words.
+// Punctuation and case are ignored, so that small variations don't hide an otherwise identical message.
+func _Shingles(content string) []string {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) >= _WordShingleSize {
+		shingles := make([]string, 0, len(words)-_WordShingleSize+1)
+		for start := 0; start+_WordShingleSize <= len(words); start++ {
+			shingles = append(shingles, strings.Join(words[start:start+_WordShingleSize], " "))
+		}
+		return shingles
+	}
+
+	characters := []rune(strings.Join(words, " "))
+	if len(characters) < _CharacterShingleSize {
+		return []string{string(characters)}
+	}
+	shingles := make([]string, 0, len(characters)-_CharacterShingleSize+1)
+	for start := 0; start+_CharacterShingleSize <= len(characters); start++ {
+		shingles = append(shingles, string(characters[start:start+_CharacterShingleSize]))
+	}
+	return shingles
+}
+
+// _MinHash computes the MinHash signature of a set of shingles
+func _MinHash(shingles []string) _MinHashSignature {
+	var signature _MinHashSignature
+	for i := range signature {
+		signature[i] = ^uint64(0)
+	}
+	for _, shingle := range shingles {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(shingle))
+		base := hasher.Sum64()
+		for i, seed := range _MinHashSeeds {
+			value := base*seed[0] + seed[1]
+			if value < signature[i] {
+				signature[i] = value
+			}
+		}
+	}
+	return signature
+}
+
+// _SignatureSimilarity estimates the Jaccard similarity of the shingles two signatures were built from
+func _SignatureSimilarity(a *_MinHashSignature, b *_MinHashSignature) float64 {
+	matching := 0
+	for i := range a {
+		if a[i] == b[i] {
+			matching++
+		}
+	}
+	return float64(matching) / _MinHashFunctions
+}
+
+// _ClusterNearDuplicates groups signatures estimated to be at least threshold similar, returning clusters of indices
+func _ClusterNearDuplicates(signatures []_MinHashSignature, threshold float64) [][]int {
+	parents := make([]int, len(signatures))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	for band := 0; band < _MinHashBands; band++ {
+		buckets := make(map[[_MinHashRows]uint64][]int)
+		for i := range signatures {
+			var key [_MinHashRows]uint64
+			copy(key[:], signatures[i][band*_MinHashRows:(band+1)*_MinHashRows])
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, candidates := range buckets {
+			for _, other := range candidates[1:] {
+				first, second := find(candidates[0]), find(other)
+				if first == second {
+					continue
+				}
+				if _SignatureSimilarity(&signatures[candidates[0]], &signatures[other]) >= threshold {
+					parents[second] = first
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range signatures {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+	clusters := make([][]int, 0)
+	for _, group := range groups {
+		if len(group) > 1 {
+			clusters = append(clusters, group)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool { return len(clusters[i]) > len(clusters[j]) })
+	return clusters
+}
+
+type _NearDuplicateMessage struct {
+	ID string
+	_MessageDocument
+}
+
+type _NearDuplicatesArgs struct {
+	Channel    string  `description:"Channel to find near-duplicate messages in."`
+	Days       int     `default:"7" description:"Number of days of messages to compare."`
+	Similarity float64 `default:"0.8" description:"How similar messages must be to be grouped, from 0 to 1."`
+	MinSize    int     `default:"3" description:"Only report groups with at least this many messages."`
+}
+
+func _NearDuplicatesHandler(message *discordgo.MessageCreate, args _NearDuplicatesArgs) {
+	if !config.EnableNearDuplicates {
+		session.ChannelMessageSend(message.ChannelID, "Near-duplicate detection is disabled. Set ENABLE_NEAR_DUPLICATES to enable it.")
+		return
+	}
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if args.Similarity <= 0 || args.Similarity > 1 {
+		session.ChannelMessageSend(message.ChannelID, "Similarity must be greater than 0 and at most 1.")
+		return
+	}
+	if args.MinSize < 2 {
+		args.MinSize = 2
+	}
+
+	messages := make([]_NearDuplicateMessage, 0)
+	signatures := make([]_MinHashSignature, 0)
+	err = _ScanAllRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"_source": []string{"content", "channel_id", "author_id", "timestamp"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", args.Days)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+	}, _ChannelRouting(channel.ID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _NearDuplicateMessage
+			if json.Unmarshal(hit.Source, &document._MessageDocument) != nil {
+				continue
+			}
+			if utf8.RuneCountInString(document.Content) < _MinDuplicateContentLength {
+				continue
+			}
+			document.ID = hit.ID
+			messages = append(messages, document)
+			signatures = append(signatures, _MinHash(_Shingles(document.Content)))
+			if len(messages) >= _MaxNearDuplicateMessages {
+				return _errNearDuplicateLimitReached
+			}
+		}
+		return nil
+	})
+	limited := errors.Is(err, _errNearDuplicateLimitReached)
+	if err != nil && !limited {
+		log.Error().Err(err).Msg("Error scanning messages for near-duplicates")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	clusters := make([][]int, 0)
+	for _, cluster := range _ClusterNearDuplicates(signatures, args.Similarity) {
+		if len(cluster) >= args.MinSize {
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	footer := fmt.Sprintf("Compared %d messages from the last %d days", len(messages), args.Days)
+	if limited {
+		footer += fmt.Sprintf(", stopping at the limit of %d", _MaxNearDuplicateMessages)
+	}
+	embed := _NewEmbed(fmt.Sprintf("Suspected near-duplicate messages in #%s", channel.Name))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, _MaxNearDuplicateClusters)
+	embed.Footer = _EmbedFooter(footer)
+	if len(clusters) == 0 {
+		embed.Description = "No groups of near-duplicate messages found."
+	}
+	for _, cluster := range clusters {
+		if len(embed.Fields) == _MaxNearDuplicateClusters {
+			break
+		}
+		authors := make(map[string]bool)
+		for _, index := range cluster {
+			authors[messages[index].AuthorID] = true
+		}
+		sample := messages[cluster[0]]
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name: fmt.Sprintf("%d messages from %d users", len(cluster), len(authors)),
+			Value: fmt.Sprintf("%s\n%s",
+				_Snippet(sample.Content, _SnippetLength),
+				_JumpURL(message.GuildID, channel.ID, sample.ID),
+			),
+		})
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
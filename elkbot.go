@@ -4,10 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 	elasticsearch "github.com/elastic/go-elasticsearch/v7"
@@ -24,57 +30,213 @@ type Config struct {
 	Prefix   string        `default:"elk!"`
 	Token    string        `required:"true"`
 	LogLevel zerolog.Level `default:"1" split_words:"true"`
+	ReadOnly bool          `default:"false" split_words:"true"`
+	Admins   []string      `default:"106162668032802816"`
+	Owners   []string      `default:"106162668032802816"`
+
+	LogFile       string `default:"" split_words:"true"`
+	LogToConsole  bool   `default:"true" split_words:"true"`
+	LogMaxSizeMB  int    `default:"100" split_words:"true"`
+	LogMaxBackups int    `default:"3" split_words:"true"`
+	LogMaxAgeDays int    `default:"28" split_words:"true"`
+
+	AllowedGuilds       []string `split_words:"true"`
+	GuildGoodbyeMessage string   `default:"" split_words:"true"`
+
+	CommandPermissions map[string]string `split_words:"true"`
+
+	MinContentLength   int      `default:"0" split_words:"true"`
+	ReplySnippetLength int      `default:"100" split_words:"true"`
+	MaxIngestMessages  int      `default:"0" split_words:"true"`
+	IngestBlockedUsers []string `split_words:"true"`
+	TuneRefreshForBulk bool     `default:"false" split_words:"true"`
+
+	ActiveNowWindow time.Duration `default:"15m" split_words:"true"`
+
+	AttachmentTypeAllowlist []string `split_words:"true"`
+	IncludeChannelContext   bool     `default:"false" split_words:"true"`
+	IncludeStageChannels    bool     `default:"false" split_words:"true"`
+	IndexScheduledEvents    bool     `default:"false" split_words:"true"`
+	IngestEvents            bool     `default:"false" split_words:"true"`
+	FlagDeletedMessages     bool     `default:"true" split_words:"true"`
+
+	MessageIndexTimeout     time.Duration `default:"0" split_words:"true"`
+	MaxIndexedContentLength int           `default:"16384" split_words:"true"`
+	MaxIndexedAttachments   int           `default:"25" split_words:"true"`
+	Enrichers               []string      `default:"links"`
+	IndexFields             []string      `split_words:"true"`
+
+	PreprocessStripEmoji          bool     `default:"false" split_words:"true"`
+	PreprocessCollapseWhitespace  bool     `default:"false" split_words:"true"`
+	PreprocessExpandAbbreviations bool     `default:"false" split_words:"true"`
+	ExcludeFields                 []string `split_words:"true"`
+	EncryptContent                bool     `default:"false" split_words:"true"`
+	ContentEncryptionKey          string   `default:"" split_words:"true"`
+
+	ConfirmationTimeout    time.Duration `default:"30s" split_words:"true"`
+	PurgeRequestsPerSecond int           `default:"500" split_words:"true"`
+
+	HTTPProxy          string   `default:"" envconfig:"HTTP_PROXY"`
+	HTTPSProxy         string   `default:"" envconfig:"HTTPS_PROXY"`
+	NoProxy            []string `envconfig:"NO_PROXY"`
+	ProxyElasticsearch bool     `default:"false" split_words:"true"`
+
+	EmbedColor      string `default:"" split_words:"true"`
+	EmbedFooterText string `default:"" split_words:"true"`
+	EmbedFooterIcon string `default:"" split_words:"true"`
+
+	AllowMentionPrefix  bool `default:"false" split_words:"true"`
+	EnableSlashCommands bool `default:"false" split_words:"true"`
+
+	LiveIngest             bool          `default:"false" split_words:"true"`
+	AutoIngestOnJoin       bool          `default:"false" split_words:"true"`
+	AutoIngestChannelDelay time.Duration `default:"30s" split_words:"true"`
+	TrackReactions         bool          `default:"false" split_words:"true"`
+	LiveIngestWorkers      int           `default:"4" split_words:"true"`
+	LiveIngestQueueSize    int           `default:"1000" split_words:"true"`
+	LiveIngestOverflow     string        `default:"block" split_words:"true"`
+	LiveIngestBlockTimeout time.Duration `default:"5s" split_words:"true"`
+	LiveDedupeCacheSize    int           `default:"1000" split_words:"true"`
+	LiveChannelMaxShare    float64       `default:"1" split_words:"true"`
+	KeepEditHistory        bool          `default:"false" split_words:"true"`
+	PausedIngestMode       string        `default:"drop" split_words:"true"`
+	MaxPausedBuffer        int           `default:"10000" split_words:"true"`
+
+	NameRefreshInterval   time.Duration `default:"0" split_words:"true"`
+	NameRefreshMaxAuthors int           `default:"50" split_words:"true"`
+
+	MaxMessageAge     time.Duration `default:"0" split_words:"true"`
+	RetentionInterval time.Duration `default:"1h" split_words:"true"`
+
+	UseTimeBasedIndices   bool              `default:"false" split_words:"true"`
+	ArchiveIndicesAfter   time.Duration     `default:"0" split_words:"true"`
+	IndexShards           int               `default:"1" split_words:"true"`
+	IndexReplicas         int               `default:"1" split_words:"true"`
+	RouteByChannel        bool              `default:"false" split_words:"true"`
+	ElasticsearchURLs     []string          `envconfig:"ELASTICSEARCH_URLS"`
+	ESMaxRetries          int               `default:"3" split_words:"true"`
+	ESDiscoverNodes       bool              `default:"false" split_words:"true"`
+	ESRetryInterval       time.Duration     `default:"30s" split_words:"true"`
+	MaxESConcurrency      int               `default:"0" split_words:"true"`
+	IngestPipeline        string            `default:"" split_words:"true"`
+	CreateDefaultPipeline bool              `default:"false" split_words:"true"`
+	PerGuildIndices       bool              `default:"false" split_words:"true"`
+	AutoMigrate           bool              `default:"false" split_words:"true"`
+	ContentAnalyzer       string            `default:"standard" split_words:"true"`
+	GuildContentAnalyzers map[string]string `split_words:"true"`
+	BackupPath            string            `default:"" split_words:"true"`
+	SnapshotRepository    string            `default:"" split_words:"true"`
+	SnapshotInterval      time.Duration     `default:"0" split_words:"true"`
+	SnapshotNotifyChannel string            `default:"" split_words:"true"`
+
+	Timezone            string        `default:"UTC"`
+	LagWarningThreshold time.Duration `default:"5m" split_words:"true"`
+	GapThreshold        time.Duration `default:"24h" split_words:"true"`
+	ResumeBackfill      bool          `default:"false" split_words:"true"`
+	HealthAddress       string        `default:"" split_words:"true"`
+	ExternalIngestToken string        `default:"" split_words:"true"`
+	ExternalSource      string        `default:"external" split_words:"true"`
+
+	HeartbeatWatchdogThreshold time.Duration `default:"0" split_words:"true"`
+
+	DiscordFetchMaxAttempts int           `default:"3" split_words:"true"`
+	DiscordFetchRetryDelay  time.Duration `default:"2s" split_words:"true"`
+
+	MaxSearchResults        int                `default:"25" split_words:"true"`
+	MaxSearchExportResults  int                `default:"10000" split_words:"true"`
+	SearchFieldBoosts       map[string]float64 `default:"content:3,content_searchable:3,poll.question:1,poll.answers.text:1,channel_topic:0.2,channel_category:0.2,thread_name:0.5" split_words:"true"`
+	SearchPaginationTimeout time.Duration      `default:"5m" split_words:"true"`
+	EnableNearDuplicates    bool               `default:"false" split_words:"true"`
 }
 
+var config Config
 var session *discordgo.Session
 var esClient *elasticsearch.Client
+var parser *parsley.Parser
 
-func _PaginateMessages(channelID string, callback func([]*discordgo.Message) error) error {
-	messages, err := session.ChannelMessages(channelID, 100, "", "", "")
+func _PaginateMessages(channelID string, before string, callback func([]*discordgo.Message) error) error {
+	messages, err := _ChannelMessages(channelID, 100, before, "")
 	if err != nil {
-		return fmt.Errorf("error fetching messages from Discord: %w", err)
+		return err
 	}
 	for len(messages) > 0 {
-		err = callback(messages)
-		if err != nil {
-			return fmt.Errorf("error when processing messages: %w", err)
+		var reachedCutoff bool
+		messages, reachedCutoff = _TrimExpired(messages)
+		if len(messages) > 0 {
+			err = callback(messages)
+			if err != nil {
+				return fmt.Errorf("error when processing messages: %w", err)
+			}
+			log.Debug().Int("count", len(messages)).Msg("Finished processing page")
+		}
+		if reachedCutoff {
+			log.Debug().Msg("Reached maximum message age, stopping pagination")
+			break
 		}
-		log.Debug().Int("count", len(messages)).Msg("Finished processing page")
 		log.Debug().Str("before", messages[len(messages)-1].ID).Msg("Fetching next page of messages")
-		messages, err = session.ChannelMessages(channelID, 100, messages[len(messages)-1].ID, "", "")
+		messages, err = _ChannelMessages(channelID, 100, messages[len(messages)-1].ID, "")
 		if err != nil {
-			return fmt.Errorf("error fetching messages from Discord: %w", err)
+			return err
 		}
 	}
 
 	return nil
 }
 
-func _InsertIndex(data map[string]interface{}, indexName string, documentID string) error {
+func _InsertIndex(data map[string]interface{}, indexName string, documentID string, version int, routing string) error {
+	resolved, err := _ResolveExistingIndices([]_BulkItem{{Index: indexName, DocumentID: documentID, Routing: routing}})
+	if err != nil {
+		return err
+	}
+	indexName = resolved[0].Index
 	reqBody, _ := json.Marshal(data)
 
 	req := esapi.IndexRequest{
-		Index:      indexName,
-		DocumentID: documentID,
-		Body:       bytes.NewReader(reqBody),
-		Refresh:    "true",
+		Index:       indexName,
+		DocumentID:  documentID,
+		Body:        bytes.NewReader(reqBody),
+		Refresh:     "true",
+		OpType:      "index",
+		Version:     &version,
+		VersionType: "external_gte",
+		Routing:     routing,
+		Pipeline:    _IndexPipeline(indexName),
 	}
 
 	resp, err := req.Do(context.Background(), esClient)
 	if err != nil {
+		_RecordMetric(_MetricESErrors, 1)
 		return fmt.Errorf("error making elasticsearch request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusConflict {
+		log.Debug().Str("index", indexName).Str("document_id", documentID).Msg("Skipping document, a newer version is already indexed")
+		return nil
+	}
+
 	if resp.IsError() {
+		_RecordMetric(_MetricESErrors, 1)
 		return fmt.Errorf("got status code %s", resp.Status())
 	}
 
+	_RecordMetric(_MetricDocumentsIndexed, 1)
 	return nil
 }
 
-func _IngestAttachment(attachment *discordgo.MessageAttachment, message *discordgo.Message) error {
-	documentBody := map[string]interface{}{
+// _DocumentVersion returns the version a message's documents should be indexed with.
+// Versions are keyed on the time the message was last edited, so that stale events never overwrite newer content.
+func _DocumentVersion(message *discordgo.Message) int {
+	timestamp := message.Timestamp
+	if message.EditedTimestamp != nil {
+		timestamp = *message.EditedTimestamp
+	}
+
+	return int(timestamp.UnixNano() / int64(time.Millisecond))
+}
+
+func _BuildAttachmentDocument(attachment *discordgo.MessageAttachment, message *discordgo.Message) map[string]interface{} {
+	document := map[string]interface{}{
 		"filename":   attachment.Filename,
 		"height":     attachment.Height,
 		"width":      attachment.Width,
@@ -82,10 +244,31 @@ func _IngestAttachment(attachment *discordgo.MessageAttachment, message *discord
 		"url":        attachment.URL,
 		"proxy_url":  attachment.ProxyURL,
 		"message_id": message.ID,
-		"timestamp":  message.Timestamp,
+		"channel_id": message.ChannelID,
+		"author_id":  message.Author.ID,
+		"timestamp":  _FormatTimestamp(message.Timestamp),
+		"is_spoiler": strings.HasPrefix(attachment.Filename, "SPOILER_"),
 	}
 
-	err := _InsertIndex(documentBody, "attachments", attachment.ID)
+	if description := _TakeAttachmentDescription(attachment.ID); description != "" {
+		document["description"] = description
+	}
+	if attachment.Width > 0 && attachment.Height > 0 {
+		document["aspect_ratio"] = math.Round(float64(attachment.Width)/float64(attachment.Height)*100) / 100
+	}
+
+	return document
+}
+
+func _IngestAttachment(attachment *discordgo.MessageAttachment, message *discordgo.Message) error {
+	if !_IsAllowedAttachment(attachment) {
+		log.Debug().Str("attachment_id", attachment.ID).Msg("Skipping attachment not matching the type allowlist")
+		return nil
+	}
+
+	documentBody := _BuildAttachmentDocument(attachment, message)
+
+	err := _InsertIndex(documentBody, _ChannelWriteIndex("attachments", message.ChannelID), attachment.ID, _DocumentVersion(message), _DocumentRouting(message.ChannelID))
 	if err != nil {
 		return fmt.Errorf("error ingesting attachment: %w", err)
 	}
@@ -93,20 +276,108 @@ func _IngestAttachment(attachment *discordgo.MessageAttachment, message *discord
 	return nil
 }
 
+// _AuthorDisplayName returns the name a message's author was displayed with at the time the message was ingested
+func _AuthorDisplayName(message *discordgo.Message) string {
+	if message.Member != nil && message.Member.Nick != "" {
+		return message.Member.Nick
+	}
+	if message.Author.GlobalName != "" {
+		return message.Author.GlobalName
+	}
+	return message.Author.Username
+}
+
+// _ReactionCount returns the total number of reactions on a message at the time it was ingested
+func _ReactionCount(message *discordgo.Message) int {
+	count := 0
+	for _, reaction := range message.Reactions {
+		count += reaction.Count
+	}
+	return count
+}
+
+// _BuildReactionDocuments returns the individual reactions on a message at the time it was ingested
+func _BuildReactionDocuments(message *discordgo.Message) []map[string]interface{} {
+	reactions := make([]map[string]interface{}, 0, len(message.Reactions))
+	for _, reaction := range message.Reactions {
+		if reaction.Emoji == nil {
+			continue
+		}
+		reactions = append(reactions, map[string]interface{}{
+			"emoji_name": reaction.Emoji.Name,
+			"emoji_id":   reaction.Emoji.ID,
+			"count":      reaction.Count,
+		})
+	}
+	return reactions
+}
+
+func _BuildMessageDocument(message *discordgo.Message) map[string]interface{} {
+	document := map[string]interface{}{
+		"content":          message.Content,
+		"content_length":   utf8.RuneCountInString(message.Content),
+		"channel_id":       message.ChannelID,
+		"guild_id":         _MessageGuildID(message),
+		"author_id":        message.Author.ID,
+		"attachment_count": len(message.Attachments),
+		"author_name":      _AuthorDisplayName(message),
+		"author_bot":       message.Author.Bot,
+		"timestamp":        _FormatTimestamp(message.Timestamp),
+		"reaction_count":   _ReactionCount(message),
+		"reactions":        _BuildReactionDocuments(message),
+		"used_emoji_ids":   _UsedEmojiIDs(message.Content),
+		"source":           _DiscordSource,
+
+		"is_crossposted":    message.Flags&discordgo.MessageFlagsIsCrossPosted != 0,
+		"embeds_suppressed": message.Flags&discordgo.MessageFlagsSuppressEmbeds != 0,
+		"is_ephemeral":      message.Flags&discordgo.MessageFlagsEphemeral != 0,
+	}
+
+	if message.Poll != nil {
+		document["poll"] = _BuildPollDocument(message.Poll)
+	}
+	_AddReferenceFields(message, document)
+	_AddChannelContextFields(message, document)
+	_AddChannelTypeField(message, document)
+	_AddThreadFields(message, document)
+	_NormalizeContent(message, document)
+	_TruncateContent(message, document)
+	_PreprocessContent(message, document)
+	_AddReplyFields(message, document)
+	_AddContentAvailability(message, document)
+	_ApplyEnrichers(message, document)
+	_EncryptDocumentContent(document)
+	_FilterDocumentFields(message, document)
+
+	return document
+}
+
 func _IngestMessage(message *discordgo.Message) error {
-	documentBody := map[string]interface{}{
-		"content":    message.Content,
-		"channel_id": message.ChannelID,
-		"author_id":  message.Author.ID,
-		"timestamp":  message.Timestamp,
+	if _IsExcludedChannel(message.ChannelID) {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping message from a channel excluded from archiving")
+		return nil
+	}
+	if _IsBlocked(message.Author.ID) {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping message from a user on the blocklist")
+		return nil
+	}
+	if _IsExpired(message) {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping message older than the maximum message age")
+		return nil
+	}
+	if _IsTooShort(message) {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping message shorter than the minimum content length")
+		return nil
 	}
 
-	err := _InsertIndex(documentBody, "messages", message.ID)
+	documentBody := _BuildMessageDocument(message)
+
+	err := _InsertIndex(documentBody, _ChannelWriteIndex("messages", message.ChannelID), message.ID, _DocumentVersion(message), _DocumentRouting(message.ChannelID))
 	if err != nil {
 		return fmt.Errorf("error ingesting message: %w", err)
 	}
 
-	for _, attachment := range message.Attachments {
+	for _, attachment := range _IndexedAttachments(message) {
 		err = _IngestAttachment(attachment, message)
 		if err != nil {
 			return err
@@ -117,42 +388,195 @@ func _IngestMessage(message *discordgo.Message) error {
 }
 
 func main() {
+	_StartTime = time.Now()
+
 	err := godotenv.Load()
 	if err != nil {
 		fmt.Printf("Failed to load .env file: %s\n", err.Error())
 	}
 
-	var config Config
 	err = envconfig.Process("elkbot", &config)
 	if err != nil {
 		panic(fmt.Errorf("error loading config: %w", err))
 	}
 
 	zerolog.SetGlobalLevel(config.LogLevel)
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	log.Logger = log.Output(_LogOutput())
+
+	err = _ValidateConfig(config)
+	if err != nil {
+		panic(err)
+	}
+	_ApplyReadOnly(&config)
+	err = _LoadCommandPermissions()
+	if err != nil {
+		panic(fmt.Errorf("invalid config: %w", err))
+	}
+	log.Info().Interface("config", _RedactedConfig(config)).Msg("Loaded config")
 
 	log.Debug().Msg("Creating Elasticsearch client")
-	esClient, err = elasticsearch.NewDefaultClient()
+	esClient, err = _NewESClient(nil)
 	if err != nil {
 		panic(fmt.Errorf("error creating Elasticsearch client: %w", err))
 	}
 	log.Debug().Msg("Elasticsearch client created")
 
+	err = _CheckESReachable()
+	if err != nil {
+		log.Error().Err(err).Dur("retry_interval", config.ESRetryInterval).Msg("Elasticsearch is unreachable, starting with ingestion disabled until it recovers")
+		go _WaitForElasticsearch()
+	} else {
+		err = _SetupElasticsearch()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if config.MaxMessageAge > 0 && config.RetentionInterval > 0 {
+		log.Debug().Dur("max_age", config.MaxMessageAge).Dur("interval", config.RetentionInterval).Msg("Starting retention enforcement")
+		go _RetentionLoop()
+	}
+
 	log.Debug().Msg("Creating Discord session")
 	session, err = discordgo.New("Bot " + config.Token)
 	if err != nil {
 		panic(fmt.Errorf("error creating Discord session: %w", err))
 	}
-	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsGuildMessages)
+	session.Identify.Intents = discordgo.MakeIntent(
+		discordgo.IntentsGuilds |
+			discordgo.IntentsGuildMessages |
+			discordgo.IntentMessageContent |
+			discordgo.IntentGuildMessagePolls,
+	)
+	if config.IndexScheduledEvents {
+		session.Identify.Intents |= discordgo.IntentsGuildScheduledEvents
+		session.AddHandler(_ScheduledEventCreateHandler)
+		session.AddHandler(_ScheduledEventUpdateHandler)
+	}
+	if config.IngestEvents {
+		session.Identify.Intents |= discordgo.IntentsGuildBans | discordgo.IntentsGuildMembers
+		session.AddHandler(_GuildBanAddHandler)
+		session.AddHandler(_GuildBanRemoveHandler)
+		session.AddHandler(_GuildMemberAddHandler)
+		session.AddHandler(_GuildMemberRemoveHandler)
+		session.AddHandler(_MessageDeleteEventHandler)
+		session.AddHandler(_MessageDeleteBulkEventHandler)
+	}
+	if config.FlagDeletedMessages {
+		session.AddHandler(_MessageDeleteFlagHandler)
+		session.AddHandler(_MessageDeleteBulkFlagHandler)
+	}
+	if config.TrackReactions {
+		session.Identify.Intents |= discordgo.IntentsGuildMessageReactions
+		session.AddHandler(_ReactionAddHandler)
+		session.AddHandler(_ReactionRemoveHandler)
+	}
+	session.AddHandler(_GuildCreateHandler)
+	session.AddHandler(_ConnectHandler)
+	session.AddHandler(_DisconnectHandler)
+	session.AddHandler(_ResumedHandler)
+	if config.ReadOnly {
+		session.Identify.Intents = _ReadOnlyIntents()
+	} else {
+		session.AddHandler(_PollVoteAddHandler)
+		session.AddHandler(_PollVoteRemoveHandler)
+		session.AddHandler(_PollUpdateHandler)
+		session.AddHandler(_ChannelUpdateHandler)
+		session.AddHandler(_ThreadUpdateHandler)
+	}
+	session.AddHandler(_InteractionHandler)
+	if config.LiveIngest {
+		_StartLiveIngestWorkers()
+		session.AddHandler(_LiveIngestEventHandler)
+		session.AddHandler(_LiveEditHandler)
+		if !config.FlagDeletedMessages {
+			session.AddHandler(_LiveDeleteHandler)
+			session.AddHandler(_LiveDeleteBulkHandler)
+		}
+	}
+	if config.EnableSlashCommands {
+		session.AddHandler(_RegisterSlashCommands)
+	}
 	log.Debug().Msg("Discord session created")
 
 	log.Debug().Msg("Creating command parser")
-	parser := parsley.New(config.Prefix)
-	parser.RegisterHandler(session)
+	parser = parsley.New(config.Prefix)
+	session.AddHandler(_CommandHandler)
+	if config.AllowMentionPrefix {
+		session.AddHandler(_MentionCommandHandler)
+	}
 	log.Debug().Msg("Parser created")
 
 	parser.NewCommand("ingest", "Ingest a backlog of messages from a certain channel.", _IngestHandler)
 	parser.NewCommand("ingestall", "Ingest a backlog of messages from all channels.", _IngestAllHandler)
+	parser.NewCommand("purge-user", "Delete all stored data for a user.", _PurgeUserHandler)
+	parser.NewCommand("search", "Search ingested messages.", _SearchHandler)
+	parser.NewCommand("attachments", "Search ingested attachments by filename and description.", _AttachmentsSearchHandler)
+	parser.NewCommand("images", "Show statistics about image attachments.", _ImagesHandler)
+	parser.NewCommand("export-stats", "Export aggregated message counts for a channel as a CSV file.", _ExportStatsHandler)
+	parser.NewCommand("longest", "Show the longest messages in a channel.", _LongestHandler)
+	parser.NewCommand("refresh-names", "Update the stored name on all of a user's messages.", _RefreshNamesHandler)
+	parser.NewCommand("lag", "Show how far behind ingestion is for this channel.", _LagHandler)
+	parser.NewCommand("refresh-index", "Make all ingested messages immediately searchable.", _RefreshIndexHandler)
+	parser.NewCommand("fetch-attachment", "Download an ingested attachment and upload it again.", _FetchAttachmentHandler)
+	parser.NewCommand("ingest-report", "Show ingestion throughput and error rates.", _IngestReportHandler)
+	parser.NewCommand("blocklist", "Manage the users whose messages are never ingested.", _BlocklistHandler)
+	parser.NewCommand("enders", "Show who most often sends the last message in a conversation.", _EndersHandler)
+	parser.NewCommand("summary", "Summarize the recent activity in a channel.", _SummaryHandler)
+	parser.NewCommand("indexed-channels", "List every channel with indexed messages.", _IndexedChannelsHandler)
+	parser.NewCommand("cluster", "Show the health of the Elasticsearch cluster and Elkbot's indices.", _ClusterHandler)
+	parser.NewCommand("replay-dlq", "Try indexing documents that previously failed again.", _ReplayDLQHandler)
+	parser.NewCommand("gaps", "Find periods in a channel where messages may have been missed.", _GapsHandler)
+	parser.NewCommand("trending", "Show words that are unusually common in a channel right now.", _TrendingHandler)
+	parser.NewCommand("reingest-attachments", "Re-index the attachments of ingested messages in a channel.", _ReingestAttachmentsHandler)
+	parser.NewCommand("ingest-many", "Ingest a backlog of messages from several channels.", _IngestManyHandler)
+	parser.NewCommand("ingest-guild", "Ingest every channel in the guild, resuming from where an earlier run stopped.", _IngestGuildHandler)
+	parser.NewCommand("verify", "Check how many of a channel's recent messages have been ingested.", _VerifyHandler)
+	parser.NewCommand("reacted", "Find the messages in a channel with the most of a certain reaction.", _ReactedHandler)
+	parser.NewCommand("loglevel", "Change the log level until the bot restarts.", _LogLevelHandler)
+	parser.NewCommand("emoji-usage", "Show the most used custom emojis.", _EmojiUsageHandler)
+	parser.NewCommand("wordcloud", "Export the most frequent words in a channel as JSON, for building a word cloud.", _WordCloudHandler)
+	parser.NewCommand("ingest-range", "Ingest the messages in a channel between two message IDs.", _IngestRangeHandler)
+	parser.NewCommand("server-activity", "Show how active the server has been over time.", _ServerActivityHandler)
+	parser.NewCommand("pause-ingest", "Pause live ingestion of new messages.", _PauseIngestHandler)
+	parser.NewCommand("resume-ingest", "Resume live ingestion of new messages.", _ResumeIngestHandler)
+	parser.NewCommand("hof", "Show the messages in a channel with the most reactions.", _HallOfFameHandler)
+	parser.NewCommand("archive-index", "Close a rolled over index so that it no longer uses resources.", _ArchiveIndexHandler)
+	parser.NewCommand("restore-index", "Reopen an archived index.", _RestoreIndexHandler)
+	parser.NewCommand("recent", "Show the most recently ingested messages in a channel.", _RecentHandler)
+	parser.NewCommand("schema", "List the fields stored in one of Elkbot's indices.", _SchemaHandler)
+	parser.NewCommand("response-times", "Show how quickly people respond to each other in a channel.", _ResponseTimesHandler)
+	parser.NewCommand("backup-mappings", "Back up the settings and mappings of Elkbot's indices to a file.", _BackupMappingsHandler)
+	parser.NewCommand("apply-mappings", "Create indices from an attached backup-mappings file.", _ApplyMappingsHandler)
+	parser.NewCommand("cancel-purge", "Cancel a running purge by its task ID.", _CancelPurgeHandler)
+	parser.NewCommand("links", "Find messages in a channel that link to a domain.", _LinksHandler)
+	parser.NewCommand("estimate", "Estimate how long ingesting a channel would take.", _EstimateHandler)
+	parser.NewCommand("near-duplicates", "Find groups of nearly identical messages in a channel, such as spam.", _NearDuplicatesHandler)
+	parser.NewCommand("backfill-field", "Fill in a field on ingested messages that predate it.", _BackfillFieldHandler)
+	parser.NewCommand("transcript", "Export a channel's ingested messages as an HTML transcript.", _TranscriptHandler)
+	parser.NewCommand("quiet", "Find the longest stretches with no messages in a channel.", _QuietHandler)
+	parser.NewCommand("snapshot", "Snapshot Elkbot's indices to the configured repository.", _SnapshotHandler)
+	parser.NewCommand("origin", "Find who first posted some text.", _OriginHandler)
+	parser.NewCommand("heatmap", "Show when a user is most active by day and hour.", _HeatmapHandler)
+	parser.NewCommand("benchmark-search", "Measure how long a search takes to run.", _BenchmarkSearchHandler)
+	parser.NewCommand("deleted", "List messages recently deleted from a channel, for moderation review.", _DeletedHandler)
+	parser.NewCommand("tag", "Add a label to a message, ingesting it first if needed.", _TagHandler)
+	parser.NewCommand("untag", "Remove a label from a message.", _UntagHandler)
+	parser.NewCommand("hourly", "Show which hours of the day the server is most active in.", _HourlyHandler)
+	parser.NewCommand("commands", "List or sync the registered slash commands.", _CommandsHandler)
+	parser.NewCommand("sentiment", "Show how positive or negative a channel's recent messages are.", _SentimentHandler)
+	parser.NewCommand("active-now", "List who has been chatting in a channel or the server recently.", _ActiveNowHandler)
+	parser.NewCommand("leaderboard", "Rank the most active users by message count.", _LeaderboardHandler)
+	parser.NewCommand("lookup", "Show everything stored about a message, by its jump link.", _LookupHandler)
+	parser.NewCommand("status", "Show Elkbot's uptime and resource usage.", _StatusHandler)
+	parser.NewCommand("card", "Make a shareable image card of a user's stats.", _CardHandler)
+	parser.NewCommand("exclude", "Manage the channels and guilds whose messages are never archived.", _ExcludeHandler)
+	parser.NewCommand("ping", "Check connectivity to Elasticsearch and Discord.", _PingHandler)
+
+	if config.HealthAddress != "" {
+		log.Debug().Str("address", config.HealthAddress).Msg("Serving health endpoint")
+		go _ServeHealth()
+	}
 
 	log.Debug().Msg("Opening Discord connection")
 	err = session.Open()
@@ -162,6 +586,30 @@ func main() {
 	}
 	log.Debug().Msg("Discord connection open")
 
+	if config.NameRefreshInterval > 0 {
+		log.Debug().Dur("interval", config.NameRefreshInterval).Msg("Starting author name refresh")
+		go _RefreshNamesLoop()
+	}
+
+	if config.AutoIngestOnJoin {
+		go _AutoIngestWorker()
+	}
+
+	if config.ArchiveIndicesAfter > 0 {
+		log.Debug().Dur("after", config.ArchiveIndicesAfter).Msg("Starting index archival")
+		go _ArchiveLoop()
+	}
+
+	if config.SnapshotInterval > 0 {
+		log.Debug().Dur("interval", config.SnapshotInterval).Str("repository", config.SnapshotRepository).Msg("Starting scheduled snapshots")
+		go _SnapshotLoop()
+	}
+
+	if config.HeartbeatWatchdogThreshold > 0 {
+		log.Debug().Dur("threshold", config.HeartbeatWatchdogThreshold).Msg("Starting heartbeat watchdog")
+		go _HeartbeatWatchdog()
+	}
+
 	log.Info().Msg("Elkbot is now running, press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
@@ -174,58 +622,209 @@ func main() {
 	}
 }
 
-func _IngestMessageArray(messages []*discordgo.Message) error {
+func _IngestMessageArray(messages []*discordgo.Message, stats *_IngestStats) error {
+	err := _IndexMessageBatch(_BuildIngestBatch(messages, stats), stats)
+	if err != nil {
+		return fmt.Errorf("error ingesting messages: %w", err)
+	}
+	return nil
+}
+
+// _BuildIngestBatch builds the bulk items for the messages that should be ingested, counting the ones that are skipped
+func _BuildIngestBatch(messages []*discordgo.Message, stats *_IngestStats) [][]_BulkItem {
+	batch := make([][]_BulkItem, 0, len(messages))
 	for _, historyMessage := range messages {
-		err := _IngestMessage(historyMessage)
-		if err != nil {
-			return err
+		if _IsBlocked(historyMessage.Author.ID) {
+			log.Debug().Str("message_id", historyMessage.ID).Msg("Skipping message from a user on the blocklist")
+			stats.SkippedBlocked++
+			continue
+		}
+		if _IsTooShort(historyMessage) {
+			stats.SkippedShort++
+			continue
+		}
+		batch = append(batch, _BuildBulkItems(historyMessage))
+		for _, attachment := range historyMessage.Attachments {
+			if !_IsAllowedAttachment(attachment) {
+				stats.SkippedAttachments++
+			}
 		}
 	}
-	return nil
+	return batch
 }
 
-func _IngestAllHandler(message *discordgo.MessageCreate, args struct{}) {
-	if message.Author.ID != "106162668032802816" {
-		log.Warn().Str("author_id", message.Author.ID).Msg("User does not have access to this command")
-		return
+// _IngestChannel ingests the backlog of messages from a channel, returning the statistics of the run
+func _IngestChannel(channelID string) (*_IngestStats, error) {
+	return _IngestChannelFrom(channelID, "", config.MaxIngestMessages)
+}
+
+// _IngestChannelFrom ingests the backlog of messages from a channel sent before a message, or the newest messages
+// if before is empty. After limit messages have been fetched the run stops, and the stats record the cursor
+// the next run should continue from. A limit of 0 ingests the whole backlog.
+func _IngestChannelFrom(channelID string, before string, limit int) (*_IngestStats, error) {
+	stats := &_IngestStats{}
+	if !_IsESAvailable() {
+		return stats, _ErrESUnavailable
+	}
+	if _IsExcludedChannel(channelID) {
+		return stats, _ErrChannelExcluded
+	}
+	err := _CheckReadHistoryPermissions(channelID)
+	if err != nil {
+		return stats, err
+	}
+
+	if _ShouldTuneRefresh(limit) {
+		paused, err := _PauseRefresh([]string{_ChannelWriteIndex("messages", channelID), _ChannelWriteIndex("attachments", channelID)})
+		if err != nil {
+			log.Warn().Err(err).Str("channel_id", channelID).Msg("Unable to disable refreshes, ingesting with them enabled")
+		} else {
+			defer func() {
+				err := _ResumeRefresh(paused)
+				if err != nil {
+					log.Error().Err(err).Str("channel_id", channelID).Msg("Error restoring refreshes after bulk ingest")
+				}
+			}()
+		}
+	}
+
+	indexer, err := _NewMessageIndexer(channelID, stats)
+	if err != nil {
+		return stats, err
 	}
 
+	started := time.Now()
+	fetched := 0
+	err = _PaginateMessages(channelID, before, func(messages []*discordgo.Message) error {
+		reachedLimit := false
+		if limit > 0 && fetched+len(messages) >= limit {
+			messages = messages[:limit-fetched]
+			reachedLimit = true
+		}
+		fetched += len(messages)
+
+		err := indexer.Add(_BuildIngestBatch(messages, stats))
+		if err != nil {
+			return fmt.Errorf("error ingesting messages: %w", err)
+		}
+		if reachedLimit {
+			stats.ResumeFrom = messages[len(messages)-1].ID
+			return _ErrIngestLimitReached
+		}
+		return nil
+	})
+	if errors.Is(err, _ErrIngestLimitReached) {
+		log.Info().Str("channel_id", channelID).Int("limit", limit).Str("resume_from", stats.ResumeFrom).Msg("Stopped ingesting at the message limit")
+		err = nil
+	}
+	// Whatever was queued before pagination stopped is still indexed, so that a failed run keeps the progress it made
+	closeErr := indexer.Close()
+	if err == nil && closeErr != nil {
+		err = fmt.Errorf("error ingesting messages: %w", closeErr)
+	}
+	if err == nil {
+		_RecordIngestThroughput(fetched, time.Since(started))
+	}
+
+	// Bulk requests don't refresh, so everything ingested is made searchable once at the end, even if the run failed
+	if stats.Indexed > 0 {
+		refreshErr := _RefreshIndex([]string{_ChannelWriteIndex("messages", channelID), _ChannelWriteIndex("attachments", channelID)})
+		if refreshErr != nil {
+			log.Warn().Err(refreshErr).Str("channel_id", channelID).Msg("Error refreshing indices after ingest")
+		}
+	}
+	return stats, err
+}
+
+func _IngestAllHandler(message *discordgo.MessageCreate, args struct{}) {
 	channels, err := session.GuildChannels(message.GuildID)
 	if err != nil {
 		log.Error().Err(err).Msg("Error fetching channels")
 	}
 
+	skipped := make([]string, 0)
 	for _, channel := range channels {
+		if !_IsIngestableChannelType(channel.Type) {
+			continue
+		}
+		if err := _CheckReadHistoryPermissions(channel.ID); err != nil {
+			log.Debug().Err(err).Str("channel_id", channel.ID).Msg("Skipping channel")
+			skipped = append(skipped, fmt.Sprintf("<#%s>", channel.ID))
+			continue
+		}
 		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Ingesting %s", channel.Name))
 
-		err := _PaginateMessages(channel.ID, _IngestMessageArray)
+		stats, err := _IngestChannel(channel.ID)
 
 		if err != nil {
 			log.Error().Err(err).Msg("Error ingesting messages")
 			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
 		} else {
-			session.ChannelMessageSend(message.ChannelID, "Channel messages successfully ingested.")
+			session.ChannelMessageSend(message.ChannelID, "Channel messages successfully ingested. "+stats.Summary())
+		}
+	}
+	if len(skipped) > 0 {
+		report := fmt.Sprintf("Skipped %d channels the bot can't read the history of: %s", len(skipped), strings.Join(skipped, ", "))
+		if len(report) > _MaxMessageLength {
+			report = fmt.Sprintf("Skipped %d channels the bot can't read the history of.", len(skipped))
 		}
+		session.ChannelMessageSend(message.ChannelID, report)
 	}
 	session.ChannelMessageSend(message.ChannelID, "All channels processed!")
 }
 
 type _IngestArgs struct {
 	ChannelID string `description:"ID of the channel to ingest logs from."`
+	Before    string `default:"" description:"Only ingest messages sent before this message ID, to continue an earlier run."`
+	Limit     int    `default:"0" description:"Stop after this many messages. Defaults to MAX_INGEST_MESSAGES."`
 }
 
 func _IngestHandler(message *discordgo.MessageCreate, args _IngestArgs) {
-	if message.Author.ID != "106162668032802816" {
-		log.Warn().Str("author_id", message.Author.ID).Msg("User does not have access to this command")
-		return
+	if args.Limit <= 0 {
+		args.Limit = config.MaxIngestMessages
 	}
-
-	err := _PaginateMessages(args.ChannelID, _IngestMessageArray)
+	stats, err := _IngestChannelFrom(args.ChannelID, args.Before, args.Limit)
 
 	if err != nil {
 		log.Error().Err(err).Msg("Error ingesting messages")
 		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
 	} else {
-		session.ChannelMessageSend(message.ChannelID, "Channel messages successfully ingested.")
+		session.ChannelMessageSend(message.ChannelID, "Channel messages successfully ingested. "+stats.Summary())
+	}
+}
+
+type _IngestManyArgs struct {
+	Channels string `description:"Mentions or IDs of the channels to ingest logs from, separated by spaces."`
+}
+
+// _IngestManyHandler ingests each of a list of channels in turn.
+// The parser only supports a fixed set of arguments, so the channel list is read from the message content instead.
+func _IngestManyHandler(message *discordgo.MessageCreate, args _IngestManyArgs) {
+	inputs := strings.Fields(message.Content)[1:]
+
+	seen := make(map[string]bool, len(inputs))
+	channels := make([]*discordgo.Channel, 0, len(inputs))
+	for _, input := range inputs {
+		channel, err := _ResolveGuildChannel(input, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Skipping %s: %s", input, err.Error()))
+			continue
+		}
+		if seen[channel.ID] {
+			continue
+		}
+		seen[channel.ID] = true
+		channels = append(channels, channel)
+	}
+
+	for _, channel := range channels {
+		stats, err := _IngestChannel(channel.ID)
+		if err != nil {
+			log.Error().Err(err).Str("channel_id", channel.ID).Msg("Error ingesting messages")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error ingesting <#%s>:\n```\n%s\n```", channel.ID, err.Error()))
+			continue
+		}
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("<#%s> successfully ingested. %s", channel.ID, stats.Summary()))
 	}
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Finished ingesting %d channels.", len(channels)))
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxEmojiUsageResults = 25
+
+var _EmojiReferencePattern = regexp.MustCompile(`<a?:\w+:(\d+)>`)
+
+// _UsedEmojiIDs returns the IDs of the custom emojis referenced in a message's content, without duplicates
+func _UsedEmojiIDs(content string) []string {
+	emojiIDs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, matches := range _EmojiReferencePattern.FindAllStringSubmatch(content, -1) {
+		if seen[matches[1]] {
+			continue
+		}
+		seen[matches[1]] = true
+		emojiIDs = append(emojiIDs, matches[1])
+	}
+	return emojiIDs
+}
+
+// _EmojiDisplay renders a custom emoji so that it shows up in a message, falling back to its ID for emojis
+// the bot can't see, such as those from other guilds
+func _EmojiDisplay(guildID string, emojiID string) string {
+	emoji, err := session.State.Emoji(guildID, emojiID)
+	if err != nil {
+		return fmt.Sprintf("`%s`", emojiID)
+	}
+	return emoji.MessageFormat()
+}
+
+type _EmojiUsageArgs struct {
+	Channel string `default:"" description:"Only count emojis used in this channel."`
+	Limit   int    `default:"10" description:"Number of emojis to show."`
+}
+
+func _EmojiUsageHandler(message *discordgo.MessageCreate, args _EmojiUsageArgs) {
+	if args.Limit < 1 || args.Limit > _MaxEmojiUsageResults {
+		args.Limit = _MaxEmojiUsageResults
+	}
+
+	index := _GuildReadIndex("messages", message.GuildID)
+	title := "Most used emojis"
+	var routing []string
+	var filter map[string]interface{}
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		index = _ChannelReadIndex("messages", channel.ID)
+		title = fmt.Sprintf("Most used emojis in #%s", channel.Name)
+		routing = _ChannelRouting(channel.ID)
+		filter = map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+	} else {
+		var err error
+		filter, err = _GuildChannelFilter(message.GuildID, "")
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+
+	resp, err := _SearchRouted([]string{index}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": []interface{}{filter, _NotDeletedFilter}},
+		},
+		"aggs": map[string]interface{}{
+			"emojis": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "used_emoji_ids", "size": args.Limit},
+			},
+		},
+	}, routing)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating emoji usage")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var emojis _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["emojis"], &emojis)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding emoji aggregation")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(title)
+	embed.Footer = _EmbedFooter("Counts the messages each custom emoji was used in")
+	if len(emojis.Buckets) == 0 {
+		embed.Description = "No custom emojis found."
+	}
+	for index, bucket := range emojis.Buckets {
+		embed.Description += fmt.Sprintf("%d. %s - %d messages\n", index+1, _EmojiDisplay(message.GuildID, fmt.Sprint(bucket.Key)), bucket.DocCount)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
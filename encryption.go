@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// With content encryption, message content is encrypted with AES-256-GCM before it is indexed, so that anyone with
+// access to Elasticsearch but not the key can't read it. This limits what Elkbot can do with the content:
+//   - Full-text, phrase and raw searches are impossible. Searches only match messages whose whole content equals
+//     the query, by comparing keyed hashes of the content.
+//   - Word clouds, trending words and language detection analyze the ciphertext, so their results are meaningless.
+//   - Enrichers that derive fields from the content, such as links, word counts and sentiment, are skipped, as their
+//     fields would reveal part of the content.
+// Message lengths, authors, timestamps, reactions, poll questions and channel details are still stored in plain text.
+// Messages indexed before enabling encryption aren't encrypted until they are re-ingested, and losing the key makes
+// encrypted content unreadable.
+
+const _EncryptedContentPrefix = "enc:v1:"
+
+// Fields of a message document that hold message content and must be encrypted
+var _EncryptedFields = []string{"content", "original_content", "content_searchable", "reply_to_snippet"}
+
+var _ContentAEAD cipher.AEAD
+var _ContentHashKey []byte
+var _ContentEncryptionOnce sync.Once
+var _ContentEncryptionErr error
+
+// _LoadContentEncryption prepares the cipher used to encrypt message content from the configured key
+func _LoadContentEncryption() error {
+	_ContentEncryptionOnce.Do(func() {
+		key, err := base64.StdEncoding.DecodeString(config.ContentEncryptionKey)
+		if err != nil {
+			_ContentEncryptionErr = fmt.Errorf("error decoding content encryption key: %w", err)
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			_ContentEncryptionErr = fmt.Errorf("error creating content cipher: %w", err)
+			return
+		}
+		_ContentAEAD, err = cipher.NewGCM(block)
+		if err != nil {
+			_ContentEncryptionErr = fmt.Errorf("error creating content cipher: %w", err)
+			return
+		}
+
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("elkbot content hash"))
+		_ContentHashKey = mac.Sum(nil)
+	})
+	return _ContentEncryptionErr
+}
+
+// _EncryptContent encrypts message content, returning an empty string rather than the plaintext if that fails
+func _EncryptContent(plaintext string) string {
+	if _LoadContentEncryption() != nil {
+		return ""
+	}
+	nonce := make([]byte, _ContentAEAD.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		log.Error().Err(err).Msg("Error generating nonce, dropping message content")
+		return ""
+	}
+	sealed := _ContentAEAD.Seal(nonce, nonce, []byte(plaintext), nil)
+	return _EncryptedContentPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// _DecryptContent decrypts content stored by _EncryptContent. Content that was never encrypted is returned unchanged.
+func _DecryptContent(stored string) string {
+	if !strings.HasPrefix(stored, _EncryptedContentPrefix) {
+		return stored
+	}
+	if _LoadContentEncryption() != nil {
+		return "[encrypted]"
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, _EncryptedContentPrefix))
+	if err != nil || len(sealed) < _ContentAEAD.NonceSize() {
+		return "[encrypted]"
+	}
+	nonceSize := _ContentAEAD.NonceSize()
+	plaintext, err := _ContentAEAD.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		log.Debug().Err(err).Msg("Unable to decrypt message content")
+		return "[encrypted]"
+	}
+	return string(plaintext)
+}
+
+// _ContentHash returns a keyed hash of message content, which lets encrypted messages be matched exactly
+func _ContentHash(content string) string {
+	if _LoadContentEncryption() != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, _ContentHashKey)
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// _EncryptDocumentContent replaces the content fields of a message document with their encrypted form, if enabled
+func _EncryptDocumentContent(document map[string]interface{}) {
+	if !config.EncryptContent {
+		return
+	}
+	if content, ok := document["content"].(string); ok {
+		document["content_hash"] = _ContentHash(content)
+	}
+	for _, field := range _EncryptedFields {
+		if value, ok := document[field].(string); ok {
+			document[field] = _EncryptContent(value)
+		}
+	}
+	delete(document, "urls")
+	delete(document, "domains")
+}
+
+// _EncryptedSearchQuery matches messages whose whole content equals the query, whether or not they were encrypted
+func _EncryptedSearchQuery(query string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"content_hash": _ContentHash(query)}},
+				map[string]interface{}{"term": map[string]interface{}{"content.keyword": query}},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
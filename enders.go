@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxEnderResults = 25
+
+type _EnderCount struct {
+	AuthorID string
+	Count    int
+}
+
+// _ConversationEnders counts, for each author, how many of their messages in a channel were followed by at least gap of silence.
+// The newest message in the channel is never counted, as the conversation it belongs to may still be ongoing.
+func _ConversationEnders(channelID string, gap time.Duration) ([]_EnderCount, int, error) {
+	counts := make(map[string]int)
+	total := 0
+
+	var previous *_MessageDocument
+	err := _ScanAllRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"_source": []string{"author_id", "timestamp"},
+		"sort":    []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _MessageDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding message document: %w", err)
+			}
+
+			if previous != nil && document.Timestamp.Sub(previous.Timestamp) >= gap {
+				counts[previous.AuthorID]++
+				total++
+			}
+			previous = &document
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	enders := make([]_EnderCount, 0, len(counts))
+	for authorID, count := range counts {
+		enders = append(enders, _EnderCount{AuthorID: authorID, Count: count})
+	}
+	sort.Slice(enders, func(i, j int) bool {
+		if enders[i].Count == enders[j].Count {
+			return enders[i].AuthorID < enders[j].AuthorID
+		}
+		return enders[i].Count > enders[j].Count
+	})
+
+	return enders, total, nil
+}
+
+type _EndersArgs struct {
+	Channel string `description:"Channel to find conversation enders in."`
+	Gap     int    `default:"30" description:"Minutes without a message after which a conversation is considered over."`
+	Limit   int    `default:"10" description:"Number of authors to show."`
+}
+
+func _EndersHandler(message *discordgo.MessageCreate, args _EndersArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Gap < 1 {
+		args.Gap = 1
+	}
+	if args.Limit < 1 || args.Limit > _MaxEnderResults {
+		args.Limit = _MaxEnderResults
+	}
+
+	enders, total, err := _ConversationEnders(channel.ID, time.Duration(args.Gap)*time.Minute)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding conversation enders")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if len(enders) > args.Limit {
+		enders = enders[:args.Limit]
+	}
+
+	lines := make([]string, 0, len(enders))
+	for index, ender := range enders {
+		lines = append(lines, fmt.Sprintf("%d. <@%s> - %d conversations", index+1, ender.AuthorID, ender.Count))
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Conversation enders in #%s", channel.Name))
+	embed.Description = strings.Join(lines, "\n")
+	embed.Footer = _EmbedFooter(fmt.Sprintf("%d conversations ended by %d minutes of silence", total, args.Gap))
+	if len(lines) == 0 {
+		embed.Description = "No conversations found."
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Enrichers add computed fields to message documents before they are indexed. They run in the order given by the
+// ENRICHERS setting, after the document has been built but before its content is encrypted, so they see the same
+// normalized and truncated content that is stored. Adding a field only takes writing an enricher and adding it to
+// _Enrichers, along with mapping the new field. Enrichers listed in _ContentEnrichers derive their fields from the
+// plaintext content, so they are skipped when content encryption is enabled rather than storing those fields in the clear.
+
+// _Enricher adds fields to the document being built for a message
+type _Enricher func(message *discordgo.Message, document map[string]interface{})
+
+var _Enrichers = map[string]_Enricher{
+	"links":      _AddLinkFields,
+	"word_count": _AddWordCountField,
+	"sentiment":  _AddSentimentField,
+}
+
+// _ContentEnrichers are the enrichers whose fields reveal information about the content of a message
+var _ContentEnrichers = map[string]bool{
+	"links":      true,
+	"word_count": true,
+	"sentiment":  true,
+}
+
+// _ApplyEnrichers runs every configured enricher against a document. An enricher that panics is skipped,
+// so that a bug in one enricher doesn't stop messages from being ingested.
+func _ApplyEnrichers(message *discordgo.Message, document map[string]interface{}) {
+	for _, name := range config.Enrichers {
+		enricher, ok := _Enrichers[name]
+		if !ok || (config.EncryptContent && _ContentEnrichers[name]) {
+			continue
+		}
+		func() {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					log.Error().Interface("panic", recovered).Str("enricher", name).Str("message_id", message.ID).Msg("Enricher panicked")
+				}
+			}()
+			enricher(message, document)
+		}()
+	}
+}
+
+// _AddWordCountField stores the number of words in a message's content
+func _AddWordCountField(_ *discordgo.Message, document map[string]interface{}) {
+	content, ok := document["content"].(string)
+	if !ok {
+		return
+	}
+	document["word_count"] = len(strings.Fields(content))
+}
+
+// A deliberately small word list. This is a placeholder until a real sentiment model is available, and only gives a rough
+// indication of tone for English messages.
+var _SentimentWords = map[string]int{
+	"love": 1, "great": 1, "good": 1, "awesome": 1, "thanks": 1, "thank": 1, "nice": 1, "happy": 1, "cool": 1, "lol": 1,
+	"hate": -1, "bad": -1, "awful": -1, "terrible": -1, "sad": -1, "angry": -1, "worst": -1, "broken": -1, "annoying": -1, "ugh": -1,
+}
+
+// _AddSentimentField stores a score from -1 for negative to 1 for positive, based on the sentiment words a message contains.
+// Messages without any sentiment words are scored 0, so that they can be told apart from messages that were never scored.
+func _AddSentimentField(_ *discordgo.Message, document map[string]interface{}) {
+	content, ok := document["content"].(string)
+	if !ok {
+		return
+	}
+
+	score, matched := 0, 0
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		if value, ok := _SentimentWords[word]; ok {
+			score += value
+			matched++
+		}
+	}
+	document["sentiment_score"] = 0.0
+	if matched > 0 {
+		document["sentiment_score"] = float64(score) / float64(matched)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestApplyEnrichers(t *testing.T) {
+	tests := []struct {
+		name      string
+		encrypted bool
+		want      []string
+	}{
+		{"plaintext", false, []string{"urls", "domains", "word_count", "sentiment_score"}},
+		{"encrypted", true, []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *Config) {
+				cfg.Enrichers = []string{"links", "word_count", "sentiment"}
+				cfg.EncryptContent = test.encrypted
+			})
+
+			document := map[string]interface{}{"content": "what a great day, see https://example.com"}
+			_ApplyEnrichers(&discordgo.Message{ID: "1"}, document)
+
+			for _, field := range test.want {
+				if _, ok := document[field]; !ok {
+					t.Errorf("got document %v, want field %s", document, field)
+				}
+			}
+			if len(document) != len(test.want)+1 {
+				t.Errorf("got document %v, want only the content and %v", document, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// _NewESClient creates an Elasticsearch client configured from the environment.
+// Requests are balanced across every configured node, and retried against another node when one fails or is unavailable.
+// Without any configured nodes, the client falls back to the ELASTICSEARCH_URL environment variable.
+// If transport is non-nil, all requests are sent through it instead of the default HTTP transport,
+// allowing Elasticsearch to be substituted without a live cluster.
+// When a maximum concurrency is configured, requests beyond it wait for a running request to finish.
+// Requests only go through the configured HTTP proxy if proxying Elasticsearch is enabled.
+func _NewESClient(transport http.RoundTripper) (*elasticsearch.Client, error) {
+	if transport == nil && config.ProxyElasticsearch {
+		transport = _ProxiedTransport()
+	}
+	if config.MaxESConcurrency > 0 {
+		transport = _NewLimitedTransport(transport, config.MaxESConcurrency)
+	}
+	return elasticsearch.NewClient(elasticsearch.Config{
+		Addresses:            config.ElasticsearchURLs,
+		Transport:            transport,
+		RetryOnStatus:        []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		EnableRetryOnTimeout: true,
+		MaxRetries:           config.ESMaxRetries,
+		DiscoverNodesOnStart: config.ESDiscoverNodes,
+	})
+}
+
+// _CheckESReachable returns an error if none of the configured Elasticsearch nodes respond
+func _CheckESReachable() error {
+	resp, err := esClient.Ping()
+	if err != nil {
+		return fmt.Errorf("unable to reach any Elasticsearch node: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+const _ScanPageSize = 1000
+const _ScanKeepAlive = time.Minute
+
+// _SearchHit represents an individual hit returned from an Elasticsearch search
+type _SearchHit struct {
+	Index   string          `json:"_index"`
+	ID      string          `json:"_id"`
+	Score   float64         `json:"_score"`
+	Version int64           `json:"_version"`
+	Source  json.RawMessage `json:"_source"`
+	Sort    []interface{}   `json:"sort"`
+}
+
+// _SearchResponse represents the parts of an Elasticsearch search response that Elkbot uses
+type _SearchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Took     int    `json:"took"`
+	Shards   struct {
+		Total int `json:"total"`
+	} `json:"_shards"`
+	Hits struct {
+		Total struct {
+			Value int `json:"value"`
+		} `json:"total"`
+		Hits []_SearchHit `json:"hits"`
+	} `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+}
+
+// _ResponseError is returned when Elasticsearch responds with an error status code
+type _ResponseError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err *_ResponseError) Error() string {
+	return fmt.Sprintf("got status code %s", err.Status)
+}
+
+func _DecodeResponse(resp *esapi.Response, result interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return &_ResponseError{StatusCode: resp.StatusCode, Status: resp.Status()}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err := json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("error decoding elasticsearch response: %w", err)
+	}
+
+	return nil
+}
+
+// _Search runs a search request with the given body against a set of indices
+func _Search(indices []string, body map[string]interface{}) (*_SearchResponse, error) {
+	return _SearchRouted(indices, body, nil)
+}
+
+// _SearchRouted runs a search request that only queries the shards the given routing values map to.
+// A nil routing queries every shard.
+func _SearchRouted(indices []string, body map[string]interface{}, routing []string) (*_SearchResponse, error) {
+	reqBody, _ := json.Marshal(body)
+
+	req := esapi.SearchRequest{
+		Index:   indices,
+		Body:    bytes.NewReader(reqBody),
+		Routing: routing,
+	}
+
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var searchResp _SearchResponse
+	err = _DecodeResponse(resp, &searchResp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &searchResp, nil
+}
+
+// _Count returns the number of documents matching a query
+func _Count(indices []string, query map[string]interface{}) (int, error) {
+	return _CountRouted(indices, query, nil)
+}
+
+// _CountRouted returns the number of documents matching a query on the shards the given routing values map to
+func _CountRouted(indices []string, query map[string]interface{}, routing []string) (int, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"query": query,
+	})
+
+	req := esapi.CountRequest{
+		Index:   indices,
+		Body:    bytes.NewReader(reqBody),
+		Routing: routing,
+	}
+
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return 0, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var countResp struct {
+		Count int `json:"count"`
+	}
+	err = _DecodeResponse(resp, &countResp)
+	if err != nil {
+		return 0, err
+	}
+
+	return countResp.Count, nil
+}
+
+// _DeleteByQuery deletes all documents matching a query, returning the number of documents deleted
+func _DeleteByQuery(indices []string, query map[string]interface{}) (int, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"query": query,
+	})
+
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index:   indices,
+		Body:    bytes.NewReader(reqBody),
+		Refresh: &refresh,
+	}
+
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return 0, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var deleteResp struct {
+		Deleted int `json:"deleted"`
+	}
+	err = _DecodeResponse(resp, &deleteResp)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleteResp.Deleted, nil
+}
+
+// _UpdateByQuery runs a painless script against all documents matching a query, returning the number of documents updated.
+// A positive requestsPerSecond throttles the update to avoid overloading the cluster.
+func _UpdateByQuery(indices []string, query map[string]interface{}, script string, params map[string]interface{}, requestsPerSecond int) (int, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"query": query,
+		"script": map[string]interface{}{
+			"source": script,
+			"lang":   "painless",
+			"params": params,
+		},
+	})
+
+	refresh := true
+	conflicts := "proceed"
+	req := esapi.UpdateByQueryRequest{
+		Index:     indices,
+		Body:      bytes.NewReader(reqBody),
+		Refresh:   &refresh,
+		Conflicts: conflicts,
+	}
+	if requestsPerSecond > 0 {
+		req.RequestsPerSecond = &requestsPerSecond
+	}
+
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return 0, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var updateResp struct {
+		Updated int `json:"updated"`
+	}
+	err = _DecodeResponse(resp, &updateResp)
+	if err != nil {
+		return 0, err
+	}
+
+	return updateResp.Updated, nil
+}
+
+// _ScanAll walks every document matching a query using the scroll API, calling callback with each page of hits
+func _ScanAll(indices []string, body map[string]interface{}, callback func([]_SearchHit) error) error {
+	return _ScanAllRouted(indices, body, nil, callback)
+}
+
+// _ScanAllRouted walks every document matching a query on the shards the given routing values map to
+func _ScanAllRouted(indices []string, body map[string]interface{}, routing []string, callback func([]_SearchHit) error) error {
+	if _, ok := body["size"]; !ok {
+		body["size"] = _ScanPageSize
+	}
+	if _, ok := body["sort"]; !ok {
+		body["sort"] = []string{"_doc"}
+	}
+	reqBody, _ := json.Marshal(body)
+
+	req := esapi.SearchRequest{
+		Index:   indices,
+		Body:    bytes.NewReader(reqBody),
+		Scroll:  _ScanKeepAlive,
+		Routing: routing,
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var searchResp _SearchResponse
+	err = _DecodeResponse(resp, &searchResp)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if searchResp.ScrollID == "" {
+			return
+		}
+		clearReq := esapi.ClearScrollRequest{
+			ScrollID: []string{searchResp.ScrollID},
+		}
+		clearResp, err := clearReq.Do(context.Background(), esClient)
+		if err == nil {
+			clearResp.Body.Close()
+		}
+	}()
+
+	for len(searchResp.Hits.Hits) > 0 {
+		err = callback(searchResp.Hits.Hits)
+		if err != nil {
+			return fmt.Errorf("error when processing hits: %w", err)
+		}
+
+		scrollReq := esapi.ScrollRequest{
+			ScrollID: searchResp.ScrollID,
+			Scroll:   _ScanKeepAlive,
+		}
+		resp, err = scrollReq.Do(context.Background(), esClient)
+		if err != nil {
+			return fmt.Errorf("error making elasticsearch request: %w", err)
+		}
+
+		searchResp = _SearchResponse{ScrollID: searchResp.ScrollID}
+		err = _DecodeResponse(resp, &searchResp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// testRequest is a request received by the mock Elasticsearch transport, with its body read in full
+type testRequest struct {
+	Method string
+	Path   string
+	Query  map[string]string
+	Body   []byte
+}
+
+// BulkLines decodes each line of an NDJSON request body
+func (req testRequest) BulkLines(t *testing.T) []map[string]interface{} {
+	t.Helper()
+	lines := make([]map[string]interface{}, 0)
+	for _, line := range bytes.Split(bytes.TrimSpace(req.Body), []byte("\n")) {
+		var decoded map[string]interface{}
+		err := json.Unmarshal(line, &decoded)
+		if err != nil {
+			t.Fatalf("error decoding bulk line %q: %s", line, err)
+		}
+		lines = append(lines, decoded)
+	}
+	return lines
+}
+
+// testResponder returns the status code and body the mock transport should respond to a request with
+type testResponder func(req testRequest) (int, string)
+
+// testTransport is an http.RoundTripper that answers every request with a responder instead of a live cluster,
+// recording the requests it receives
+type testTransport struct {
+	responder testResponder
+
+	lock     sync.Mutex
+	requests []testRequest
+}
+
+func (transport *testTransport) RoundTrip(httpReq *http.Request) (*http.Response, error) {
+	req := testRequest{Method: httpReq.Method, Path: httpReq.URL.Path, Query: map[string]string{}}
+	for key := range httpReq.URL.Query() {
+		req.Query[key] = httpReq.URL.Query().Get(key)
+	}
+	if httpReq.Body != nil {
+		body, err := ioutil.ReadAll(httpReq.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	transport.lock.Lock()
+	transport.requests = append(transport.requests, req)
+	transport.lock.Unlock()
+
+	status, body := transport.responder(req)
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    httpReq,
+	}, nil
+}
+
+// Requests returns the requests received so far
+func (transport *testTransport) Requests() []testRequest {
+	transport.lock.Lock()
+	defer transport.lock.Unlock()
+	return append([]testRequest{}, transport.requests...)
+}
+
+// newTestClient points the Elasticsearch client at a mock transport for the duration of a test
+func newTestClient(t *testing.T, responder testResponder) *testTransport {
+	t.Helper()
+	transport := &testTransport{responder: responder}
+	client, err := _NewESClient(transport)
+	if err != nil {
+		t.Fatalf("error creating client: %s", err)
+	}
+
+	previous := esClient
+	esClient = client
+	t.Cleanup(func() { esClient = previous })
+	return transport
+}
+
+// setTestSession replaces the Discord session for the duration of a test with one whose state holds guild 1 and its
+// text channel 7, so that lookups are answered from the state instead of Discord
+func setTestSession(t *testing.T) *discordgo.Session {
+	t.Helper()
+	testSession, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatalf("error creating session: %s", err)
+	}
+	testSession.State.User = &discordgo.User{ID: "100"}
+	err = testSession.State.GuildAdd(&discordgo.Guild{
+		ID:       "1",
+		Channels: []*discordgo.Channel{{ID: "7", GuildID: "1", Name: "general", Type: discordgo.ChannelTypeGuildText}},
+	})
+	if err != nil {
+		t.Fatalf("error adding guild to state: %s", err)
+	}
+
+	previous := session
+	session = testSession
+	t.Cleanup(func() { session = previous })
+	return testSession
+}
+
+// newTestDiscordAPI answers the Discord API requests of a test session with a responder instead of Discord
+func newTestDiscordAPI(testSession *discordgo.Session, responder testResponder) *testTransport {
+	transport := &testTransport{responder: responder}
+	testSession.Client = &http.Client{Transport: transport}
+	testSession.MaxRestRetries = 0
+	return transport
+}
+
+// setTestConfig changes the config for the duration of a test
+func setTestConfig(t *testing.T, change func(cfg *Config)) {
+	t.Helper()
+	previous := config
+	change(&config)
+	t.Cleanup(func() { config = previous })
+}
+
+func TestInsertIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"created", http.StatusCreated, false},
+		{"updated", http.StatusOK, false},
+		{"newer version indexed", http.StatusConflict, false},
+		{"rejected", http.StatusBadRequest, true},
+		{"unavailable", http.StatusInternalServerError, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := newTestClient(t, func(req testRequest) (int, string) {
+				return test.status, `{}`
+			})
+
+			err := _InsertIndex(map[string]interface{}{"content": "hello"}, "messages", "123", 1000, "456")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+
+			requests := transport.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(requests))
+			}
+			req := requests[0]
+			if req.Method != http.MethodPut || req.Path != "/messages/_doc/123" {
+				t.Errorf("got %s %s, want PUT /messages/_doc/123", req.Method, req.Path)
+			}
+			for key, want := range map[string]string{"version": "1000", "version_type": "external_gte", "routing": "456", "op_type": "index"} {
+				if req.Query[key] != want {
+					t.Errorf("got %s=%q, want %q", key, req.Query[key], want)
+				}
+			}
+			var body map[string]interface{}
+			json.Unmarshal(req.Body, &body)
+			if body["content"] != "hello" {
+				t.Errorf("got body %s, want the document", req.Body)
+			}
+		})
+	}
+}
+
+func TestBulkBatching(t *testing.T) {
+	previousDelay := _BulkRetryDelay
+	_BulkRetryDelay = 0
+	t.Cleanup(func() { _BulkRetryDelay = previousDelay })
+
+	attempts := 0
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		if req.Path != "/_bulk" {
+			return http.StatusOK, `{"errors": false, "items": []}`
+		}
+		attempts++
+		if attempts == 1 {
+			return http.StatusOK, `{"errors": true, "items": [
+				{"index": {"_index": "messages", "_id": "1", "status": 201}},
+				{"index": {"_index": "messages", "_id": "2", "status": 429, "error": {"type": "es_rejected_execution_exception", "reason": "busy"}}},
+				{"index": {"_index": "messages", "_id": "3", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "bad"}}}
+			]}`
+		}
+		return http.StatusOK, `{"errors": false, "items": [{"index": {"_index": "messages", "_id": "2", "status": 201}}]}`
+	})
+
+	items := []_BulkItem{
+		{Index: "messages", DocumentID: "1", Version: 10, Routing: "a", Body: map[string]interface{}{"content": "one"}},
+		{Index: "messages", DocumentID: "2", Version: 20, Body: map[string]interface{}{"content": "two"}},
+		{Index: "messages", DocumentID: "3", Version: 30, Body: map[string]interface{}{"content": "three"}},
+	}
+	failed, err := _BulkIndex(items)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(failed) != 1 || failed[0].Item.DocumentID != "3" || failed[0].Reason != "mapper_parsing_exception: bad" {
+		t.Fatalf("got failures %+v, want only document 3", failed)
+	}
+
+	requests := transport.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	first := requests[0].BulkLines(t)
+	if len(first) != 6 {
+		t.Fatalf("got %d lines in the first request, want an action and document for each item", len(first))
+	}
+	action := first[0]["index"].(map[string]interface{})
+	if action["_id"] != "1" || action["version"] != float64(10) || action["version_type"] != "external_gte" || action["routing"] != "a" {
+		t.Errorf("got action %v", action)
+	}
+	if first[1]["content"] != "one" {
+		t.Errorf("got document %v, want the first item's body", first[1])
+	}
+
+	retried := requests[1].BulkLines(t)
+	if len(retried) != 2 || retried[0]["index"].(map[string]interface{})["_id"] != "2" {
+		t.Errorf("got retried lines %v, want only the rejected item", retried)
+	}
+}
+
+func TestBulkRequestError(t *testing.T) {
+	previousDelay := _BulkRetryDelay
+	_BulkRetryDelay = 0
+	t.Cleanup(func() { _BulkRetryDelay = previousDelay })
+
+	newTestClient(t, func(req testRequest) (int, string) {
+		return http.StatusUnauthorized, `{}`
+	})
+
+	items := []_BulkItem{{Index: "messages", DocumentID: "1", Version: 10, Body: map[string]interface{}{}}}
+	failed, err := _BulkIndex(items)
+	if err == nil {
+		t.Fatal("got no error, want the request's status")
+	}
+	if len(failed) != 1 {
+		t.Errorf("got %d failures, want the item to be failed once retries are exhausted", len(failed))
+	}
+}
+
+func TestResponseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus int
+		wantErr    bool
+	}{
+		{"success", http.StatusOK, `{"hits": {"total": {"value": 1}, "hits": [{"_id": "1"}]}}`, 0, false},
+		{"not found", http.StatusNotFound, `{}`, http.StatusNotFound, true},
+		{"bad request", http.StatusBadRequest, `{}`, http.StatusBadRequest, true},
+		{"invalid body", http.StatusOK, `not json`, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := newTestClient(t, func(req testRequest) (int, string) {
+				return test.status, test.body
+			})
+
+			resp, err := _SearchRouted([]string{"messages"}, map[string]interface{}{"size": 1}, []string{"7"})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			var responseErr *_ResponseError
+			if errors.As(err, &responseErr) != (test.wantStatus != 0) {
+				t.Fatalf("got error %v, want a response error %t", err, test.wantStatus != 0)
+			}
+			if responseErr != nil && responseErr.StatusCode != test.wantStatus {
+				t.Errorf("got status %d, want %d", responseErr.StatusCode, test.wantStatus)
+			}
+			if err == nil && len(resp.Hits.Hits) != 1 {
+				t.Errorf("got %d hits, want 1", len(resp.Hits.Hits))
+			}
+
+			req := transport.Requests()[0]
+			if req.Path != "/messages/_search" || req.Query["routing"] != "7" {
+				t.Errorf("got %s?routing=%s, want /messages/_search?routing=7", req.Path, req.Query["routing"])
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord doesn't report how many messages a channel has, so estimates sample the channel's first and latest messages
+// and assume the posting rate moved evenly between the two over the channel's lifetime.
+// Ingest duration is based on the throughput of earlier ingest runs since startup, falling back to a conservative
+// guess when nothing has been ingested yet.
+
+const _EstimateSampleSize = 100
+
+// Assumed ingest throughput in messages per second before any ingest run has been measured
+const _DefaultIngestThroughput = 100.0
+
+// Ingest runs shorter than this are too dominated by fixed overheads to measure throughput with
+const _MinMeasuredIngestDuration = 10 * time.Second
+
+var _MeasuredIngestMessages int
+var _MeasuredIngestDuration time.Duration
+var _MeasuredIngestLock sync.Mutex
+
+// _RecordIngestThroughput records how long an ingest run took to fetch and index a number of messages
+func _RecordIngestThroughput(messages int, duration time.Duration) {
+	if messages == 0 || duration < _MinMeasuredIngestDuration {
+		return
+	}
+	_MeasuredIngestLock.Lock()
+	defer _MeasuredIngestLock.Unlock()
+
+	_MeasuredIngestMessages += messages
+	_MeasuredIngestDuration += duration
+}
+
+// _IngestThroughput returns the average ingest throughput in messages per second, and whether it was measured
+func _IngestThroughput() (float64, bool) {
+	_MeasuredIngestLock.Lock()
+	defer _MeasuredIngestLock.Unlock()
+
+	if _MeasuredIngestMessages == 0 {
+		return _DefaultIngestThroughput, false
+	}
+	return float64(_MeasuredIngestMessages) / _MeasuredIngestDuration.Seconds(), true
+}
+
+// _SampleRate returns the rate messages were posted at across a page of messages, in messages per second
+func _SampleRate(messages []*discordgo.Message) float64 {
+	if len(messages) < 2 {
+		return 0
+	}
+	newest, oldest := messages[0].Timestamp, messages[len(messages)-1].Timestamp
+	if newest.Before(oldest) {
+		newest, oldest = oldest, newest
+	}
+	span := newest.Sub(oldest).Seconds()
+	if span <= 0 {
+		return 0
+	}
+	return float64(len(messages)-1) / span
+}
+
+// _EstimateMessageCount estimates how many messages a channel contains, returning an exact count for small channels
+func _EstimateMessageCount(channelID string) (int, bool, error) {
+	latest, err := _ChannelMessages(channelID, _EstimateSampleSize, "", "")
+	if err != nil {
+		return 0, false, err
+	}
+	if len(latest) < _EstimateSampleSize {
+		return len(latest), true, nil
+	}
+
+	first, err := _ChannelMessages(channelID, _EstimateSampleSize, "", "0")
+	if err != nil {
+		return 0, false, err
+	}
+
+	created, err := discordgo.SnowflakeTimestamp(channelID)
+	if err != nil {
+		return 0, false, fmt.Errorf("error determining channel creation date: %w", err)
+	}
+	lifetime := latest[0].Timestamp.Sub(created).Seconds()
+	if firstMessage := first[len(first)-1].Timestamp; firstMessage.After(created) {
+		lifetime = latest[0].Timestamp.Sub(firstMessage).Seconds()
+	}
+
+	rate := (_SampleRate(first) + _SampleRate(latest)) / 2
+	estimate := int(rate * lifetime)
+	if estimate < 2*_EstimateSampleSize {
+		estimate = 2 * _EstimateSampleSize
+	}
+	return estimate, false, nil
+}
+
+type _EstimateArgs struct {
+	Channel string `description:"Channel to estimate the ingest duration of."`
+}
+
+func _EstimateHandler(message *discordgo.MessageCreate, args _EstimateArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	err = _CheckReadHistoryPermissions(channel.ID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	count, exact, err := _EstimateMessageCount(channel.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error sampling channel messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if config.MaxIngestMessages > 0 && count > config.MaxIngestMessages {
+		count = config.MaxIngestMessages
+	}
+
+	throughput, measured := _IngestThroughput()
+	duration := time.Duration(float64(count) / throughput * float64(time.Second)).Round(time.Second)
+
+	countDescription := fmt.Sprintf("about %d messages", count)
+	if exact {
+		countDescription = fmt.Sprintf("%d messages", count)
+	}
+	throughputDescription := fmt.Sprintf("an assumed %.0f messages per second, as nothing has been ingested since startup", throughput)
+	if measured {
+		throughputDescription = fmt.Sprintf("a measured %.0f messages per second", throughput)
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Ingest estimate for #%s", channel.Name))
+	embed.Description = fmt.Sprintf(
+		"Ingesting this channel would index %s and take roughly %s, based on %s.",
+		countDescription, duration, throughputDescription,
+	)
+	embed.Footer = _EmbedFooter("This is an estimate from sampling the channel's first and latest messages, and may be far off for channels with uneven activity.")
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Moderation events such as bans, members leaving and deleted messages are stored in their own index, separately from
+// messages, so that they can be searched as a moderation history. Ingesting them is toggled independently of
+// message ingestion, and needs the privileged server members intent for member events.
+
+const _EventsIndex = "events"
+
+const _EventBanAdd = "ban_add"
+const _EventBanRemove = "ban_remove"
+const _EventMemberAdd = "member_add"
+const _EventMemberRemove = "member_remove"
+const _EventMessageDelete = "message_delete"
+const _EventMessageDeleteBulk = "message_delete_bulk"
+
+var _EventsMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"type":        map[string]interface{}{"type": "keyword"},
+		"guild_id":    map[string]interface{}{"type": "keyword"},
+		"channel_id":  map[string]interface{}{"type": "keyword"},
+		"user_id":     map[string]interface{}{"type": "keyword"},
+		"user_name":   map[string]interface{}{"type": "keyword"},
+		"message_ids": map[string]interface{}{"type": "keyword"},
+		"count":       map[string]interface{}{"type": "integer"},
+		"timestamp":   map[string]interface{}{"type": "date"},
+	},
+}
+
+// _IndexEvent stores a moderation event. Events are identified by their type, guild, subject and time,
+// so a duplicate delivery of the same event replaces the earlier copy.
+func _IndexEvent(eventType string, guildID string, subject string, fields map[string]interface{}) {
+	if !_IsAllowedGuild(guildID) {
+		return
+	}
+
+	now := time.Now()
+	document := map[string]interface{}{
+		"type":      eventType,
+		"guild_id":  guildID,
+		"timestamp": _FormatTimestamp(now),
+	}
+	for field, value := range fields {
+		document[field] = value
+	}
+
+	documentID := strings.Join([]string{eventType, guildID, subject, fmt.Sprint(now.Unix())}, ":")
+	err := _InsertIndex(document, _EventsIndex, documentID, int(now.UnixNano()/int64(time.Millisecond)), "")
+	if err != nil {
+		log.Error().Err(err).Str("type", eventType).Str("guild_id", guildID).Msg("Error indexing event")
+	}
+}
+
+// _UserFields returns the fields identifying the user an event is about
+func _UserFields(user *discordgo.User) map[string]interface{} {
+	if user == nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"user_id": user.ID, "user_name": user.Username}
+}
+
+func _GuildBanAddHandler(_ *discordgo.Session, ban *discordgo.GuildBanAdd) {
+	_IndexEvent(_EventBanAdd, ban.GuildID, ban.User.ID, _UserFields(ban.User))
+}
+
+func _GuildBanRemoveHandler(_ *discordgo.Session, ban *discordgo.GuildBanRemove) {
+	_IndexEvent(_EventBanRemove, ban.GuildID, ban.User.ID, _UserFields(ban.User))
+}
+
+func _GuildMemberAddHandler(_ *discordgo.Session, member *discordgo.GuildMemberAdd) {
+	_IndexEvent(_EventMemberAdd, member.GuildID, member.User.ID, _UserFields(member.User))
+}
+
+func _GuildMemberRemoveHandler(_ *discordgo.Session, member *discordgo.GuildMemberRemove) {
+	_IndexEvent(_EventMemberRemove, member.GuildID, member.User.ID, _UserFields(member.User))
+}
+
+func _MessageDeleteEventHandler(_ *discordgo.Session, deleted *discordgo.MessageDelete) {
+	fields := map[string]interface{}{
+		"channel_id":  deleted.ChannelID,
+		"message_ids": []string{deleted.ID},
+		"count":       1,
+	}
+	if deleted.BeforeDelete != nil {
+		for field, value := range _UserFields(deleted.BeforeDelete.Author) {
+			fields[field] = value
+		}
+	}
+	_IndexEvent(_EventMessageDelete, deleted.GuildID, deleted.ID, fields)
+}
+
+func _MessageDeleteBulkEventHandler(_ *discordgo.Session, deleted *discordgo.MessageDeleteBulk) {
+	if len(deleted.Messages) == 0 {
+		return
+	}
+	_IndexEvent(_EventMessageDeleteBulk, deleted.GuildID, deleted.Messages[0], map[string]interface{}{
+		"channel_id":  deleted.ChannelID,
+		"message_ids": deleted.Messages,
+		"count":       len(deleted.Messages),
+	})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Channels and guilds can be excluded from archiving, so that nothing sent in them is ingested, live or from a backlog.
+// Excluding a channel also excludes the threads inside it. Exclusions are stored in their own index like the blocklist.
+
+const _ExclusionsIndex = "excluded-channels"
+
+var _ExclusionsMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"scope":       map[string]interface{}{"type": "keyword"},
+		"guild_id":    map[string]interface{}{"type": "keyword"},
+		"excluded_by": map[string]interface{}{"type": "keyword"},
+		"timestamp":   map[string]interface{}{"type": "date"},
+	},
+}
+
+var _ErrChannelExcluded = errors.New("this channel is excluded from archiving")
+
+// _Exclusions maps the ID of each excluded channel or guild to its scope, either channel or guild
+var _Exclusions = map[string]string{}
+var _ExclusionsLock sync.RWMutex
+
+func _LoadExclusions() error {
+	err := _EnsureStandaloneIndex(_ExclusionsIndex, _ExclusionsMapping)
+	if err != nil {
+		return err
+	}
+
+	exclusions := map[string]string{}
+	err = _ScanAll([]string{_ExclusionsIndex}, map[string]interface{}{"_source": []string{"scope"}}, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var exclusion struct {
+				Scope string `json:"scope"`
+			}
+			err := json.Unmarshal(hit.Source, &exclusion)
+			if err != nil {
+				return fmt.Errorf("error decoding exclusion: %w", err)
+			}
+			exclusions[hit.ID] = exclusion.Scope
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error loading exclusions: %w", err)
+	}
+
+	_ExclusionsLock.Lock()
+	_Exclusions = exclusions
+	_ExclusionsLock.Unlock()
+
+	log.Debug().Int("count", len(exclusions)).Msg("Loaded archiving exclusions")
+	return nil
+}
+
+// _IsExcludedChannel returns whether messages sent in a channel shouldn't be archived, because the channel,
+// the channel a thread belongs to or its guild was excluded
+func _IsExcludedChannel(channelID string) bool {
+	_ExclusionsLock.RLock()
+	defer _ExclusionsLock.RUnlock()
+	if len(_Exclusions) == 0 {
+		return false
+	}
+	if _, ok := _Exclusions[channelID]; ok {
+		return true
+	}
+
+	channel, err := session.State.Channel(channelID)
+	if err != nil {
+		return false
+	}
+	if _, ok := _Exclusions[channel.GuildID]; ok {
+		return true
+	}
+	_, ok := _Exclusions[channel.ParentID]
+	return channel.IsThread() && ok
+}
+
+func _AddExclusion(id string, scope string, guildID string, excludedBy string) error {
+	now := time.Now()
+	err := _InsertIndex(map[string]interface{}{
+		"scope":       scope,
+		"guild_id":    guildID,
+		"excluded_by": excludedBy,
+		"timestamp":   _FormatTimestamp(now),
+	}, _ExclusionsIndex, id, int(now.UnixNano()/int64(time.Millisecond)), "")
+	if err != nil {
+		return fmt.Errorf("error storing exclusion: %w", err)
+	}
+
+	_ExclusionsLock.Lock()
+	_Exclusions[id] = scope
+	_ExclusionsLock.Unlock()
+	return nil
+}
+
+func _RemoveExclusion(id string) error {
+	req := esapi.DeleteRequest{
+		Index:      _ExclusionsIndex,
+		DocumentID: id,
+		Refresh:    "true",
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		err = _DecodeResponse(resp, nil)
+		if err != nil {
+			return fmt.Errorf("error removing exclusion: %w", err)
+		}
+	} else {
+		resp.Body.Close()
+	}
+
+	_ExclusionsLock.Lock()
+	delete(_Exclusions, id)
+	_ExclusionsLock.Unlock()
+	return nil
+}
+
+// _ExcludedChannelIDs returns the IDs of the channels an exclusion covers, including the threads inside them that
+// are in the state cache
+func _ExcludedChannelIDs(id string, scope string, guildID string) []string {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return []string{id}
+	}
+
+	channelIDs := make([]string, 0)
+	if scope == "channel" {
+		channelIDs = append(channelIDs, id)
+	} else {
+		for _, channel := range guild.Channels {
+			channelIDs = append(channelIDs, channel.ID)
+		}
+	}
+	for _, thread := range guild.Threads {
+		if scope == "guild" || thread.ParentID == id {
+			channelIDs = append(channelIDs, thread.ID)
+		}
+	}
+	return channelIDs
+}
+
+// _PurgeExcluded deletes the messages and attachments already archived from an excluded channel or guild.
+// Like _PurgeUser, messages are deleted by a throttled background task that can be stopped with cancel-purge, and
+// progress is called with the task's ID once it starts and again with its status each time it is checked.
+// Archived threads that aren't in the state cache are missed.
+func _PurgeExcluded(id string, scope string, guildID string, progress func(string, *_TaskStatus)) (int, int, error) {
+	query := map[string]interface{}{"terms": map[string]interface{}{"channel_id": _ExcludedChannelIDs(id, scope, guildID)}}
+
+	attachments, err := _DeleteByQuery([]string{_GuildReadIndex("attachments", guildID)}, query)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error deleting attachments: %w", err)
+	}
+
+	taskID, err := _StartDeleteByQuery([]string{_GuildReadIndex("messages", guildID)}, query, config.PurgeRequestsPerSecond)
+	if err != nil {
+		return 0, attachments, fmt.Errorf("error deleting messages: %w", err)
+	}
+	log.Info().Str("id", id).Str("scope", scope).Str("task_id", taskID).Msg("Started deleting excluded messages")
+	progress(taskID, nil)
+	messages, err := _WaitForDeleteTask(taskID, func(status *_TaskStatus) {
+		progress(taskID, status)
+	})
+	if err != nil {
+		return messages, attachments, fmt.Errorf("error deleting messages: %w", err)
+	}
+	return messages, attachments, nil
+}
+
+type _ExcludeArgs struct {
+	Action  string `default:"list" description:"Action to perform. One of list, add or remove."`
+	Channel string `description:"Channel to exclude or include again. Defaults to the current channel."`
+	Guild   bool   `default:"false" description:"Exclude or include the whole guild instead of a channel."`
+	Purge   bool   `default:"false" description:"When adding an exclusion, also delete the messages already archived. Pass as Purge=true."`
+}
+
+func _ExcludeHandler(message *discordgo.MessageCreate, args _ExcludeArgs) {
+	if args.Action == "list" {
+		_ExclusionsLock.RLock()
+		excluded := make([]string, 0, len(_Exclusions))
+		for id, scope := range _Exclusions {
+			if scope == "guild" && id == message.GuildID {
+				excluded = append(excluded, "this guild")
+				continue
+			}
+			if channel, err := session.State.Channel(id); err == nil && channel.GuildID == message.GuildID {
+				excluded = append(excluded, fmt.Sprintf("<#%s>", id))
+			}
+		}
+		_ExclusionsLock.RUnlock()
+
+		if len(excluded) == 0 {
+			session.ChannelMessageSend(message.ChannelID, "Nothing in this guild is excluded from archiving.")
+			return
+		}
+		sort.Strings(excluded)
+		session.ChannelMessageSend(message.ChannelID, "Excluded from archiving: "+strings.Join(excluded, ", "))
+		return
+	}
+
+	id, scope, target := message.GuildID, "guild", "this guild"
+	if !args.Guild {
+		if args.Channel == "" {
+			args.Channel = message.ChannelID
+		}
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		id, scope, target = channel.ID, "channel", fmt.Sprintf("<#%s>", channel.ID)
+	}
+
+	switch args.Action {
+	case "add":
+		if args.Purge {
+			confirmed, err := _Confirm(message, fmt.Sprintf("This will exclude %s and permanently delete the messages and attachments already archived from it.", target))
+			if err != nil {
+				log.Error().Err(err).Msg("Error confirming purge")
+				return
+			}
+			if !confirmed {
+				session.ChannelMessageSend(message.ChannelID, "Purge cancelled.")
+				return
+			}
+		}
+
+		err := _AddExclusion(id, scope, message.GuildID, message.Author.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error adding exclusion")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		log.Info().Str("id", id).Str("scope", scope).Msg("Excluded from archiving")
+
+		if !args.Purge {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Messages in %s will no longer be archived.", target))
+			return
+		}
+
+		var progressMessage *discordgo.Message
+		deletedMessages, deletedAttachments, err := _PurgeExcluded(id, scope, message.GuildID, func(taskID string, status *_TaskStatus) {
+			content := fmt.Sprintf("Deleting messages archived from %s in task `%s`. Run `cancel-purge %s` to stop it.", target, taskID, taskID)
+			if status != nil {
+				content = fmt.Sprintf("%s\nDeleted %d of %d messages.", content, status.Task.Status.Deleted, status.Task.Status.Total)
+			}
+			if progressMessage == nil {
+				progressMessage, _ = session.ChannelMessageSend(message.ChannelID, content)
+			} else {
+				session.ChannelMessageEdit(message.ChannelID, progressMessage.ID, content)
+			}
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error purging excluded messages")
+			session.ChannelMessageSend(
+				message.ChannelID,
+				fmt.Sprintf("Deleted %d messages and %d attachments before stopping:\n```\n%s\n```", deletedMessages, deletedAttachments, err.Error()),
+			)
+			return
+		}
+		session.ChannelMessageSend(
+			message.ChannelID,
+			fmt.Sprintf("Messages in %s will no longer be archived. Deleted %d messages and %d attachments.", target, deletedMessages, deletedAttachments),
+		)
+	case "remove":
+		err := _RemoveExclusion(id)
+		if err != nil {
+			log.Error().Err(err).Msg("Error removing exclusion")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		log.Info().Str("id", id).Str("scope", scope).Msg("Included in archiving again")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Messages in %s will be archived again.", target))
+	default:
+		session.ChannelMessageSend(message.ChannelID, "Unknown action. Valid actions are list, add and remove.")
+	}
+}
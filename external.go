@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages from chat systems other than Discord, such as a bridged IRC or Matrix channel, can be posted to the HTTP server
+// to be indexed alongside Discord's messages. They are tagged with the configured source, so they can be told apart
+// from Discord's messages, which are tagged with discord. Every external message belongs to a guild, and is searched
+// along with that guild's messages.
+
+const _DiscordSource = "discord"
+const _MaxExternalMessageSize = 1 << 20
+
+// _ExternalMessage represents a message posted from an external chat system
+type _ExternalMessage struct {
+	ID         string     `json:"id"`
+	GuildID    string     `json:"guild_id"`
+	ChannelID  string     `json:"channel_id"`
+	AuthorID   string     `json:"author_id"`
+	AuthorName string     `json:"author_name"`
+	Content    string     `json:"content"`
+	Timestamp  time.Time  `json:"timestamp"`
+	EditedAt   *time.Time `json:"edited_timestamp"`
+}
+
+// _ValidateExternalMessage returns an error describing the first field of an external message that is missing or invalid
+func _ValidateExternalMessage(message *_ExternalMessage) error {
+	switch {
+	case message.ID == "":
+		return errors.New("id is required")
+	case message.GuildID == "":
+		return errors.New("guild_id is required")
+	case message.ChannelID == "":
+		return errors.New("channel_id is required")
+	case message.AuthorName == "":
+		return errors.New("author_name is required")
+	case message.Content == "":
+		return errors.New("content is required")
+	case message.Timestamp.IsZero():
+		return errors.New("timestamp is required")
+	case !_IsAllowedGuild(message.GuildID):
+		return fmt.Errorf("guild %s is not allowed", message.GuildID)
+	}
+	return nil
+}
+
+// _BuildExternalMessageDocument builds the document stored for an external message, using the same content processing
+// as Discord messages
+func _BuildExternalMessageDocument(external *_ExternalMessage) map[string]interface{} {
+	authorID := external.AuthorID
+	if authorID == "" {
+		authorID = external.AuthorName
+	}
+
+	document := map[string]interface{}{
+		"content":           external.Content,
+		"content_length":    utf8.RuneCountInString(external.Content),
+		"content_available": true,
+		"channel_id":        external.ChannelID,
+		"author_id":         authorID,
+		"author_name":       external.AuthorName,
+		"timestamp":         _FormatTimestamp(external.Timestamp),
+		"guild_id":          external.GuildID,
+		"source":            config.ExternalSource,
+	}
+
+	message := &discordgo.Message{ID: external.ID, ChannelID: external.ChannelID, Content: external.Content}
+	_NormalizeContent(message, document)
+	_TruncateContent(message, document)
+	_PreprocessContent(message, document)
+	_ApplyEnrichers(message, document)
+	_EncryptDocumentContent(document)
+	_FilterDocumentFields(message, document)
+
+	return document
+}
+
+// _IngestExternalMessage indexes an external message. Its ID is prefixed with the source, so it can't collide with
+// a Discord message or a message from another source.
+func _IngestExternalMessage(external *_ExternalMessage) error {
+	version := external.Timestamp
+	if external.EditedAt != nil {
+		version = *external.EditedAt
+	}
+
+	index := _GuildWriteIndex("messages", external.GuildID)
+	documentID := config.ExternalSource + "-" + external.ID
+	err := _InsertIndex(_BuildExternalMessageDocument(external), index, documentID, int(version.UnixNano()/int64(time.Millisecond)), _DocumentRouting(external.ChannelID))
+	if err != nil {
+		return fmt.Errorf("error ingesting external message: %w", err)
+	}
+	return nil
+}
+
+// _IsExternalIngestAuthorized returns whether a request carries the configured bearer token
+func _IsExternalIngestAuthorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.ExternalIngestToken)) == 1
+}
+
+func _ExternalMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !_IsExternalIngestAuthorized(r) {
+		http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+
+	var external _ExternalMessage
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, _MaxExternalMessageSize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&external)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+	err = _ValidateExternalMessage(&external)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	err = _IngestExternalMessage(&external)
+	if err != nil {
+		log.Error().Err(err).Str("source", config.ExternalSource).Str("message_id", external.ID).Msg("Error ingesting external message")
+		http.Error(w, "error indexing message", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord rejects uploads larger than this for bots in guilds without boosts
+const _MaxReuploadSize = 25 * 1024 * 1024
+
+var _ErrAttachmentUnavailable = errors.New("none of the stored links for this attachment are still available, and no archived copy exists")
+
+var _DownloadClient = &http.Client{Timeout: time.Minute, Transport: _ProxiedTransport()}
+
+// _AttachmentDocument represents the parts of an indexed attachment needed to recover it
+type _AttachmentDocument struct {
+	Filename  string `json:"filename"`
+	Size      int    `json:"size"`
+	URL       string `json:"url"`
+	ProxyURL  string `json:"proxy_url"`
+	MessageID string `json:"message_id"`
+	ChannelID string `json:"channel_id"`
+}
+
+// _FindAttachment looks up an indexed attachment by its ID from one of the guild's channels that a user can view
+func _FindAttachment(attachmentID string, guildID string, userID string) (*_AttachmentDocument, error) {
+	channelFilter, err := _GuildChannelFilter(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("attachments", guildID)}, map[string]interface{}{
+		"size": 1,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"ids": map[string]interface{}{"values": []string{attachmentID}}},
+					channelFilter,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Hits.Hits) == 0 {
+		return nil, nil
+	}
+
+	var attachment _AttachmentDocument
+	err = json.Unmarshal(resp.Hits.Hits[0].Source, &attachment)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding attachment document: %w", err)
+	}
+	return &attachment, nil
+}
+
+func _Download(url string) ([]byte, error) {
+	resp, err := _DownloadClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, _MaxReuploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	if len(data) > _MaxReuploadSize {
+		return nil, fmt.Errorf("file is larger than the %d byte upload limit", _MaxReuploadSize)
+	}
+	return data, nil
+}
+
+// _DownloadAttachment downloads an attachment from the first of its stored links that still works
+func _DownloadAttachment(attachment *_AttachmentDocument) ([]byte, error) {
+	if attachment.Size > _MaxReuploadSize {
+		return nil, fmt.Errorf("file is larger than the %d byte upload limit", _MaxReuploadSize)
+	}
+
+	for _, url := range []string{attachment.URL, attachment.ProxyURL} {
+		if url == "" {
+			continue
+		}
+		data, err := _Download(url)
+		if err != nil {
+			log.Debug().Err(err).Str("url", url).Msg("Unable to download attachment")
+			continue
+		}
+		return data, nil
+	}
+	return nil, _ErrAttachmentUnavailable
+}
+
+type _FetchAttachmentArgs struct {
+	AttachmentID string `description:"ID of the attachment to fetch."`
+}
+
+func _FetchAttachmentHandler(message *discordgo.MessageCreate, args _FetchAttachmentArgs) {
+	attachment, err := _FindAttachment(args.AttachmentID, message.GuildID, message.Author.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error looking up attachment")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if attachment == nil {
+		session.ChannelMessageSend(message.ChannelID, "No ingested attachment with that ID was found in this server.")
+		return
+	}
+
+	data, err := _DownloadAttachment(attachment)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Attachment from %s.", _JumpURL(message.GuildID, attachment.ChannelID, attachment.MessageID)),
+		Files: []*discordgo.File{{
+			Name:   attachment.Filename,
+			Reader: bytes.NewReader(data),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading attachment")
+	}
+}
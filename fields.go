@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// Field lists let operators minimise what is stored, for example indexing only metadata and never message content.
+// They apply to the top-level fields of message documents, after every other field has been added and content encrypted.
+// Commands that rely on an omitted field, such as search without content, simply stop finding anything.
+
+// _RequiredDocumentFields are always stored, as routing, scoping and ordering messages all depend on them
+var _RequiredDocumentFields = map[string]bool{
+	"timestamp":  true,
+	"channel_id": true,
+	"guild_id":   true,
+}
+
+// _IsKnownDocumentField returns whether a field is part of the message mapping
+func _IsKnownDocumentField(field string) bool {
+	_, ok := _MessageMapping["properties"].(map[string]interface{})[field]
+	return ok
+}
+
+// _FilterDocumentFields removes the fields from a message document that INDEX_FIELDS and EXCLUDE_FIELDS don't allow
+func _FilterDocumentFields(_ *discordgo.Message, document map[string]interface{}) {
+	if len(config.IndexFields) == 0 && len(config.ExcludeFields) == 0 {
+		return
+	}
+
+	allowed := make(map[string]bool, len(config.IndexFields))
+	for _, field := range config.IndexFields {
+		allowed[field] = true
+	}
+	excluded := make(map[string]bool, len(config.ExcludeFields))
+	for _, field := range config.ExcludeFields {
+		excluded[field] = true
+	}
+
+	for field := range document {
+		if _RequiredDocumentFields[field] {
+			continue
+		}
+		if (len(allowed) > 0 && !allowed[field]) || excluded[field] {
+			delete(document, field)
+		}
+	}
+}
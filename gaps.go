@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Only the largest gaps are cross-checked against Discord, to limit the number of API requests made
+const _MaxReportedGaps = 10
+
+// _IngestionGap represents a period with no indexed messages between two consecutive indexed messages
+type _IngestionGap struct {
+	Start         time.Time
+	End           time.Time
+	MissingCount  int
+	MissingCapped bool
+}
+
+// _FindIngestionGaps returns the largest periods between consecutive indexed messages in a channel that exceed a threshold
+func _FindIngestionGaps(channelID string, threshold time.Duration) ([]_IngestionGap, error) {
+	gaps := make([]_IngestionGap, 0)
+
+	var previous *time.Time
+	err := _ScanAllRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"channel_id": channelID},
+		},
+		"_source": []string{"timestamp"},
+		"sort":    []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _MessageDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding message document: %w", err)
+			}
+
+			if previous != nil && document.Timestamp.Sub(*previous) >= threshold {
+				gaps = append(gaps, _IngestionGap{Start: *previous, End: document.Timestamp})
+			}
+			timestamp := document.Timestamp
+			previous = &timestamp
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].End.Sub(gaps[i].Start) > gaps[j].End.Sub(gaps[j].Start)
+	})
+	if len(gaps) > _MaxReportedGaps {
+		gaps = gaps[:_MaxReportedGaps]
+	}
+	return gaps, nil
+}
+
+// _CountMissedMessages fetches the messages Discord has from the start of a gap, and counts how many of them were sent during it.
+// Only a single page is fetched, so the count is capped at 100.
+func _CountMissedMessages(channelID string, gap *_IngestionGap) error {
+	start := gap.Start.Add(time.Millisecond)
+	messages, err := _ChannelMessages(channelID, 100, "", _SnowflakeAt(start))
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if message.Timestamp.Before(gap.End) {
+			gap.MissingCount++
+		}
+	}
+	gap.MissingCapped = len(messages) == 100 && gap.MissingCount == len(messages)
+	return nil
+}
+
+type _GapsArgs struct {
+	Channel string `description:"Channel to check for ingestion gaps."`
+	Hours   int    `default:"0" description:"Minimum gap length, in hours. Defaults to the configured gap threshold."`
+}
+
+func _GapsHandler(message *discordgo.MessageCreate, args _GapsArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	threshold := config.GapThreshold
+	if args.Hours > 0 {
+		threshold = time.Duration(args.Hours) * time.Hour
+	}
+
+	gaps, err := _FindIngestionGaps(channel.ID, threshold)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding ingestion gaps")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, len(gaps))
+	for _, gap := range gaps {
+		status := ""
+		err = _CountMissedMessages(channel.ID, &gap)
+		switch {
+		case err != nil:
+			status = "unable to check Discord"
+		case gap.MissingCount == 0:
+			status = "no messages missing"
+		case gap.MissingCapped:
+			status = fmt.Sprintf("⚠️ at least %d messages missing", gap.MissingCount)
+		default:
+			status = fmt.Sprintf("⚠️ %d messages missing", gap.MissingCount)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"<t:%d:f> to <t:%d:f> (%s): %s",
+			gap.Start.Unix(),
+			gap.End.Unix(),
+			gap.End.Sub(gap.Start).Round(time.Minute),
+			status,
+		))
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Ingestion gaps in #%s", channel.Name))
+	embed.Description = strings.Join(lines, "\n")
+	embed.Footer = _EmbedFooter(fmt.Sprintf("Showing the %d largest gaps longer than %s", _MaxReportedGaps, threshold))
+	if len(lines) == 0 {
+		embed.Description = "No gaps found."
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -3,10 +3,13 @@ module github.com/nint8835/Elkbot
 go 1.15
 
 require (
-	github.com/bwmarrin/discordgo v0.22.0
+	github.com/bwmarrin/discordgo v0.29.0
 	github.com/elastic/go-elasticsearch/v7 v7.10.0
 	github.com/joho/godotenv v1.3.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/nint8835/parsley v0.0.0-20201224020611-dee14cbf9618
 	github.com/rs/zerolog v1.20.0
+	golang.org/x/image v0.1.0
+	golang.org/x/text v0.4.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 )
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// With per-guild indices, each guild's messages and attachments are written to their own indices
+// (such as messages-<guild ID>), so that queries for one guild can never return another guild's data.
+// Queries that aren't scoped to a guild, such as admin commands covering every guild, target all of them with a wildcard.
+// Switching this on or off doesn't move existing data, so channels should be re-ingested afterwards.
+
+var _EnsuredGuildIndices = map[string]bool{}
+var _EnsuredGuildIndicesLock sync.Mutex
+
+// _GuildBase returns the base index that a guild's documents are stored under
+func _GuildBase(base string, guildID string) string {
+	if !config.PerGuildIndices || guildID == "" {
+		return base
+	}
+	return base + "-" + guildID
+}
+
+// _ChannelGuildID returns the ID of the guild a channel belongs to, or an empty string if it can't be determined
+func _ChannelGuildID(channelID string) string {
+	channel, err := session.State.Channel(channelID)
+	if err == nil {
+		return channel.GuildID
+	}
+	channel, err = session.Channel(channelID)
+	if err != nil {
+		log.Debug().Err(err).Str("channel_id", channelID).Msg("Unable to determine guild of channel")
+		return ""
+	}
+	return channel.GuildID
+}
+
+// _MessageGuildID returns the ID of the guild a message was sent in.
+// Messages fetched from a channel's history don't include their guild, so it's looked up from the channel instead.
+func _MessageGuildID(message *discordgo.Message) string {
+	if message.GuildID != "" {
+		return message.GuildID
+	}
+	return _ChannelGuildID(message.ChannelID)
+}
+
+// _GuildReadIndex returns the index pattern that queries scoped to a single guild should target.
+// The guild's indices are created if needed, so that querying a guild without any data doesn't fail.
+func _GuildReadIndex(base string, guildID string) string {
+	if !config.PerGuildIndices || guildID == "" {
+		return _ReadIndex(base)
+	}
+	_EnsureGuildIndices(guildID)
+	return _GuildBase(base, guildID)
+}
+
+// _ChannelReadIndex returns the index pattern that queries scoped to a single channel should target
+func _ChannelReadIndex(base string, channelID string) string {
+	if !config.PerGuildIndices {
+		return _ReadIndex(base)
+	}
+	return _GuildReadIndex(base, _ChannelGuildID(channelID))
+}
+
+// _ChannelWriteIndex returns the index that documents from a channel should be written to,
+// creating the indices of the channel's guild the first time they are needed
+func _ChannelWriteIndex(base string, channelID string) string {
+	if !config.PerGuildIndices {
+		return _WriteIndex(base)
+	}
+	return _GuildWriteIndex(base, _ChannelGuildID(channelID))
+}
+
+// _GuildWriteIndex returns the index that documents belonging to a guild should be written to
+func _GuildWriteIndex(base string, guildID string) string {
+	if config.PerGuildIndices && guildID != "" {
+		_EnsureGuildIndices(guildID)
+	}
+	return _WriteIndex(_GuildBase(base, guildID))
+}
+
+// _EnsureGuildIndices creates a guild's indices if they haven't been created since Elkbot started
+func _EnsureGuildIndices(guildID string) {
+	_EnsuredGuildIndicesLock.Lock()
+	defer _EnsuredGuildIndicesLock.Unlock()
+
+	if _EnsuredGuildIndices[guildID] || config.ReadOnly {
+		return
+	}
+
+	for _, base := range []string{"messages", "attachments"} {
+		var mapping map[string]interface{}
+		if base == "messages" && _ContentAnalyzer(guildID) != config.ContentAnalyzer {
+			mapping = map[string]interface{}{
+				"properties": map[string]interface{}{
+					"content":            _ContentMapping(_ContentAnalyzer(guildID)),
+					"content_searchable": map[string]interface{}{"type": "text", "analyzer": _ContentAnalyzer(guildID)},
+				},
+			}
+		}
+		err := _EnsureIndexWithMapping(_GuildBase(base, guildID), mapping)
+		if err != nil {
+			log.Error().Err(err).Str("guild_id", guildID).Msg("Error creating guild index")
+			return
+		}
+	}
+	_EnsuredGuildIndices[guildID] = true
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Guild backfills ingest every readable channel in a guild, saving a checkpoint for each channel as they go.
+// Running the backfill again after it was interrupted, or after Elkbot restarted, skips the channels that were finished
+// and continues the others from the oldest message they had reached. Messages sent after a channel's backfill started
+// are left to live ingestion.
+
+const _CheckpointsIndex = "ingest-checkpoints"
+
+var _CheckpointsMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"channel_id": map[string]interface{}{"type": "keyword"},
+		"guild_id":   map[string]interface{}{"type": "keyword"},
+		"before":     map[string]interface{}{"type": "keyword"},
+		"indexed":    map[string]interface{}{"type": "long"},
+		"completed":  map[string]interface{}{"type": "boolean"},
+		"timestamp":  map[string]interface{}{"type": "date"},
+	},
+}
+
+// Messages ingested between checkpoints, which is also the most an interrupted backfill has to redo per channel
+const _CheckpointInterval = 2500
+
+// _IngestCheckpoint records how far the backfill of a channel has got
+type _IngestCheckpoint struct {
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Before    string `json:"before"`
+	Indexed   int    `json:"indexed"`
+	Completed bool   `json:"completed"`
+}
+
+// _RunningGuildIngests holds the guilds that have a backfill in progress, so that two can't run over each other
+var _RunningGuildIngests sync.Map
+
+// _LoadCheckpoints returns the checkpoints of every channel in a guild, keyed by channel ID
+func _LoadCheckpoints(guildID string) (map[string]*_IngestCheckpoint, error) {
+	checkpoints := make(map[string]*_IngestCheckpoint)
+	err := _ScanAll([]string{_CheckpointsIndex}, map[string]interface{}{
+		"query": map[string]interface{}{"term": map[string]interface{}{"guild_id": guildID}},
+	}, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var checkpoint _IngestCheckpoint
+			err := json.Unmarshal(hit.Source, &checkpoint)
+			if err != nil {
+				return fmt.Errorf("error decoding checkpoint: %w", err)
+			}
+			checkpoints[checkpoint.ChannelID] = &checkpoint
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+func _SaveCheckpoint(checkpoint *_IngestCheckpoint) error {
+	now := time.Now()
+	err := _InsertIndex(map[string]interface{}{
+		"channel_id": checkpoint.ChannelID,
+		"guild_id":   checkpoint.GuildID,
+		"before":     checkpoint.Before,
+		"indexed":    checkpoint.Indexed,
+		"completed":  checkpoint.Completed,
+		"timestamp":  _FormatTimestamp(now),
+	}, _CheckpointsIndex, checkpoint.ChannelID, int(now.UnixNano()/int64(time.Millisecond)), "")
+	if err != nil {
+		return fmt.Errorf("error saving checkpoint: %w", err)
+	}
+	return nil
+}
+
+// _ClearCheckpoints removes the checkpoints of a guild, so that its next backfill starts over
+func _ClearCheckpoints(guildID string) error {
+	_, err := _DeleteByQuery([]string{_CheckpointsIndex}, map[string]interface{}{"term": map[string]interface{}{"guild_id": guildID}})
+	if err != nil {
+		return fmt.Errorf("error clearing checkpoints: %w", err)
+	}
+	return nil
+}
+
+// _BackfillProgress estimates how much of a channel's history has been ingested, from how far back in time the backfill
+// has reached between the channel's newest message and its creation
+func _BackfillProgress(channelID string, newest time.Time, before string) float64 {
+	if before == "" {
+		return 0
+	}
+	created, err := discordgo.SnowflakeTimestamp(channelID)
+	if err != nil {
+		return 0
+	}
+	reached, err := discordgo.SnowflakeTimestamp(before)
+	if err != nil || !newest.After(created) {
+		return 0
+	}
+	progress := newest.Sub(reached).Seconds() / newest.Sub(created).Seconds()
+	if progress > 1 {
+		progress = 1
+	}
+	return progress * 100
+}
+
+// _BackfillChannel ingests a channel from its checkpoint in steps, saving the checkpoint after each one.
+// progress is called with the number of messages indexed so far and the estimated percentage complete.
+func _BackfillChannel(checkpoint *_IngestCheckpoint, progress func(int, float64)) error {
+	newest := time.Now()
+	latest, err := _ChannelMessages(checkpoint.ChannelID, 1, "", "")
+	if err == nil && len(latest) > 0 {
+		newest = latest[0].Timestamp
+	}
+
+	for !checkpoint.Completed {
+		stats, err := _IngestChannelFrom(checkpoint.ChannelID, checkpoint.Before, _CheckpointInterval)
+		checkpoint.Indexed += stats.Indexed
+		if err != nil {
+			return err
+		}
+		if stats.ResumeFrom == "" {
+			checkpoint.Completed = true
+		} else {
+			checkpoint.Before = stats.ResumeFrom
+		}
+
+		err = _SaveCheckpoint(checkpoint)
+		if err != nil {
+			return err
+		}
+		if !checkpoint.Completed {
+			progress(checkpoint.Indexed, _BackfillProgress(checkpoint.ChannelID, newest, checkpoint.Before))
+		}
+	}
+	return nil
+}
+
+type _IngestGuildArgs struct {
+	Restart bool `default:"false" description:"Discard the saved checkpoints and ingest every channel from the start. Pass as Restart=true."`
+}
+
+func _IngestGuildHandler(message *discordgo.MessageCreate, args _IngestGuildArgs) {
+	if _, running := _RunningGuildIngests.LoadOrStore(message.GuildID, true); running {
+		session.ChannelMessageSend(message.ChannelID, "A backfill of this guild is already running.")
+		return
+	}
+	defer _RunningGuildIngests.Delete(message.GuildID)
+
+	err := _EnsureStandaloneIndex(_CheckpointsIndex, _CheckpointsMapping)
+	if err == nil && args.Restart {
+		err = _ClearCheckpoints(message.GuildID)
+	}
+	var checkpoints map[string]*_IngestCheckpoint
+	if err == nil {
+		checkpoints, err = _LoadCheckpoints(message.GuildID)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error preparing guild backfill")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	channels := make([]*discordgo.Channel, 0)
+	for _, channel := range _ReadableTextChannels(message.GuildID) {
+		if !_IsExcludedChannel(channel.ID) {
+			channels = append(channels, channel)
+		}
+	}
+
+	started := time.Now()
+	indexed, finished, failed := 0, 0, 0
+	for i, channel := range channels {
+		checkpoint, ok := checkpoints[channel.ID]
+		if !ok {
+			checkpoint = &_IngestCheckpoint{ChannelID: channel.ID, GuildID: message.GuildID}
+		}
+		if checkpoint.Completed {
+			finished++
+			continue
+		}
+
+		status := fmt.Sprintf("Ingesting <#%s> (%d of %d)", channel.ID, i+1, len(channels))
+		if checkpoint.Before != "" {
+			status += fmt.Sprintf(", resuming after %d messages", checkpoint.Indexed)
+		}
+		progressMessage, _ := session.ChannelMessageSend(message.ChannelID, status+"...")
+
+		channelStarted := time.Now()
+		resumedFrom := checkpoint.Indexed
+		err := _BackfillChannel(checkpoint, func(channelIndexed int, percent float64) {
+			if progressMessage == nil {
+				return
+			}
+			rate := float64(channelIndexed-resumedFrom) / time.Since(channelStarted).Seconds()
+			session.ChannelMessageEdit(
+				message.ChannelID,
+				progressMessage.ID,
+				fmt.Sprintf("%s: %d messages indexed, %.0f messages/sec, about %.0f%% complete", status, channelIndexed, rate, percent),
+			)
+		})
+		indexed += checkpoint.Indexed - resumedFrom
+		if err != nil {
+			failed++
+			log.Error().Err(err).Str("channel_id", channel.ID).Msg("Error backfilling channel")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Error ingesting <#%s>, run the command again to resume it:\n```\n%s\n```", channel.ID, err.Error()))
+			continue
+		}
+		finished++
+		session.ChannelMessageSend(
+			message.ChannelID,
+			fmt.Sprintf("<#%s> finished, %d messages indexed in %s.", channel.ID, checkpoint.Indexed, time.Since(channelStarted).Round(time.Second)),
+		)
+	}
+
+	summary := fmt.Sprintf("Guild backfill finished: %d of %d channels complete, %d messages indexed in %s.", finished, len(channels), indexed, time.Since(started).Round(time.Second))
+	if failed > 0 {
+		summary += fmt.Sprintf(" %d channels failed and will be resumed by running the command again.", failed)
+	}
+	session.ChannelMessageSend(message.ChannelID, summary)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _IsAllowedGuild returns whether Elkbot is allowed to serve a guild.
+// An empty allowlist allows every guild.
+func _IsAllowedGuild(guildID string) bool {
+	if len(config.AllowedGuilds) == 0 {
+		return true
+	}
+	return _Contains(config.AllowedGuilds, guildID)
+}
+
+// _GuildCreateHandler leaves any guild that Elkbot joins, or was already in, that isn't on the allowlist.
+// Allowed guilds that were just joined have their history ingested, if enabled.
+func _GuildCreateHandler(_ *discordgo.Session, guild *discordgo.GuildCreate) {
+	if _IsAllowedGuild(guild.ID) {
+		if config.AutoIngestOnJoin {
+			_AutoIngestGuild(guild)
+		}
+		return
+	}
+
+	log.Warn().Str("guild_id", guild.ID).Str("guild_name", guild.Name).Msg("Leaving guild that is not on the allowlist")
+
+	if config.GuildGoodbyeMessage != "" && guild.SystemChannelID != "" {
+		_, err := session.ChannelMessageSend(guild.SystemChannelID, config.GuildGoodbyeMessage)
+		if err != nil {
+			log.Debug().Err(err).Str("guild_id", guild.ID).Msg("Unable to send goodbye message")
+		}
+	}
+
+	err := session.GuildLeave(guild.ID)
+	if err != nil {
+		log.Error().Err(err).Str("guild_id", guild.ID).Msg("Error leaving guild")
+	}
+}
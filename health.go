@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// _HealthStatus represents the body returned by the health endpoint
+type _HealthStatus struct {
+	Healthy   bool              `json:"healthy"`
+	Discord   _ConnectionStatus `json:"discord"`
+	Heartbeat _HeartbeatStatus  `json:"heartbeat"`
+
+	IngestPaused  bool `json:"ingest_paused"`
+	Elasticsearch bool `json:"elasticsearch"`
+}
+
+func _HealthHandler(w http.ResponseWriter, _ *http.Request) {
+	status := _HealthStatus{
+		Discord:       _CurrentConnection(),
+		Heartbeat:     _CurrentHeartbeat(),
+		IngestPaused:  _IsIngestPaused(),
+		Elasticsearch: _IsESAvailable(),
+	}
+	status.Healthy = status.Discord.State == _ConnectionConnected && !status.Heartbeat.Overdue
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// _ServeHealth serves the health endpoint and expvar metrics on the configured address
+func _ServeHealth() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", _HealthHandler)
+	mux.Handle("/debug/vars", expvar.Handler())
+	if config.ExternalIngestToken != "" {
+		mux.HandleFunc("/message", _ExternalMessageHandler)
+	}
+
+	err := http.ListenAndServe(config.HealthAddress, mux)
+	if err != nil {
+		log.Error().Err(err).Msg("Error serving health endpoint")
+	}
+}
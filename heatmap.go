@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages are bucketed by a script rather than a date histogram, as histograms can't group by day of week and hour.
+// Each bucket key is the day of the week (1 for Monday to 7 for Sunday) multiplied by 24, plus the hour.
+const _HeatmapScript = `ZonedDateTime timestamp = doc['timestamp'].value.withZoneSameInstant(ZoneId.of(params.zone));
+return timestamp.getDayOfWeek().getValue() * 24 + timestamp.getHour();`
+
+// Below this many messages, a heatmap says more about chance than about when someone is active
+const _MinHeatmapMessages = 50
+
+var _HeatmapDays = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+var _HeatmapShades = []rune(" ░▒▓█")
+
+// _UserHeatmap counts a user's messages in a guild by day of the week and hour of the day, in the configured timezone
+func _UserHeatmap(userID string, guildID string) ([7][24]int, int, error) {
+	var heatmap [7][24]int
+
+	query, err := _UserQuery(userID, guildID)
+	if err != nil {
+		return heatmap, 0, err
+	}
+	query["bool"].(map[string]interface{})["filter"] = append(query["bool"].(map[string]interface{})["filter"].([]interface{}), _NotDeletedFilter)
+
+	resp, err := _Search([]string{_GuildReadIndex("messages", guildID)}, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query":            query,
+		"aggs": map[string]interface{}{
+			"hours": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"script": map[string]interface{}{
+						"source": _HeatmapScript,
+						"lang":   "painless",
+						"params": map[string]interface{}{"zone": config.Timezone},
+					},
+					"size": 7 * 24,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return heatmap, 0, err
+	}
+
+	var hours _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["hours"], &hours)
+	if err != nil {
+		return heatmap, 0, fmt.Errorf("error decoding hour aggregation: %w", err)
+	}
+	for _, bucket := range hours.Buckets {
+		key, ok := bucket.Key.(float64)
+		if !ok {
+			continue
+		}
+		day, hour := int(key)/24-1, int(key)%24
+		if day >= 0 && day < 7 {
+			heatmap[day][hour] = bucket.DocCount
+		}
+	}
+
+	return heatmap, resp.Hits.Total.Value, nil
+}
+
+// _RenderHeatmap draws a heatmap with a row for each day of the week and a column for each hour, shaded relative to the busiest hour
+func _RenderHeatmap(heatmap [7][24]int) string {
+	busiest := 0
+	for _, day := range heatmap {
+		for _, count := range day {
+			if count > busiest {
+				busiest = count
+			}
+		}
+	}
+
+	var chart strings.Builder
+	chart.WriteString("    0     6     12    18    \n")
+	for index, day := range heatmap {
+		chart.WriteString(_HeatmapDays[index] + " ")
+		for _, count := range day {
+			shade := 0
+			if count > 0 {
+				shade = 1 + count*(len(_HeatmapShades)-2)/busiest
+			}
+			chart.WriteRune(_HeatmapShades[shade])
+		}
+		chart.WriteString("\n")
+	}
+	return chart.String()
+}
+
+type _HeatmapArgs struct {
+	User string `description:"Mention or ID of the user to show the activity of."`
+}
+
+func _HeatmapHandler(message *discordgo.MessageCreate, args _HeatmapArgs) {
+	userID := _ParseUserID(args.User)
+	if userID == "" {
+		session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+		return
+	}
+
+	heatmap, total, err := _UserHeatmap(userID, message.GuildID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating user activity")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if total == 0 {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("No ingested messages from <@%s> found.", userID))
+		return
+	}
+
+	embed := _NewEmbed("Activity heatmap")
+	embed.Description = fmt.Sprintf("When <@%s> sends messages, by hour (%s)\n```\n%s```", userID, config.Timezone, _RenderHeatmap(heatmap))
+	footer := fmt.Sprintf("Based on %d messages", total)
+	if total < _MinHeatmapMessages {
+		footer += ", which may be too few to show a pattern"
+	}
+	embed.Footer = _EmbedFooter(footer)
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
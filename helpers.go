@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var _UserMentionPattern = regexp.MustCompile(`^<@!?(\d+)>$`)
+var _SnowflakePattern = regexp.MustCompile(`^\d+$`)
+
+// _ParseUserID extracts a user ID from either a user mention or a raw ID, returning an empty string if neither matched
+func _ParseUserID(input string) string {
+	if matches := _UserMentionPattern.FindStringSubmatch(input); matches != nil {
+		return matches[1]
+	}
+	if _SnowflakePattern.MatchString(input) {
+		return input
+	}
+	return ""
+}
+
+var _ChannelMentionPattern = regexp.MustCompile(`^<#(\d+)>$`)
+
+// _ParseChannelID extracts a channel ID from either a channel mention or a raw ID, returning an empty string if neither matched
+func _ParseChannelID(input string) string {
+	if matches := _ChannelMentionPattern.FindStringSubmatch(input); matches != nil {
+		return matches[1]
+	}
+	if _SnowflakePattern.MatchString(input) {
+		return input
+	}
+	return ""
+}
+
+// _ResolveGuildChannel parses a channel argument, ensuring that it refers to a channel within the given guild
+func _ResolveGuildChannel(input string, guildID string) (*discordgo.Channel, error) {
+	channelID := _ParseChannelID(input)
+	if channelID == "" {
+		return nil, fmt.Errorf("%q is not a valid channel mention or ID", input)
+	}
+
+	channel, err := session.State.Channel(channelID)
+	if err != nil {
+		channel, err = session.Channel(channelID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching channel: %w", err)
+		}
+	}
+
+	if channel.GuildID != guildID {
+		return nil, fmt.Errorf("channel %s is not part of this guild", channelID)
+	}
+
+	return channel, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxHallOfFameResults = 10
+
+type _HallOfFameArgs struct {
+	Channel      string `description:"Channel to find the most reacted messages in."`
+	Days         int    `default:"0" description:"Only include messages from this many days ago onwards. 0 includes every message."`
+	MinReactions int    `default:"1" description:"Minimum number of reactions a message needs."`
+	Limit        int    `default:"5" description:"Number of messages to show."`
+}
+
+func _HallOfFameHandler(message *discordgo.MessageCreate, args _HallOfFameArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxHallOfFameResults {
+		args.Limit = _MaxHallOfFameResults
+	}
+	if args.MinReactions < 1 {
+		args.MinReactions = 1
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+		map[string]interface{}{"range": map[string]interface{}{"reaction_count": map[string]interface{}{"gte": args.MinReactions}}},
+		_NotDeletedFilter,
+	}
+	if args.Days > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", args.Days)}},
+		})
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  args.Limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":  []interface{}{map[string]interface{}{"reaction_count": "desc"}, map[string]interface{}{"timestamp": "desc"}},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for most reacted messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Hall of fame for #%s", channel.Name))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	if !config.TrackReactions {
+		embed.Footer = _EmbedFooter("Reaction counts are as of when each message was ingested")
+	}
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No messages found."
+	}
+	for index, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+		if len(hit.Sort) > 0 {
+			field.Name = fmt.Sprintf("#%d - %v reactions", index+1, hit.Sort[0])
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _HourlyScript = `doc['timestamp'].value.withZoneSameInstant(ZoneId.of(params.zone)).getHour()`
+
+type _HourlyArgs struct {
+	Channel string `default:"" description:"Only count messages from this channel."`
+}
+
+func _HourlyHandler(message *discordgo.MessageCreate, args _HourlyArgs) {
+	index := _GuildReadIndex("messages", message.GuildID)
+	var scopeFilter map[string]interface{}
+	var routing []string
+	scope := "the server"
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		index = _ChannelReadIndex("messages", channel.ID)
+		scopeFilter = map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+		routing = _ChannelRouting(channel.ID)
+		scope = "#" + channel.Name
+	} else {
+		var err error
+		scopeFilter, err = _GuildMessagesFilter(message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+
+	resp, err := _SearchRouted([]string{index}, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{scopeFilter, _NotDeletedFilter},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"hours": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"script": map[string]interface{}{
+						"source": _HourlyScript,
+						"lang":   "painless",
+						"params": map[string]interface{}{"zone": config.Timezone},
+					},
+					"size": 24,
+				},
+			},
+		},
+	}, routing)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating hourly activity")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var hours _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["hours"], &hours)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding hourly activity")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	counts := make([]int, 24)
+	for _, bucket := range hours.Buckets {
+		if hour, ok := bucket.Key.(float64); ok && hour >= 0 && hour < 24 {
+			counts[int(hour)] = bucket.DocCount
+		}
+	}
+	buckets := make([]_StatsBucket, 0, len(counts))
+	for hour, count := range counts {
+		buckets = append(buckets, _StatsBucket{KeyAsString: fmt.Sprintf("%02d:00", hour), DocCount: count})
+	}
+
+	header := fmt.Sprintf("Messages in %s by hour of day, in %s (%d total):", scope, config.Timezone, resp.Hits.Total.Value)
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%s\n```\n%s```", header, _ActivityChart(buckets, len("00:00"))))
+}
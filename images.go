@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _AspectRatioNames maps rounded aspect ratios to the names they are commonly known by
+var _AspectRatioNames = map[float64]string{
+	1:    "1:1",
+	1.33: "4:3",
+	0.75: "3:4",
+	1.5:  "3:2",
+	0.67: "2:3",
+	1.78: "16:9",
+	0.56: "9:16",
+	1.6:  "16:10",
+	2.17: "19.5:9",
+	0.46: "9:19.5",
+	2.33: "21:9",
+}
+
+type _TermsAggregation struct {
+	Buckets []struct {
+		Key      interface{} `json:"key"`
+		DocCount int         `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type _RangeAggregation struct {
+	Buckets []struct {
+		Key      string `json:"key"`
+		DocCount int    `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func _FormatAspectRatio(ratio float64) string {
+	if name, ok := _AspectRatioNames[ratio]; ok {
+		return name
+	}
+	return fmt.Sprintf("%.2f:1", ratio)
+}
+
+func _ImageStats(guildID string) (*discordgo.MessageEmbed, error) {
+	channelFilter, err := _GuildChannelFilter(guildID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("attachments", guildID)}, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					channelFilter,
+					map[string]interface{}{"exists": map[string]interface{}{"field": "aspect_ratio"}},
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"sizes": map[string]interface{}{
+				"range": map[string]interface{}{
+					"field": "size",
+					"ranges": []interface{}{
+						map[string]interface{}{"key": "Under 100 KB", "to": 100 * 1024},
+						map[string]interface{}{"key": "100 KB - 1 MB", "from": 100 * 1024, "to": 1024 * 1024},
+						map[string]interface{}{"key": "1 MB - 8 MB", "from": 1024 * 1024, "to": 8 * 1024 * 1024},
+						map[string]interface{}{"key": "Over 8 MB", "from": 8 * 1024 * 1024},
+					},
+				},
+			},
+			"aspect_ratios": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "aspect_ratio",
+					"size":  10,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes _RangeAggregation
+	err = json.Unmarshal(resp.Aggregations["sizes"], &sizes)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding size aggregation: %w", err)
+	}
+	var ratios _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["aspect_ratios"], &ratios)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding aspect ratio aggregation: %w", err)
+	}
+
+	sizeLines := make([]string, 0, len(sizes.Buckets))
+	for _, bucket := range sizes.Buckets {
+		sizeLines = append(sizeLines, fmt.Sprintf("%s: %d", bucket.Key, bucket.DocCount))
+	}
+	ratioLines := make([]string, 0, len(ratios.Buckets))
+	for _, bucket := range ratios.Buckets {
+		ratio, _ := bucket.Key.(float64)
+		ratioLines = append(ratioLines, fmt.Sprintf("%s: %d", _FormatAspectRatio(ratio), bucket.DocCount))
+	}
+	if len(ratioLines) == 0 {
+		ratioLines = append(ratioLines, "No images found.")
+	}
+
+	embed := _NewEmbed("Image statistics")
+	embed.Description = fmt.Sprintf("%d images indexed", resp.Hits.Total.Value)
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "File sizes", Value: strings.Join(sizeLines, "\n"), Inline: true},
+		{Name: "Aspect ratios", Value: strings.Join(ratioLines, "\n"), Inline: true},
+	}
+	return embed, nil
+}
+
+// Image searches rely on the precomputed aspect ratio, which is only stored for attachments with dimensions,
+// so non-image attachments never match
+var _ImageOrientationFilters = map[string]map[string]interface{}{
+	"landscape": {"range": map[string]interface{}{"aspect_ratio": map[string]interface{}{"gt": 1}}},
+	"portrait":  {"range": map[string]interface{}{"aspect_ratio": map[string]interface{}{"lt": 1}}},
+	"square":    {"term": map[string]interface{}{"aspect_ratio": 1}},
+}
+
+// Discord shows at most 10 embeds on a message
+const _MaxImageSearchResults = 10
+
+// _ImageSearchAttachment represents the parts of an indexed attachment shown in image search results
+type _ImageSearchAttachment struct {
+	Filename  string `json:"filename"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	URL       string `json:"url"`
+	ProxyURL  string `json:"proxy_url"`
+	MessageID string `json:"message_id"`
+	ChannelID string `json:"channel_id"`
+	IsSpoiler bool   `json:"is_spoiler"`
+}
+
+// _DimensionRange returns a range filter on a dimension, or nil if neither bound is set
+func _DimensionRange(field string, min int, max int) map[string]interface{} {
+	bounds := map[string]interface{}{}
+	if min > 0 {
+		bounds["gte"] = min
+	}
+	if max > 0 {
+		bounds["lte"] = max
+	}
+	if len(bounds) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"range": map[string]interface{}{field: bounds}}
+}
+
+// _ImageSearchFilters builds the filters for an image search, returning an error if the criteria can't match anything
+func _ImageSearchFilters(args _ImagesArgs) ([]interface{}, error) {
+	if args.MinWidth < 0 || args.MaxWidth < 0 || args.MinHeight < 0 || args.MaxHeight < 0 {
+		return nil, fmt.Errorf("dimensions must not be negative")
+	}
+	if args.MaxWidth > 0 && args.MinWidth > args.MaxWidth {
+		return nil, fmt.Errorf("MinWidth %d is larger than MaxWidth %d", args.MinWidth, args.MaxWidth)
+	}
+	if args.MaxHeight > 0 && args.MinHeight > args.MaxHeight {
+		return nil, fmt.Errorf("MinHeight %d is larger than MaxHeight %d", args.MinHeight, args.MaxHeight)
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"exists": map[string]interface{}{"field": "aspect_ratio"}},
+	}
+	if args.Orientation != "" {
+		orientation, ok := _ImageOrientationFilters[args.Orientation]
+		if !ok {
+			return nil, fmt.Errorf("unknown orientation %q, expected landscape, portrait or square", args.Orientation)
+		}
+		filters = append(filters, orientation)
+	}
+	if width := _DimensionRange("width", args.MinWidth, args.MaxWidth); width != nil {
+		filters = append(filters, width)
+	}
+	if height := _DimensionRange("height", args.MinHeight, args.MaxHeight); height != nil {
+		filters = append(filters, height)
+	}
+	return filters, nil
+}
+
+// _SearchImages finds the most recent images in a guild matching dimension criteria, from the channels a user can view
+func _SearchImages(guildID string, userID string, args _ImagesArgs) ([]*discordgo.MessageEmbed, int, error) {
+	filters, err := _ImageSearchFilters(args)
+	if err != nil {
+		return nil, 0, err
+	}
+	channelFilter, err := _GuildChannelFilter(guildID, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	filters = append(filters, channelFilter)
+
+	if args.Limit < 1 || args.Limit > _MaxImageSearchResults {
+		args.Limit = _MaxImageSearchResults
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("attachments", guildID)}, map[string]interface{}{
+		"size":             args.Limit,
+		"track_total_hits": true,
+		"query":            map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":             []interface{}{map[string]interface{}{"timestamp": "desc"}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	embeds := make([]*discordgo.MessageEmbed, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		var attachment _ImageSearchAttachment
+		err = json.Unmarshal(hit.Source, &attachment)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error decoding attachment: %w", err)
+		}
+
+		embed := _NewEmbed(attachment.Filename)
+		embed.URL = attachment.URL
+		embed.Description = fmt.Sprintf("%dx%d in <#%s> - [Jump](%s)", attachment.Width, attachment.Height, attachment.ChannelID, _JumpURL(guildID, attachment.ChannelID, attachment.MessageID))
+		if !attachment.IsSpoiler {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: attachment.ProxyURL}
+		}
+		embeds = append(embeds, embed)
+	}
+	return embeds, resp.Hits.Total.Value, nil
+}
+
+type _ImagesArgs struct {
+	Action      string `default:"stats" description:"Action to perform: stats or search."`
+	MinWidth    int    `default:"0" description:"Only find images at least this many pixels wide."`
+	MaxWidth    int    `default:"0" description:"Only find images at most this many pixels wide."`
+	MinHeight   int    `default:"0" description:"Only find images at least this many pixels tall."`
+	MaxHeight   int    `default:"0" description:"Only find images at most this many pixels tall."`
+	Orientation string `default:"" description:"Only find landscape, portrait or square images."`
+	Limit       int    `default:"5" description:"Number of images to show when searching."`
+}
+
+func _ImagesHandler(message *discordgo.MessageCreate, args _ImagesArgs) {
+	switch args.Action {
+	case "stats":
+		embed, err := _ImageStats(message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error fetching image statistics")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		session.ChannelMessageSendEmbed(message.ChannelID, embed)
+	case "search":
+		embeds, total, err := _SearchImages(message.GuildID, message.Author.ID, args)
+		if err != nil {
+			log.Error().Err(err).Msg("Error searching images")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		if len(embeds) == 0 {
+			session.ChannelMessageSend(message.ChannelID, "No matching images found.")
+			return
+		}
+		session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+			Content: fmt.Sprintf("Showing %d of %d matching images.", len(embeds), total),
+			Embeds:  embeds,
+		})
+	default:
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown action `%s`.", args.Action))
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/rs/zerolog/log"
+)
+
+// Channel ingests stream their documents through go-elasticsearch's BulkIndexer, which sends them from background workers
+// as its buffers fill, so that fetching the next page of history from Discord overlaps with indexing the last one.
+// The BulkIndexer in this version of the client can't set a version on each document, so documents are sent with the
+// create action, which never overwrites one that is already indexed. Documents that already exist, were rejected
+// for transient reasons or were in a request that failed are indexed afterwards through _BulkIndex with their usual
+// external version, so that an older copy of a message still can't replace a newer one.
+
+// _IndexerMessage tracks the documents of a single message sent through a _MessageIndexer
+type _IndexerMessage struct {
+	items    []_BulkItem
+	resolved []bool
+	failed   bool
+}
+
+// _MessageIndexer indexes the messages of a channel through a BulkIndexer
+type _MessageIndexer struct {
+	indexer esutil.BulkIndexer
+	stats   *_IngestStats
+
+	lock     sync.Mutex
+	messages []*_IndexerMessage
+	failures []_BulkFailure
+}
+
+func _NewMessageIndexer(channelID string, stats *_IngestStats) (*_MessageIndexer, error) {
+	messageIndexer := &_MessageIndexer{stats: stats}
+	indexer, err := esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:   esClient,
+		Routing:  _DocumentRouting(channelID),
+		Pipeline: _IndexPipeline(_ChannelWriteIndex("messages", channelID)),
+		OnFlushStart: func(ctx context.Context) context.Context {
+			_RecordMetric(_MetricBulkRequests, 1)
+			return ctx
+		},
+		OnError: func(_ context.Context, err error) {
+			_RecordMetric(_MetricESErrors, 1)
+			log.Warn().Err(err).Str("channel_id", channelID).Msg("Bulk indexer request failed, its documents will be retried")
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating bulk indexer: %w", err)
+	}
+	messageIndexer.indexer = indexer
+	return messageIndexer, nil
+}
+
+// Add queues a batch of messages to be indexed, where each entry holds the items of a single message
+func (indexer *_MessageIndexer) Add(batch [][]_BulkItem) error {
+	indexer.countIndexed()
+
+	batch, err := _ResolveBatchIndices(batch)
+	if err != nil {
+		return err
+	}
+
+	for _, messageItems := range batch {
+		message := &_IndexerMessage{items: messageItems, resolved: make([]bool, len(messageItems))}
+		indexer.lock.Lock()
+		indexer.messages = append(indexer.messages, message)
+		indexer.lock.Unlock()
+
+		for position, item := range messageItems {
+			body, err := json.Marshal(item.Body)
+			if err != nil {
+				return fmt.Errorf("error encoding document %s: %w", item.DocumentID, err)
+			}
+
+			position, item := position, item
+			_RecordMetric(_MetricBulkDocuments, 1)
+			err = indexer.indexer.Add(context.Background(), esutil.BulkIndexerItem{
+				Index:      item.Index,
+				Action:     "create",
+				DocumentID: item.DocumentID,
+				Body:       bytes.NewReader(body),
+				OnSuccess: func(context.Context, esutil.BulkIndexerItem, esutil.BulkIndexerResponseItem) {
+					_RecordMetric(_MetricDocumentsIndexed, 1)
+					indexer.lock.Lock()
+					message.resolved[position] = true
+					indexer.lock.Unlock()
+				},
+				OnFailure: func(_ context.Context, _ esutil.BulkIndexerItem, result esutil.BulkIndexerResponseItem, _ error) {
+					// Documents that already exist, or were rejected for transient reasons, are left for the versioned pass
+					if result.Status == http.StatusConflict || result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+						return
+					}
+					_RecordMetric(_MetricESErrors, 1)
+					indexer.lock.Lock()
+					message.resolved[position] = true
+					message.failed = message.failed || position == 0
+					indexer.failures = append(indexer.failures, _BulkFailure{
+						Item:   item,
+						Reason: fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason),
+					})
+					indexer.lock.Unlock()
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error adding document to bulk indexer: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// _ResolveBatchIndices resolves the indices of the items of a batch of messages with a single lookup,
+// see _ResolveExistingIndices
+func _ResolveBatchIndices(batch [][]_BulkItem) ([][]_BulkItem, error) {
+	items := make([]_BulkItem, 0, len(batch))
+	for _, messageItems := range batch {
+		items = append(items, messageItems...)
+	}
+	items, err := _ResolveExistingIndices(items)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([][]_BulkItem, 0, len(batch))
+	for _, messageItems := range batch {
+		resolved = append(resolved, items[:len(messageItems)])
+		items = items[len(messageItems):]
+	}
+	return resolved, nil
+}
+
+// countIndexed counts the messages whose documents have all been created and stops tracking them,
+// so that a long ingest only holds on to the documents still being sent
+func (indexer *_MessageIndexer) countIndexed() {
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+
+	pending := make([]*_IndexerMessage, 0, len(indexer.messages))
+	for _, message := range indexer.messages {
+		done := true
+		for _, resolved := range message.resolved {
+			done = done && resolved
+		}
+		if !done {
+			pending = append(pending, message)
+		} else if !message.failed {
+			indexer.stats.Indexed++
+		}
+	}
+	indexer.messages = pending
+}
+
+// Close waits for every queued document to be sent, then indexes the documents that weren't created through _BulkIndex.
+// Documents that still fail are dead lettered, and the messages that were indexed are counted in the ingest statistics.
+func (indexer *_MessageIndexer) Close() error {
+	err := indexer.indexer.Close(context.Background())
+	if err != nil {
+		return fmt.Errorf("error closing bulk indexer: %w", err)
+	}
+
+	indexer.lock.Lock()
+	defer indexer.lock.Unlock()
+
+	if len(indexer.failures) > 0 {
+		_DeadLetter(indexer.failures)
+		indexer.stats.DeadLettered += len(indexer.failures)
+	}
+
+	remaining := make([][]_BulkItem, 0)
+	for _, message := range indexer.messages {
+		unresolved := make([]_BulkItem, 0)
+		for position, item := range message.items {
+			if !message.resolved[position] {
+				unresolved = append(unresolved, item)
+			}
+		}
+		switch {
+		case len(unresolved) > 0 && !message.failed:
+			remaining = append(remaining, unresolved)
+		case len(unresolved) > 0:
+			// The message document itself failed, so its attachments are indexed without counting the message again
+			failed, err := _BulkIndex(unresolved)
+			if len(failed) > 0 {
+				_DeadLetter(failed)
+				indexer.stats.DeadLettered += len(failed)
+			}
+			if err != nil {
+				return err
+			}
+		case !message.failed:
+			indexer.stats.Indexed++
+		}
+	}
+	if len(remaining) > 0 {
+		log.Debug().Int("count", len(remaining)).Msg("Indexing documents that weren't created by the bulk indexer")
+	}
+	return _IndexMessageBatch(remaining, indexer.stats)
+}
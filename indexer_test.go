@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMessageIndexer(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.RouteByChannel = true })
+
+	statuses := map[string]int{"1": http.StatusCreated, "a1": http.StatusBadRequest, "2": http.StatusConflict}
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		if req.Path != "/_bulk" {
+			return http.StatusOK, `{}`
+		}
+
+		items := make([]map[string]interface{}, 0)
+		lines := req.BulkLines(t)
+		for i := 0; i < len(lines); i += 2 {
+			for action, metadata := range lines[i] {
+				id := metadata.(map[string]interface{})["_id"].(string)
+				status := http.StatusCreated
+				if action == "create" {
+					status = statuses[id]
+				}
+				result := map[string]interface{}{"_id": id, "status": status}
+				if status >= 300 {
+					result["error"] = map[string]interface{}{"type": "error", "reason": http.StatusText(status)}
+				}
+				items = append(items, map[string]interface{}{action: result})
+			}
+		}
+		body, _ := json.Marshal(map[string]interface{}{"errors": true, "items": items})
+		return http.StatusOK, string(body)
+	})
+
+	stats := &_IngestStats{}
+	indexer, err := _NewMessageIndexer("7", stats)
+	if err != nil {
+		t.Fatalf("error creating indexer: %s", err)
+	}
+	err = indexer.Add([][]_BulkItem{
+		{
+			{Index: "messages", DocumentID: "1", Version: 10, Routing: "7", Body: map[string]interface{}{"content": "one"}},
+			{Index: "attachments", DocumentID: "a1", Version: 10, Routing: "7", Body: map[string]interface{}{"filename": "a.png"}},
+		},
+		{{Index: "messages", DocumentID: "2", Version: 20, Routing: "7", Body: map[string]interface{}{"content": "two"}}},
+	})
+	if err != nil {
+		t.Fatalf("error adding messages: %s", err)
+	}
+	err = indexer.Close()
+	if err != nil {
+		t.Fatalf("got error %s, want the ingest to continue past failed documents", err)
+	}
+
+	if stats.Indexed != 2 || stats.DeadLettered != 1 {
+		t.Errorf("got %d indexed and %d dead lettered, want 2 and 1", stats.Indexed, stats.DeadLettered)
+	}
+
+	var versioned, deadLettered []map[string]interface{}
+	for _, req := range transport.Requests() {
+		lines := req.BulkLines(t)
+		if _, created := lines[0]["create"]; created {
+			if req.Query["routing"] != "7" {
+				t.Errorf("got routing %q, want the channel's", req.Query["routing"])
+			}
+			continue
+		}
+		if strings.Contains(string(req.Body), _DeadLetterIndex) {
+			deadLettered = append(deadLettered, lines...)
+		} else {
+			versioned = append(versioned, lines...)
+		}
+	}
+
+	if len(versioned) != 2 {
+		t.Fatalf("got versioned lines %v, want only the document that already existed", versioned)
+	}
+	action := versioned[0]["index"].(map[string]interface{})
+	if action["_id"] != "2" || action["version"] != float64(20) || action["version_type"] != "external_gte" {
+		t.Errorf("got action %v, want document 2 indexed with its version", action)
+	}
+	if len(deadLettered) != 2 || deadLettered[1]["document_id"] != "a1" {
+		t.Errorf("got dead letters %v, want only attachment a1", deadLettered)
+	}
+}
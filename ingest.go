@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _IngestStats tracks the outcome of ingesting a backlog of messages
+type _IngestStats struct {
+	Indexed        int
+	SkippedShort   int
+	SkippedBlocked int
+
+	SkippedAttachments int
+	SkippedTimeout     int
+
+	// DeadLettered is the number of documents that failed to index and were stored in the dead letter index
+	DeadLettered int
+
+	// ResumeFrom is the ID of the oldest message ingested when the run stopped at its message limit
+	ResumeFrom string
+}
+
+// _ErrIngestLimitReached stops pagination once an ingest run has fetched as many messages as it is allowed to
+var _ErrIngestLimitReached = errors.New("reached the maximum number of messages for this run")
+
+// _ErrMissingChannelPermissions is returned when the bot isn't allowed to read the history of a channel
+var _ErrMissingChannelPermissions = errors.New("missing the View Channel or Read Message History permission")
+
+// _ReadHistoryPermissions are the permissions the bot needs in a channel to ingest its backlog
+const _ReadHistoryPermissions = int64(discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory)
+
+// _CheckReadHistoryPermissions returns an error if the bot can't read the message history of a channel,
+// so that ingestion can skip it up front instead of failing partway through pagination
+func _CheckReadHistoryPermissions(channelID string) error {
+	permissions, err := session.UserChannelPermissions(session.State.User.ID, channelID)
+	if err != nil {
+		return fmt.Errorf("error checking channel permissions: %w", err)
+	}
+	if permissions&_ReadHistoryPermissions != _ReadHistoryPermissions {
+		return fmt.Errorf("unable to ingest channel %s: %w", channelID, _ErrMissingChannelPermissions)
+	}
+	return nil
+}
+
+// Summary returns a short human-readable description of the ingest run
+func (stats *_IngestStats) Summary() string {
+	parts := []string{fmt.Sprintf("%d messages indexed", stats.Indexed)}
+	if stats.SkippedShort > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped for being too short", stats.SkippedShort))
+	}
+	if stats.SkippedBlocked > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped from blocked users", stats.SkippedBlocked))
+	}
+	if stats.SkippedAttachments > 0 {
+		parts = append(parts, fmt.Sprintf("%d attachments skipped for their type", stats.SkippedAttachments))
+	}
+	if stats.SkippedTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped for taking too long to index", stats.SkippedTimeout))
+	}
+	if stats.DeadLettered > 0 {
+		parts = append(parts, fmt.Sprintf("%d documents failed to index and were dead lettered", stats.DeadLettered))
+	}
+	summary := "(" + strings.Join(parts, ", ") + ")"
+	if stats.ResumeFrom != "" {
+		summary += fmt.Sprintf(" Stopped at the message limit, continue with Before=%s.", stats.ResumeFrom)
+	}
+	return summary
+}
+
+// _IndexMessageBatch indexes the bulk items for a batch of messages, where each entry holds the items of a single message.
+// When a message indexing timeout is configured, the batch is given that long per message. If it runs out of time,
+// the messages are retried one by one with their own deadline, and any that still time out are dead lettered and skipped
+// so that a single pathological message can't stall the rest of the ingest.
+func _IndexMessageBatch(batch [][]_BulkItem, stats *_IngestStats) error {
+	items := make([]_BulkItem, 0, len(batch))
+	for _, messageItems := range batch {
+		items = append(items, messageItems...)
+	}
+
+	if config.MessageIndexTimeout <= 0 {
+		failed, err := _BulkIndex(items)
+		return _RecordBatchResults(batch, failed, err, stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.MessageIndexTimeout*time.Duration(len(batch)))
+	failed, err := _BulkIndexContext(ctx, items)
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return _RecordBatchResults(batch, failed, err, stats)
+	}
+
+	log.Warn().Int("count", len(batch)).Msg("Indexing batch timed out, indexing messages individually")
+	for _, messageItems := range batch {
+		ctx, cancel := context.WithTimeout(context.Background(), config.MessageIndexTimeout)
+		failed, err := _BulkIndexContext(ctx, messageItems)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			_DeadLetter(failed)
+			log.Warn().Str("message_id", messageItems[0].DocumentID).Dur("timeout", config.MessageIndexTimeout).Msg("Skipping message that took too long to index")
+			stats.SkippedTimeout++
+			continue
+		}
+		err = _RecordBatchResults([][]_BulkItem{messageItems}, failed, err, stats)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// _RecordBatchResults dead letters the documents of a batch that failed to index and counts the messages that were indexed.
+// Individual documents failing don't stop the ingest, only the request itself failing does.
+func _RecordBatchResults(batch [][]_BulkItem, failed []_BulkFailure, err error, stats *_IngestStats) error {
+	if len(failed) > 0 {
+		_DeadLetter(failed)
+	}
+	if err != nil {
+		return err
+	}
+
+	failedIDs := make(map[string]bool, len(failed))
+	for _, failure := range failed {
+		failedIDs[_DeadLetterID(failure.Item)] = true
+	}
+	for _, messageItems := range batch {
+		if !failedIDs[_DeadLetterID(messageItems[0])] {
+			stats.Indexed++
+		}
+	}
+	stats.DeadLettered += len(failed)
+	return nil
+}
+
+// _TimestampFormat is RFC 3339 with millisecond precision, matching the precision of Elasticsearch's date type
+const _TimestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// _FormatTimestamp normalizes a timestamp to a UTC string that Elasticsearch's date mapping always accepts,
+// rather than relying on the default JSON encoding of time.Time
+func _FormatTimestamp(timestamp time.Time) string {
+	return timestamp.UTC().Format(_TimestampFormat)
+}
+
+// _IsTooShort returns whether a message should be skipped for having less content than the configured minimum.
+// Messages with attachments or embeds are always kept, regardless of their content, as are messages whose content
+// was withheld, so that their metadata is still indexed.
+func _IsTooShort(message *discordgo.Message) bool {
+	if config.MinContentLength <= 0 || len(message.Attachments) > 0 || len(message.Embeds) > 0 || _IsContentWithheld(message) {
+		return false
+	}
+	return utf8.RuneCountInString(message.Content) < config.MinContentLength
+}
+
+// _ValidateAttachmentTypes checks that every entry in the attachment type allowlist is either a MIME type prefix
+// (such as image/) or a file extension (such as .png)
+func _ValidateAttachmentTypes(allowlist []string) error {
+	for _, allowed := range allowlist {
+		if !strings.Contains(allowed, "/") && !strings.HasPrefix(allowed, ".") {
+			return fmt.Errorf("attachment type %q must be a MIME type prefix or a file extension starting with a dot", allowed)
+		}
+	}
+	return nil
+}
+
+// _IsAllowedAttachment returns whether an attachment matches the configured type allowlist.
+// An empty allowlist allows every attachment.
+func _IsAllowedAttachment(attachment *discordgo.MessageAttachment) bool {
+	if len(config.AttachmentTypeAllowlist) == 0 {
+		return true
+	}
+
+	contentType := strings.ToLower(attachment.ContentType)
+	filename := strings.ToLower(attachment.Filename)
+	for _, allowed := range config.AttachmentTypeAllowlist {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, ".") {
+			if strings.HasSuffix(filename, allowed) {
+				return true
+			}
+		} else if contentType != "" && strings.HasPrefix(contentType, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestIndexMessageBatchDeadLettersFailures(t *testing.T) {
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		if strings.Contains(string(req.Body), `"_index":"`+_DeadLetterIndex+`"`) {
+			return http.StatusOK, `{"errors": false, "items": [{"index": {"_index": "dead-letter", "_id": "messages:2", "status": 201}}]}`
+		}
+		return http.StatusOK, `{"errors": true, "items": [
+			{"index": {"_index": "messages", "_id": "1", "status": 201}},
+			{"index": {"_index": "messages", "_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "bad"}}},
+			{"index": {"_index": "messages", "_id": "3", "status": 201}}
+		]}`
+	})
+
+	batch := [][]_BulkItem{
+		{{Index: "messages", DocumentID: "1", Version: 1, Body: map[string]interface{}{}}},
+		{{Index: "messages", DocumentID: "2", Version: 1, Body: map[string]interface{}{}}},
+		{{Index: "messages", DocumentID: "3", Version: 1, Body: map[string]interface{}{}}},
+	}
+	stats := &_IngestStats{}
+	err := _IndexMessageBatch(batch, stats)
+	if err != nil {
+		t.Fatalf("got error %s, want the ingest to continue past failed documents", err)
+	}
+	if stats.Indexed != 2 || stats.DeadLettered != 1 {
+		t.Errorf("got %d indexed and %d dead lettered, want 2 and 1", stats.Indexed, stats.DeadLettered)
+	}
+
+	requests := transport.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want the batch and its dead letters", len(requests))
+	}
+	deadLetters := requests[1].BulkLines(t)
+	if len(deadLetters) != 2 || deadLetters[1]["document_id"] != "2" {
+		t.Errorf("got dead letters %v, want only document 2", deadLetters)
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		want      string
+	}{
+		{"utc", time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), "2021-03-04T05:06:07.000Z"},
+		{"offset", time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("", -5*60*60)), "2021-03-04T10:06:07.000Z"},
+		{"nanoseconds", time.Date(2021, 3, 4, 5, 6, 7, 123456789, time.UTC), "2021-03-04T05:06:07.123Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := _FormatTimestamp(test.timestamp)
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMessageTimestampRoundTrip(t *testing.T) {
+	setTestSession(t)
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		return http.StatusCreated, `{}`
+	})
+
+	sent := time.Date(2021, 3, 4, 5, 6, 7, 891000000, time.FixedZone("", 2*60*60))
+	message := &discordgo.Message{
+		ID:        "42",
+		ChannelID: "7",
+		GuildID:   "1",
+		Content:   "hello",
+		Author:    &discordgo.User{ID: "5", Username: "user"},
+		Timestamp: sent,
+	}
+	err := _InsertIndex(_BuildMessageDocument(message), "messages", message.ID, _DocumentVersion(message), "")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	var stored map[string]interface{}
+	err = json.Unmarshal(transport.Requests()[0].Body, &stored)
+	if err != nil {
+		t.Fatalf("error decoding indexed document: %s", err)
+	}
+	timestamp, ok := stored["timestamp"].(string)
+	if !ok {
+		t.Fatalf("got timestamp %v, want a string", stored["timestamp"])
+	}
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		t.Fatalf("got timestamp %q that doesn't parse as a date: %s", timestamp, err)
+	}
+	if !parsed.Equal(sent) {
+		t.Errorf("got %s, want %s", parsed, sent)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _IngestRange ingests the messages in a channel sent after afterID and before beforeID, both exclusive.
+// Pages are walked backwards from beforeID, stopping at the first message that isn't after afterID.
+func _IngestRange(channelID string, afterID uint64, beforeID uint64) (*_IngestStats, error) {
+	stats := &_IngestStats{}
+	before := strconv.FormatUint(beforeID, 10)
+	for {
+		messages, err := _ChannelMessages(channelID, 100, before, "")
+		if err != nil {
+			return stats, err
+		}
+		if len(messages) == 0 {
+			return stats, nil
+		}
+
+		inRange := make([]*discordgo.Message, 0, len(messages))
+		reachedStart := false
+		for _, message := range messages {
+			id, err := strconv.ParseUint(message.ID, 10, 64)
+			if err != nil || id <= afterID {
+				reachedStart = true
+				break
+			}
+			inRange = append(inRange, message)
+		}
+		inRange, reachedCutoff := _TrimExpired(inRange)
+
+		if len(inRange) > 0 {
+			err = _IngestMessageArray(inRange, stats)
+			if err != nil {
+				return stats, fmt.Errorf("error when processing messages: %w", err)
+			}
+			log.Debug().Int("count", len(inRange)).Msg("Finished processing page")
+		}
+		if reachedStart || reachedCutoff {
+			return stats, nil
+		}
+		before = messages[len(messages)-1].ID
+	}
+}
+
+type _IngestRangeArgs struct {
+	Channel string `description:"Channel to ingest logs from."`
+	After   string `description:"Only ingest messages sent after this message ID."`
+	Before  string `description:"Only ingest messages sent before this message ID."`
+}
+
+func _IngestRangeHandler(message *discordgo.MessageCreate, args _IngestRangeArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	afterID, afterErr := strconv.ParseUint(args.After, 10, 64)
+	beforeID, beforeErr := strconv.ParseUint(args.Before, 10, 64)
+	if afterErr != nil || beforeErr != nil {
+		session.ChannelMessageSend(message.ChannelID, "Please provide valid message IDs.")
+		return
+	}
+	if afterID >= beforeID {
+		session.ChannelMessageSend(message.ChannelID, "The after message ID must be older than the before message ID.")
+		return
+	}
+
+	stats, err := _IngestRange(channel.ID, afterID, beforeID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error ingesting messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Messages in range successfully ingested from <#%s>. %s", channel.ID, stats.Summary()))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxLagChannels = 25
+
+type _LatestTimestampAggregation struct {
+	Buckets []struct {
+		Key    string `json:"key"`
+		Latest struct {
+			ValueAsString string `json:"value_as_string"`
+		} `json:"latest"`
+	} `json:"buckets"`
+}
+
+// _LatestIndexedTimestamps returns the timestamp of the newest indexed message for each of the given channels,
+// which must all belong to the same guild
+func _LatestIndexedTimestamps(channelIDs []string) (map[string]time.Time, error) {
+	index := _ReadIndex("messages")
+	if len(channelIDs) > 0 {
+		index = _ChannelReadIndex("messages", channelIDs[0])
+	}
+
+	resp, err := _SearchRouted([]string{index}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{"channel_id": channelIDs},
+		},
+		"aggs": map[string]interface{}{
+			"channels": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "channel_id", "size": len(channelIDs)},
+				"aggs": map[string]interface{}{
+					"latest": map[string]interface{}{"max": map[string]interface{}{"field": "timestamp"}},
+				},
+			},
+		},
+	}, _ChannelRouting(channelIDs...))
+	if err != nil {
+		return nil, err
+	}
+
+	var channels _LatestTimestampAggregation
+	err = json.Unmarshal(resp.Aggregations["channels"], &channels)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding channel aggregation: %w", err)
+	}
+
+	latest := make(map[string]time.Time, len(channels.Buckets))
+	for _, bucket := range channels.Buckets {
+		timestamp, err := time.Parse(time.RFC3339, bucket.Latest.ValueAsString)
+		if err != nil {
+			continue
+		}
+		latest[bucket.Key] = timestamp
+	}
+	return latest, nil
+}
+
+type _LagArgs struct {
+	All bool `default:"false" description:"Report lag for every channel in the guild. Admin only."`
+}
+
+func _LagHandler(message *discordgo.MessageCreate, args _LagArgs) {
+	var channels []*discordgo.Channel
+	if args.All {
+		if !_IsAdmin(message.Author.ID) {
+			log.Warn().Str("author_id", message.Author.ID).Msg("User does not have access to this command")
+			return
+		}
+		channels = _ReadableTextChannels(message.GuildID)
+		if len(channels) > _MaxLagChannels {
+			channels = channels[:_MaxLagChannels]
+		}
+	} else {
+		channel, err := _ResolveGuildChannel(message.ChannelID, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		channels = []*discordgo.Channel{channel}
+	}
+
+	channelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	latest, err := _LatestIndexedTimestamps(channelIDs)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching latest indexed timestamps")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed("Ingestion lag")
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(channels))
+	embed.Footer = _EmbedFooter(fmt.Sprintf("⚠️ marks channels lagging by more than %s", config.LagWarningThreshold))
+	for _, channel := range channels {
+		value := "Up to date"
+		newest, err := session.ChannelMessages(channel.ID, 1, "", "", "")
+		if err != nil {
+			value = "Unable to fetch messages"
+		} else if len(newest) == 0 {
+			value = "No messages"
+		} else if indexed, ok := latest[channel.ID]; !ok {
+			value = "⚠️ Not ingested"
+		} else if newest[0].Timestamp.After(indexed) {
+			lag := newest[0].Timestamp.Sub(indexed).Round(time.Second)
+			value = lag.String()
+			if lag > config.LagWarningThreshold {
+				value = "⚠️ " + value
+			}
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "#" + channel.Name,
+			Value:  value,
+			Inline: true,
+		})
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxLeaderboardUsers = 25
+
+// Messages ingested before author_bot was stored can't be excluded by the query, so extra authors are fetched
+// to make up for any bots that are only recognised once their member is resolved
+const _LeaderboardBotSlack = 10
+
+var _LeaderboardMedals = []string{"🥇", "🥈", "🥉"}
+
+type _LeaderboardArgs struct {
+	Channel     string `default:"" description:"Only count messages from this channel."`
+	Days        int    `default:"0" description:"Only count messages from this many days ago onwards. 0 includes every message."`
+	Limit       int    `default:"10" description:"Number of users to show."`
+	IncludeBots bool   `default:"false" description:"Include messages sent by bots."`
+}
+
+func _LeaderboardHandler(message *discordgo.MessageCreate, args _LeaderboardArgs) {
+	if args.Limit < 1 || args.Limit > _MaxLeaderboardUsers {
+		args.Limit = _MaxLeaderboardUsers
+	}
+
+	index := _GuildReadIndex("messages", message.GuildID)
+	var scopeFilter map[string]interface{}
+	var routing []string
+	scope := "the server"
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		index = _ChannelReadIndex("messages", channel.ID)
+		scopeFilter = map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+		routing = _ChannelRouting(channel.ID)
+		scope = "#" + channel.Name
+	} else {
+		var err error
+		scopeFilter, err = _GuildMessagesFilter(message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+
+	filters := []interface{}{scopeFilter, _NotDeletedFilter}
+	if args.Days > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", args.Days)}},
+		})
+	}
+	query := map[string]interface{}{"filter": filters}
+	size := args.Limit
+	if !args.IncludeBots {
+		query["must_not"] = map[string]interface{}{"term": map[string]interface{}{"author_bot": true}}
+		size += _LeaderboardBotSlack
+	}
+
+	resp, err := _SearchRouted([]string{index}, map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"bool": query},
+		"aggs": map[string]interface{}{
+			"authors": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "author_id", "size": size},
+			},
+		},
+	}, routing)
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating message authors")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var authors _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["authors"], &authors)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding message authors")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, args.Limit)
+	for _, bucket := range authors.Buckets {
+		authorID := fmt.Sprint(bucket.Key)
+		name := fmt.Sprintf("<@%s>", authorID)
+		member, err := _FetchMember(message.GuildID, authorID)
+		if err == nil {
+			if member.User.Bot && !args.IncludeBots {
+				continue
+			}
+			name = _MemberDisplayName(member)
+		}
+
+		rank := fmt.Sprintf("%d.", len(lines)+1)
+		if len(lines) < len(_LeaderboardMedals) {
+			rank = _LeaderboardMedals[len(lines)]
+		}
+		lines = append(lines, fmt.Sprintf("%s %s - %d messages", rank, name, bucket.DocCount))
+		if len(lines) == args.Limit {
+			break
+		}
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Most active users in %s", scope))
+	embed.Description = strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		embed.Description = "No messages found."
+	}
+	if args.Days > 0 {
+		embed.Footer = _EmbedFooter(fmt.Sprintf("Messages from the last %d days", args.Days))
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
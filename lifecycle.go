@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+const _LifecyclePolicyName = "elkbot"
+
+var _LifecyclePolicy = map[string]interface{}{
+	"policy": map[string]interface{}{
+		"phases": map[string]interface{}{
+			"hot": map[string]interface{}{
+				"actions": map[string]interface{}{
+					"rollover": map[string]interface{}{
+						"max_age":  "30d",
+						"max_size": "50gb",
+					},
+				},
+			},
+		},
+	},
+}
+
+const _WriteAliasSuffix = "-write"
+
+// _WriteIndex returns the index or alias that documents belonging to a base index should be written to.
+// When time-based indices are in use, documents that already exist are written to the index holding them instead,
+// see _ResolveExistingIndices.
+func _WriteIndex(base string) string {
+	if config.UseTimeBasedIndices {
+		return base + _WriteAliasSuffix
+	}
+	return base
+}
+
+// _ResolveExistingIndices points items written to a time-based write alias at the backing index that already holds
+// their document, if any. Writing through the alias always targets the newest backing index, so re-ingesting or editing
+// a message after a rollover would otherwise leave a second copy of it under the same ID in the new index.
+func _ResolveExistingIndices(items []_BulkItem) ([]_BulkItem, error) {
+	if !config.UseTimeBasedIndices {
+		return items, nil
+	}
+
+	byAlias := make(map[string][]int)
+	for position, item := range items {
+		if strings.HasSuffix(item.Index, _WriteAliasSuffix) {
+			byAlias[item.Index] = append(byAlias[item.Index], position)
+		}
+	}
+	if len(byAlias) == 0 {
+		return items, nil
+	}
+
+	resolved := append([]_BulkItem{}, items...)
+	for alias, positions := range byAlias {
+		documentIDs := make([]string, 0, len(positions))
+		routingSet := make(map[string]bool)
+		for _, position := range positions {
+			documentIDs = append(documentIDs, items[position].DocumentID)
+			routingSet[items[position].Routing] = true
+		}
+		var routing []string
+		if !routingSet[""] {
+			for value := range routingSet {
+				routing = append(routing, value)
+			}
+		}
+
+		resp, err := _SearchRouted([]string{_ReadIndex(strings.TrimSuffix(alias, _WriteAliasSuffix))}, map[string]interface{}{
+			"size":    len(documentIDs),
+			"_source": false,
+			"query":   map[string]interface{}{"ids": map[string]interface{}{"values": documentIDs}},
+		}, routing)
+		if err != nil {
+			return items, fmt.Errorf("error finding existing documents: %w", err)
+		}
+
+		existing := make(map[string]string, len(resp.Hits.Hits))
+		for _, hit := range resp.Hits.Hits {
+			existing[hit.ID] = hit.Index
+		}
+		for _, position := range positions {
+			if index, ok := existing[items[position].DocumentID]; ok {
+				resolved[position].Index = index
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// _ReadIndex returns the index pattern that queries against a base index should target.
+// The pattern also matches the original non-time-based index, so data ingested before enabling
+// time-based indices remains searchable. With per-guild indices, it matches the indices of every guild.
+func _ReadIndex(base string) string {
+	if config.UseTimeBasedIndices || config.PerGuildIndices {
+		return base + "*"
+	}
+	return base
+}
+
+func _EnsureLifecyclePolicy() error {
+	reqBody, _ := json.Marshal(_LifecyclePolicy)
+
+	req := esapi.ILMPutLifecycleRequest{
+		Policy: _LifecyclePolicyName,
+		Body:   bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	return _DecodeResponse(resp, nil)
+}
+
+// _EnsureTimeBasedIndex bootstraps the first time-based index and write alias for a base index
+func _EnsureTimeBasedIndex(base string) error {
+	alias := _WriteIndex(base)
+
+	aliasReq := esapi.IndicesExistsAliasRequest{
+		Name: []string{alias},
+	}
+	aliasResp, err := aliasReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	aliasResp.Body.Close()
+	if aliasResp.StatusCode == http.StatusOK {
+		log.Debug().Str("alias", alias).Msg("Write alias already exists")
+		return nil
+	}
+
+	createBody, _ := json.Marshal(map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	})
+	createReq := esapi.IndicesCreateRequest{
+		Index: url.PathEscape(fmt.Sprintf("<%s-{now/M{yyyy.MM}}-000001>", base)),
+		Body:  bytes.NewReader(createBody),
+	}
+	createResp, err := createReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(createResp, nil)
+	if err != nil {
+		return fmt.Errorf("error creating initial index for %s: %w", base, err)
+	}
+	log.Info().Str("alias", alias).Msg("Created time-based index")
+
+	return nil
+}
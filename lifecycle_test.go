@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBulkIndexWritesToExistingBackingIndex(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.UseTimeBasedIndices = true })
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_search") {
+			return http.StatusOK, `{"hits": {"total": {"value": 1}, "hits": [{"_index": "messages-2021.01-000001", "_id": "1"}]}}`
+		}
+		return http.StatusOK, `{"errors": false, "items": []}`
+	})
+
+	failed, err := _BulkIndex([]_BulkItem{
+		{Index: "messages-write", DocumentID: "1", Version: 10, Routing: "7", Body: map[string]interface{}{"content": "edited"}},
+		{Index: "messages-write", DocumentID: "2", Version: 20, Routing: "7", Body: map[string]interface{}{"content": "new"}},
+	})
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("got failures %+v and error %v", failed, err)
+	}
+
+	requests := transport.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want the lookup and the bulk request", len(requests))
+	}
+	if requests[0].Path != "/messages*/_search" || requests[0].Query["routing"] != "7" {
+		t.Errorf("got lookup %s?routing=%s, want it across every backing index", requests[0].Path, requests[0].Query["routing"])
+	}
+	lines := requests[1].BulkLines(t)
+	if index := lines[0]["index"].(map[string]interface{})["_index"]; index != "messages-2021.01-000001" {
+		t.Errorf("got existing document written to %v, want the backing index holding it", index)
+	}
+	if index := lines[2]["index"].(map[string]interface{})["_index"]; index != "messages-write" {
+		t.Errorf("got new document written to %v, want the write alias", index)
+	}
+}
+
+func TestInsertIndexWritesToExistingBackingIndex(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.UseTimeBasedIndices = true })
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_search") {
+			return http.StatusOK, `{"hits": {"total": {"value": 1}, "hits": [{"_index": "messages-2021.01-000001", "_id": "1"}]}}`
+		}
+		return http.StatusOK, `{}`
+	})
+
+	err := _InsertIndex(map[string]interface{}{"content": "edited"}, "messages-write", "1", 10, "")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if path := transport.Requests()[1].Path; path != "/messages-2021.01-000001/_doc/1" {
+		t.Errorf("got %s, want the edit written to the backing index holding the document", path)
+	}
+}
+
+func TestResolveExistingIndicesWithoutTimeBasedIndices(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.UseTimeBasedIndices = false })
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		return http.StatusOK, `{}`
+	})
+
+	items := []_BulkItem{{Index: "messages", DocumentID: "1"}}
+	resolved, err := _ResolveExistingIndices(items)
+	if err != nil || resolved[0].Index != "messages" {
+		t.Fatalf("got %+v and error %v, want the items unchanged", resolved, err)
+	}
+	if len(transport.Requests()) != 0 {
+		t.Error("got a lookup, want none without time-based indices")
+	}
+}
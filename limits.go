@@ -0,0 +1,52 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Oversized documents can exceed Elasticsearch's field or request size limits and fail the whole bulk request they're in,
+// so documents are capped before they're indexed. The original content length is still recorded in content_length.
+
+// _TruncateContent truncates a message document's content to the configured maximum, flagging documents that were changed
+func _TruncateContent(message *discordgo.Message, document map[string]interface{}) {
+	if config.MaxIndexedContentLength <= 0 {
+		return
+	}
+
+	truncated := false
+	for _, field := range []string{"content", "original_content"} {
+		value, ok := document[field].(string)
+		if !ok {
+			continue
+		}
+		content := []rune(value)
+		if len(content) > config.MaxIndexedContentLength {
+			document[field] = string(content[:config.MaxIndexedContentLength])
+			truncated = true
+		}
+	}
+	if truncated {
+		log.Warn().Str("message_id", message.ID).Int("length", utf8.RuneCountInString(message.Content)).Int("max", config.MaxIndexedContentLength).Msg("Truncating message content")
+		document["truncated"] = true
+	}
+}
+
+// _IndexedAttachments returns the attachments of a message that should be indexed, which are those matching the type
+// allowlist up to the configured maximum per message
+func _IndexedAttachments(message *discordgo.Message) []*discordgo.MessageAttachment {
+	attachments := make([]*discordgo.MessageAttachment, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		if _IsAllowedAttachment(attachment) {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	if config.MaxIndexedAttachments > 0 && len(attachments) > config.MaxIndexedAttachments {
+		log.Warn().Str("message_id", message.ID).Int("count", len(attachments)).Int("max", config.MaxIndexedAttachments).Msg("Only indexing some of message's attachments")
+		attachments = attachments[:config.MaxIndexedAttachments]
+	}
+	return attachments
+}
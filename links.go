@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Links are extracted from message content when it is ingested, so that messages can be found by the sites they link to.
+// Each link's domain is stored along with its parent domains, so filtering by example.com also matches www.example.com.
+
+const _MaxLinkResults = 20
+
+var _URLPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// Punctuation that commonly follows a link in a sentence rather than being part of it
+const _URLTrailingPunctuation = ".,:;!?'\")]}*_~|"
+
+// _ExtractURLs returns the valid links in a message's content, without duplicates
+func _ExtractURLs(content string) []string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range _URLPattern.FindAllString(content, -1) {
+		match = strings.TrimRight(match, _URLTrailingPunctuation)
+		parsed, err := url.Parse(match)
+		if err != nil || parsed.Hostname() == "" || seen[match] {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+	}
+	return urls
+}
+
+// _LinkDomains returns the domains linked to by a set of URLs, including each domain's parent domains
+func _LinkDomains(urls []string) []string {
+	domains := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, link := range urls {
+		parsed, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		labels := strings.Split(strings.ToLower(parsed.Hostname()), ".")
+		for start := range labels {
+			if start > 0 && start == len(labels)-1 {
+				break
+			}
+			domain := strings.Join(labels[start:], ".")
+			if domain == "" || seen[domain] {
+				continue
+			}
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// _AddLinkFields adds the links in a message's content and the domains they point to to its document
+func _AddLinkFields(message *discordgo.Message, document map[string]interface{}) {
+	content, _ := document["content"].(string)
+	urls := _ExtractURLs(content)
+	if len(urls) == 0 {
+		return
+	}
+	document["urls"] = urls
+	document["domains"] = _LinkDomains(urls)
+}
+
+type _LinksArgs struct {
+	Channel string `description:"Channel to find links in."`
+	Domain  string `default:"" description:"Only include links to this domain or its subdomains."`
+	Limit   int    `default:"10" description:"Number of messages to show."`
+}
+
+func _LinksHandler(message *discordgo.MessageCreate, args _LinksArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxLinkResults {
+		args.Limit = _MaxLinkResults
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+		_NotDeletedFilter,
+	}
+	domain := strings.TrimPrefix(strings.ToLower(args.Domain), "www.")
+	if domain != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"domains": domain}})
+	} else {
+		filters = append(filters, map[string]interface{}{"exists": map[string]interface{}{"field": "urls"}})
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  args.Limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":  []interface{}{map[string]interface{}{"timestamp": "desc"}},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for links")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	title := fmt.Sprintf("Links in #%s", channel.Name)
+	if domain != "" {
+		title = fmt.Sprintf("Links to %s in #%s", domain, channel.Name)
+	}
+	embed := _NewEmbed(title)
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	embed.Footer = _EmbedFooter(fmt.Sprintf("%d matching messages", resp.Hits.Total.Value))
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No links found."
+	}
+	for _, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
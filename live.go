@@ -0,0 +1,276 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Live ingestion indexes new messages as they're sent, so that channels don't need to be re-ingested to stay up to date.
+// It can be paused for maintenance, such as an Elasticsearch upgrade, during which new messages are either dropped
+// or buffered in memory until ingestion is resumed, depending on the configured mode.
+// New messages are queued for a fixed pool of workers, so that a burst of messages can't start an unbounded number of
+// concurrent requests. When the queue is full, messages either wait briefly for room or are dropped, depending on the
+// configured overflow policy.
+// Each channel can also be limited to a share of the queue, so that a single busy channel can't crowd out the rest.
+// A channel's messages count against its share from being queued until they have been ingested, and messages beyond
+// it are handled by the same overflow policy.
+
+const _PausedModeDrop = "drop"
+const _PausedModeBuffer = "buffer"
+
+const _ResumeBatchSize = 100
+
+const _OverflowBlock = "block"
+const _OverflowDrop = "drop"
+
+// Dropped messages are only logged this often, rather than once for each message in a burst
+const _LiveDroppedLogInterval = 100
+
+var _LiveQueue chan *discordgo.Message
+var _LiveDropped int64
+
+// _LiveChannelSlots holds a semaphore for each channel, with one slot per message it can have queued or being ingested
+var _LiveChannelSlots = map[string]chan struct{}{}
+var _LiveChannelSlotsLock sync.Mutex
+
+// _LiveChannelCounters holds the number of live messages ingested from each channel, published through expvar
+var _LiveChannelCounters = expvar.NewMap("live_ingest_channels")
+
+var _IngestPaused int32
+
+var _PausedBuffer = make([]*discordgo.Message, 0)
+var _PausedDropped = 0
+var _PausedLock sync.Mutex
+
+// _IsIngestPaused returns whether live ingestion is currently paused
+func _IsIngestPaused() bool {
+	return atomic.LoadInt32(&_IngestPaused) == 1
+}
+
+// _ValidatePausedMode checks that the configured paused ingestion mode is known
+func _ValidatePausedMode(mode string) error {
+	if mode != _PausedModeDrop && mode != _PausedModeBuffer {
+		return fmt.Errorf("unknown paused ingest mode %q, expected %s or %s", mode, _PausedModeDrop, _PausedModeBuffer)
+	}
+	return nil
+}
+
+// _ValidateOverflowPolicy checks that the configured live ingestion overflow policy is known
+func _ValidateOverflowPolicy(policy string) error {
+	if policy != _OverflowBlock && policy != _OverflowDrop {
+		return fmt.Errorf("unknown overflow policy %q, expected %s or %s", policy, _OverflowBlock, _OverflowDrop)
+	}
+	return nil
+}
+
+// _StartLiveIngestWorkers creates the live ingestion queue and starts the workers that drain it.
+// The queue's depth is published through expvar.
+func _StartLiveIngestWorkers() {
+	_LiveQueue = make(chan *discordgo.Message, config.LiveIngestQueueSize)
+	expvar.Publish("live_ingest_queue_depth", expvar.Func(func() interface{} { return len(_LiveQueue) }))
+
+	for i := 0; i < config.LiveIngestWorkers; i++ {
+		go _LiveIngestWorker()
+	}
+}
+
+func _LiveIngestWorker() {
+	for message := range _LiveQueue {
+		err := _IngestMessage(message)
+		if err != nil {
+			log.Error().Err(err).Str("message_id", message.ID).Msg("Error ingesting live message")
+		}
+		_LiveChannelCounters.Add(message.ChannelID, 1)
+		_ReleaseChannelSlot(message.ChannelID)
+	}
+}
+
+// _ChannelSlots returns the semaphore limiting a channel's share of the live ingestion queue,
+// or nil if channels aren't limited
+func _ChannelSlots(channelID string) chan struct{} {
+	if config.LiveChannelMaxShare >= 1 {
+		return nil
+	}
+
+	_LiveChannelSlotsLock.Lock()
+	defer _LiveChannelSlotsLock.Unlock()
+
+	slots, ok := _LiveChannelSlots[channelID]
+	if !ok {
+		size := int(config.LiveChannelMaxShare * float64(config.LiveIngestQueueSize))
+		if size < 1 {
+			size = 1
+		}
+		slots = make(chan struct{}, size)
+		_LiveChannelSlots[channelID] = slots
+	}
+	return slots
+}
+
+// _AcquireChannelSlot reserves room for a message within its channel's share of the queue, waiting until timeout
+// fires if the channel is at its limit. A nil timeout doesn't wait.
+func _AcquireChannelSlot(channelID string, timeout <-chan time.Time) bool {
+	slots := _ChannelSlots(channelID)
+	if slots == nil {
+		return true
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout == nil {
+		return false
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timeout:
+		return false
+	}
+}
+
+// _ReleaseChannelSlot frees the room a message took up within its channel's share of the queue
+func _ReleaseChannelSlot(channelID string) {
+	if slots := _ChannelSlots(channelID); slots != nil {
+		<-slots
+	}
+}
+
+// _EnqueueLiveMessage queues a message for the live ingestion workers. When the queue or the message's channel's
+// share of it is full, the message is dropped, after waiting for room for up to the configured timeout if the overflow
+// policy is to block.
+func _EnqueueLiveMessage(message *discordgo.Message) {
+	var timeout <-chan time.Time
+	if config.LiveIngestOverflow == _OverflowBlock {
+		timer := time.NewTimer(config.LiveIngestBlockTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	if !_AcquireChannelSlot(message.ChannelID, timeout) {
+		_RecordMetric(_MetricLiveThrottled, 1)
+		log.Debug().Str("channel_id", message.ChannelID).Str("message_id", message.ID).Msg("Channel is over its share of live ingestion, dropping message")
+		return
+	}
+
+	select {
+	case _LiveQueue <- message:
+		return
+	default:
+	}
+
+	if timeout != nil {
+		select {
+		case _LiveQueue <- message:
+			return
+		case <-timeout:
+		}
+	}
+
+	_ReleaseChannelSlot(message.ChannelID)
+	_RecordMetric(_MetricLiveDropped, 1)
+	dropped := atomic.AddInt64(&_LiveDropped, 1)
+	if dropped == 1 || dropped%_LiveDroppedLogInterval == 0 {
+		log.Warn().Int64("dropped", dropped).Int("queue_size", config.LiveIngestQueueSize).Msg("Live ingestion queue is full, dropping messages")
+	}
+}
+
+// _HoldMessage buffers or drops a message if ingestion is paused, returning whether it was held
+func _HoldMessage(message *discordgo.Message) bool {
+	_PausedLock.Lock()
+	defer _PausedLock.Unlock()
+
+	if !_IsIngestPaused() {
+		return false
+	}
+	if config.PausedIngestMode == _PausedModeBuffer && len(_PausedBuffer) < config.MaxPausedBuffer {
+		_PausedBuffer = append(_PausedBuffer, message)
+		return true
+	}
+	_PausedDropped++
+	return true
+}
+
+// _LiveIngestHandler ingests messages as they are sent
+func _LiveIngestHandler(_ *discordgo.Session, message *discordgo.MessageCreate) {
+	if message.GuildID == "" || !_IsAllowedGuild(message.GuildID) {
+		return
+	}
+	if _IsOwnMessage(message.Message) || _IsEmptyMessage(message.Message) {
+		return
+	}
+	if _IsDuplicateLiveMessage(message.ID) {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping duplicate live message")
+		_RecordMetric(_MetricLiveDuplicates, 1)
+		return
+	}
+
+	if _IsIngestPaused() && _HoldMessage(message.Message) {
+		return
+	}
+	if !_IsESAvailable() {
+		log.Debug().Str("message_id", message.ID).Msg("Skipping live message, Elasticsearch is unavailable")
+		return
+	}
+
+	_EnqueueLiveMessage(message.Message)
+}
+
+func _PauseIngestHandler(message *discordgo.MessageCreate, args struct{}) {
+	if !atomic.CompareAndSwapInt32(&_IngestPaused, 0, 1) {
+		session.ChannelMessageSend(message.ChannelID, "Live ingestion is already paused.")
+		return
+	}
+	log.Warn().Str("author_id", message.Author.ID).Str("mode", config.PausedIngestMode).Msg("Paused live ingestion")
+
+	if config.PausedIngestMode == _PausedModeBuffer {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Live ingestion paused. Up to %d new messages will be buffered until it's resumed.", config.MaxPausedBuffer))
+	} else {
+		session.ChannelMessageSend(message.ChannelID, "Live ingestion paused. New messages will be dropped until it's resumed.")
+	}
+}
+
+func _ResumeIngestHandler(message *discordgo.MessageCreate, args struct{}) {
+	_PausedLock.Lock()
+	if !atomic.CompareAndSwapInt32(&_IngestPaused, 1, 0) {
+		_PausedLock.Unlock()
+		session.ChannelMessageSend(message.ChannelID, "Live ingestion isn't paused.")
+		return
+	}
+	buffered := make([]*discordgo.Message, 0, len(_PausedBuffer))
+	for _, bufferedMessage := range _PausedBuffer {
+		if !_IsExcludedChannel(bufferedMessage.ChannelID) {
+			buffered = append(buffered, bufferedMessage)
+		}
+	}
+	dropped := _PausedDropped
+	_PausedBuffer = make([]*discordgo.Message, 0)
+	_PausedDropped = 0
+	_PausedLock.Unlock()
+
+	log.Info().Str("author_id", message.Author.ID).Int("buffered", len(buffered)).Int("dropped", dropped).Msg("Resumed live ingestion")
+
+	stats := &_IngestStats{}
+	for start := 0; start < len(buffered); start += _ResumeBatchSize {
+		end := start + _ResumeBatchSize
+		if end > len(buffered) {
+			end = len(buffered)
+		}
+		err := _IngestMessageArray(buffered[start:end], stats)
+		if err != nil {
+			log.Error().Err(err).Msg("Error ingesting buffered messages")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Live ingestion resumed. Ingested %d buffered messages and dropped %d. %s", len(buffered), dropped, stats.Summary()))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// With live ingestion enabled, edits re-index the edited message in place. Deleted messages are flagged with the time
+// they were deleted, or removed along with their attachments when FLAG_DELETED_MESSAGES is disabled.
+// With KEEP_EDIT_HISTORY, the content an edit replaced is kept in the message's edits field. It is stored as it was
+// indexed, so it stays encrypted when content encryption is enabled, but it isn't searchable.
+
+const _SetEditsScript = "ctx._source.edits = params.edits"
+
+// Only the most recent edits are kept, so that frequently edited messages don't grow without bound
+const _MaxEditHistory = 20
+
+// _IsOwnMessage returns whether a message was sent by Elkbot itself
+func _IsOwnMessage(message *discordgo.Message) bool {
+	return message.Author != nil && session.State.User != nil && message.Author.ID == session.State.User.ID
+}
+
+// _IsEmptyMessage returns whether a message has nothing worth indexing, such as system messages for pins and joins.
+// Messages whose content was withheld are still indexed for their metadata.
+func _IsEmptyMessage(message *discordgo.Message) bool {
+	return message.Content == "" && len(message.Attachments) == 0 && message.Poll == nil && !_IsContentWithheld(message)
+}
+
+// _LiveEditHandler re-indexes messages when their content is edited. As documents are versioned by their edit time,
+// the edited content replaces the stored document. Updates without an author are partial, such as embeds being
+// added to a message, and are ignored.
+func _LiveEditHandler(_ *discordgo.Session, update *discordgo.MessageUpdate) {
+	if update.GuildID == "" || !_IsAllowedGuild(update.GuildID) {
+		return
+	}
+	if update.Author == nil || update.EditedTimestamp == nil || _IsOwnMessage(update.Message) || _IsEmptyMessage(update.Message) {
+		return
+	}
+	if !_IsESAvailable() {
+		log.Debug().Str("message_id", update.ID).Msg("Skipping live edit, Elasticsearch is unavailable")
+		return
+	}
+
+	if config.KeepEditHistory && _IsEditHistoryStored() {
+		err := _IngestEdit(update.Message)
+		if err != nil {
+			log.Error().Err(err).Str("message_id", update.ID).Msg("Error ingesting live edit")
+		}
+		return
+	}
+	_EnqueueLiveMessage(update.Message)
+}
+
+// _IsEditHistoryStored returns whether INDEX_FIELDS and EXCLUDE_FIELDS allow both content and edits to be stored
+func _IsEditHistoryStored() bool {
+	for _, field := range []string{"content", "edits"} {
+		if _Contains(config.ExcludeFields, field) || (len(config.IndexFields) > 0 && !_Contains(config.IndexFields, field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// _IngestEdit re-indexes an edited message, appending the content it replaced to the message's edit history.
+// The stored document is replaced when the message is re-indexed, so edits bypass the live ingestion queue
+// to carry the history over straight after.
+func _IngestEdit(message *discordgo.Message) error {
+	if !_IsIngestible(message) {
+		return nil
+	}
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", message.ChannelID)}, map[string]interface{}{
+		"size":    1,
+		"version": true,
+		"query":   map[string]interface{}{"ids": map[string]interface{}{"values": []string{message.ID}}},
+		"_source": []string{"content", "edits"},
+	}, _ChannelRouting(message.ChannelID))
+	if err != nil {
+		return fmt.Errorf("error fetching stored message: %w", err)
+	}
+	if len(resp.Hits.Hits) == 0 {
+		return _IngestMessage(message)
+	}
+
+	hit := resp.Hits.Hits[0]
+	if hit.Version >= int64(_DocumentVersion(message)) {
+		log.Debug().Str("message_id", message.ID).Msg("Edit is already indexed")
+		return nil
+	}
+	var stored struct {
+		Content interface{}   `json:"content"`
+		Edits   []interface{} `json:"edits"`
+	}
+	err = json.Unmarshal(hit.Source, &stored)
+	if err != nil {
+		return fmt.Errorf("error decoding stored message: %w", err)
+	}
+
+	err = _IngestMessage(message)
+	if err != nil || stored.Content == nil || _IsContentWithheld(message) {
+		return err
+	}
+
+	edits := append(stored.Edits, map[string]interface{}{
+		"content":   stored.Content,
+		"edited_at": _FormatTimestamp(*message.EditedTimestamp),
+	})
+	if len(edits) > _MaxEditHistory {
+		edits = edits[len(edits)-_MaxEditHistory:]
+	}
+	_, err = _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", message.ChannelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": []string{message.ID}}},
+		_SetEditsScript,
+		map[string]interface{}{"edits": edits},
+		0,
+	)
+	if err != nil {
+		return fmt.Errorf("error storing edit history: %w", err)
+	}
+	return nil
+}
+
+// _DeleteIngestedMessages removes messages from a channel and the attachments belonging to them
+func _DeleteIngestedMessages(channelID string, messageIDs []string) {
+	deleted, err := _DeleteByQuery(
+		[]string{_ChannelReadIndex("messages", channelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": messageIDs}},
+	)
+	if err != nil {
+		log.Error().Err(err).Str("channel_id", channelID).Int("count", len(messageIDs)).Msg("Error deleting messages")
+		return
+	}
+
+	attachments, err := _DeleteByQuery(
+		[]string{_ChannelReadIndex("attachments", channelID)},
+		map[string]interface{}{"terms": map[string]interface{}{"message_id": messageIDs}},
+	)
+	if err != nil {
+		log.Error().Err(err).Str("channel_id", channelID).Int("count", len(messageIDs)).Msg("Error deleting attachments of deleted messages")
+		return
+	}
+	log.Debug().Str("channel_id", channelID).Int("messages", deleted).Int("attachments", attachments).Msg("Removed deleted messages")
+}
+
+func _LiveDeleteHandler(_ *discordgo.Session, deleted *discordgo.MessageDelete) {
+	if !_IsAllowedGuild(deleted.GuildID) || !_IsESAvailable() {
+		return
+	}
+	_DeleteIngestedMessages(deleted.ChannelID, []string{deleted.ID})
+}
+
+func _LiveDeleteBulkHandler(_ *discordgo.Session, deleted *discordgo.MessageDeleteBulk) {
+	if !_IsAllowedGuild(deleted.GuildID) || len(deleted.Messages) == 0 || !_IsESAvailable() {
+		return
+	}
+	_DeleteIngestedMessages(deleted.ChannelID, deleted.Messages)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// _LogOutput returns the writer logs should be sent to. Logs are always written to the console unless a log file
+// is configured and console output is disabled. Log files are written as JSON lines and rotated by size.
+func _LogOutput() io.Writer {
+	console := zerolog.ConsoleWriter{Out: os.Stderr}
+	if config.LogFile == "" {
+		return console
+	}
+
+	file := &lumberjack.Logger{
+		Filename:   config.LogFile,
+		MaxSize:    config.LogMaxSizeMB,
+		MaxBackups: config.LogMaxBackups,
+		MaxAge:     config.LogMaxAgeDays,
+	}
+	if !config.LogToConsole {
+		return file
+	}
+	return zerolog.MultiLevelWriter(console, file)
+}
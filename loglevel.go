@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type _LogLevelArgs struct {
+	Level string `description:"Level to log at: trace, debug, info, warn, error, fatal, panic or disabled."`
+}
+
+// _LogLevelHandler changes the global log level without restarting.
+// The level is process-wide, so it affects every log output, including the log file if one is configured.
+func _LogLevelHandler(message *discordgo.MessageCreate, args _LogLevelArgs) {
+	level, err := zerolog.ParseLevel(strings.ToLower(strings.TrimSpace(args.Level)))
+	if err != nil || level == zerolog.NoLevel {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%q is not a valid log level.", args.Level))
+		return
+	}
+
+	previous := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(level)
+	log.Info().Str("previous", previous.String()).Str("level", level.String()).Str("author_id", message.Author.ID).Msg("Changed log level")
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Changed the log level from `%s` to `%s` for all log output.", previous, level))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxLongestResults = 10
+
+type _LongestArgs struct {
+	Channel string `description:"Channel to find the longest messages in."`
+	From    string `default:"" description:"Only include messages from this user."`
+	Min     int    `default:"0" description:"Minimum message length, in characters."`
+	Limit   int    `default:"5" description:"Number of messages to show."`
+}
+
+func _LongestHandler(message *discordgo.MessageCreate, args _LongestArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxLongestResults {
+		args.Limit = _MaxLongestResults
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+		map[string]interface{}{"range": map[string]interface{}{"content_length": map[string]interface{}{"gte": args.Min}}},
+		_NotDeletedFilter,
+	}
+	if args.From != "" {
+		userID := _ParseUserID(args.From)
+		if userID == "" {
+			session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+			return
+		}
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"author_id": userID}})
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  args.Limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":  []interface{}{map[string]interface{}{"content_length": "desc"}},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for longest messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Longest messages in #%s", channel.Name))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No messages found."
+	}
+	for index, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+		if len(hit.Sort) > 0 {
+			field.Name = fmt.Sprintf("#%d - %v characters", index+1, hit.Sort[0])
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
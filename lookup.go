@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Only the latest version of a message is stored, so its edit history is limited to when it was last edited,
+// which is recorded as the document's version
+
+// _MessageRecord is a message's stored document along with the documents of its attachments
+type _MessageRecord struct {
+	Message     map[string]interface{}   `json:"message"`
+	Attachments []map[string]interface{} `json:"attachments"`
+}
+
+// _ParseJumpURL extracts the guild, channel and message IDs from a message jump URL
+func _ParseJumpURL(input string) (string, string, string, error) {
+	matches := _MessageLinkPattern.FindStringSubmatch(strings.Trim(input, "<>"))
+	if matches == nil {
+		return "", "", "", errors.New("expected a message link such as https://discord.com/channels/<guild>/<channel>/<message>")
+	}
+	return matches[1], matches[2], matches[3], nil
+}
+
+// _DecryptDocument decrypts the content fields of a stored message document in place
+func _DecryptDocument(document map[string]interface{}) {
+	for _, field := range _EncryptedFields {
+		if value, ok := document[field].(string); ok {
+			document[field] = _DecryptContent(value)
+		}
+	}
+}
+
+// _FetchMessageRecord fetches the stored documents for a message, returning nil if it hasn't been ingested.
+// The returned time is when the message was last edited, or zero if it hasn't been edited since it was sent.
+func _FetchMessageRecord(channelID string, messageID string) (*_MessageRecord, time.Time, error) {
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"size":    1,
+		"version": true,
+		"query":   map[string]interface{}{"ids": map[string]interface{}{"values": []string{messageID}}},
+	}, _ChannelRouting(channelID))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(resp.Hits.Hits) == 0 {
+		return nil, time.Time{}, nil
+	}
+
+	hit := resp.Hits.Hits[0]
+	record := &_MessageRecord{Attachments: make([]map[string]interface{}, 0)}
+	err = json.Unmarshal(hit.Source, &record.Message)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error decoding message document: %w", err)
+	}
+	_DecryptDocument(record.Message)
+
+	var editedAt time.Time
+	if timestamp, err := time.Parse(time.RFC3339, fmt.Sprint(record.Message["timestamp"])); err == nil {
+		versionTime := time.Unix(0, hit.Version*int64(time.Millisecond))
+		if versionTime.Sub(timestamp) >= time.Second {
+			editedAt = versionTime
+		}
+	}
+
+	attachments, err := _SearchRouted([]string{_ChannelReadIndex("attachments", channelID)}, map[string]interface{}{
+		"size":  config.MaxIndexedAttachments,
+		"query": map[string]interface{}{"term": map[string]interface{}{"message_id": messageID}},
+	}, _ChannelRouting(channelID))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error fetching attachments: %w", err)
+	}
+	for _, attachmentHit := range attachments.Hits.Hits {
+		var attachment map[string]interface{}
+		err = json.Unmarshal(attachmentHit.Source, &attachment)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("error decoding attachment document: %w", err)
+		}
+		record.Attachments = append(record.Attachments, attachment)
+	}
+	return record, editedAt, nil
+}
+
+// _LiveMessageEmbed renders a message fetched from Discord, for messages that haven't been ingested
+func _LiveMessageEmbed(message *discordgo.Message) *discordgo.MessageEmbed {
+	embed := _NewEmbed("Message not ingested")
+	embed.Description = _Snippet(message.Content, _SnippetLength)
+	embed.Footer = _EmbedFooter("Showing the message as it currently is on Discord")
+
+	edited := "Never"
+	if message.EditedTimestamp != nil {
+		edited = message.EditedTimestamp.Format(time.RFC3339)
+	}
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Author", Value: fmt.Sprintf("<@%s>", message.Author.ID), Inline: true},
+		{Name: "Sent", Value: message.Timestamp.Format(time.RFC3339), Inline: true},
+		{Name: "Edited", Value: edited, Inline: true},
+		{Name: "Reactions", Value: fmt.Sprint(_ReactionCount(message)), Inline: true},
+		{Name: "Attachments", Value: fmt.Sprint(len(message.Attachments)), Inline: true},
+	}
+	return embed
+}
+
+type _LookupArgs struct {
+	Link string `description:"Jump link of the message to look up."`
+}
+
+func _LookupHandler(message *discordgo.MessageCreate, args _LookupArgs) {
+	guildID, channelID, messageID, err := _ParseJumpURL(args.Link)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if guildID != message.GuildID {
+		if _, err := session.State.Guild(guildID); err != nil {
+			session.ChannelMessageSend(message.ChannelID, "That message is from a server Elkbot isn't in.")
+			return
+		}
+		session.ChannelMessageSend(message.ChannelID, "Only messages from this server can be looked up here.")
+		return
+	}
+	channel, err := _ResolveGuildChannel(channelID, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	record, editedAt, err := _FetchMessageRecord(channel.ID, messageID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching message record")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if record == nil {
+		live, err := session.ChannelMessage(channel.ID, messageID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, "That message hasn't been ingested and couldn't be fetched from Discord.")
+			return
+		}
+		session.ChannelMessageSendEmbed(message.ChannelID, _LiveMessageEmbed(live))
+		return
+	}
+
+	content, _ := record.Message["content"].(string)
+	edited := "Not since it was ingested"
+	if !editedAt.IsZero() {
+		edited = editedAt.Format(time.RFC3339)
+	}
+
+	embed := _NewEmbed("Stored message")
+	embed.URL = _JumpURL(guildID, channel.ID, messageID)
+	embed.Description = _Snippet(content, _SnippetLength)
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Author", Value: fmt.Sprintf("<@%v>", record.Message["author_id"]), Inline: true},
+		{Name: "Sent", Value: fmt.Sprint(record.Message["timestamp"]), Inline: true},
+		{Name: "Last edited", Value: edited, Inline: true},
+		{Name: "Reactions", Value: fmt.Sprint(record.Message["reaction_count"]), Inline: true},
+		{Name: "Attachments", Value: fmt.Sprint(len(record.Attachments)), Inline: true},
+	}
+	if deleted, _ := record.Message["deleted"].(bool); deleted {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Deleted", Value: fmt.Sprint(record.Message["deleted_at"]), Inline: true})
+	}
+
+	stored, _ := json.MarshalIndent(record, "", "  ")
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("message-%s.json", messageID),
+			ContentType: "application/json",
+			Reader:      strings.NewReader(string(stored)),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading message record")
+	}
+}
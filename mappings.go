@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Keywords longer than this are not indexed, keeping terms under Lucene's limit for even 4-byte characters
+const _ContentKeywordMaxLength = 8191
+
+var _MessageMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"content":            _ContentMapping("standard"),
+		"original_content":   map[string]interface{}{"type": "text", "index": false},
+		"content_searchable": map[string]interface{}{"type": "text", "analyzer": "standard"},
+		"content_hash":       map[string]interface{}{"type": "keyword"},
+		"content_length":     map[string]interface{}{"type": "integer"},
+		"content_available":  map[string]interface{}{"type": "boolean"},
+		"source":             map[string]interface{}{"type": "keyword"},
+		"word_count":         map[string]interface{}{"type": "integer"},
+		"sentiment_score":    map[string]interface{}{"type": "float"},
+		"edits":              map[string]interface{}{"type": "object", "enabled": false},
+		"deleted":            map[string]interface{}{"type": "boolean"},
+		"deleted_at":         map[string]interface{}{"type": "date"},
+		"deleted_by":         map[string]interface{}{"type": "keyword"},
+		"tags":               map[string]interface{}{"type": "keyword"},
+		"truncated":          map[string]interface{}{"type": "boolean"},
+		"language":           map[string]interface{}{"type": "keyword"},
+		"channel_id":         map[string]interface{}{"type": "keyword"},
+		"guild_id":           map[string]interface{}{"type": "keyword"},
+		"author_id":          map[string]interface{}{"type": "keyword"},
+		"author_bot":         map[string]interface{}{"type": "boolean"},
+		"attachment_count":   map[string]interface{}{"type": "integer"},
+		"author_name": map[string]interface{}{
+			"type": "text",
+			"fields": map[string]interface{}{
+				"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+			},
+		},
+		"timestamp":      map[string]interface{}{"type": "date"},
+		"reaction_count": map[string]interface{}{"type": "integer"},
+		"used_emoji_ids": map[string]interface{}{"type": "keyword"},
+		"urls":           map[string]interface{}{"type": "keyword", "ignore_above": _ContentKeywordMaxLength},
+		"domains":        map[string]interface{}{"type": "keyword"},
+
+		"thread_id":            map[string]interface{}{"type": "keyword"},
+		"thread_message_count": map[string]interface{}{"type": "integer"},
+		"thread_member_count":  map[string]interface{}{"type": "integer"},
+		"thread_name":          map[string]interface{}{"type": "text"},
+
+		"channel_topic":    map[string]interface{}{"type": "text"},
+		"channel_category": map[string]interface{}{"type": "text"},
+		"channel_type":     map[string]interface{}{"type": "keyword"},
+
+		"scheduled_event": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"id":       map[string]interface{}{"type": "keyword"},
+				"name":     map[string]interface{}{"type": "text"},
+				"start":    map[string]interface{}{"type": "date"},
+				"end":      map[string]interface{}{"type": "date"},
+				"status":   map[string]interface{}{"type": "integer"},
+				"location": map[string]interface{}{"type": "text"},
+			},
+		},
+
+		"reactions": map[string]interface{}{
+			"type": "nested",
+			"properties": map[string]interface{}{
+				"emoji_name": map[string]interface{}{"type": "keyword"},
+				"emoji_id":   map[string]interface{}{"type": "keyword"},
+				"count":      map[string]interface{}{"type": "integer"},
+			},
+		},
+
+		"is_crossposted":    map[string]interface{}{"type": "boolean"},
+		"embeds_suppressed": map[string]interface{}{"type": "boolean"},
+		"is_ephemeral":      map[string]interface{}{"type": "boolean"},
+
+		"referenced_message_id": map[string]interface{}{"type": "keyword"},
+		"reply_to_snippet":      map[string]interface{}{"type": "text"},
+		"reference_type":        map[string]interface{}{"type": "keyword"},
+		"reference_channel_id":  map[string]interface{}{"type": "keyword"},
+		"reference_guild_id":    map[string]interface{}{"type": "keyword"},
+
+		"poll": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"question":          map[string]interface{}{"type": "text"},
+				"allow_multiselect": map[string]interface{}{"type": "boolean"},
+				"expiry":            map[string]interface{}{"type": "date"},
+				"finalized":         map[string]interface{}{"type": "boolean"},
+				"total_votes":       map[string]interface{}{"type": "integer"},
+				"answers": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"answer_id": map[string]interface{}{"type": "integer"},
+						"text":      map[string]interface{}{"type": "text"},
+						"votes":     map[string]interface{}{"type": "integer"},
+					},
+				},
+			},
+		},
+	},
+}
+
+var _AttachmentMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"filename":    map[string]interface{}{"type": "text"},
+		"description": map[string]interface{}{"type": "text"},
+		"height":      map[string]interface{}{"type": "integer"},
+		"width":       map[string]interface{}{"type": "integer"},
+		"size":        map[string]interface{}{"type": "long"},
+		"url":         map[string]interface{}{"type": "keyword"},
+		"proxy_url":   map[string]interface{}{"type": "keyword"},
+		"message_id":  map[string]interface{}{"type": "keyword"},
+		"channel_id":  map[string]interface{}{"type": "keyword"},
+		"author_id":   map[string]interface{}{"type": "keyword"},
+		"timestamp":   map[string]interface{}{"type": "date"},
+		"is_spoiler":  map[string]interface{}{"type": "boolean"},
+		"aspect_ratio": map[string]interface{}{
+			"type":           "scaled_float",
+			"scaling_factor": 100,
+		},
+	},
+}
+
+// _TemplateVersion should be incremented whenever the mappings or settings of an index change,
+// so that the new template replaces the old one on the next startup.
+const _TemplateVersion = 33
+
+func _TemplateName(base string, version int) string {
+	return fmt.Sprintf("elkbot-%s-v%d", base, version)
+}
+
+// _IndexSettings returns the settings applied to every index Elkbot creates for a base index
+func _IndexSettings(base string) map[string]interface{} {
+	settings := map[string]interface{}{
+		"index.number_of_shards":   config.IndexShards,
+		"index.number_of_replicas": config.IndexReplicas,
+		"index.analysis":           _WordCloudAnalysis,
+	}
+	if config.UseTimeBasedIndices {
+		settings["index.lifecycle.name"] = _LifecyclePolicyName
+		settings["index.lifecycle.rollover_alias"] = _WriteIndex(base)
+	}
+	return settings
+}
+
+// _EnsureTemplate installs the current version of the index template for a base index and removes any older versions
+func _EnsureTemplate(base string, mapping map[string]interface{}) error {
+	templateName := _TemplateName(base, _TemplateVersion)
+
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"index_patterns": []string{base + "*"},
+		"priority":       100 + _TemplateVersion,
+		"version":        _TemplateVersion,
+		"template": map[string]interface{}{
+			"settings": _IndexSettings(base),
+			"mappings": _WithSchemaVersion(mapping),
+		},
+	})
+	putReq := esapi.IndicesPutIndexTemplateRequest{
+		Name: templateName,
+		Body: bytes.NewReader(reqBody),
+	}
+	putResp, err := putReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(putResp, nil)
+	if err != nil {
+		return fmt.Errorf("error installing index template %s: %w", templateName, err)
+	}
+	log.Debug().Str("template", templateName).Msg("Installed index template")
+
+	getReq := esapi.IndicesGetIndexTemplateRequest{
+		Name: []string{"elkbot-" + base + "*"},
+	}
+	getResp, err := getReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if getResp.StatusCode == http.StatusNotFound {
+		getResp.Body.Close()
+		return nil
+	}
+	var templates struct {
+		IndexTemplates []struct {
+			Name string `json:"name"`
+		} `json:"index_templates"`
+	}
+	err = _DecodeResponse(getResp, &templates)
+	if err != nil {
+		return fmt.Errorf("error listing index templates: %w", err)
+	}
+
+	for _, template := range templates.IndexTemplates {
+		if template.Name == templateName {
+			continue
+		}
+		deleteReq := esapi.IndicesDeleteIndexTemplateRequest{
+			Name: template.Name,
+		}
+		deleteResp, err := deleteReq.Do(context.Background(), esClient)
+		if err != nil {
+			return fmt.Errorf("error making elasticsearch request: %w", err)
+		}
+		err = _DecodeResponse(deleteResp, nil)
+		if err != nil {
+			return fmt.Errorf("error removing outdated index template %s: %w", template.Name, err)
+		}
+		log.Info().Str("template", template.Name).Msg("Removed outdated index template")
+	}
+
+	return nil
+}
+
+// _UpdateMappings adds any newly introduced fields to the mappings of existing indices
+func _UpdateMappings(base string, mapping map[string]interface{}) error {
+	reqBody, _ := json.Marshal(mapping)
+
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{_ReadIndex(base)},
+		Body:  bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	return _DecodeResponse(resp, nil)
+}
+
+// _EnsureIndex creates an index if it does not exist yet, relying on the installed template for its mappings
+func _EnsureIndex(indexName string) error {
+	return _EnsureIndexWithMapping(indexName, nil)
+}
+
+// _EnsureIndexWithMapping creates an index if it does not exist yet, overriding parts of the template's mappings
+func _EnsureIndexWithMapping(indexName string, mapping map[string]interface{}) error {
+	existsReq := esapi.IndicesExistsRequest{
+		Index: []string{indexName},
+	}
+	existsResp, err := existsReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	existsResp.Body.Close()
+
+	if existsResp.StatusCode == http.StatusOK {
+		log.Debug().Str("index", indexName).Msg("Index already exists")
+		return nil
+	}
+
+	createReq := esapi.IndicesCreateRequest{
+		Index: indexName,
+	}
+	if mapping != nil {
+		reqBody, _ := json.Marshal(map[string]interface{}{"mappings": mapping})
+		createReq.Body = bytes.NewReader(reqBody)
+	}
+	createResp, err := createReq.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(createResp, nil)
+	if err != nil {
+		return fmt.Errorf("error creating index %s: %w", indexName, err)
+	}
+	log.Info().Str("index", indexName).Msg("Created index")
+
+	return nil
+}
+
+// _EnsureStandaloneIndex creates an index that isn't covered by an index template if it does not exist yet,
+// and applies its mapping
+func _EnsureStandaloneIndex(indexName string, mapping map[string]interface{}) error {
+	err := _EnsureIndex(indexName)
+	if err != nil {
+		return err
+	}
+
+	reqBody, _ := json.Marshal(mapping)
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{indexName},
+		Body:  bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(resp, nil)
+	if err != nil {
+		return fmt.Errorf("error updating mapping of index %s: %w", indexName, err)
+	}
+	return nil
+}
+
+// _EnsureIndices installs the index templates for Elkbot's indices and creates any indices that do not exist yet
+func _EnsureIndices() error {
+	if config.UseTimeBasedIndices {
+		err := _EnsureLifecyclePolicy()
+		if err != nil {
+			return fmt.Errorf("error creating lifecycle policy: %w", err)
+		}
+	}
+
+	indices := []struct {
+		base    string
+		mapping map[string]interface{}
+	}{
+		{"messages", _MessageMappingWithAnalyzer(config.ContentAnalyzer)},
+		{"attachments", _AttachmentMapping},
+	}
+
+	for _, index := range indices {
+		err := _EnsureTemplate(index.base, index.mapping)
+		if err != nil {
+			return err
+		}
+
+		if config.AutoMigrate {
+			err = _MigrateIndex(index.base)
+			if err != nil {
+				return err
+			}
+		}
+
+		if config.UseTimeBasedIndices {
+			err = _EnsureTimeBasedIndex(index.base)
+		} else {
+			err = _EnsureIndex(index.base)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = _UpdateMappings(index.base, index.mapping)
+		if err != nil && index.base == "messages" {
+			err = _UpdateMappings(index.base, _MessageMappingWithoutContent())
+			if err == nil {
+				log.Warn().Str("index", index.base).Msg("Existing indices use a different content analyzer, re-ingest into a new index to use the configured one")
+			}
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("index", index.base).Msg("Unable to update mappings of existing indices, a reindex may be required")
+		}
+	}
+
+	return nil
+}
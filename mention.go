@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// _StripBotMention returns the content of a message with a leading mention of the bot removed,
+// and whether the message started with such a mention.
+func _StripBotMention(content string, botID string) (string, bool) {
+	for _, mention := range []string{"<@" + botID + ">", "<@!" + botID + ">"} {
+		if strings.HasPrefix(content, mention) {
+			return strings.TrimSpace(strings.TrimPrefix(content, mention)), true
+		}
+	}
+	return content, false
+}
+
+// _MentionCommandHandler runs commands from messages that start by mentioning the bot instead of using the prefix
+func _MentionCommandHandler(_ *discordgo.Session, message *discordgo.MessageCreate) {
+	if session.State.User == nil || message.Author.ID == session.State.User.ID {
+		return
+	}
+
+	remainder, mentioned := _StripBotMention(message.Content, session.State.User.ID)
+	if !mentioned || remainder == "" {
+		return
+	}
+
+	// Copy the message so that other handlers still see the original content
+	commandMessage := *message.Message
+	commandMessage.Content = config.Prefix + remainder
+
+	_RunCommand(&discordgo.MessageCreate{Message: &commandMessage})
+}
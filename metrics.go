@@ -0,0 +1,71 @@
+package main
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+const _MetricBulkRequests = "bulk_requests"
+const _MetricBulkDocuments = "bulk_documents"
+const _MetricBulkRetries = "bulk_retries"
+const _MetricDocumentsIndexed = "documents_indexed"
+const _MetricESErrors = "es_errors"
+const _MetricLiveDropped = "live_dropped"
+const _MetricLiveDuplicates = "live_duplicates"
+const _MetricLiveThrottled = "live_throttled"
+
+// Metrics are kept in per-minute buckets for as long as the longest window reported on
+const _MetricsBucketSize = time.Minute
+const _MetricsRetention = 24 * time.Hour
+
+type _MetricsBucket struct {
+	Start    time.Time
+	Counters map[string]int
+}
+
+// _IngestCounters holds the all-time totals of each metric, published through expvar
+var _IngestCounters = expvar.NewMap("ingest")
+
+var _MetricsBuckets = make([]*_MetricsBucket, 0)
+var _MetricsLock sync.Mutex
+
+// _RecordMetric adds delta to the named metric
+func _RecordMetric(name string, delta int) {
+	if delta == 0 {
+		return
+	}
+	_IngestCounters.Add(name, int64(delta))
+
+	_MetricsLock.Lock()
+	defer _MetricsLock.Unlock()
+
+	now := time.Now().Truncate(_MetricsBucketSize)
+	if len(_MetricsBuckets) == 0 || _MetricsBuckets[len(_MetricsBuckets)-1].Start.Before(now) {
+		_MetricsBuckets = append(_MetricsBuckets, &_MetricsBucket{Start: now, Counters: make(map[string]int)})
+	}
+	_MetricsBuckets[len(_MetricsBuckets)-1].Counters[name] += delta
+
+	cutoff := now.Add(-_MetricsRetention)
+	for len(_MetricsBuckets) > 0 && !_MetricsBuckets[0].Start.After(cutoff) {
+		_MetricsBuckets = _MetricsBuckets[1:]
+	}
+}
+
+// _MetricsSince returns the totals of each metric recorded within a window ending now
+func _MetricsSince(window time.Duration) map[string]int {
+	_MetricsLock.Lock()
+	defer _MetricsLock.Unlock()
+
+	cutoff := time.Now().Add(-window)
+	totals := make(map[string]int)
+	for _, bucket := range _MetricsBuckets {
+		if bucket.Start.Before(cutoff.Truncate(_MetricsBucketSize)) {
+			continue
+		}
+		for name, value := range bucket.Counters {
+			totals[name] += value
+		}
+	}
+	return totals
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Automatic migration copies an index into a new one created from the current template whenever the schema version
+// stored in its mapping is older than _TemplateVersion, then points the base name at the new index as an alias and
+// deletes the old one. Indices created before schema versions were stored count as version 0, so enabling it for the
+// first time migrates every index once. Messages written to the old index by another running instance during a
+// migration are lost, so other ingesting instances should be stopped while upgrading.
+// Only single indices are migrated. Time-based indices pick up new templates when they roll over instead.
+
+const _SchemaVersionMetaField = "elkbot_schema_version"
+const _MigrationLockIndex = "elkbot-locks"
+
+// A lock older than this is assumed to belong to an instance that died mid-migration
+const _MigrationLockTimeout = 6 * time.Hour
+const _MigrationLockPollInterval = 10 * time.Second
+
+// _WithSchemaVersion returns a copy of a mapping that records the current schema version in its metadata
+func _WithSchemaVersion(mapping map[string]interface{}) map[string]interface{} {
+	versioned := make(map[string]interface{}, len(mapping)+1)
+	for key, value := range mapping {
+		versioned[key] = value
+	}
+	versioned["_meta"] = map[string]interface{}{_SchemaVersionMetaField: _TemplateVersion}
+	return versioned
+}
+
+// _IndexSchemaVersion returns the concrete index behind a base index name and the schema version in its mapping.
+// An empty index name means the index doesn't exist yet.
+func _IndexSchemaVersion(base string) (string, int, error) {
+	req := esapi.IndicesGetMappingRequest{Index: []string{base}}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return "", 0, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return "", 0, nil
+	}
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta map[string]interface{} `json:"_meta"`
+		} `json:"mappings"`
+	}
+	err = _DecodeResponse(resp, &mappings)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(mappings) != 1 {
+		return "", 0, fmt.Errorf("expected %s to be a single index, found %d", base, len(mappings))
+	}
+
+	for index, mapping := range mappings {
+		version, _ := mapping.Mappings.Meta[_SchemaVersionMetaField].(float64)
+		return index, int(version), nil
+	}
+	return "", 0, nil
+}
+
+// _AcquireMigrationLock creates the lock document for migrating a base index, returning false if another instance
+// already holds it. Locks older than _MigrationLockTimeout are taken over.
+func _AcquireMigrationLock(base string) (bool, error) {
+	hostname, _ := os.Hostname()
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"owner":     fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		"locked_at": _FormatTimestamp(time.Now()),
+	})
+
+	req := esapi.CreateRequest{
+		Index:      _MigrationLockIndex,
+		DocumentID: base,
+		Body:       bytes.NewReader(reqBody),
+		Refresh:    "true",
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return false, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if resp.StatusCode != http.StatusConflict {
+		return true, _DecodeResponse(resp, nil)
+	}
+	resp.Body.Close()
+
+	getReq := esapi.GetRequest{Index: _MigrationLockIndex, DocumentID: base}
+	getResp, err := getReq.Do(context.Background(), esClient)
+	if err != nil {
+		return false, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if getResp.StatusCode == http.StatusNotFound {
+		getResp.Body.Close()
+		return _AcquireMigrationLock(base)
+	}
+	var lock struct {
+		SeqNo       int `json:"_seq_no"`
+		PrimaryTerm int `json:"_primary_term"`
+		Source      struct {
+			Owner    string    `json:"owner"`
+			LockedAt time.Time `json:"locked_at"`
+		} `json:"_source"`
+	}
+	err = _DecodeResponse(getResp, &lock)
+	if err != nil {
+		return false, fmt.Errorf("error fetching migration lock: %w", err)
+	}
+	if time.Since(lock.Source.LockedAt) < _MigrationLockTimeout {
+		log.Info().Str("index", base).Str("owner", lock.Source.Owner).Msg("Another instance is migrating the index, waiting for it to finish")
+		return false, nil
+	}
+
+	log.Warn().Str("index", base).Str("owner", lock.Source.Owner).Time("locked_at", lock.Source.LockedAt).Msg("Taking over stale migration lock")
+	deleteReq := esapi.DeleteRequest{
+		Index:         _MigrationLockIndex,
+		DocumentID:    base,
+		IfSeqNo:       &lock.SeqNo,
+		IfPrimaryTerm: &lock.PrimaryTerm,
+		Refresh:       "true",
+	}
+	deleteResp, err := deleteReq.Do(context.Background(), esClient)
+	if err != nil {
+		return false, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	if deleteResp.StatusCode == http.StatusConflict || deleteResp.StatusCode == http.StatusNotFound {
+		deleteResp.Body.Close()
+		return false, nil
+	}
+	err = _DecodeResponse(deleteResp, nil)
+	if err != nil {
+		return false, fmt.Errorf("error removing stale migration lock: %w", err)
+	}
+	return _AcquireMigrationLock(base)
+}
+
+// _ReleaseMigrationLock deletes the lock document for migrating a base index
+func _ReleaseMigrationLock(base string) {
+	req := esapi.DeleteRequest{Index: _MigrationLockIndex, DocumentID: base, Refresh: "true"}
+	resp, err := req.Do(context.Background(), esClient)
+	if err == nil {
+		err = _DecodeResponse(resp, nil)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("index", base).Msg("Error releasing migration lock")
+	}
+}
+
+// _Reindex copies every document from one index into another in the background, logging progress until it finishes.
+// Document versions are kept, so newer copies already in the destination aren't overwritten.
+func _Reindex(source string, dest string) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"conflicts": "proceed",
+		"source":    map[string]interface{}{"index": source},
+		"dest":      map[string]interface{}{"index": dest, "version_type": "external"},
+	})
+
+	refresh := true
+	waitForCompletion := false
+	req := esapi.ReindexRequest{
+		Body:              bytes.NewReader(reqBody),
+		Refresh:           &refresh,
+		Slices:            "auto",
+		WaitForCompletion: &waitForCompletion,
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	var taskResp struct {
+		Task string `json:"task"`
+	}
+	err = _DecodeResponse(resp, &taskResp)
+	if err != nil {
+		return fmt.Errorf("error starting reindex: %w", err)
+	}
+
+	for {
+		time.Sleep(_TaskPollInterval)
+
+		status, err := _GetTaskStatus(taskResp.Task)
+		if err != nil {
+			return fmt.Errorf("error checking progress of task %s: %w", taskResp.Task, err)
+		}
+		if !status.Completed {
+			copied := status.Task.Status.Created + status.Task.Status.Updated
+			log.Info().Str("source", source).Str("dest", dest).Int("copied", copied).Int("total", status.Task.Status.Total).Msg("Migrating index")
+			continue
+		}
+
+		if status.Error != nil {
+			return fmt.Errorf("task %s failed: %v", taskResp.Task, status.Error["reason"])
+		}
+		if len(status.Response.Failures) > 0 {
+			return fmt.Errorf("task %s finished with %d failures", taskResp.Task, len(status.Response.Failures))
+		}
+		return nil
+	}
+}
+
+// _SwapMigratedIndex deletes the old index and points the base name at the migrated one in a single atomic action
+func _SwapMigratedIndex(base string, source string, dest string) error {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"actions": []interface{}{
+			map[string]interface{}{"remove_index": map[string]interface{}{"index": source}},
+			map[string]interface{}{"add": map[string]interface{}{"index": dest, "alias": base}},
+		},
+	})
+
+	req := esapi.IndicesUpdateAliasesRequest{Body: bytes.NewReader(reqBody)}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+// _MigrateIndex reindexes a base index into a new index with the current mappings if its schema version is outdated.
+// Only one instance migrates at a time, with others waiting for it to finish.
+func _MigrateIndex(base string) error {
+	for {
+		source, version, err := _IndexSchemaVersion(base)
+		if err != nil {
+			return fmt.Errorf("error checking schema version of %s: %w", base, err)
+		}
+		if source == "" || version >= _TemplateVersion {
+			return nil
+		}
+
+		acquired, err := _AcquireMigrationLock(base)
+		if err != nil {
+			return fmt.Errorf("error acquiring migration lock for %s: %w", base, err)
+		}
+		if acquired {
+			defer _ReleaseMigrationLock(base)
+			break
+		}
+		time.Sleep(_MigrationLockPollInterval)
+	}
+
+	// Another instance may have finished migrating between checking the version and acquiring the lock
+	source, version, err := _IndexSchemaVersion(base)
+	if err != nil {
+		return fmt.Errorf("error checking schema version of %s: %w", base, err)
+	}
+	if version >= _TemplateVersion {
+		return nil
+	}
+
+	dest := fmt.Sprintf("%s-v%d", base, _TemplateVersion)
+	log.Info().Str("source", source).Str("dest", dest).Int("from_version", version).Int("to_version", _TemplateVersion).Msg("Migrating index to new schema version")
+	err = _EnsureIndex(dest)
+	if err != nil {
+		return err
+	}
+
+	err = _Reindex(source, dest)
+	if err != nil {
+		return fmt.Errorf("error reindexing %s into %s: %w", source, dest, err)
+	}
+
+	sourceCount, err := _Count([]string{source}, map[string]interface{}{"match_all": map[string]interface{}{}})
+	if err != nil {
+		return fmt.Errorf("error counting documents in %s: %w", source, err)
+	}
+	destCount, err := _Count([]string{dest}, map[string]interface{}{"match_all": map[string]interface{}{}})
+	if err != nil {
+		return fmt.Errorf("error counting documents in %s: %w", dest, err)
+	}
+	if destCount < sourceCount {
+		return fmt.Errorf("migrated index %s only has %d of the %d documents in %s, leaving the old index in place", dest, destCount, sourceCount, source)
+	}
+
+	err = _SwapMigratedIndex(base, source, dest)
+	if err != nil {
+		return fmt.Errorf("error swapping %s to %s: %w", base, dest, err)
+	}
+	log.Info().Str("index", base).Str("dest", dest).Int("documents", destCount).Msg("Finished migrating index")
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Author names are snapshotted when a message is ingested, so they show the name the author used at the time.
+// Refreshing them trades that point-in-time accuracy for names that match what users are currently called.
+// Updating a document also bumps its version, so re-ingesting an unedited message afterwards is skipped as stale.
+// Reactions, poll votes and thread counts are refreshed with partial updates, so they aren't affected.
+
+const _RefreshNamesScript = "ctx._source.author_name = params.name"
+const _RefreshNamesRequestsPerSecond = 500
+const _RefreshNamesMemberDelay = time.Second
+
+// _FetchMember fetches a guild member from the state cache, falling back to the API
+func _FetchMember(guildID string, userID string) (*discordgo.Member, error) {
+	member, err := session.State.Member(guildID, userID)
+	if err != nil {
+		member, err = session.GuildMember(guildID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching guild member: %w", err)
+		}
+	}
+	return member, nil
+}
+
+// _MemberDisplayName returns the name a member is displayed with in their guild
+func _MemberDisplayName(member *discordgo.Member) string {
+	if member.Nick != "" {
+		return member.Nick
+	}
+	if member.User.GlobalName != "" {
+		return member.User.GlobalName
+	}
+	return member.User.Username
+}
+
+// _CurrentDisplayName fetches the name a user is currently displayed with in a guild
+func _CurrentDisplayName(guildID string, userID string) (string, error) {
+	member, err := _FetchMember(guildID, userID)
+	if err != nil {
+		return "", err
+	}
+	return _MemberDisplayName(member), nil
+}
+
+// _RefreshAuthorName updates the stored author name on all of a user's messages within a guild
+func _RefreshAuthorName(guildID string, userID string) (int, error) {
+	name, err := _CurrentDisplayName(guildID, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	query, err := _UserQuery(userID, guildID)
+	if err != nil {
+		return 0, err
+	}
+	query["bool"].(map[string]interface{})["must_not"] = map[string]interface{}{
+		"term": map[string]interface{}{"author_name.keyword": name},
+	}
+
+	return _UpdateByQuery(
+		[]string{_GuildReadIndex("messages", guildID)},
+		query,
+		_RefreshNamesScript,
+		map[string]interface{}{"name": name},
+		_RefreshNamesRequestsPerSecond,
+	)
+}
+
+// _RecentAuthors returns the IDs of the most active authors of recent messages in a guild
+func _RecentAuthors(guildID string) ([]string, error) {
+	channelFilter, err := _GuildDiscordChannelFilter(guildID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("messages", guildID)}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					channelFilter,
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": "now-7d"}}},
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"authors": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "author_id", "size": config.NameRefreshMaxAuthors},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var authors _TermsAggregation
+	err = json.Unmarshal(resp.Aggregations["authors"], &authors)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding author aggregation: %w", err)
+	}
+
+	authorIDs := make([]string, 0, len(authors.Buckets))
+	for _, bucket := range authors.Buckets {
+		authorIDs = append(authorIDs, fmt.Sprint(bucket.Key))
+	}
+	return authorIDs, nil
+}
+
+// _RefreshNamesLoop periodically refreshes the names of recently active authors in every guild
+func _RefreshNamesLoop() {
+	ticker := time.NewTicker(config.NameRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !_IsConnected() {
+			log.Debug().Msg("Not connected to Discord, skipping author name refresh")
+			continue
+		}
+
+		for _, guild := range session.State.Guilds {
+			if !_IsAllowedGuild(guild.ID) {
+				continue
+			}
+			authorIDs, err := _RecentAuthors(guild.ID)
+			if err != nil {
+				log.Error().Err(err).Str("guild_id", guild.ID).Msg("Error fetching recent authors")
+				continue
+			}
+
+			for _, authorID := range authorIDs {
+				updated, err := _RefreshAuthorName(guild.ID, authorID)
+				if err != nil {
+					log.Debug().Err(err).Str("user_id", authorID).Msg("Unable to refresh author name")
+				} else if updated > 0 {
+					log.Debug().Str("user_id", authorID).Int("updated", updated).Msg("Refreshed author name")
+				}
+				time.Sleep(_RefreshNamesMemberDelay)
+			}
+		}
+	}
+}
+
+type _RefreshNamesArgs struct {
+	User string `description:"Mention or ID of the user whose name should be refreshed."`
+}
+
+func _RefreshNamesHandler(message *discordgo.MessageCreate, args _RefreshNamesArgs) {
+	userID := _ParseUserID(args.User)
+	if userID == "" {
+		session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+		return
+	}
+
+	updated, err := _RefreshAuthorName(message.GuildID, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error refreshing author name")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Updated the name on %d messages from <@%s>.", updated, userID))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Text can represent the same characters in different ways, such as é as a single code point or as e followed by
+// a combining accent. Content and search queries are both normalized to NFC so that they match regardless of how
+// they were typed. When normalizing changes a message's content, the original is kept in original_content.
+
+// _NormalizeText converts text to Unicode normalization form C
+func _NormalizeText(text string) string {
+	return norm.NFC.String(text)
+}
+
+// _NormalizeContent stores the normalized form of a message's content, keeping the original if it differs
+func _NormalizeContent(message *discordgo.Message, document map[string]interface{}) {
+	normalized := _NormalizeText(message.Content)
+	if normalized == message.Content {
+		return
+	}
+	document["content"] = normalized
+	document["original_content"] = message.Content
+}
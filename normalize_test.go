@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const composedCafe = "caf\u00e9"
+const decomposedCafe = "cafe\u0301"
+
+func TestNormalizeContent(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantOriginal bool
+	}{
+		{"composed", composedCafe, false},
+		{"decomposed", decomposedCafe, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document := map[string]interface{}{"content": test.content}
+			_NormalizeContent(&discordgo.Message{Content: test.content}, document)
+
+			if document["content"] != composedCafe {
+				t.Errorf("got content %q, want %q", document["content"], composedCafe)
+			}
+			original, kept := document["original_content"]
+			if kept != test.wantOriginal || (kept && original != test.content) {
+				t.Errorf("got original content %q, want it kept only when normalizing changed the content", original)
+			}
+		})
+	}
+}
+
+func TestNormalizedSearchMatchesContent(t *testing.T) {
+	for _, content := range []string{composedCafe, decomposedCafe} {
+		document := map[string]interface{}{"content": content}
+		_NormalizeContent(&discordgo.Message{Content: content}, document)
+
+		for _, query := range []string{composedCafe, decomposedCafe} {
+			searched := _SearchTextQuery(_SearchArgs{Query: query, Exact: true})
+			term := searched["term"].(map[string]interface{})["content.keyword"]
+			if term != document["content"] {
+				t.Errorf("got query %q for stored content %q, want them to match", term, document["content"])
+			}
+
+			phrase := _OriginQuery(query)["match_phrase"].(map[string]interface{})["content"]
+			if phrase != document["content"] {
+				t.Errorf("got origin query %q for stored content %q, want them to match", phrase, document["content"])
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _OriginQuery matches messages containing the words of some text in order. Encrypted content can only be matched exactly.
+func _OriginQuery(text string) map[string]interface{} {
+	text = _NormalizeText(text)
+	if config.EncryptContent {
+		return _EncryptedSearchQuery(text)
+	}
+	return map[string]interface{}{
+		"match_phrase": map[string]interface{}{"content": text},
+	}
+}
+
+type _OriginArgs struct {
+	Text           string `description:"Text to find the first poster of."`
+	IncludeDeleted bool   `default:"false" description:"Also consider messages that have since been deleted. Admin only."`
+}
+
+func _OriginHandler(message *discordgo.MessageCreate, args _OriginArgs) {
+	if args.IncludeDeleted && !_IsAdmin(message.Author.ID) {
+		session.ChannelMessageSend(message.ChannelID, "Only admins can include deleted messages.")
+		return
+	}
+
+	channelFilter, err := _GuildChannelFilter(message.GuildID, message.Author.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error building origin query")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	filters := []interface{}{_OriginQuery(args.Text), channelFilter}
+	if !args.IncludeDeleted {
+		filters = append(filters, _NotDeletedFilter)
+	}
+
+	resp, err := _Search([]string{_GuildReadIndex("messages", message.GuildID)}, map[string]interface{}{
+		"size":             1,
+		"track_total_hits": true,
+		"query":            map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":             []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for earliest message")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if len(resp.Hits.Hits) == 0 {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("No messages containing \"%s\" found.", _Snippet(args.Text, 100)))
+		return
+	}
+
+	field, err := _MessageHitField(resp.Hits.Hits[0], message.GuildID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error rendering message")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	field.Name = "First posted " + field.Name
+
+	embed := _NewEmbed(fmt.Sprintf("Origin of \"%s\"", _Snippet(args.Text, 100)))
+	embed.Fields = []*discordgo.MessageEmbedField{field}
+	embed.Footer = _EmbedFooter(fmt.Sprintf("Earliest of %d matching messages", resp.Hits.Total.Value))
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _PermissionLevel represents the level of access a user needs in order to run a command
+type _PermissionLevel int
+
+const (
+	_PermissionEveryone _PermissionLevel = iota
+	_PermissionAdmin
+	_PermissionOwner
+)
+
+var _PermissionLevelNames = map[string]_PermissionLevel{
+	"everyone": _PermissionEveryone,
+	"admin":    _PermissionAdmin,
+	"owner":    _PermissionOwner,
+}
+
+// _DefaultCommandPermissions contains the level required for each command, unless overridden by config.
+// Commands that are missing from this map require admin access.
+var _DefaultCommandPermissions = map[string]_PermissionLevel{
+	"ingest":               _PermissionAdmin,
+	"ingestall":            _PermissionAdmin,
+	"purge-user":           _PermissionOwner,
+	"search":               _PermissionEveryone,
+	"attachments":          _PermissionEveryone,
+	"images":               _PermissionEveryone,
+	"export-stats":         _PermissionEveryone,
+	"longest":              _PermissionEveryone,
+	"refresh-names":        _PermissionAdmin,
+	"lag":                  _PermissionEveryone,
+	"refresh-index":        _PermissionAdmin,
+	"fetch-attachment":     _PermissionEveryone,
+	"ingest-report":        _PermissionAdmin,
+	"blocklist":            _PermissionAdmin,
+	"enders":               _PermissionEveryone,
+	"summary":              _PermissionEveryone,
+	"indexed-channels":     _PermissionEveryone,
+	"cluster":              _PermissionAdmin,
+	"replay-dlq":           _PermissionAdmin,
+	"gaps":                 _PermissionAdmin,
+	"trending":             _PermissionEveryone,
+	"reingest-attachments": _PermissionAdmin,
+	"ingest-many":          _PermissionAdmin,
+	"ingest-guild":         _PermissionAdmin,
+	"verify":               _PermissionAdmin,
+	"reacted":              _PermissionEveryone,
+	"loglevel":             _PermissionAdmin,
+	"emoji-usage":          _PermissionEveryone,
+	"wordcloud":            _PermissionEveryone,
+	"ingest-range":         _PermissionAdmin,
+	"server-activity":      _PermissionEveryone,
+	"pause-ingest":         _PermissionAdmin,
+	"resume-ingest":        _PermissionAdmin,
+	"hof":                  _PermissionEveryone,
+	"archive-index":        _PermissionAdmin,
+	"restore-index":        _PermissionAdmin,
+	"recent":               _PermissionEveryone,
+	"schema":               _PermissionEveryone,
+	"response-times":       _PermissionEveryone,
+	"backup-mappings":      _PermissionAdmin,
+	"apply-mappings":       _PermissionAdmin,
+	"cancel-purge":         _PermissionOwner,
+	"links":                _PermissionEveryone,
+	"estimate":             _PermissionAdmin,
+	"near-duplicates":      _PermissionAdmin,
+	"backfill-field":       _PermissionAdmin,
+	"transcript":           _PermissionAdmin,
+	"quiet":                _PermissionEveryone,
+	"snapshot":             _PermissionAdmin,
+	"origin":               _PermissionEveryone,
+	"heatmap":              _PermissionEveryone,
+	"benchmark-search":     _PermissionAdmin,
+	"deleted":              _PermissionAdmin,
+	"tag":                  _PermissionAdmin,
+	"untag":                _PermissionAdmin,
+	"hourly":               _PermissionEveryone,
+	"commands":             _PermissionAdmin,
+	"sentiment":            _PermissionEveryone,
+	"active-now":           _PermissionEveryone,
+	"leaderboard":          _PermissionEveryone,
+	"lookup":               _PermissionAdmin,
+	"status":               _PermissionAdmin,
+	"card":                 _PermissionEveryone,
+	"exclude":              _PermissionAdmin,
+	"ping":                 _PermissionAdmin,
+}
+
+var _CommandPermissions = map[string]_PermissionLevel{}
+
+// _LoadCommandPermissions combines the default command permissions with any overrides from the config
+func _LoadCommandPermissions() error {
+	for command, level := range _DefaultCommandPermissions {
+		_CommandPermissions[command] = level
+	}
+
+	for command, levelName := range config.CommandPermissions {
+		level, ok := _PermissionLevelNames[strings.ToLower(levelName)]
+		if !ok {
+			return fmt.Errorf("unknown permission level %q for command %s", levelName, command)
+		}
+		_CommandPermissions[command] = level
+	}
+
+	return nil
+}
+
+func _Contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// _UserPermissionLevel returns the highest permission level a user has
+func _UserPermissionLevel(userID string) _PermissionLevel {
+	if _Contains(config.Owners, userID) {
+		return _PermissionOwner
+	}
+	if _Contains(config.Admins, userID) {
+		return _PermissionAdmin
+	}
+	return _PermissionEveryone
+}
+
+// _IsAdmin returns whether a user is allowed to run administrative commands
+func _IsAdmin(userID string) bool {
+	return _UserPermissionLevel(userID) >= _PermissionAdmin
+}
+
+// _CanRunCommand returns whether a user has the permission level required to run a command
+func _CanRunCommand(userID string, command string) bool {
+	required, ok := _CommandPermissions[command]
+	if !ok {
+		required = _PermissionAdmin
+	}
+	return _UserPermissionLevel(userID) >= required
+}
+
+// _CommandName returns the name of the command a message is invoking, or an empty string if it isn't a command
+func _CommandName(content string) string {
+	if !strings.HasPrefix(content, config.Prefix) {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(content, config.Prefix))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// _RunCommand checks that the author of a message is allowed to run the command it invokes before dispatching it
+func _RunCommand(message *discordgo.MessageCreate) {
+	command := _CommandName(message.Content)
+	if command == "" || !_IsAllowedGuild(message.GuildID) {
+		return
+	}
+
+	if !_CanRunCommand(message.Author.ID, command) {
+		log.Warn().Str("author_id", message.Author.ID).Str("command", command).Msg("User does not have access to this command")
+		return
+	}
+	if _IsReadOnlyBlocked(command) {
+		session.ChannelMessageSend(message.ChannelID, _ReadOnlyMessage(command))
+		return
+	}
+	if !_IsESAvailable() && !_CommandsWithoutES[command] {
+		session.ChannelMessageSend(message.ChannelID, _ESUnavailableMessage)
+		return
+	}
+
+	err := parser.RunCommand(message)
+	if err != nil {
+		_, err = session.ChannelMessageSend(
+			message.ChannelID,
+			fmt.Sprintf("An error occurred running your command:\n```\n%s\n```", err.Error()),
+		)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to send error message")
+		}
+	}
+}
+
+// _CommandHandler runs commands from messages that start with the prefix.
+// Without a prefix every message would parse as a command, so commands can then only be run by mentioning the bot.
+func _CommandHandler(_ *discordgo.Session, message *discordgo.MessageCreate) {
+	if config.Prefix == "" {
+		return
+	}
+	_RunCommand(message)
+}
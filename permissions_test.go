@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestCommandHandlerWithoutPrefix(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) {
+		cfg.Prefix = ""
+		cfg.AllowMentionPrefix = true
+		cfg.Admins = []string{"5"}
+		// Read-only mode answers mutating commands without parsing them, so they show whether a message was run
+		cfg.ReadOnly = true
+	})
+	testSession := setTestSession(t)
+	transport := newTestDiscordAPI(testSession, func(req testRequest) (int, string) {
+		return http.StatusOK, `{}`
+	})
+
+	// With no prefix, plain chat has to be ignored rather than parsed as a command
+	for _, content := range []string{"refresh-index now", "hello everyone"} {
+		_CommandHandler(testSession, &discordgo.MessageCreate{Message: &discordgo.Message{
+			ID:        "42",
+			ChannelID: "7",
+			GuildID:   "1",
+			Content:   content,
+			Author:    &discordgo.User{ID: "5"},
+		}})
+	}
+	if requests := transport.Requests(); len(requests) != 0 {
+		t.Errorf("got %d Discord requests, want plain messages to be ignored", len(requests))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+type _ClusterInfo struct {
+	ClusterName string `json:"cluster_name"`
+	Version     struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+func _FormatLatency(latency time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(latency)/float64(time.Millisecond))
+}
+
+func _PingHandler(message *discordgo.MessageCreate, args struct{}) {
+	start := time.Now()
+	pingResp, err := esClient.Ping()
+	if err != nil {
+		log.Error().Err(err).Msg("Error pinging Elasticsearch")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	pingResp.Body.Close()
+	esLatency := time.Since(start)
+	if pingResp.IsError() {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Elasticsearch ping failed with status code %s", pingResp.Status()))
+		return
+	}
+
+	infoResp, err := esClient.Info()
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching Elasticsearch info")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	var info _ClusterInfo
+	err = _DecodeResponse(infoResp, &info)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching Elasticsearch info")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed("Pong!")
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Cluster", Value: info.ClusterName, Inline: true},
+		{Name: "Version", Value: info.Version.Number, Inline: true},
+		{Name: "Elasticsearch latency", Value: _FormatLatency(esLatency)},
+		{Name: "Gateway latency", Value: _FormatLatency(session.HeartbeatLatency())},
+	}
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
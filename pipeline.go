@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// When an ingest pipeline is configured, every message and attachment document is passed through it as it's indexed,
+// so that enrichment can be done by Elasticsearch rather than Elkbot. The pipeline can be any that exists in the cluster,
+// such as one using the geoip, user_agent or enrich processors.
+// Elkbot can also create a default pipeline under the configured name, which uses the built-in lang_ident_model_1
+// model to detect the language of each message's content and store it in the language field.
+// The default pipeline's inference processor requires machine learning to be enabled on the cluster.
+
+var _DefaultPipeline = map[string]interface{}{
+	"description": "Detects the language of Elkbot messages",
+	"processors": []interface{}{
+		map[string]interface{}{
+			"inference": map[string]interface{}{
+				"if":           "ctx.content != null && ctx.content != ''",
+				"model_id":     "lang_ident_model_1",
+				"target_field": "_ml.lang_ident",
+				"field_map":    map[string]interface{}{"content": "text"},
+				"inference_config": map[string]interface{}{
+					"classification": map[string]interface{}{"num_top_classes": 1},
+				},
+			},
+		},
+		map[string]interface{}{
+			"set": map[string]interface{}{
+				"if":    "ctx._ml?.lang_ident?.predicted_value != null",
+				"field": "language",
+				"value": "{{_ml.lang_ident.predicted_value}}",
+			},
+		},
+		map[string]interface{}{
+			"remove": map[string]interface{}{"field": "_ml", "ignore_missing": true},
+		},
+	},
+	"on_failure": []interface{}{
+		map[string]interface{}{
+			"remove": map[string]interface{}{"field": "_ml", "ignore_missing": true},
+		},
+	},
+}
+
+// _IndexPipeline returns the ingest pipeline documents written to an index should be passed through.
+// Elkbot's own bookkeeping indices are never passed through the pipeline.
+func _IndexPipeline(index string) string {
+	switch index {
+	case _DeadLetterIndex, _BlocklistIndex, _ExclusionsIndex, _CheckpointsIndex, _EventsIndex, _MigrationLockIndex:
+		return ""
+	}
+	return config.IngestPipeline
+}
+
+// _EnsureDefaultPipeline creates or replaces the default ingest pipeline under the configured pipeline name
+func _EnsureDefaultPipeline() error {
+	if config.IngestPipeline == "" {
+		return fmt.Errorf("an ingest pipeline name must be configured to create the default pipeline")
+	}
+
+	reqBody, _ := json.Marshal(_DefaultPipeline)
+	req := esapi.IngestPutPipelineRequest{
+		PipelineID: config.IngestPipeline,
+		Body:       bytes.NewReader(reqBody),
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(resp, nil)
+	if err != nil {
+		return fmt.Errorf("error creating ingest pipeline: %w", err)
+	}
+
+	log.Debug().Str("pipeline", config.IngestPipeline).Msg("Ensured default ingest pipeline")
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestIndexPipeline(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.IngestPipeline = "elkbot" })
+
+	tests := []struct {
+		index string
+		want  string
+	}{
+		{"messages-000001", "elkbot"},
+		{"attachments", "elkbot"},
+		{_DeadLetterIndex, ""},
+		{_BlocklistIndex, ""},
+		{_ExclusionsIndex, ""},
+		{_CheckpointsIndex, ""},
+		{_EventsIndex, ""},
+		{_MigrationLockIndex, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.index, func(t *testing.T) {
+			got := _IndexPipeline(test.index)
+			if got != test.want {
+				t.Errorf("got pipeline %q, want %q", got, test.want)
+			}
+		})
+	}
+}
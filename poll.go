@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+func _BuildPollDocument(poll *discordgo.Poll) map[string]interface{} {
+	votes := make(map[int]int)
+	finalized := false
+	if poll.Results != nil {
+		finalized = poll.Results.Finalized
+		for _, count := range poll.Results.AnswerCounts {
+			votes[count.ID] = count.Count
+		}
+	}
+
+	totalVotes := 0
+	answers := make([]map[string]interface{}, 0, len(poll.Answers))
+	for _, answer := range poll.Answers {
+		text := ""
+		if answer.Media != nil {
+			text = answer.Media.Text
+		}
+		answers = append(answers, map[string]interface{}{
+			"answer_id": answer.AnswerID,
+			"text":      text,
+			"votes":     votes[answer.AnswerID],
+		})
+		totalVotes += votes[answer.AnswerID]
+	}
+
+	document := map[string]interface{}{
+		"question":          poll.Question.Text,
+		"answers":           answers,
+		"allow_multiselect": poll.AllowMultiselect,
+		"finalized":         finalized,
+		"total_votes":       totalVotes,
+	}
+	if poll.Expiry != nil {
+		document["expiry"] = _FormatTimestamp(*poll.Expiry)
+	}
+
+	return document
+}
+
+func _PollVoteAddHandler(_ *discordgo.Session, vote *discordgo.MessagePollVoteAdd) {
+	if !_IsAllowedGuild(vote.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(vote.ChannelID, vote.MessageID)
+}
+
+func _PollVoteRemoveHandler(_ *discordgo.Session, vote *discordgo.MessagePollVoteRemove) {
+	if !_IsAllowedGuild(vote.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(vote.ChannelID, vote.MessageID)
+}
+
+// _PollUpdateHandler captures the final results of a poll, as Discord sends a message update when a poll ends
+func _PollUpdateHandler(_ *discordgo.Session, update *discordgo.MessageUpdate) {
+	if update.Poll == nil || !_IsAllowedGuild(update.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(update.ChannelID, update.ID)
+}
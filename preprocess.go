@@ -0,0 +1,71 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Preprocessing cleans up content before it is searched, without changing what is displayed. The processed text is
+// stored in content_searchable, which is only added when it differs from content, while content keeps the message
+// as it was sent. Each transform is toggled separately, and only applies to messages ingested after it's enabled.
+
+var _CustomEmojiMarkupPattern = regexp.MustCompile(`<a?:(\w+):\d+>`)
+
+// _ExpandableAbbreviations maps common chat abbreviations to their expansions. The abbreviation is kept alongside
+// its expansion, so searches for either match.
+var _ExpandableAbbreviations = map[string]string{
+	"afaik": "as far as i know",
+	"btw":   "by the way",
+	"fyi":   "for your information",
+	"idk":   "i don't know",
+	"iirc":  "if i remember correctly",
+	"imo":   "in my opinion",
+	"imho":  "in my humble opinion",
+	"irl":   "in real life",
+	"tbh":   "to be honest",
+	"tldr":  "too long didn't read",
+	"ty":    "thank you",
+	"np":    "no problem",
+}
+
+var _AbbreviationPattern = regexp.MustCompile(`\b\w+\b`)
+
+// _PreprocessingEnabled returns whether any content preprocessing transform is enabled
+func _PreprocessingEnabled() bool {
+	return config.PreprocessStripEmoji || config.PreprocessCollapseWhitespace || config.PreprocessExpandAbbreviations
+}
+
+// _PreprocessText applies the enabled preprocessing transforms to content
+func _PreprocessText(content string) string {
+	if config.PreprocessStripEmoji {
+		content = _CustomEmojiMarkupPattern.ReplaceAllString(content, "$1")
+	}
+	if config.PreprocessExpandAbbreviations {
+		content = _AbbreviationPattern.ReplaceAllStringFunc(content, func(word string) string {
+			if expansion, ok := _ExpandableAbbreviations[strings.ToLower(word)]; ok {
+				return word + " " + expansion
+			}
+			return word
+		})
+	}
+	if config.PreprocessCollapseWhitespace {
+		content = strings.Join(strings.Fields(content), " ")
+	}
+	return content
+}
+
+// _PreprocessContent stores the preprocessed form of a message's content for searching, if it differs from the content
+func _PreprocessContent(_ *discordgo.Message, document map[string]interface{}) {
+	if !_PreprocessingEnabled() {
+		return
+	}
+	content, ok := document["content"].(string)
+	if !ok {
+		return
+	}
+	if processed := _PreprocessText(content); processed != content {
+		document["content_searchable"] = processed
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestPreprocessText(t *testing.T) {
+	tests := []struct {
+		name    string
+		emoji   bool
+		spaces  bool
+		expand  bool
+		content string
+		want    string
+	}{
+		{"disabled", false, false, false, "<:blob:123>  btw", "<:blob:123>  btw"},
+		{"strip emoji", true, false, false, "hi <:blob:123> <a:wave:456>", "hi blob wave"},
+		{"collapse whitespace", false, true, false, "  hello \n\t world  ", "hello world"},
+		{"expand abbreviations", false, false, true, "BTW it works imo", "BTW by the way it works imo in my opinion"},
+		{"abbreviations only as words", false, false, true, "type tyre", "type tyre"},
+		{"all", true, true, true, "<:blob:123>   tbh", "blob tbh to be honest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *Config) {
+				cfg.PreprocessStripEmoji = test.emoji
+				cfg.PreprocessCollapseWhitespace = test.spaces
+				cfg.PreprocessExpandAbbreviations = test.expand
+			})
+
+			if got := _PreprocessText(test.content); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPreprocessContentKeepsDisplayContent(t *testing.T) {
+	setTestSession(t)
+	setTestConfig(t, func(cfg *Config) {
+		cfg.PreprocessStripEmoji = true
+		cfg.PreprocessCollapseWhitespace = true
+		cfg.PreprocessExpandAbbreviations = true
+	})
+
+	content := "fyi  <:blob:123> done"
+	document := _BuildMessageDocument(&discordgo.Message{
+		ID:        "42",
+		ChannelID: "7",
+		GuildID:   "1",
+		Content:   content,
+		Author:    &discordgo.User{ID: "5"},
+	})
+	if document["content"] != content {
+		t.Errorf("got content %q, want the message as it was sent", document["content"])
+	}
+	if document["content_searchable"] != "fyi for your information blob done" {
+		t.Errorf("got searchable content %q", document["content_searchable"])
+	}
+
+	unchanged := map[string]interface{}{"content": "nothing to do"}
+	_PreprocessContent(nil, unchanged)
+	if _, ok := unchanged["content_searchable"]; ok {
+		t.Error("got searchable content, want it only added when preprocessing changes the content")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// _ProxyFor returns the proxy a request should be sent through, or nil to connect directly.
+// Proxies configured for Elkbot take precedence, otherwise the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables are used.
+func _ProxyFor(req *http.Request) (*url.URL, error) {
+	if config.HTTPProxy == "" && config.HTTPSProxy == "" {
+		return http.ProxyFromEnvironment(req)
+	}
+	if _BypassesProxy(req.URL.Hostname()) {
+		return nil, nil
+	}
+
+	proxy := config.HTTPProxy
+	if req.URL.Scheme == "https" && config.HTTPSProxy != "" {
+		proxy = config.HTTPSProxy
+	}
+	if proxy == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %q: %w", proxy, err)
+	}
+	return proxyURL, nil
+}
+
+// _BypassesProxy returns whether a host matches the no proxy list, using the same format as NO_PROXY:
+// entries are host names that also match their subdomains, IP addresses, or * to bypass the proxy entirely
+func _BypassesProxy(host string) bool {
+	noProxy := config.NoProxy
+	if len(noProxy) == 0 {
+		noProxy = strings.Split(os.Getenv("NO_PROXY"), ",")
+	}
+
+	host = strings.ToLower(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// _ProxiedTransport returns a copy of the default HTTP transport that sends requests through the configured proxy
+func _ProxiedTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = _ProxyFor
+	return transport
+}
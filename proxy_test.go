@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		noProxy []string
+		want    string
+	}{
+		{"http", "http://cdn.example.com/a.png", nil, "http://http-proxy:3128"},
+		{"https", "https://cdn.example.com/a.png", nil, "http://https-proxy:3128"},
+		{"bypassed host", "https://es.internal/_bulk", []string{"es.internal"}, ""},
+		{"bypassed subdomain", "https://node1.es.internal/_bulk", []string{".es.internal"}, ""},
+		{"bypassed network", "http://10.1.2.3:9200/", []string{"10.0.0.0/8"}, ""},
+		{"other host", "https://cdn.example.com/a.png", []string{"es.internal"}, "http://https-proxy:3128"},
+		{"bypass everything", "https://cdn.example.com/a.png", []string{"*"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(cfg *Config) {
+				cfg.HTTPProxy = "http://http-proxy:3128"
+				cfg.HTTPSProxy = "http://https-proxy:3128"
+				cfg.NoProxy = test.noProxy
+			})
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			proxy, err := _ProxyFor(req)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			got := ""
+			if proxy != nil {
+				got = proxy.String()
+			}
+			if got != test.want {
+				t.Errorf("got proxy %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDownloadHonorsProxy(t *testing.T) {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.Write([]byte("through the proxy"))
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("direct"))
+	}))
+	defer direct.Close()
+
+	setTestConfig(t, func(cfg *Config) {
+		cfg.HTTPProxy = proxy.URL
+		cfg.NoProxy = []string{"127.0.0.1"}
+	})
+
+	data, err := _Download("http://cdn.example.test/attachments/a.png")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if string(data) != "through the proxy" || <-proxied != "http://cdn.example.test/attachments/a.png" {
+		t.Errorf("got %q, want the download to be sent through the proxy", data)
+	}
+
+	data, err = _Download(direct.URL)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if string(data) != "direct" {
+		t.Errorf("got %q, want hosts on the no proxy list to be connected to directly", data)
+	}
+}
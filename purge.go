@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _PurgeAttachmentBatchSize = 1000
+
+const _ClearReplySnippetScript = "ctx._source.remove('reply_to_snippet')"
+
+// _UserQuery builds a query matching all of a user's messages, optionally restricted to the channels of a single guild
+func _UserQuery(userID string, guildID string) (map[string]interface{}, error) {
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"author_id": userID}},
+	}
+
+	if guildID != "" {
+		channelFilter, err := _GuildChannelFilter(guildID, "")
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, channelFilter)
+	}
+
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"filter": filters},
+	}, nil
+}
+
+// _PurgeUser deletes all of a user's messages and the attachments belonging to them, and clears the snippets of their
+// messages from replies.
+// Messages are deleted by a background task throttled to requestsPerSecond, and progress is called with the task's ID
+// once it starts and again with its status each time it is checked.
+func _PurgeUser(userID string, guildID string, requestsPerSecond int, progress func(string, *_TaskStatus)) (int, int, error) {
+	query, err := _UserQuery(userID, guildID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	deletedAttachments := 0
+	err = _ScanAll([]string{_GuildReadIndex("messages", guildID)}, map[string]interface{}{"query": query, "_source": false}, func(hits []_SearchHit) error {
+		for start := 0; start < len(hits); start += _PurgeAttachmentBatchSize {
+			end := start + _PurgeAttachmentBatchSize
+			if end > len(hits) {
+				end = len(hits)
+			}
+
+			messageIDs := make([]string, 0, end-start)
+			for _, hit := range hits[start:end] {
+				messageIDs = append(messageIDs, hit.ID)
+			}
+
+			deleted, err := _DeleteByQuery([]string{_GuildReadIndex("attachments", guildID)}, map[string]interface{}{
+				"terms": map[string]interface{}{"message_id": messageIDs},
+			})
+			if err != nil {
+				return fmt.Errorf("error deleting attachments: %w", err)
+			}
+			deletedAttachments += deleted
+
+			_, err = _ClearReplySnippets(messageIDs, guildID)
+			if err != nil {
+				return fmt.Errorf("error clearing reply snippets: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, deletedAttachments, err
+	}
+
+	taskID, err := _StartDeleteByQuery([]string{_GuildReadIndex("messages", guildID)}, query, requestsPerSecond)
+	if err != nil {
+		return 0, deletedAttachments, fmt.Errorf("error deleting messages: %w", err)
+	}
+	log.Info().Str("user_id", userID).Str("task_id", taskID).Msg("Started deleting messages")
+	if progress != nil {
+		progress(taskID, nil)
+	}
+	deletedMessages, err := _WaitForDeleteTask(taskID, func(status *_TaskStatus) {
+		if progress != nil {
+			progress(taskID, status)
+		}
+	})
+	if err != nil {
+		return deletedMessages, deletedAttachments, fmt.Errorf("error deleting messages: %w", err)
+	}
+
+	deletedDeadLetters, err := _PurgeDeadLetters(userID, guildID)
+	if err != nil {
+		return deletedMessages, deletedAttachments, fmt.Errorf("error deleting dead lettered documents: %w", err)
+	}
+	deletedEvents, err := _PurgeUserEvents(userID, guildID)
+	if err != nil {
+		return deletedMessages, deletedAttachments, fmt.Errorf("error deleting events: %w", err)
+	}
+	log.Info().Str("user_id", userID).Int("dead_letters", deletedDeadLetters).Int("events", deletedEvents).Msg("Deleted dead lettered documents and events")
+
+	for _, guild := range session.State.Guilds {
+		if guildID != "" && guild.ID != guildID {
+			continue
+		}
+		session.State.MemberRemove(&discordgo.Member{GuildID: guild.ID, User: &discordgo.User{ID: userID}})
+	}
+
+	return deletedMessages, deletedAttachments, nil
+}
+
+// _ClearReplySnippets removes the snippets of a set of messages stored on the replies to them, which can be from other
+// authors, so that purging a user doesn't leave the content of their messages behind on other messages
+func _ClearReplySnippets(messageIDs []string, guildID string) (int, error) {
+	_ReplyCacheLock.Lock()
+	for _, messageID := range messageIDs {
+		delete(_ReplyCache, messageID)
+	}
+	_ReplyCacheLock.Unlock()
+
+	return _UpdateByQuery(
+		[]string{_GuildReadIndex("messages", guildID)},
+		map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"terms": map[string]interface{}{"referenced_message_id": messageIDs}},
+					map[string]interface{}{"exists": map[string]interface{}{"field": "reply_to_snippet"}},
+				},
+			},
+		},
+		_ClearReplySnippetScript,
+		nil,
+		0,
+	)
+}
+
+// _PurgeUserEvents deletes the moderation events about a user, optionally restricted to a single guild
+func _PurgeUserEvents(userID string, guildID string) (int, error) {
+	filters := []interface{}{map[string]interface{}{"term": map[string]interface{}{"user_id": userID}}}
+	if guildID != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"guild_id": guildID}})
+	}
+
+	deleted, err := _DeleteByQuery([]string{_EventsIndex}, map[string]interface{}{"bool": map[string]interface{}{"filter": filters}})
+	var responseErr *_ResponseError
+	if errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	return deleted, err
+}
+
+type _PurgeUserArgs struct {
+	User      string `description:"Mention or ID of the user whose data should be deleted."`
+	GuildOnly bool   `default:"false" description:"Only delete data from the current guild."`
+	RPS       int    `default:"0" description:"Maximum number of messages to delete per second. Defaults to PURGE_REQUESTS_PER_SECOND."`
+}
+
+func _PurgeUserHandler(message *discordgo.MessageCreate, args _PurgeUserArgs) {
+	userID := _ParseUserID(args.User)
+	if userID == "" {
+		session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+		return
+	}
+
+	guildID := ""
+	if args.GuildOnly {
+		guildID = message.GuildID
+	}
+
+	query, err := _UserQuery(userID, guildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	count, err := _Count([]string{_GuildReadIndex("messages", guildID)}, query)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	confirmed, err := _Confirm(message, fmt.Sprintf("This will permanently delete %d messages from <@%s> and their attachments.", count, userID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error confirming purge")
+		return
+	}
+	if !confirmed {
+		session.ChannelMessageSend(message.ChannelID, "Purge cancelled.")
+		return
+	}
+
+	requestsPerSecond := args.RPS
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = config.PurgeRequestsPerSecond
+	}
+
+	log.Info().Str("user_id", userID).Str("guild_id", guildID).Int("requests_per_second", requestsPerSecond).Msg("Purging user data")
+	var progressMessage *discordgo.Message
+	deletedMessages, deletedAttachments, err := _PurgeUser(userID, guildID, requestsPerSecond, func(taskID string, status *_TaskStatus) {
+		content := fmt.Sprintf("Deleting messages from <@%s> in task `%s`. Run `cancel-purge %s` to stop it.", userID, taskID, taskID)
+		if status != nil {
+			content = fmt.Sprintf("%s\nDeleted %d of %d messages.", content, status.Task.Status.Deleted, status.Task.Status.Total)
+		}
+		if progressMessage == nil {
+			progressMessage, _ = session.ChannelMessageSend(message.ChannelID, content)
+		} else {
+			session.ChannelMessageEdit(message.ChannelID, progressMessage.ID, content)
+		}
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error purging user data")
+		session.ChannelMessageSend(
+			message.ChannelID,
+			fmt.Sprintf("Deleted %d messages and %d attachments before stopping:\n```\n%s\n```", deletedMessages, deletedAttachments, err.Error()),
+		)
+		return
+	}
+
+	session.ChannelMessageSend(
+		message.ChannelID,
+		fmt.Sprintf("Deleted %d messages and %d attachments from <@%s>.", deletedMessages, deletedAttachments, userID),
+	)
+}
+
+type _CancelPurgeArgs struct {
+	TaskID string `description:"ID of the purge task to cancel, as reported when the purge started."`
+}
+
+func _CancelPurgeHandler(message *discordgo.MessageCreate, args _CancelPurgeArgs) {
+	err := _CancelDeleteTask(args.TaskID)
+	if err != nil {
+		log.Error().Err(err).Str("task_id", args.TaskID).Msg("Error cancelling purge")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	log.Info().Str("task_id", args.TaskID).Msg("Cancelled purge")
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Cancelled task `%s`. Messages deleted so far stay deleted.", args.TaskID))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestClearReplySnippets(t *testing.T) {
+	transport := newTestClient(t, func(req testRequest) (int, string) {
+		return http.StatusOK, `{"updated": 2}`
+	})
+	_ReplyCacheLock.Lock()
+	_ReplyCache["10"] = "purged content"
+	_ReplyCache["30"] = "kept content"
+	_ReplyCacheLock.Unlock()
+	t.Cleanup(func() {
+		_ReplyCacheLock.Lock()
+		delete(_ReplyCache, "10")
+		delete(_ReplyCache, "30")
+		_ReplyCacheLock.Unlock()
+	})
+
+	updated, err := _ClearReplySnippets([]string{"10", "20"}, "")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if updated != 2 {
+		t.Errorf("got %d updated, want 2", updated)
+	}
+
+	req := transport.Requests()[0]
+	if req.Path != "/messages/_update_by_query" {
+		t.Errorf("got path %s, want an update by query on messages", req.Path)
+	}
+	var body struct {
+		Query struct {
+			Bool struct {
+				Filter []map[string]map[string]interface{} `json:"filter"`
+			} `json:"bool"`
+		} `json:"query"`
+		Script struct {
+			Source string `json:"source"`
+		} `json:"script"`
+	}
+	json.Unmarshal(req.Body, &body)
+	if ids := body.Query.Bool.Filter[0]["terms"]["referenced_message_id"]; len(ids.([]interface{})) != 2 {
+		t.Errorf("got filter %v, want replies to the purged messages", body.Query.Bool.Filter)
+	}
+	if body.Script.Source != _ClearReplySnippetScript {
+		t.Errorf("got script %q, want the snippet to be removed", body.Script.Source)
+	}
+
+	_ReplyCacheLock.Lock()
+	_, purgedCached := _ReplyCache["10"]
+	_, keptCached := _ReplyCache["30"]
+	_ReplyCacheLock.Unlock()
+	if purgedCached || !keptCached {
+		t.Errorf("got purged cached %t and kept cached %t, want only the purged snippet evicted", purgedCached, keptCached)
+	}
+}
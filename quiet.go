@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxQuietPeriods = 10
+
+// _QuietPeriod represents a stretch of time in which no messages were sent in a channel.
+// Ongoing periods started with the newest message and last until now.
+type _QuietPeriod struct {
+	Start   time.Time
+	End     time.Time
+	Ongoing bool
+}
+
+func (period _QuietPeriod) Duration() time.Duration {
+	return period.End.Sub(period.Start)
+}
+
+// _AddQuietPeriod inserts a period into a list sorted from longest to shortest, keeping at most limit periods
+func _AddQuietPeriod(periods []_QuietPeriod, period _QuietPeriod, limit int) []_QuietPeriod {
+	index := sort.Search(len(periods), func(i int) bool {
+		return periods[i].Duration() < period.Duration()
+	})
+	if index >= limit {
+		return periods
+	}
+	periods = append(periods, _QuietPeriod{})
+	copy(periods[index+1:], periods[index:])
+	periods[index] = period
+	if len(periods) > limit {
+		periods = periods[:limit]
+	}
+	return periods
+}
+
+// _FindQuietPeriods returns the longest stretches between consecutive messages in a channel, optionally only looking at
+// the last few days. The time since the newest message is included, so a channel that has gone silent is reported too.
+func _FindQuietPeriods(channelID string, days int, limit int) ([]_QuietPeriod, error) {
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+		_NotDeletedFilter,
+	}
+	if days > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", days)}},
+		})
+	}
+
+	periods := make([]_QuietPeriod, 0, limit)
+	var previous *time.Time
+	err := _ScanAllRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+		"_source": []string{"timestamp"},
+		"sort":    []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _MessageDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding message document: %w", err)
+			}
+
+			if previous != nil {
+				periods = _AddQuietPeriod(periods, _QuietPeriod{Start: *previous, End: document.Timestamp}, limit)
+			}
+			timestamp := document.Timestamp
+			previous = &timestamp
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		periods = _AddQuietPeriod(periods, _QuietPeriod{Start: *previous, End: time.Now(), Ongoing: true}, limit)
+	}
+	return periods, nil
+}
+
+type _QuietArgs struct {
+	Channel string `description:"Channel to find quiet periods in."`
+	Days    int    `default:"0" description:"Only look at messages from this many days ago onwards. Defaults to all ingested messages."`
+	Limit   int    `default:"5" description:"Number of quiet periods to show."`
+}
+
+func _QuietHandler(message *discordgo.MessageCreate, args _QuietArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if args.Limit < 1 || args.Limit > _MaxQuietPeriods {
+		args.Limit = _MaxQuietPeriods
+	}
+
+	periods, err := _FindQuietPeriods(channel.ID, args.Days, args.Limit)
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding quiet periods")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, len(periods))
+	for index, period := range periods {
+		end := fmt.Sprintf("<t:%d:f>", period.End.Unix())
+		if period.Ongoing {
+			end = "now"
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%d. %s: <t:%d:f> to %s",
+			index+1,
+			period.Duration().Round(time.Minute),
+			period.Start.Unix(),
+			end,
+		))
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Quiet periods in #%s", channel.Name))
+	embed.Description = strings.Join(lines, "\n")
+	if args.Days > 0 {
+		embed.Footer = _EmbedFooter(fmt.Sprintf("Based on messages ingested from the last %d days", args.Days))
+	} else {
+		embed.Footer = _EmbedFooter("Based on all ingested messages")
+	}
+	if len(lines) == 0 {
+		embed.Description = "Not enough messages have been ingested from this channel."
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxReactedResults = 10
+
+var _CustomEmojiPattern = regexp.MustCompile(`^<a?:(\w+):(\d+)>$`)
+
+// _ReactionEmojiFilter builds a filter matching reactions with the given emoji, which may be a unicode emoji,
+// a custom emoji as it appears in a message, or the name or ID of a custom emoji
+func _ReactionEmojiFilter(input string) map[string]interface{} {
+	input = strings.TrimSpace(input)
+	if matches := _CustomEmojiPattern.FindStringSubmatch(input); matches != nil {
+		return map[string]interface{}{"term": map[string]interface{}{"reactions.emoji_id": matches[2]}}
+	}
+	if _SnowflakePattern.MatchString(input) {
+		return map[string]interface{}{"term": map[string]interface{}{"reactions.emoji_id": input}}
+	}
+	return map[string]interface{}{"term": map[string]interface{}{"reactions.emoji_name": strings.Trim(input, ":")}}
+}
+
+type _ReactedArgs struct {
+	Emoji   string `description:"Emoji to find reactions with."`
+	Channel string `description:"Channel to search for reacted messages in."`
+	Limit   int    `default:"5" description:"Number of messages to show."`
+}
+
+func _ReactedHandler(message *discordgo.MessageCreate, args _ReactedArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxReactedResults {
+		args.Limit = _MaxReactedResults
+	}
+
+	emojiFilter := _ReactionEmojiFilter(args.Emoji)
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size": args.Limit,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+					map[string]interface{}{"nested": map[string]interface{}{"path": "reactions", "query": emojiFilter}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{
+				"reactions.count": map[string]interface{}{
+					"order":  "desc",
+					"mode":   "max",
+					"nested": map[string]interface{}{"path": "reactions", "filter": emojiFilter},
+				},
+			},
+		},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching for reacted messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Messages in #%s reacted with %s", channel.Name, args.Emoji))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	embed.Footer = _EmbedFooter("Reaction counts are as of when each message was ingested")
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No messages found."
+	}
+	for index, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+		if len(hit.Sort) > 0 {
+			field.Name = fmt.Sprintf("#%d - %v reactions", index+1, hit.Sort[0])
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Reactions, poll votes and thread counts change without the message being edited, so re-indexing the message with its
+// edit time as the version would be rejected once anything else has updated the document and bumped its version.
+// They are applied as a partial update of only those fields instead.
+const _RefreshFieldsScript = "for (entry in params.fields.entrySet()) { ctx._source[entry.getKey()] = entry.getValue(); }"
+
+// _RefreshedFields builds the fields of a message document that change without the message being edited
+func _RefreshedFields(message *discordgo.Message) map[string]interface{} {
+	fields := map[string]interface{}{
+		"reaction_count": _ReactionCount(message),
+		"reactions":      _BuildReactionDocuments(message),
+	}
+	if message.Poll != nil {
+		fields["poll"] = _BuildPollDocument(message.Poll)
+	}
+	if message.Thread != nil {
+		fields["thread_id"] = message.Thread.ID
+		fields["thread_message_count"] = message.Thread.MessageCount
+		fields["thread_member_count"] = message.Thread.MemberCount
+		fields["thread_name"] = message.Thread.Name
+	}
+	_FilterDocumentFields(message, fields)
+	return fields
+}
+
+// _RefreshIngestedMessage re-fetches a message from Discord and updates its document, capturing changes such as poll votes
+// and reactions. Messages that were never ingested are left alone.
+func _RefreshIngestedMessage(channelID string, messageID string) {
+	count, err := _Count([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"ids": map[string]interface{}{"values": []string{messageID}},
+	})
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error checking for message document")
+		return
+	}
+	if count == 0 {
+		return
+	}
+
+	message, err := session.ChannelMessage(channelID, messageID)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error fetching message")
+		return
+	}
+
+	_, err = _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", channelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": []string{messageID}}},
+		_RefreshFieldsScript,
+		map[string]interface{}{"fields": _RefreshedFields(message)},
+		0,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error refreshing message")
+	}
+}
+
+// _ReactionAddHandler keeps the indexed reactions of a message current as reactions are added
+func _ReactionAddHandler(_ *discordgo.Session, reaction *discordgo.MessageReactionAdd) {
+	if !_IsAllowedGuild(reaction.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(reaction.ChannelID, reaction.MessageID)
+}
+
+// _ReactionRemoveHandler keeps the indexed reactions of a message current as reactions are removed
+func _ReactionRemoveHandler(_ *discordgo.Session, reaction *discordgo.MessageReactionRemove) {
+	if !_IsAllowedGuild(reaction.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(reaction.ChannelID, reaction.MessageID)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// In read-only mode Elkbot only serves searches and analytics from indices maintained by another instance.
+// Nothing is ingested, no index is created or changed, and commands that would write are rejected.
+
+// _MutatingCommands lists the commands that ingest messages or change the contents or state of Elkbot's indices.
+// Syncing slash commands is rejected by the commands handler itself, as listing them is still allowed.
+var _MutatingCommands = map[string]bool{
+	"ingest":               true,
+	"ingestall":            true,
+	"ingest-many":          true,
+	"ingest-guild":         true,
+	"ingest-range":         true,
+	"reingest-attachments": true,
+	"replay-dlq":           true,
+	"purge-user":           true,
+	"cancel-purge":         true,
+	"refresh-names":        true,
+	"blocklist":            true,
+	"exclude":              true,
+	"pause-ingest":         true,
+	"resume-ingest":        true,
+	"archive-index":        true,
+	"restore-index":        true,
+	"apply-mappings":       true,
+	"backfill-field":       true,
+	"tag":                  true,
+	"untag":                true,
+	"snapshot":             true,
+	"refresh-index":        true,
+}
+
+// _IsReadOnlyBlocked returns whether a command is unavailable because Elkbot is running in read-only mode
+func _IsReadOnlyBlocked(command string) bool {
+	return config.ReadOnly && _MutatingCommands[command]
+}
+
+// _ReadOnlyMessage is the reply sent when a mutating command is run in read-only mode
+func _ReadOnlyMessage(command string) string {
+	return fmt.Sprintf("Elkbot is running in read-only mode, so `%s` is unavailable. Run it on the ingesting instance instead.", command)
+}
+
+// _ApplyReadOnly turns off every setting that would make Elkbot write to Elasticsearch, so that a replica can share
+// its config with the ingesting instance
+func _ApplyReadOnly(cfg *Config) {
+	if !cfg.ReadOnly {
+		return
+	}
+
+	disabled := make([]string, 0)
+	disable := func(enabled bool, name string) bool {
+		if enabled {
+			disabled = append(disabled, name)
+		}
+		return false
+	}
+	cfg.LiveIngest = disable(cfg.LiveIngest, "LIVE_INGEST")
+	cfg.AutoIngestOnJoin = disable(cfg.AutoIngestOnJoin, "AUTO_INGEST_ON_JOIN")
+	cfg.TrackReactions = disable(cfg.TrackReactions, "TRACK_REACTIONS")
+	cfg.IndexScheduledEvents = disable(cfg.IndexScheduledEvents, "INDEX_SCHEDULED_EVENTS")
+	cfg.IngestEvents = disable(cfg.IngestEvents, "INGEST_EVENTS")
+	cfg.FlagDeletedMessages = disable(cfg.FlagDeletedMessages, "FLAG_DELETED_MESSAGES")
+	cfg.IncludeChannelContext = disable(cfg.IncludeChannelContext, "INCLUDE_CHANNEL_CONTEXT")
+	cfg.ResumeBackfill = disable(cfg.ResumeBackfill, "RESUME_BACKFILL")
+	cfg.CreateDefaultPipeline = disable(cfg.CreateDefaultPipeline, "CREATE_DEFAULT_PIPELINE")
+	cfg.AutoMigrate = disable(cfg.AutoMigrate, "AUTO_MIGRATE")
+	if cfg.MaxMessageAge > 0 {
+		disabled = append(disabled, "MAX_MESSAGE_AGE")
+		cfg.MaxMessageAge = 0
+	}
+	if cfg.ArchiveIndicesAfter > 0 {
+		disabled = append(disabled, "ARCHIVE_INDICES_AFTER")
+		cfg.ArchiveIndicesAfter = 0
+	}
+	if cfg.SnapshotInterval > 0 {
+		disabled = append(disabled, "SNAPSHOT_INTERVAL")
+		cfg.SnapshotInterval = 0
+	}
+	if cfg.NameRefreshInterval > 0 {
+		disabled = append(disabled, "NAME_REFRESH_INTERVAL")
+		cfg.NameRefreshInterval = 0
+	}
+	if cfg.ExternalIngestToken != "" {
+		disabled = append(disabled, "EXTERNAL_INGEST_TOKEN")
+		cfg.ExternalIngestToken = ""
+	}
+
+	if len(disabled) > 0 {
+		log.Warn().Strs("settings", disabled).Msg("Ignoring settings that write to Elasticsearch in read-only mode")
+	}
+}
+
+// _ReadOnlyIntents returns the gateway intents needed in read-only mode, which only has to receive commands
+func _ReadOnlyIntents() discordgo.Intent {
+	return discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentMessageContent
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsReadOnlyBlocked(t *testing.T) {
+	setTestConfig(t, func(cfg *Config) { cfg.ReadOnly = true })
+
+	for _, command := range []string{"ingest", "purge-user", "snapshot", "refresh-index", "apply-mappings"} {
+		if !_IsReadOnlyBlocked(command) {
+			t.Errorf("got %s allowed, want it rejected in read-only mode", command)
+		}
+	}
+	for _, command := range []string{"search", "stats", "commands"} {
+		if _IsReadOnlyBlocked(command) {
+			t.Errorf("got %s rejected, want it allowed in read-only mode", command)
+		}
+	}
+}
+
+func TestApplyReadOnly(t *testing.T) {
+	cfg := Config{
+		ReadOnly:            true,
+		LiveIngest:          true,
+		SnapshotInterval:    24 * time.Hour,
+		NameRefreshInterval: time.Hour,
+		ExternalIngestToken: "secret",
+	}
+	_ApplyReadOnly(&cfg)
+
+	if cfg.LiveIngest || cfg.SnapshotInterval != 0 || cfg.NameRefreshInterval != 0 || cfg.ExternalIngestToken != "" {
+		t.Errorf("got %+v, want every setting that writes disabled", cfg)
+	}
+}
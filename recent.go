@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxRecentResults = 20
+
+type _RecentArgs struct {
+	Channel string `description:"Channel to show the most recently ingested messages of."`
+	Limit   int    `default:"10" description:"Number of messages to show."`
+	From    string `default:"" description:"Only include messages from this user."`
+}
+
+func _RecentHandler(message *discordgo.MessageCreate, args _RecentArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxRecentResults {
+		args.Limit = _MaxRecentResults
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+		_NotDeletedFilter,
+	}
+	if args.From != "" {
+		userID := _ParseUserID(args.From)
+		if userID == "" {
+			session.ChannelMessageSend(message.ChannelID, "Please provide a valid user mention or ID.")
+			return
+		}
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"author_id": userID}})
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  args.Limit,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort":  []interface{}{map[string]interface{}{"timestamp": "desc"}},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching recent messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Most recently ingested messages in #%s", channel.Name))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No messages found."
+	}
+	for _, hit := range resp.Hits.Hits {
+		field, err := _MessageHitField(hit, message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+			continue
+		}
+		embed.Fields = append(embed.Fields, field)
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
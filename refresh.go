@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// _RefreshIndices makes all recently indexed documents in Elkbot's indices visible to searches
+func _RefreshIndices() error {
+	return _RefreshIndex([]string{_ReadIndex("messages"), _ReadIndex("attachments")})
+}
+
+// _RefreshIndex makes recently indexed documents in a set of indices visible to searches
+func _RefreshIndex(indices []string) error {
+	req := esapi.IndicesRefreshRequest{Index: indices}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+func _RefreshIndexHandler(message *discordgo.MessageCreate, args struct{}) {
+	start := time.Now()
+	err := _RefreshIndices()
+	if err != nil {
+		log.Error().Err(err).Msg("Error refreshing indices")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Indices refreshed in %s.", _FormatLatency(time.Since(start))))
+}
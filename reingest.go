@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _IngestedMessageIDs returns which of the given messages from a channel have been ingested
+func _IngestedMessageIDs(channelID string, messages []*discordgo.Message) (map[string]bool, error) {
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"size":    len(messageIDs),
+		"_source": false,
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": messageIDs},
+		},
+	}, _ChannelRouting(channelID))
+	if err != nil {
+		return nil, err
+	}
+
+	ingested := make(map[string]bool, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		ingested[hit.ID] = true
+	}
+	return ingested, nil
+}
+
+// _ReingestAttachments re-indexes the attachments of every ingested message in a channel using the current schema,
+// leaving the message documents themselves untouched. Messages that were never ingested are skipped.
+func _ReingestAttachments(channelID string) (int, error) {
+	updated := 0
+	err := _PaginateMessages(channelID, "", func(messages []*discordgo.Message) error {
+		withAttachments := make([]*discordgo.Message, 0, len(messages))
+		for _, message := range messages {
+			if len(message.Attachments) > 0 {
+				withAttachments = append(withAttachments, message)
+			}
+		}
+		if len(withAttachments) == 0 {
+			return nil
+		}
+
+		ingested, err := _IngestedMessageIDs(channelID, withAttachments)
+		if err != nil {
+			return err
+		}
+
+		items := make([]_BulkItem, 0)
+		for _, message := range withAttachments {
+			if ingested[message.ID] {
+				items = append(items, _BuildAttachmentItems(message)...)
+			}
+		}
+
+		err = _BulkInsert(items)
+		if err != nil {
+			return fmt.Errorf("error ingesting attachments: %w", err)
+		}
+		updated += len(items)
+		return nil
+	})
+	return updated, err
+}
+
+type _ReingestAttachmentsArgs struct {
+	Channel string `description:"Channel to re-index the attachments of."`
+}
+
+func _ReingestAttachmentsHandler(message *discordgo.MessageCreate, args _ReingestAttachmentsArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	updated, err := _ReingestAttachments(channel.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error re-indexing attachments")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Re-indexed %d attachments in <#%s>.", updated, channel.ID))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _ReplyCacheSize = 10000
+
+var _ReplyCache = make(map[string]string)
+var _ReplyCacheLock sync.Mutex
+
+// _ReplySnippet returns a short snippet of the message a reply refers to.
+// Lookups are cached, and references to messages that no longer exist produce an empty snippet.
+func _ReplySnippet(message *discordgo.Message) string {
+	reference := message.MessageReference
+
+	_ReplyCacheLock.Lock()
+	snippet, ok := _ReplyCache[reference.MessageID]
+	_ReplyCacheLock.Unlock()
+	if ok {
+		return snippet
+	}
+
+	referenced := message.ReferencedMessage
+	if referenced == nil {
+		channelID := reference.ChannelID
+		if channelID == "" {
+			channelID = message.ChannelID
+		}
+
+		var err error
+		referenced, err = session.ChannelMessage(channelID, reference.MessageID)
+		if err != nil {
+			log.Debug().Err(err).Str("message_id", reference.MessageID).Msg("Unable to fetch referenced message, it may have been deleted")
+		}
+	}
+	if referenced != nil {
+		snippet = _Snippet(referenced.Content, config.ReplySnippetLength)
+	}
+
+	_ReplyCacheLock.Lock()
+	if len(_ReplyCache) >= _ReplyCacheSize {
+		_ReplyCache = make(map[string]string)
+	}
+	_ReplyCache[reference.MessageID] = snippet
+	_ReplyCacheLock.Unlock()
+
+	return snippet
+}
+
+// _AddReplyFields records which message a reply refers to on its document
+func _AddReplyFields(message *discordgo.Message, document map[string]interface{}) {
+	if message.Type != discordgo.MessageTypeReply || message.MessageReference == nil {
+		return
+	}
+
+	document["referenced_message_id"] = message.MessageReference.MessageID
+	if config.ReplySnippetLength > 0 {
+		if snippet := _ReplySnippet(message); snippet != "" {
+			document["reply_to_snippet"] = snippet
+		}
+	}
+}
+
+// _ReferenceType describes why a message references another one
+func _ReferenceType(message *discordgo.Message) string {
+	switch {
+	case message.MessageReference.Type == discordgo.MessageReferenceTypeForward:
+		return "forward"
+	case message.Flags&discordgo.MessageFlagsIsCrossPosted != 0:
+		return "crosspost"
+	case message.Type == discordgo.MessageTypeReply:
+		return "reply"
+	default:
+		return "other"
+	}
+}
+
+// _AddReferenceFields records where the content a message references originated from, such as the channel and guild
+// a forwarded or crossposted message was first sent in
+func _AddReferenceFields(message *discordgo.Message, document map[string]interface{}) {
+	if message.MessageReference == nil {
+		return
+	}
+
+	document["referenced_message_id"] = message.MessageReference.MessageID
+	document["reference_type"] = _ReferenceType(message)
+	if message.MessageReference.ChannelID != "" {
+		document["reference_channel_id"] = message.MessageReference.ChannelID
+	}
+	if message.MessageReference.GuildID != "" {
+		document["reference_guild_id"] = message.MessageReference.GuildID
+	}
+}
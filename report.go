@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+var _IngestReportWindows = []struct {
+	Name   string
+	Window time.Duration
+}{
+	{"Last hour", time.Hour},
+	{"Last day", 24 * time.Hour},
+}
+
+// _FormatIngestMetrics summarizes the ingestion metrics recorded within a window
+func _FormatIngestMetrics(metrics map[string]int) string {
+	requests := metrics[_MetricBulkRequests]
+	averageBatch := 0.0
+	errorRate := 0.0
+	if requests > 0 {
+		averageBatch = float64(metrics[_MetricBulkDocuments]) / float64(requests)
+		errorRate = float64(metrics[_MetricESErrors]) / float64(requests) * 100
+	}
+
+	return fmt.Sprintf(
+		"Documents indexed: %d\nBulk requests: %d\nAverage batch size: %.1f\nElasticsearch errors: %d (%.1f%% of bulk requests)\nRetries: %d\nLive messages dropped: %d\nDuplicate live messages skipped: %d\nLive messages over their channel's share: %d",
+		metrics[_MetricDocumentsIndexed],
+		requests,
+		averageBatch,
+		metrics[_MetricESErrors],
+		errorRate,
+		metrics[_MetricBulkRetries],
+		metrics[_MetricLiveDropped],
+		metrics[_MetricLiveDuplicates],
+		metrics[_MetricLiveThrottled],
+	)
+}
+
+func _IngestReportHandler(message *discordgo.MessageCreate, args struct{}) {
+	embed := _NewEmbed("Ingestion report")
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(_IngestReportWindows))
+	embed.Footer = _EmbedFooter("Counters reset when Elkbot restarts")
+	for _, window := range _IngestReportWindows {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   window.Name,
+			Value:  _FormatIngestMetrics(_MetricsSince(window.Window)),
+			Inline: true,
+		})
+	}
+
+	withheld, total, err := _ContentAvailability(message.GuildID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error counting messages without content")
+	} else {
+		value := "Available for all indexed messages"
+		if withheld > 0 {
+			value = fmt.Sprintf("⚠️ Unavailable for %d of %d indexed messages, check that the message content intent is enabled", withheld, total)
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Message content in this server",
+			Value: value,
+		})
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// A channel needs at least this many responses for its statistics to mean anything
+const _MinResponseSamples = 10
+
+// _ResponseBuckets are the upper bounds of each bucket in the response time distribution.
+// Responses slower than the last bound fall into a final open-ended bucket.
+var _ResponseBuckets = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, 24 * time.Hour}
+
+// _ResponseTimes returns, in order of size, the gaps between each message in a channel and the message before it
+// from a different author. Consecutive messages from the same author are a continuation rather than a response.
+func _ResponseTimes(channelID string, days int) ([]time.Duration, error) {
+	responses := make([]time.Duration, 0)
+
+	var previous *_MessageDocument
+	err := _ScanAllRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", days)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"_source": []string{"author_id", "timestamp"},
+		"sort":    []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var document _MessageDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding message document: %w", err)
+			}
+
+			if previous != nil && previous.AuthorID != document.AuthorID {
+				responses = append(responses, document.Timestamp.Sub(previous.Timestamp))
+			}
+			previous = &document
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(responses, func(i, j int) bool { return responses[i] < responses[j] })
+	return responses, nil
+}
+
+// _Percentile returns the value at a percentile of sorted durations, using the nearest rank
+func _Percentile(sorted []time.Duration, percentile float64) time.Duration {
+	rank := int(percentile/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type _ResponseTimesArgs struct {
+	Channel string `description:"Channel to measure response times in."`
+	Days    int    `default:"30" description:"Number of days of messages to include."`
+}
+
+func _ResponseTimesHandler(message *discordgo.MessageCreate, args _ResponseTimesArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if args.Days < 1 {
+		args.Days = 1
+	}
+
+	responses, err := _ResponseTimes(channel.ID, args.Days)
+	if err != nil {
+		log.Error().Err(err).Msg("Error measuring response times")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if len(responses) < _MinResponseSamples {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("<#%s> only has %d responses in the last %d days, which isn't enough to measure response times.", channel.ID, len(responses), args.Days))
+		return
+	}
+
+	counts := make([]int, len(_ResponseBuckets)+1)
+	for _, response := range responses {
+		bucket := sort.Search(len(_ResponseBuckets), func(i int) bool { return response < _ResponseBuckets[i] })
+		counts[bucket]++
+	}
+
+	distribution := ""
+	for index, count := range counts {
+		label := fmt.Sprintf("> %s", _ResponseBuckets[len(_ResponseBuckets)-1])
+		if index < len(_ResponseBuckets) {
+			label = fmt.Sprintf("< %s", _ResponseBuckets[index])
+		}
+		distribution += fmt.Sprintf("%-10s %5.1f%% (%d)\n", label, float64(count)/float64(len(responses))*100, count)
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Response times in #%s", channel.Name))
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Responses", Value: fmt.Sprint(len(responses)), Inline: true},
+		{Name: "Median", Value: _Percentile(responses, 50).Round(time.Second).String(), Inline: true},
+		{Name: "90th percentile", Value: _Percentile(responses, 90).Round(time.Second).String(), Inline: true},
+		{Name: "Distribution", Value: "```\n" + distribution + "```"},
+	}
+	embed.Footer = _EmbedFooter(fmt.Sprintf("Time between messages from different authors over the last %d days", args.Days))
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// _RetentionCutoff returns the oldest time a message can have and still be retained, if a maximum age is configured
+func _RetentionCutoff() (time.Time, bool) {
+	if config.MaxMessageAge <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(-config.MaxMessageAge), true
+}
+
+// _IsExpired returns whether a message is older than the configured maximum message age
+func _IsExpired(message *discordgo.Message) bool {
+	cutoff, enabled := _RetentionCutoff()
+	return enabled && message.Timestamp.Before(cutoff)
+}
+
+// _TrimExpired removes expired messages from a page of messages ordered newest-to-oldest,
+// also returning whether any messages were removed.
+func _TrimExpired(messages []*discordgo.Message) ([]*discordgo.Message, bool) {
+	for index, message := range messages {
+		if _IsExpired(message) {
+			return messages[:index], true
+		}
+	}
+	return messages, false
+}
+
+// _EnforceRetention deletes all documents older than the configured maximum message age
+func _EnforceRetention() {
+	cutoff, enabled := _RetentionCutoff()
+	if !enabled {
+		return
+	}
+
+	query := map[string]interface{}{
+		"range": map[string]interface{}{
+			"timestamp": map[string]interface{}{"lt": _FormatTimestamp(cutoff)},
+		},
+	}
+
+	for _, index := range []string{"messages", "attachments"} {
+		deleted, err := _DeleteByQuery([]string{_ReadIndex(index)}, query)
+		if err != nil {
+			log.Error().Err(err).Str("index", index).Msg("Error enforcing retention")
+			continue
+		}
+		log.Debug().Str("index", index).Int("deleted", deleted).Msg("Enforced retention")
+	}
+}
+
+// _RetentionLoop periodically removes expired documents until the process exits
+func _RetentionLoop() {
+	ticker := time.NewTicker(config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		_EnforceRetention()
+		<-ticker.C
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+// Routing documents by channel stores all of a channel's messages and attachments on the same shard,
+// so that searches scoped to a channel only need to query a single shard.
+// This can cause shard hot-spotting when a few channels are much busier than the rest.
+// Documents indexed before routing was enabled (or after it was disabled) are stored on a different shard,
+// so messages must be re-ingested into fresh indices whenever the setting is changed, or duplicates will be created.
+
+// _DocumentRouting returns the routing value to index a channel's documents with, or an empty string when routing is disabled
+func _DocumentRouting(channelID string) string {
+	if !config.RouteByChannel {
+		return ""
+	}
+	return channelID
+}
+
+// _ChannelRouting returns the routing values for a search scoped to the given channels, or nil when routing is disabled
+func _ChannelRouting(channelIDs ...string) []string {
+	if !config.RouteByChannel {
+		return nil
+	}
+	return channelIDs
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+var _SchemaIndices = map[string]string{
+	"messages":    "messages",
+	"attachments": "attachments",
+	"blocklist":   _BlocklistIndex,
+	"exclusions":  _ExclusionsIndex,
+	"checkpoints": _CheckpointsIndex,
+	"dead-letter": _DeadLetterIndex,
+	"events":      _EventsIndex,
+}
+
+type _IndexMapping struct {
+	Mappings struct {
+		Properties map[string]_MappingField `json:"properties"`
+	} `json:"mappings"`
+}
+
+type _MappingField struct {
+	Type       string                   `json:"type"`
+	Properties map[string]_MappingField `json:"properties"`
+	Fields     map[string]_MappingField `json:"fields"`
+}
+
+// _FlattenMapping lists every field in a mapping by its full path, including object properties and multi-fields
+func _FlattenMapping(prefix string, properties map[string]_MappingField, fields map[string]string) {
+	for name, field := range properties {
+		path := prefix + name
+		fieldType := field.Type
+		if fieldType == "" {
+			fieldType = "object"
+		}
+		fields[path] = fieldType
+		_FlattenMapping(path+".", field.Properties, fields)
+		_FlattenMapping(path+".", field.Fields, fields)
+	}
+}
+
+// _FetchSchema returns the type of every field in one of Elkbot's indices. When the pattern matches several indices,
+// such as with time-based indices, fields from all of them are included.
+func _FetchSchema(index string) (map[string]string, error) {
+	req := esapi.IndicesGetMappingRequest{Index: []string{index}}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var mappings map[string]_IndexMapping
+	err = _DecodeResponse(resp, &mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string)
+	for _, mapping := range mappings {
+		_FlattenMapping("", mapping.Mappings.Properties, fields)
+	}
+	return fields, nil
+}
+
+type _SchemaArgs struct {
+	Index string `default:"messages" description:"Index to show the fields of: messages, attachments, blocklist, exclusions, checkpoints, dead-letter or events."`
+}
+
+func _SchemaHandler(message *discordgo.MessageCreate, args _SchemaArgs) {
+	index, ok := _SchemaIndices[args.Index]
+	if !ok {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown index %q, expected one of messages, attachments, blocklist, exclusions, checkpoints, dead-letter or events.", args.Index))
+		return
+	}
+	if args.Index == "messages" || args.Index == "attachments" {
+		index = _GuildReadIndex(index, message.GuildID)
+	}
+
+	fields, err := _FetchSchema(index)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching index mapping")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var schema strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&schema, "%s: %s\n", path, fields[path])
+	}
+
+	header := fmt.Sprintf("Fields in the %s index (%d):", args.Index, len(paths))
+	if len(header)+schema.Len()+len("\n```\n```") <= _MaxMessageLength {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("%s\n```\n%s```", header, schema.String()))
+		return
+	}
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: header,
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("%s-schema.txt", args.Index),
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(schema.String()),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading schema")
+	}
+}
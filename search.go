@@ -0,0 +1,611 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _PreviousPageID = "search:previous"
+const _NextPageID = "search:next"
+const _SnippetLength = 200
+
+// Discord allows 5 rows of 5 buttons per message, and the first row is used for navigation
+const _ButtonsPerRow = 5
+const _MaxJumpButtons = 4 * _ButtonsPerRow
+
+// Elasticsearch rejects searches whose from + size exceeds index.max_result_window, which defaults to 10000
+const _MaxResultWindow = 10000
+
+// _MessageDocument represents a message document as stored in Elasticsearch
+type _MessageDocument struct {
+	Content    string    `json:"content"`
+	ChannelID  string    `json:"channel_id"`
+	AuthorID   string    `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Source     string    `json:"source"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// UnmarshalJSON decodes a message document, decrypting its content if it was encrypted
+func (document *_MessageDocument) UnmarshalJSON(data []byte) error {
+	type storedDocument _MessageDocument
+	err := json.Unmarshal(data, (*storedDocument)(document))
+	if err != nil {
+		return err
+	}
+	document.Content = _DecryptContent(document.Content)
+	return nil
+}
+
+// _SearchSession stores the state required to paginate through the results of a search
+type _SearchSession struct {
+	AuthorID  string
+	ChannelID string
+	GuildID   string
+	Text      string
+	Query     map[string]interface{}
+	Sort      []interface{}
+	Routing   []string
+	Page      int
+	PageSize  int
+	Total     int
+
+	// Attachments searches the attachments index instead of messages
+	Attachments bool
+
+	// lock is held while a page is fetched and sent, so that presses on one search's buttons are handled in order
+	lock sync.Mutex
+}
+
+// _SearchPages returns the number of pages of a search session that can be fetched within the result window
+func _SearchPages(searchSession *_SearchSession) int {
+	total := searchSession.Total
+	if total > _MaxResultWindow {
+		total = _MaxResultWindow
+	}
+	pages := (total + searchSession.PageSize - 1) / searchSession.PageSize
+	if pages == 0 {
+		pages = 1
+	}
+	return pages
+}
+
+var _SearchSessions = make(map[string]*_SearchSession)
+var _SearchSessionsLock sync.Mutex
+
+// _CanViewChannel returns whether a user can view a channel, treating permissions that can't be determined as denied
+func _CanViewChannel(userID string, channelID string) bool {
+	permissions, err := session.UserChannelPermissions(userID, channelID)
+	if err != nil {
+		log.Warn().Err(err).Str("user_id", userID).Str("channel_id", channelID).Msg("Error checking channel permissions")
+		return false
+	}
+	return permissions&discordgo.PermissionViewChannel != 0
+}
+
+// _GuildDiscordChannelFilter builds a filter restricting documents to the Discord channels of a guild.
+// When userID is set, only the channels that user can view are included, so that searches don't reveal private channels.
+func _GuildDiscordChannelFilter(guildID string, userID string) (map[string]interface{}, error) {
+	channels, err := session.GuildChannels(guildID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching guild channels: %w", err)
+	}
+	channelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if userID != "" && !_CanViewChannel(userID, channel.ID) {
+			continue
+		}
+		channelIDs = append(channelIDs, channel.ID)
+	}
+	return map[string]interface{}{"terms": map[string]interface{}{"channel_id": channelIDs}}, nil
+}
+
+// _GuildChannelFilter builds a filter restricting documents to the channels of a guild, along with the messages
+// posted to it from external sources, whose channels aren't Discord's. See _GuildDiscordChannelFilter for userID.
+func _GuildChannelFilter(guildID string, userID string) (map[string]interface{}, error) {
+	discordFilter, err := _GuildDiscordChannelFilter(guildID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				discordFilter,
+				map[string]interface{}{"bool": map[string]interface{}{
+					"filter":   map[string]interface{}{"term": map[string]interface{}{"guild_id": guildID}},
+					"must_not": map[string]interface{}{"term": map[string]interface{}{"source": _DiscordSource}},
+				}},
+			},
+			"minimum_should_match": 1,
+		},
+	}, nil
+}
+
+func _Snippet(content string, length int) string {
+	runes := []rune(content)
+	if len(runes) <= length {
+		return content
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+func _JumpURL(guildID string, channelID string, messageID string) string {
+	return fmt.Sprintf("https://discord.com/channels/%s/%s/%s", guildID, channelID, messageID)
+}
+
+// _MessageHitField renders a message search hit as an embed field
+func _MessageHitField(hit _SearchHit, guildID string) (*discordgo.MessageEmbedField, error) {
+	var document _MessageDocument
+	err := json.Unmarshal(hit.Source, &document)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding message document: %w", err)
+	}
+
+	// External messages have no Discord channel or message to link to
+	if document.Source != "" && document.Source != _DiscordSource {
+		return &discordgo.MessageEmbedField{
+			Name: document.Timestamp.Format("2006-01-02 15:04"),
+			Value: fmt.Sprintf(
+				"%s in %s on %s\n%s",
+				document.AuthorName,
+				document.ChannelID,
+				document.Source,
+				_Snippet(document.Content, _SnippetLength),
+			),
+		}, nil
+	}
+
+	return &discordgo.MessageEmbedField{
+		Name: document.Timestamp.Format("2006-01-02 15:04"),
+		Value: fmt.Sprintf(
+			"<@%s> in <#%s>\n%s\n[Jump to message](%s)",
+			document.AuthorID,
+			document.ChannelID,
+			_Snippet(document.Content, _SnippetLength),
+			_JumpURL(guildID, document.ChannelID, hit.ID),
+		),
+	}, nil
+}
+
+// _SearchSorts maps the sort orders search results can be shown in to the sort clause used for them.
+// Sorting by relevance uses Elasticsearch's default ordering by score.
+var _SearchSorts = map[string][]interface{}{
+	"relevance": nil,
+	"newest":    {map[string]interface{}{"timestamp": "desc"}},
+	"oldest":    {map[string]interface{}{"timestamp": "asc"}},
+	"reactions": {
+		map[string]interface{}{"reaction_count": map[string]interface{}{"order": "desc", "missing": "_last"}},
+		map[string]interface{}{"timestamp": "desc"},
+	},
+}
+
+// _NotDeletedFilter excludes messages that have been flagged as deleted
+var _NotDeletedFilter = map[string]interface{}{
+	"bool": map[string]interface{}{
+		"must_not": map[string]interface{}{
+			"term": map[string]interface{}{"deleted": true},
+		},
+	},
+}
+
+// _RunSearch fetches the current page of a search session, updating the session's total hit count
+func _RunSearch(searchSession *_SearchSession) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	if searchSession.PageSize > _MaxResultWindow {
+		searchSession.PageSize = _MaxResultWindow
+	}
+	if maxPage := (_MaxResultWindow+searchSession.PageSize-1)/searchSession.PageSize - 1; searchSession.Page > maxPage {
+		searchSession.Page = maxPage
+	}
+	from := searchSession.Page * searchSession.PageSize
+	size := searchSession.PageSize
+	if from+size > _MaxResultWindow {
+		size = _MaxResultWindow - from
+	}
+	body := map[string]interface{}{
+		"query": searchSession.Query,
+		"from":  from,
+		"size":  size,
+	}
+	if searchSession.Sort != nil {
+		body["sort"] = searchSession.Sort
+	}
+	index, title := "messages", "Search results"
+	if searchSession.Attachments {
+		index, title = "attachments", "Attachment results"
+	}
+	resp, err := _SearchRouted([]string{_GuildReadIndex(index, searchSession.GuildID)}, body, searchSession.Routing)
+	if err != nil {
+		return nil, nil, err
+	}
+	searchSession.Total = resp.Hits.Total.Value
+
+	embed := _NewEmbed(fmt.Sprintf("%s for \"%s\"", title, _Snippet(searchSession.Text, 100)))
+	embed.Fields = make([]*discordgo.MessageEmbedField, 0, len(resp.Hits.Hits))
+	if len(resp.Hits.Hits) == 0 {
+		embed.Description = "No results found."
+	}
+
+	jumpURLs := make([]string, 0, len(resp.Hits.Hits))
+	for index, hit := range resp.Hits.Hits {
+		var field *discordgo.MessageEmbedField
+		var jumpURL string
+		if searchSession.Attachments {
+			field, jumpURL, err = _AttachmentHitField(hit, searchSession.GuildID)
+		} else {
+			field, err = _MessageHitField(hit, searchSession.GuildID)
+			var document _MessageDocument
+			json.Unmarshal(hit.Source, &document)
+			jumpURL = _JumpURL(searchSession.GuildID, document.ChannelID, hit.ID)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		field.Name = fmt.Sprintf("%d. %s", searchSession.Page*searchSession.PageSize+index+1, field.Name)
+		embed.Fields = append(embed.Fields, field)
+		jumpURLs = append(jumpURLs, jumpURL)
+	}
+
+	pages := _SearchPages(searchSession)
+	footer := fmt.Sprintf("Page %d of %d (%d results)", searchSession.Page+1, pages, searchSession.Total)
+	if searchSession.Total > _MaxResultWindow {
+		footer = fmt.Sprintf("Page %d of %d (%d results, only the first %d can be paged through)", searchSession.Page+1, pages, searchSession.Total, _MaxResultWindow)
+	}
+	embed.Footer = _EmbedFooter(footer)
+
+	return embed, _SearchComponents(searchSession, pages, jumpURLs), nil
+}
+
+// _SearchComponents builds the buttons attached to a page of search results.
+// Navigation buttons are only included when there is more than one page, followed by a link to each result.
+func _SearchComponents(searchSession *_SearchSession, pages int, jumpURLs []string) []discordgo.MessageComponent {
+	components := make([]discordgo.MessageComponent, 0)
+	if pages > 1 {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: _PreviousPageID,
+				Disabled: searchSession.Page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next",
+				Style:    discordgo.SecondaryButton,
+				CustomID: _NextPageID,
+				Disabled: searchSession.Page >= pages-1,
+			},
+		}})
+	}
+
+	if len(jumpURLs) > _MaxJumpButtons {
+		jumpURLs = jumpURLs[:_MaxJumpButtons]
+	}
+	for start := 0; start < len(jumpURLs); start += _ButtonsPerRow {
+		row := discordgo.ActionsRow{}
+		for index := start; index < start+_ButtonsPerRow && index < len(jumpURLs); index++ {
+			row.Components = append(row.Components, discordgo.Button{
+				Label: fmt.Sprintf("Jump to %d", searchSession.Page*searchSession.PageSize+index+1),
+				Style: discordgo.LinkButton,
+				URL:   jumpURLs[index],
+			})
+		}
+		components = append(components, row)
+	}
+
+	return components
+}
+
+// _ExpireSearchSession stops a search result message from responding to its buttons
+func _ExpireSearchSession(messageID string) {
+	_SearchSessionsLock.Lock()
+	searchSession, ok := _SearchSessions[messageID]
+	delete(_SearchSessions, messageID)
+	_SearchSessionsLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	_, err := session.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         messageID,
+		Channel:    searchSession.ChannelID,
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		log.Debug().Err(err).Str("message_id", messageID).Msg("Unable to remove buttons from expired search results")
+	}
+}
+
+type _SearchArgs struct {
+	Query   string `description:"Text to search for. Can include author:, channel:, before:, after: and has:attachment filters."`
+	Limit   int    `default:"5" description:"Number of results to show per page."`
+	Channel string `default:"" description:"Only search messages from this channel."`
+	Phrase  bool   `default:"false" description:"Only match messages containing the words of the query in order. Case is still ignored."`
+	Exact   bool   `default:"false" description:"Only match messages whose entire content is exactly the query, including case."`
+	Raw     bool   `default:"false" description:"Treat the query as Lucene query string syntax, such as content:foo AND author_id:123."`
+	Sort    string `default:"relevance" description:"Order to show results in: relevance, newest, oldest or reactions."`
+	Tag     string `default:"" description:"Only search messages with this tag."`
+	Export  string `default:"" description:"Upload every matching message as a json or csv file instead of showing a page of results."`
+}
+
+// _RawQueryFields lists the fields that raw queries are allowed to reference
+var _RawQueryFields = map[string]bool{
+	"content":           true,
+	"content.keyword":   true,
+	"author_id":         true,
+	"attachment_count":  true,
+	"author_name":       true,
+	"channel_id":        true,
+	"timestamp":         true,
+	"reaction_count":    true,
+	"content_length":    true,
+	"source":            true,
+	"tags":              true,
+	"poll.question":     true,
+	"poll.answers.text": true,
+}
+
+var _RawQueryFieldPattern = regexp.MustCompile(`([\w.*]+):`)
+
+// _ValidateRawQuery checks that a raw query only references fields that are allowed to be searched
+func _ValidateRawQuery(query string) error {
+	for _, matches := range _RawQueryFieldPattern.FindAllStringSubmatch(query, -1) {
+		if !_RawQueryFields[matches[1]] {
+			return fmt.Errorf("the %s field can't be searched", matches[1])
+		}
+	}
+	return nil
+}
+
+// _SearchFields returns the fields searched by default, boosted so that matches in a message's own content rank
+// above matches in less prominent text
+func _SearchFields() []string {
+	fields := make([]string, 0, len(config.SearchFieldBoosts))
+	for field, boost := range config.SearchFieldBoosts {
+		fields = append(fields, fmt.Sprintf("%s^%g", field, boost))
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// _SearchTextQuery builds the query used to match search text against messages.
+// By default any of the words in the text can match, ignoring case. Without any text every message matches,
+// leaving the search to its filters.
+func _SearchTextQuery(args _SearchArgs) map[string]interface{} {
+	args.Query = _NormalizeText(args.Query)
+	if strings.TrimSpace(args.Query) == "" {
+		return map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	if config.EncryptContent {
+		return _EncryptedSearchQuery(args.Query)
+	}
+	if args.Exact {
+		return map[string]interface{}{
+			"term": map[string]interface{}{"content.keyword": args.Query},
+		}
+	}
+	if args.Raw {
+		return map[string]interface{}{
+			"query_string": map[string]interface{}{
+				"query":                  args.Query,
+				"fields":                 _SearchFields(),
+				"allow_leading_wildcard": false,
+			},
+		}
+	}
+
+	query := map[string]interface{}{
+		"query":  args.Query,
+		"fields": _SearchFields(),
+	}
+	if args.Phrase {
+		query["type"] = "phrase"
+	}
+	return map[string]interface{}{"multi_match": query}
+}
+
+func _SearchHandler(message *discordgo.MessageCreate, args _SearchArgs) {
+	if args.Limit < 1 {
+		args.Limit = 1
+	}
+	if args.Limit > config.MaxSearchResults {
+		args.Limit = config.MaxSearchResults
+	}
+
+	if (args.Phrase && args.Exact) || (args.Raw && (args.Phrase || args.Exact)) {
+		session.ChannelMessageSend(message.ChannelID, "Only one of phrase, exact and raw search can be used at a time.")
+		return
+	}
+	sortClause, ok := _SearchSorts[args.Sort]
+	if !ok {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Unknown sort %q, expected relevance, newest, oldest or reactions.", args.Sort))
+		return
+	}
+	if args.Export != "" {
+		err := _ValidateExportFormat(args.Export)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+	if config.EncryptContent && (args.Phrase || args.Raw) {
+		session.ChannelMessageSend(message.ChannelID, "Message content is encrypted, so only searches for a message's exact content are supported.")
+		return
+	}
+	if args.Raw {
+		err := _ValidateRawQuery(args.Query)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid query: %s.", err.Error()))
+			return
+		}
+	}
+
+	text := args.Query
+	inlineFilters := make([]interface{}, 0)
+	var routing []string
+	if !args.Raw {
+		var err error
+		args.Query, inlineFilters, routing, err = _ParseSearchFilters(args.Query, message.GuildID, false)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid query: %s.", err.Error()))
+			return
+		}
+	}
+
+	var channelFilter map[string]interface{}
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		if !_CanViewChannel(message.Author.ID, channel.ID) {
+			session.ChannelMessageSend(message.ChannelID, "You can't view that channel.")
+			return
+		}
+		channelFilter = map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+		routing = _ChannelRouting(channel.ID)
+	} else {
+		var err error
+		channelFilter, err = _GuildChannelFilter(message.GuildID, message.Author.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error building search query")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+	}
+
+	if args.Tag != "" {
+		tag, err := _NormalizeTag(args.Tag)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid tag: %s.", err.Error()))
+			return
+		}
+		channelFilter = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{channelFilter, map[string]interface{}{"term": map[string]interface{}{"tags": tag}}},
+			},
+		}
+	}
+
+	// Scores are ignored when results aren't sorted by relevance, so the text query can run in filter context
+	// and skip scoring entirely
+	query := map[string]interface{}{
+		"must":   _SearchTextQuery(args),
+		"filter": append([]interface{}{channelFilter, _NotDeletedFilter}, inlineFilters...),
+	}
+	if sortClause != nil {
+		delete(query, "must")
+		query["filter"] = append([]interface{}{_SearchTextQuery(args), channelFilter, _NotDeletedFilter}, inlineFilters...)
+	}
+
+	searchSession := &_SearchSession{
+		AuthorID:  message.Author.ID,
+		ChannelID: message.ChannelID,
+		GuildID:   message.GuildID,
+		Text:      text,
+		Query:     map[string]interface{}{"bool": query},
+		Sort:      sortClause,
+		Routing:   routing,
+		PageSize:  args.Limit,
+	}
+	if args.Export != "" {
+		_ExportSearchResults(message, searchSession, args.Export)
+		return
+	}
+
+	embed, components, err := _RunSearch(searchSession)
+	var responseErr *_ResponseError
+	if args.Raw && errors.As(err, &responseErr) && responseErr.StatusCode == http.StatusBadRequest {
+		session.ChannelMessageSend(message.ChannelID, "Elasticsearch couldn't parse that query. Check its syntax, such as unbalanced quotes or brackets.")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	_SendSearchPage(message, searchSession, embed, components)
+}
+
+// _SendSearchPage sends the first page of a search's results, keeping the search session around to paginate through
+// the rest when there is more than one page
+func _SendSearchPage(message *discordgo.MessageCreate, searchSession *_SearchSession, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) {
+	resultMessage, err := session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error sending search results")
+		return
+	}
+
+	if searchSession.Total <= searchSession.PageSize {
+		return
+	}
+
+	_SearchSessionsLock.Lock()
+	_SearchSessions[resultMessage.ID] = searchSession
+	_SearchSessionsLock.Unlock()
+	time.AfterFunc(config.SearchPaginationTimeout, func() { _ExpireSearchSession(resultMessage.ID) })
+}
+
+// _SearchComponentHandler handles paginating through search results when the user who searched presses their buttons
+func _SearchComponentHandler(interaction *discordgo.InteractionCreate) {
+	customID := interaction.MessageComponentData().CustomID
+	if customID != _PreviousPageID && customID != _NextPageID {
+		return
+	}
+
+	_SearchSessionsLock.Lock()
+	searchSession, ok := _SearchSessions[interaction.Message.ID]
+	_SearchSessionsLock.Unlock()
+	if !ok {
+		_RespondEphemeral(interaction, "These search results have expired, please search again.")
+		return
+	}
+	if _InteractionMessage(interaction).Author.ID != searchSession.AuthorID {
+		_RespondEphemeral(interaction, "Only the user who searched can change pages.")
+		return
+	}
+
+	searchSession.lock.Lock()
+	defer searchSession.lock.Unlock()
+
+	page := searchSession.Page
+	if customID == _NextPageID {
+		page++
+	} else {
+		page--
+	}
+	if page >= 0 && page < _SearchPages(searchSession) {
+		searchSession.Page = page
+	}
+
+	embed, components, err := _RunSearch(searchSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching page of search results")
+		_RespondEphemeral(interaction, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error updating search results")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestRunSearchResultWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     int
+		pageSize int
+		wantPage int
+		wantFrom int
+		wantSize int
+	}{
+		{"first page", 0, 5, 0, 0, 5},
+		{"last page in window", 1999, 5, 1999, 9995, 5},
+		{"beyond window", 5000, 5, 1999, 9995, 5},
+		{"partial last page", 3333, 3, 3333, 9999, 1},
+		{"page size over window", 0, 20000, 0, 0, _MaxResultWindow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := newTestClient(t, func(req testRequest) (int, string) {
+				return http.StatusOK, `{"hits": {"total": {"value": 50000}, "hits": []}}`
+			})
+
+			searchSession := &_SearchSession{
+				Text:     "hello",
+				Query:    map[string]interface{}{"match_all": map[string]interface{}{}},
+				Page:     test.page,
+				PageSize: test.pageSize,
+			}
+			embed, _, err := _RunSearch(searchSession)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if searchSession.Page != test.wantPage {
+				t.Errorf("got page %d, want %d", searchSession.Page, test.wantPage)
+			}
+
+			var body map[string]interface{}
+			json.Unmarshal(transport.Requests()[0].Body, &body)
+			if body["from"] != float64(test.wantFrom) || body["size"] != float64(test.wantSize) {
+				t.Errorf("got from %v and size %v, want %d and %d", body["from"], body["size"], test.wantFrom, test.wantSize)
+			}
+			if pages := _SearchPages(searchSession); searchSession.Page >= pages {
+				t.Errorf("got page %d of %d pages", searchSession.Page, pages)
+			}
+			if embed.Footer == nil {
+				t.Error("got no footer, want the page count")
+			}
+		})
+	}
+}
+
+func TestGuildChannelFilterHidesPrivateChannels(t *testing.T) {
+	testSession := setTestSession(t)
+	guild, _ := testSession.State.Guild("1")
+	guild.Roles = []*discordgo.Role{{ID: "1", Permissions: discordgo.PermissionViewChannel}}
+	private := &discordgo.Channel{
+		ID:      "8",
+		GuildID: "1",
+		Name:    "staff",
+		Type:    discordgo.ChannelTypeGuildText,
+		PermissionOverwrites: []*discordgo.PermissionOverwrite{
+			{ID: "1", Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+		},
+	}
+	testSession.State.ChannelAdd(private)
+	testSession.State.MemberAdd(&discordgo.Member{GuildID: "1", User: &discordgo.User{ID: "5"}})
+	newTestDiscordAPI(testSession, func(req testRequest) (int, string) {
+		channels, _ := json.Marshal(guild.Channels)
+		return http.StatusOK, string(channels)
+	})
+
+	tests := []struct {
+		name   string
+		userID string
+		want   []interface{}
+	}{
+		{"member", "5", []interface{}{"7"}},
+		{"unfiltered", "", []interface{}{"7", "8"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := _GuildDiscordChannelFilter("1", test.userID)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			encoded, _ := json.Marshal(filter)
+			var decoded map[string]map[string][]interface{}
+			json.Unmarshal(encoded, &decoded)
+			got := decoded["terms"]["channel_id"]
+			if len(got) != len(test.want) {
+				t.Fatalf("got channels %v, want %v", got, test.want)
+			}
+			for index := range got {
+				if got[index] != test.want[index] {
+					t.Errorf("got channels %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+var _errSearchExportLimitReached = errors.New("reached the maximum number of exported search results")
+
+// _ExportedMessage represents a message in an exported set of search results
+type _ExportedMessage struct {
+	ID         string    `json:"id"`
+	ChannelID  string    `json:"channel_id"`
+	AuthorID   string    `json:"author_id"`
+	AuthorName string    `json:"author_name"`
+	Timestamp  time.Time `json:"timestamp"`
+	Content    string    `json:"content"`
+	URL        string    `json:"url"`
+}
+
+// _ValidateExportFormat checks that search results can be exported in a format
+func _ValidateExportFormat(format string) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unknown export format %q, expected json or csv", format)
+	}
+	return nil
+}
+
+// _ScanSearchResults collects every message matching a search, up to the configured maximum,
+// also returning whether there were more matches than that
+func _ScanSearchResults(searchSession *_SearchSession) ([]_ExportedMessage, bool, error) {
+	body := map[string]interface{}{"query": searchSession.Query}
+	if searchSession.Sort != nil {
+		body["sort"] = searchSession.Sort
+	}
+
+	messages := make([]_ExportedMessage, 0)
+	err := _ScanAllRouted([]string{_GuildReadIndex("messages", searchSession.GuildID)}, body, searchSession.Routing, func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			if len(messages) >= config.MaxSearchExportResults {
+				return _errSearchExportLimitReached
+			}
+
+			var document _MessageDocument
+			err := json.Unmarshal(hit.Source, &document)
+			if err != nil {
+				return fmt.Errorf("error decoding message document: %w", err)
+			}
+			var author struct {
+				AuthorName string `json:"author_name"`
+			}
+			json.Unmarshal(hit.Source, &author)
+
+			messages = append(messages, _ExportedMessage{
+				ID:         hit.ID,
+				ChannelID:  document.ChannelID,
+				AuthorID:   document.AuthorID,
+				AuthorName: author.AuthorName,
+				Timestamp:  document.Timestamp,
+				Content:    document.Content,
+				URL:        _JumpURL(searchSession.GuildID, document.ChannelID, hit.ID),
+			})
+		}
+		return nil
+	})
+	limited := errors.Is(err, _errSearchExportLimitReached)
+	if limited {
+		err = nil
+	}
+	return messages, limited, err
+}
+
+// _WriteSearchResults encodes exported messages in the given format
+func _WriteSearchResults(format string, messages []_ExportedMessage) (*bytes.Buffer, error) {
+	var output bytes.Buffer
+	if format == "json" {
+		encoder := json.NewEncoder(&output)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(messages)
+		if err != nil {
+			return nil, fmt.Errorf("error writing JSON: %w", err)
+		}
+		return &output, nil
+	}
+
+	writer := csv.NewWriter(&output)
+	err := writer.Write([]string{"id", "channel_id", "author_id", "author_name", "timestamp", "content", "url"})
+	if err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %w", err)
+	}
+	for _, message := range messages {
+		err = writer.Write([]string{
+			message.ID,
+			message.ChannelID,
+			message.AuthorID,
+			message.AuthorName,
+			message.Timestamp.UTC().Format(time.RFC3339),
+			message.Content,
+			message.URL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error writing CSV row: %w", err)
+		}
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return nil, fmt.Errorf("error writing CSV: %w", err)
+	}
+	return &output, nil
+}
+
+// _ExportSearchResults uploads every message matching a search as a file, instead of showing a page of results
+func _ExportSearchResults(message *discordgo.MessageCreate, searchSession *_SearchSession, format string) {
+	messages, limited, err := _ScanSearchResults(searchSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Error exporting search results")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	output, err := _WriteSearchResults(format, messages)
+	if err != nil {
+		log.Error().Err(err).Msg("Error writing search results")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	content := fmt.Sprintf("Exported %d matching messages for \"%s\".", len(messages), _Snippet(searchSession.Text, 100))
+	if limited {
+		content += fmt.Sprintf(" ⚠️ Only the first %d matches were exported.", config.MaxSearchExportResults)
+	}
+	contentType := "application/json"
+	if format == "csv" {
+		contentType = "text/csv"
+	}
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: content,
+		Files: []*discordgo.File{{
+			Name:        "search-results." + format,
+			ContentType: contentType,
+			Reader:      output,
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading search results")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Search text can narrow results with filters written inline, like Discord's own search: author:, channel:, before:, after:
+// and has:attachment. Dates are whole days in the configured timezone, and both before: and after: exclude the day itself.
+// Every other word is searched for as text, so a query made only of filters matches everything they allow.
+
+var _SearchFilterPrefixes = []string{"author:", "channel:", "before:", "after:", "has:"}
+
+// _ParseSearchFilters splits the inline filters out of search text, returning the remaining text along with the filters
+// and the routing of the channel searched, if any. Attachment documents don't record whether they have attachments,
+// so has: is only accepted when searching messages.
+func _ParseSearchFilters(text string, guildID string, attachments bool) (string, []interface{}, []string, error) {
+	words := make([]string, 0)
+	filters := make([]interface{}, 0)
+	var routing []string
+
+	for _, word := range strings.Fields(text) {
+		prefix := ""
+		for _, candidate := range _SearchFilterPrefixes {
+			if strings.HasPrefix(strings.ToLower(word), candidate) {
+				prefix = candidate
+			}
+		}
+		value := word[len(prefix):]
+		if prefix == "" || value == "" {
+			words = append(words, word)
+			continue
+		}
+
+		switch prefix {
+		case "author:":
+			userID := _ParseUserID(value)
+			if userID == "" {
+				return "", nil, nil, fmt.Errorf("%q is not a valid user mention or ID", value)
+			}
+			filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"author_id": userID}})
+		case "channel:":
+			channel, err := _ResolveGuildChannel(value, guildID)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}})
+			routing = _ChannelRouting(channel.ID)
+		case "before:", "after:":
+			_, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("%q is not a date in the format YYYY-MM-DD", value)
+			}
+			operator := "lt"
+			if prefix == "after:" {
+				operator = "gt"
+			}
+			filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{
+				operator:    value + "||/d",
+				"format":    "yyyy-MM-dd",
+				"time_zone": config.Timezone,
+			}}})
+		case "has:":
+			if attachments || (value != "attachment" && value != "attachments") {
+				return "", nil, nil, fmt.Errorf("unknown filter %q, only has:attachment is supported when searching messages", word)
+			}
+			filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"attachment_count": map[string]interface{}{"gte": 1}}})
+		}
+	}
+
+	return strings.Join(words, " "), filters, routing, nil
+}
+
+// _AttachmentHitField renders an attachment search hit as an embed field, along with the jump URL of its message
+func _AttachmentHitField(hit _SearchHit, guildID string) (*discordgo.MessageEmbedField, string, error) {
+	var document struct {
+		Filename  string    `json:"filename"`
+		URL       string    `json:"url"`
+		MessageID string    `json:"message_id"`
+		ChannelID string    `json:"channel_id"`
+		AuthorID  string    `json:"author_id"`
+		Timestamp time.Time `json:"timestamp"`
+		IsSpoiler bool      `json:"is_spoiler"`
+	}
+	err := json.Unmarshal(hit.Source, &document)
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding attachment document: %w", err)
+	}
+
+	jumpURL := _JumpURL(guildID, document.ChannelID, document.MessageID)
+	location := fmt.Sprintf("<#%s>", document.ChannelID)
+	if document.AuthorID != "" {
+		location = fmt.Sprintf("<@%s> in %s", document.AuthorID, location)
+	}
+	filename := fmt.Sprintf("[%s](%s)", document.Filename, document.URL)
+	if document.IsSpoiler {
+		filename = "||" + filename + "||"
+	}
+
+	return &discordgo.MessageEmbedField{
+		Name:  document.Timestamp.Format("2006-01-02 15:04"),
+		Value: fmt.Sprintf("%s\n%s\n[Jump to message](%s)", location, filename, jumpURL),
+	}, jumpURL, nil
+}
+
+type _AttachmentsSearchArgs struct {
+	Query   string `default:"" description:"Text to search attachment filenames and descriptions for, along with any filters."`
+	Limit   int    `default:"5" description:"Number of results to show per page."`
+	Channel string `default:"" description:"Only search attachments from this channel."`
+}
+
+func _AttachmentsSearchHandler(message *discordgo.MessageCreate, args _AttachmentsSearchArgs) {
+	if args.Limit < 1 {
+		args.Limit = 1
+	}
+	if args.Limit > config.MaxSearchResults {
+		args.Limit = config.MaxSearchResults
+	}
+
+	text, filters, routing, err := _ParseSearchFilters(args.Query, message.GuildID, true)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid query: %s.", err.Error()))
+		return
+	}
+
+	if args.Channel != "" {
+		channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+		if err != nil {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		if !_CanViewChannel(message.Author.ID, channel.ID) {
+			session.ChannelMessageSend(message.ChannelID, "You can't view that channel.")
+			return
+		}
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}})
+		routing = _ChannelRouting(channel.ID)
+	} else {
+		channelFilter, err := _GuildChannelFilter(message.GuildID, message.Author.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error building attachment search query")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		filters = append(filters, channelFilter)
+	}
+
+	query := map[string]interface{}{"filter": filters}
+	sortClause := _SearchSorts["newest"]
+	if text != "" {
+		query["must"] = map[string]interface{}{
+			"multi_match": map[string]interface{}{"query": text, "fields": []string{"filename", "description"}},
+		}
+		sortClause = nil
+	}
+
+	searchSession := &_SearchSession{
+		AuthorID:    message.Author.ID,
+		ChannelID:   message.ChannelID,
+		GuildID:     message.GuildID,
+		Text:        args.Query,
+		Query:       map[string]interface{}{"bool": query},
+		Sort:        sortClause,
+		Routing:     routing,
+		PageSize:    args.Limit,
+		Attachments: true,
+	}
+
+	embed, components, err := _RunSearch(searchSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Error searching attachments")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	_SendSearchPage(message, searchSession, embed, components)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Sentiment is scored when messages are ingested by the sentiment enricher, so reporting on it only needs an aggregation.
+// The scores come from a small English word list, so they miss sarcasm, negation ("not good"), slang and other languages,
+// and are only meaningful in aggregate. Messages ingested without the enricher enabled have no score and are left out.
+
+type _FiltersAggregation struct {
+	Buckets map[string]struct {
+		DocCount int `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+// _SentimentBar renders a proportion of messages as a bar
+func _SentimentBar(count int, total int) string {
+	width := 0
+	if total > 0 {
+		width = count * _ActivityBarWidth / total
+	}
+	return strings.Repeat("█", width) + strings.Repeat(" ", _ActivityBarWidth-width)
+}
+
+type _SentimentArgs struct {
+	Channel string `description:"Channel to report the sentiment of."`
+	Days    int    `default:"30" description:"Number of days of messages to include."`
+}
+
+func _SentimentHandler(message *discordgo.MessageCreate, args _SentimentArgs) {
+	enabled := false
+	for _, enricher := range config.Enrichers {
+		enabled = enabled || enricher == "sentiment"
+	}
+	if !enabled {
+		session.ChannelMessageSend(message.ChannelID, "Sentiment isn't being scored, add sentiment to ENRICHERS to score newly ingested messages.")
+		return
+	}
+
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if args.Days < 1 {
+		args.Days = 1
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+					map[string]interface{}{"exists": map[string]interface{}{"field": "sentiment_score"}},
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd/d", args.Days)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"sentiment": map[string]interface{}{
+				"filters": map[string]interface{}{
+					"filters": map[string]interface{}{
+						"positive": map[string]interface{}{"range": map[string]interface{}{"sentiment_score": map[string]interface{}{"gt": 0}}},
+						"negative": map[string]interface{}{"range": map[string]interface{}{"sentiment_score": map[string]interface{}{"lt": 0}}},
+					},
+				},
+			},
+		},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating sentiment")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var sentiment _FiltersAggregation
+	err = json.Unmarshal(resp.Aggregations["sentiment"], &sentiment)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding sentiment aggregation")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	total := resp.Hits.Total.Value
+	positive := sentiment.Buckets["positive"].DocCount
+	negative := sentiment.Buckets["negative"].DocCount
+	neutral := total - positive - negative
+
+	var chart strings.Builder
+	for _, row := range []struct {
+		Name  string
+		Count int
+	}{{"Positive", positive}, {"Neutral ", neutral}, {"Negative", negative}} {
+		fmt.Fprintf(&chart, "%s %s %d\n", row.Name, _SentimentBar(row.Count, total), row.Count)
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Sentiment in #%s", channel.Name))
+	embed.Description = fmt.Sprintf("```\n%s```", chart.String())
+	embed.Footer = _EmbedFooter(fmt.Sprintf("%d scored messages from the last %d days. Scores are rough word-list estimates.", total, args.Days))
+	if total == 0 {
+		embed.Description = "No scored messages found."
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
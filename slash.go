@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Discord rejects autocomplete responses with more than 25 choices
+const _MaxAutocompleteChoices = 25
+
+var _SlashCommands = []*discordgo.ApplicationCommand{
+	{
+		Name:        "search",
+		Description: "Search ingested messages.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "query",
+				Description: "Text to search for.",
+				Required:    true,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "channel",
+				Description:  "Only search messages from this channel.",
+				Autocomplete: true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "sort",
+				Description: "Order to show results in.",
+				Choices: []*discordgo.ApplicationCommandOptionChoice{
+					{Name: "Relevance", Value: "relevance"},
+					{Name: "Newest", Value: "newest"},
+					{Name: "Oldest", Value: "oldest"},
+					{Name: "Reactions", Value: "reactions"},
+				},
+			},
+		},
+	},
+	{
+		Name:        "ingest",
+		Description: "Ingest a backlog of messages from a certain channel.",
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "channel",
+				Description:  "Channel to ingest logs from.",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	},
+}
+
+// _RegisterSlashCommands replaces the bot's global application commands with the ones Elkbot currently supports
+func _RegisterSlashCommands(_ *discordgo.Session, ready *discordgo.Ready) {
+	_, err := session.ApplicationCommandBulkOverwrite(ready.User.ID, "", _SlashCommands)
+	if err != nil {
+		log.Error().Err(err).Msg("Error registering slash commands")
+		return
+	}
+	log.Debug().Int("count", len(_SlashCommands)).Msg("Registered slash commands")
+}
+
+func _InteractionOptions(interaction *discordgo.InteractionCreate) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	options := make(map[string]*discordgo.ApplicationCommandInteractionDataOption)
+	for _, option := range interaction.ApplicationCommandData().Options {
+		options[option.Name] = option
+	}
+	return options
+}
+
+// _InteractionMessage builds a message equivalent to a slash command invocation, so that it can be passed to
+// the same handlers used for prefixed commands
+func _InteractionMessage(interaction *discordgo.InteractionCreate) *discordgo.MessageCreate {
+	author := interaction.User
+	if interaction.Member != nil {
+		author = interaction.Member.User
+	}
+
+	return &discordgo.MessageCreate{Message: &discordgo.Message{
+		ID:        interaction.ID,
+		ChannelID: interaction.ChannelID,
+		GuildID:   interaction.GuildID,
+		Author:    author,
+	}}
+}
+
+// _RespondEphemeral replies to an interaction with a message only visible to the user who triggered it
+func _RespondEphemeral(interaction *discordgo.InteractionCreate, content string) {
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error responding to interaction")
+	}
+}
+
+// _ReadableTextChannels returns the text channels in a guild that the bot is able to read the history of,
+// including stage channels when enabled
+func _ReadableTextChannels(guildID string) []*discordgo.Channel {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return nil
+	}
+
+	channels := make([]*discordgo.Channel, 0, len(guild.Channels))
+	for _, channel := range guild.Channels {
+		if !_IsIngestableChannelType(channel.Type) {
+			continue
+		}
+		permissions, err := session.State.UserChannelPermissions(session.State.User.ID, channel.ID)
+		if err != nil || permissions&_ReadHistoryPermissions != _ReadHistoryPermissions {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+func _AutocompleteChannels(interaction *discordgo.InteractionCreate) {
+	typed := ""
+	for _, option := range interaction.ApplicationCommandData().Options {
+		if option.Focused {
+			typed = strings.ToLower(option.StringValue())
+		}
+	}
+
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, _MaxAutocompleteChoices)
+	for _, channel := range _ReadableTextChannels(interaction.GuildID) {
+		if !strings.Contains(strings.ToLower(channel.Name), typed) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  "#" + channel.Name,
+			Value: channel.ID,
+		})
+		if len(choices) == _MaxAutocompleteChoices {
+			break
+		}
+	}
+
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error responding to autocomplete")
+	}
+}
+
+func _RunSlashCommand(interaction *discordgo.InteractionCreate) {
+	data := interaction.ApplicationCommandData()
+	options := _InteractionOptions(interaction)
+	message := _InteractionMessage(interaction)
+
+	content := fmt.Sprintf("Running `/%s`...", data.Name)
+	allowed := _CanRunCommand(message.Author.ID, data.Name)
+	if !allowed {
+		log.Warn().Str("author_id", message.Author.ID).Str("command", data.Name).Msg("User does not have access to this command")
+		content = "You do not have access to this command."
+	} else if _IsReadOnlyBlocked(data.Name) {
+		allowed = false
+		content = _ReadOnlyMessage(data.Name)
+	} else if !_IsESAvailable() {
+		allowed = false
+		content = _ESUnavailableMessage
+	}
+
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error acknowledging slash command")
+		return
+	}
+	if !allowed {
+		return
+	}
+
+	switch data.Name {
+	case "search":
+		args := _SearchArgs{Query: options["query"].StringValue(), Limit: 5, Sort: "relevance"}
+		if channel, ok := options["channel"]; ok {
+			args.Channel = channel.StringValue()
+		}
+		if sort, ok := options["sort"]; ok {
+			args.Sort = sort.StringValue()
+		}
+		_SearchHandler(message, args)
+	case "ingest":
+		_IngestHandler(message, _IngestArgs{ChannelID: options["channel"].StringValue()})
+	}
+}
+
+// _InteractionHandler dispatches slash command invocations, autocomplete requests and button presses
+func _InteractionHandler(_ *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	if !_IsAllowedGuild(interaction.GuildID) {
+		return
+	}
+
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		_RunSlashCommand(interaction)
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		_AutocompleteChannels(interaction)
+	case discordgo.InteractionMessageComponent:
+		_SearchComponentHandler(interaction)
+	}
+}
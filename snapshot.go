@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Snapshots are written to a repository that has to be registered with Elasticsearch beforehand, as registering one
+// depends on how the cluster's storage is set up. Only the indices Elkbot uses are included.
+
+// _SnapshotResult represents the outcome of a completed snapshot
+type _SnapshotResult struct {
+	Snapshot string `json:"snapshot"`
+	State    string `json:"state"`
+	Shards   struct {
+		Total      int `json:"total"`
+		Failed     int `json:"failed"`
+		Successful int `json:"successful"`
+	} `json:"shards"`
+}
+
+// _CheckSnapshotRepository returns an error if the configured snapshot repository hasn't been registered
+func _CheckSnapshotRepository() error {
+	req := esapi.SnapshotGetRepositoryRequest{Repository: []string{config.SnapshotRepository}}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	err = _DecodeResponse(resp, nil)
+	if err != nil {
+		return fmt.Errorf("snapshot repository %s is not registered: %w", config.SnapshotRepository, err)
+	}
+	return nil
+}
+
+// _SnapshotName returns the name of a snapshot taken at a given time. Snapshot names must be lowercase.
+func _SnapshotName(at time.Time) string {
+	return "elkbot-" + strings.ToLower(at.UTC().Format("2006.01.02-15.04.05"))
+}
+
+// _CreateSnapshot snapshots every index Elkbot uses to the configured repository, waiting for it to complete
+func _CreateSnapshot() (*_SnapshotResult, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"indices":              strings.Join(_BackupIndexPatterns(), ","),
+		"ignore_unavailable":   true,
+		"include_global_state": false,
+	})
+
+	waitForCompletion := true
+	req := esapi.SnapshotCreateRequest{
+		Repository:        config.SnapshotRepository,
+		Snapshot:          _SnapshotName(time.Now()),
+		Body:              bytes.NewReader(reqBody),
+		WaitForCompletion: &waitForCompletion,
+	}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var snapshotResp struct {
+		Snapshot _SnapshotResult `json:"snapshot"`
+	}
+	err = _DecodeResponse(resp, &snapshotResp)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotResp.Snapshot.State != "SUCCESS" {
+		return &snapshotResp.Snapshot, fmt.Errorf(
+			"snapshot %s finished in state %s with %d of %d shards failed",
+			snapshotResp.Snapshot.Snapshot,
+			snapshotResp.Snapshot.State,
+			snapshotResp.Snapshot.Shards.Failed,
+			snapshotResp.Snapshot.Shards.Total,
+		)
+	}
+	return &snapshotResp.Snapshot, nil
+}
+
+// _SnapshotSummary describes the outcome of a snapshot for posting to Discord
+func _SnapshotSummary(result *_SnapshotResult, err error) string {
+	if err != nil {
+		return fmt.Sprintf("Snapshot failed:\n```\n%s\n```", err.Error())
+	}
+	return fmt.Sprintf("Created snapshot `%s` of %d shards in repository `%s`.", result.Snapshot, result.Shards.Successful, config.SnapshotRepository)
+}
+
+// _SnapshotLoop periodically snapshots Elkbot's indices, posting the outcome to the configured channel if there is one
+func _SnapshotLoop() {
+	ticker := time.NewTicker(config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := _CreateSnapshot()
+		if err != nil {
+			log.Error().Err(err).Str("repository", config.SnapshotRepository).Msg("Error creating scheduled snapshot")
+		} else {
+			log.Info().Str("snapshot", result.Snapshot).Int("shards", result.Shards.Successful).Msg("Created scheduled snapshot")
+		}
+
+		if config.SnapshotNotifyChannel != "" {
+			_, sendErr := session.ChannelMessageSend(config.SnapshotNotifyChannel, _SnapshotSummary(result, err))
+			if sendErr != nil {
+				log.Error().Err(sendErr).Msg("Error posting snapshot outcome")
+			}
+		}
+	}
+}
+
+func _SnapshotHandler(message *discordgo.MessageCreate, args struct{}) {
+	if config.SnapshotRepository == "" {
+		session.ChannelMessageSend(message.ChannelID, "Snapshots aren't configured, set SNAPSHOT_REPOSITORY to a registered repository to enable them.")
+		return
+	}
+
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Creating a snapshot in `%s`, this may take a while...", config.SnapshotRepository))
+	result, err := _CreateSnapshot()
+	if err != nil {
+		log.Error().Err(err).Msg("Error creating snapshot")
+	}
+	session.ChannelMessageSend(message.ChannelID, _SnapshotSummary(result, err))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxAuthorBuckets = 1000
+
+type _StatsBucket struct {
+	Key         interface{} `json:"key"`
+	KeyAsString string      `json:"key_as_string"`
+	DocCount    int         `json:"doc_count"`
+}
+
+type _StatsAggregation struct {
+	Buckets []_StatsBucket `json:"buckets"`
+}
+
+// _StatsAggregationFor builds the aggregation used to group message counts by the given dimension
+func _StatsAggregationFor(by string) (map[string]interface{}, error) {
+	switch by {
+	case "day", "hour":
+		return map[string]interface{}{
+			"date_histogram": map[string]interface{}{
+				"field":             "timestamp",
+				"calendar_interval": by,
+				"min_doc_count":     1,
+			},
+		}, nil
+	case "author":
+		return map[string]interface{}{
+			"terms": map[string]interface{}{
+				"field": "author_id",
+				"size":  _MaxAuthorBuckets,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown grouping %q, expected one of author, day or hour", by)
+	}
+}
+
+// _WriteStatsCSV writes each aggregation bucket as a row of a CSV file
+func _WriteStatsCSV(by string, buckets []_StatsBucket) (*bytes.Buffer, error) {
+	var output bytes.Buffer
+	writer := csv.NewWriter(&output)
+
+	err := writer.Write([]string{by, "messages"})
+	if err != nil {
+		return nil, fmt.Errorf("error writing CSV header: %w", err)
+	}
+	for _, bucket := range buckets {
+		key := bucket.KeyAsString
+		if key == "" {
+			key = fmt.Sprint(bucket.Key)
+		}
+		err = writer.Write([]string{key, strconv.Itoa(bucket.DocCount)})
+		if err != nil {
+			return nil, fmt.Errorf("error writing CSV row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return nil, fmt.Errorf("error writing CSV: %w", err)
+	}
+
+	return &output, nil
+}
+
+// _ExportStatsQuery builds a query matching the messages of a channel that haven't been deleted
+func _ExportStatsQuery(channelID string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+				_NotDeletedFilter,
+			},
+		},
+	}
+}
+
+type _ExportStatsArgs struct {
+	Channel string `description:"Channel to export statistics for."`
+	By      string `default:"day" description:"How to group message counts. One of author, day or hour."`
+}
+
+func _ExportStatsHandler(message *discordgo.MessageCreate, args _ExportStatsArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	aggregation, err := _StatsAggregationFor(args.By)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  0,
+		"query": _ExportStatsQuery(channel.ID),
+		"aggs":  map[string]interface{}{"stats": aggregation},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating message statistics")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var stats _StatsAggregation
+	err = json.Unmarshal(resp.Aggregations["stats"], &stats)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding message statistics")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	output, err := _WriteStatsCSV(args.By, stats.Buckets)
+	if err != nil {
+		log.Error().Err(err).Msg("Error writing message statistics")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Message counts for <#%s> by %s.", channel.ID, args.By),
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("%s-by-%s.csv", channel.Name, args.By),
+			ContentType: "text/csv",
+			Reader:      output,
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading message statistics")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExportStatsQuery(t *testing.T) {
+	filters := _ExportStatsQuery("7")["bool"].(map[string]interface{})["filter"].([]interface{})
+	if len(filters) != 2 {
+		t.Fatalf("got filters %v, want the channel and deleted message filters", filters)
+	}
+	want := map[string]interface{}{"term": map[string]interface{}{"channel_id": "7"}}
+	if !reflect.DeepEqual(filters[0], want) {
+		t.Errorf("got filter %v, want %v", filters[0], want)
+	}
+	if !reflect.DeepEqual(filters[1], _NotDeletedFilter) {
+		t.Errorf("got filter %v, want deleted messages to be excluded", filters[1])
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// _StartTime is when the process started, recorded at the top of main
+var _StartTime time.Time
+
+// _FormatBytes renders a byte count in the largest binary unit that keeps it above 1
+func _FormatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	divisor, exponent := uint64(unit), 0
+	for remaining := bytes / unit; remaining >= unit; remaining /= unit {
+		divisor *= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(divisor), "KMGTPE"[exponent])
+}
+
+func _StatusHandler(message *discordgo.MessageCreate, args struct{}) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	queue := "Disabled"
+	if _LiveQueue != nil {
+		queue = fmt.Sprintf("%d / %d", len(_LiveQueue), cap(_LiveQueue))
+	}
+	elasticsearch := "Available"
+	if !_IsESAvailable() {
+		elasticsearch = "Unavailable"
+	}
+
+	embed := _NewEmbed("Status")
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Uptime", Value: time.Since(_StartTime).Round(time.Second).String(), Inline: true},
+		{Name: "Guilds", Value: fmt.Sprint(len(session.State.Guilds)), Inline: true},
+		{Name: "Goroutines", Value: fmt.Sprint(runtime.NumGoroutine()), Inline: true},
+		{Name: "Heap in use", Value: _FormatBytes(memory.HeapAlloc), Inline: true},
+		{Name: "Memory from OS", Value: _FormatBytes(memory.Sys), Inline: true},
+		{Name: "Live ingest queue", Value: queue, Inline: true},
+		{Name: "Elasticsearch", Value: elasticsearch, Inline: true},
+	}
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxSummaryHours = 24 * 7
+
+type _SummaryAggregations struct {
+	Participants struct {
+		Value int `json:"value"`
+	} `json:"participants"`
+	Hours struct {
+		Buckets []_StatsBucket `json:"buckets"`
+	} `json:"hours"`
+	MostReacted struct {
+		Hits struct {
+			Hits []_SearchHit `json:"hits"`
+		} `json:"hits"`
+	} `json:"most_reacted"`
+}
+
+// _ChannelSummary aggregates the activity in a channel since a point in time
+func _ChannelSummary(channelID string, since time.Time) (int, *_SummaryAggregations, error) {
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": _FormatTimestamp(since)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"participants": map[string]interface{}{"cardinality": map[string]interface{}{"field": "author_id"}},
+			"hours": map[string]interface{}{
+				"date_histogram": map[string]interface{}{
+					"field":          "timestamp",
+					"fixed_interval": "1h",
+					"min_doc_count":  1,
+				},
+			},
+			"most_reacted": map[string]interface{}{
+				"filter": map[string]interface{}{"range": map[string]interface{}{"reaction_count": map[string]interface{}{"gt": 0}}},
+				"aggs": map[string]interface{}{
+					"hits": map[string]interface{}{
+						"top_hits": map[string]interface{}{
+							"size": 1,
+							"sort": []interface{}{map[string]interface{}{"reaction_count": "desc"}},
+						},
+					},
+				},
+			},
+		},
+	}, _ChannelRouting(channelID))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	aggregations := &_SummaryAggregations{}
+	for name, target := range map[string]interface{}{
+		"participants": &aggregations.Participants,
+		"hours":        &aggregations.Hours,
+		"most_reacted": &aggregations.MostReacted,
+	} {
+		err = json.Unmarshal(resp.Aggregations[name], target)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error decoding %s aggregation: %w", name, err)
+		}
+	}
+
+	return resp.Hits.Total.Value, aggregations, nil
+}
+
+type _SummaryArgs struct {
+	Channel string `description:"Channel to summarize."`
+	Hours   int    `default:"24" description:"Number of hours of activity to summarize."`
+}
+
+func _SummaryHandler(message *discordgo.MessageCreate, args _SummaryArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Hours < 1 || args.Hours > _MaxSummaryHours {
+		args.Hours = _MaxSummaryHours
+	}
+
+	count, aggregations, err := _ChannelSummary(channel.ID, time.Now().Add(-time.Duration(args.Hours)*time.Hour))
+	if err != nil {
+		log.Error().Err(err).Msg("Error summarizing channel")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("#%s in the last %d hours", channel.Name, args.Hours))
+	if count == 0 {
+		embed.Description = "No messages found."
+		session.ChannelMessageSendEmbed(message.ChannelID, embed)
+		return
+	}
+
+	busiest := aggregations.Hours.Buckets[0]
+	for _, bucket := range aggregations.Hours.Buckets {
+		if bucket.DocCount > busiest.DocCount {
+			busiest = bucket
+		}
+	}
+	busiestHour := busiest.KeyAsString
+	if key, ok := busiest.Key.(float64); ok {
+		busiestHour = fmt.Sprintf("<t:%d:f>", int64(key)/1000)
+	}
+
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Messages", Value: fmt.Sprint(count), Inline: true},
+		{Name: "Participants", Value: fmt.Sprint(aggregations.Participants.Value), Inline: true},
+		{Name: "Busiest hour", Value: fmt.Sprintf("%s (%d messages)", busiestHour, busiest.DocCount), Inline: true},
+	}
+
+	if hits := aggregations.MostReacted.Hits.Hits; len(hits) > 0 {
+		field, err := _MessageHitField(hits[0], message.GuildID)
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering message")
+		} else {
+			field.Name = "Most reacted message"
+			embed.Fields = append(embed.Fields, field)
+		}
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
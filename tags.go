@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Tags let moderators curate collections of messages within the index, which can then be searched by tag.
+// Tags are stored on the message's document, so they are lost if an edited version of the message is ingested again.
+
+const _MaxTagLength = 50
+
+const _TagScript = `if (ctx._source.tags == null) { ctx._source.tags = []; }
+if (ctx._source.tags.contains(params.tag)) { ctx.op = 'noop'; } else { ctx._source.tags.add(params.tag); }`
+
+const _UntagScript = `if (ctx._source.tags == null || !ctx._source.tags.removeIf(tag -> tag == params.tag)) { ctx.op = 'noop'; }`
+
+var _MessageLinkPattern = regexp.MustCompile(`^https://(?:\w+\.)?discord(?:app)?\.com/channels/(\d+)/(\d+)/(\d+)$`)
+
+// _ParseMessageReference extracts the channel and message IDs from a message link, or treats the input as the ID of a message
+// in the given channel
+func _ParseMessageReference(input string, channelID string) (string, string) {
+	if matches := _MessageLinkPattern.FindStringSubmatch(input); matches != nil {
+		return matches[2], matches[3]
+	}
+	return channelID, input
+}
+
+// _NormalizeTag cleans up a tag so that the same label always matches, regardless of case or surrounding spaces
+func _NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("tags can't be empty")
+	}
+	if len([]rune(tag)) > _MaxTagLength {
+		return "", fmt.Errorf("tags can be at most %d characters long", _MaxTagLength)
+	}
+	return tag, nil
+}
+
+// _IsMessageIndexed returns whether a message has been ingested
+func _IsMessageIndexed(channelID string, messageID string) (bool, error) {
+	count, err := _CountRouted(
+		[]string{_ChannelReadIndex("messages", channelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": []string{messageID}}},
+		_ChannelRouting(channelID),
+	)
+	return count > 0, err
+}
+
+// _EnsureMessageIndexed ingests a message if it hasn't been ingested yet
+func _EnsureMessageIndexed(channelID string, messageID string) error {
+	indexed, err := _IsMessageIndexed(channelID, messageID)
+	if err != nil || indexed {
+		return err
+	}
+
+	message, err := session.ChannelMessage(channelID, messageID)
+	if err != nil {
+		return fmt.Errorf("error fetching message: %w", err)
+	}
+	if message.GuildID == "" {
+		message.GuildID = _ChannelGuildID(channelID)
+	}
+	err = _IngestMessage(message)
+	if err != nil {
+		return err
+	}
+
+	indexed, err = _IsMessageIndexed(channelID, messageID)
+	if err == nil && !indexed {
+		return errors.New("the message was skipped when ingesting it, such as because its author is on the blocklist")
+	}
+	return err
+}
+
+// _UpdateTag runs a tagging script against a message's document, returning whether the document changed
+func _UpdateTag(channelID string, messageID string, script string, tag string) (bool, error) {
+	updated, err := _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", channelID)},
+		map[string]interface{}{"ids": map[string]interface{}{"values": []string{messageID}}},
+		script,
+		map[string]interface{}{"tag": tag},
+		0,
+	)
+	return updated > 0, err
+}
+
+type _TagArgs struct {
+	Message string `description:"Link to the message, or the ID of a message in this channel."`
+	Tag     string `description:"Label to add to the message."`
+}
+
+func _TagHandler(message *discordgo.MessageCreate, args _TagArgs) {
+	tag, err := _NormalizeTag(args.Tag)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid tag: %s.", err.Error()))
+		return
+	}
+	channelID, messageID := _ParseMessageReference(args.Message, message.ChannelID)
+	channel, err := _ResolveGuildChannel(channelID, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	err = _EnsureMessageIndexed(channel.ID, messageID)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error ingesting message to tag")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	changed, err := _UpdateTag(channel.ID, messageID, _TagScript, tag)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error tagging message")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if !changed {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("That message is already tagged `%s`.", tag))
+		return
+	}
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Tagged %s as `%s`.", _JumpURL(message.GuildID, channel.ID, messageID), tag))
+}
+
+type _UntagArgs struct {
+	Message string `description:"Link to the message, or the ID of a message in this channel."`
+	Tag     string `description:"Label to remove from the message."`
+}
+
+func _UntagHandler(message *discordgo.MessageCreate, args _UntagArgs) {
+	tag, err := _NormalizeTag(args.Tag)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Invalid tag: %s.", err.Error()))
+		return
+	}
+	channelID, messageID := _ParseMessageReference(args.Message, message.ChannelID)
+	channel, err := _ResolveGuildChannel(channelID, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	changed, err := _UpdateTag(channel.ID, messageID, _UntagScript, tag)
+	if err != nil {
+		log.Error().Err(err).Str("message_id", messageID).Msg("Error untagging message")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if !changed {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("That message isn't tagged `%s`.", tag))
+		return
+	}
+	session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Removed the `%s` tag from %s.", tag, _JumpURL(message.GuildID, channel.ID, messageID)))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// Large deletes run as background Elasticsearch tasks rather than in a single request that waits for completion.
+// They are sliced across shards and throttled, and can be followed or cancelled by their task ID until they finish.
+
+const _DeleteByQueryAction = "indices:data/write/delete/byquery"
+const _TaskPollInterval = 10 * time.Second
+
+// _TaskStatus represents the parts of an Elasticsearch task's status that Elkbot reports
+type _TaskStatus struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Action string `json:"action"`
+		Status struct {
+			Total   int `json:"total"`
+			Created int `json:"created"`
+			Updated int `json:"updated"`
+			Deleted int `json:"deleted"`
+		} `json:"status"`
+		Cancelled bool `json:"cancelled"`
+	} `json:"task"`
+	Response struct {
+		Created  int           `json:"created"`
+		Updated  int           `json:"updated"`
+		Deleted  int           `json:"deleted"`
+		Canceled string        `json:"canceled"`
+		Failures []interface{} `json:"failures"`
+	} `json:"response"`
+	Error map[string]interface{} `json:"error"`
+}
+
+// _StartDeleteByQuery starts deleting all documents matching a query in the background, returning the ID of the task.
+// A positive requestsPerSecond throttles the delete to avoid overloading the cluster.
+func _StartDeleteByQuery(indices []string, query map[string]interface{}, requestsPerSecond int) (string, error) {
+	reqBody, _ := json.Marshal(map[string]interface{}{
+		"query": query,
+	})
+
+	refresh := true
+	waitForCompletion := false
+	req := esapi.DeleteByQueryRequest{
+		Index:             indices,
+		Body:              bytes.NewReader(reqBody),
+		Refresh:           &refresh,
+		Conflicts:         "proceed",
+		Slices:            "auto",
+		WaitForCompletion: &waitForCompletion,
+	}
+	if requestsPerSecond > 0 {
+		req.RequestsPerSecond = &requestsPerSecond
+	}
+
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return "", fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var taskResp struct {
+		Task string `json:"task"`
+	}
+	err = _DecodeResponse(resp, &taskResp)
+	if err != nil {
+		return "", err
+	}
+	return taskResp.Task, nil
+}
+
+// _GetTaskStatus fetches the current status of a task
+func _GetTaskStatus(taskID string) (*_TaskStatus, error) {
+	req := esapi.TasksGetRequest{TaskID: taskID}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return nil, fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+
+	var status _TaskStatus
+	err = _DecodeResponse(resp, &status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// _CancelDeleteTask cancels a running delete by query task. Other kinds of tasks are refused,
+// so that operators can't accidentally cancel unrelated work on the cluster.
+func _CancelDeleteTask(taskID string) error {
+	status, err := _GetTaskStatus(taskID)
+	if err != nil {
+		return fmt.Errorf("error looking up task: %w", err)
+	}
+	if !strings.HasPrefix(status.Task.Action, _DeleteByQueryAction) {
+		return fmt.Errorf("task %s is not a delete task", taskID)
+	}
+	if status.Completed {
+		return fmt.Errorf("task %s has already finished", taskID)
+	}
+
+	req := esapi.TasksCancelRequest{TaskID: taskID}
+	resp, err := req.Do(context.Background(), esClient)
+	if err != nil {
+		return fmt.Errorf("error making elasticsearch request: %w", err)
+	}
+	return _DecodeResponse(resp, nil)
+}
+
+// _WaitForDeleteTask polls a delete by query task until it finishes, calling progress with its status after every poll.
+// It returns the number of documents deleted, which is partial if the task was cancelled or failed.
+func _WaitForDeleteTask(taskID string, progress func(*_TaskStatus)) (int, error) {
+	for {
+		time.Sleep(_TaskPollInterval)
+
+		status, err := _GetTaskStatus(taskID)
+		if err != nil {
+			return 0, fmt.Errorf("error checking progress of task %s: %w", taskID, err)
+		}
+		if progress != nil {
+			progress(status)
+		}
+		if !status.Completed {
+			continue
+		}
+
+		if status.Response.Canceled != "" {
+			return status.Response.Deleted, fmt.Errorf("task %s was cancelled: %s", taskID, status.Response.Canceled)
+		}
+		if status.Error != nil {
+			return status.Response.Deleted, fmt.Errorf("task %s failed: %v", taskID, status.Error["reason"])
+		}
+		if len(status.Response.Failures) > 0 {
+			return status.Response.Deleted, fmt.Errorf("task %s finished with %d failures", taskID, len(status.Response.Failures))
+		}
+		return status.Response.Deleted, nil
+	}
+}
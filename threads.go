@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Thread names often summarise the conversation inside them, so they are stored on the thread's messages to let searches
+// match a conversation by its title. Names are read from the state cache, which holds every thread Elkbot has seen.
+
+const _RefreshThreadNameScript = "ctx._source.thread_name = params.name"
+const _RefreshThreadNameRequestsPerSecond = 500
+
+// _AddThreadFields adds the stats of the thread a message started, and the name of the thread a message was sent in
+func _AddThreadFields(message *discordgo.Message, document map[string]interface{}) {
+	if message.Thread != nil {
+		document["thread_id"] = message.Thread.ID
+		document["thread_message_count"] = message.Thread.MessageCount
+		document["thread_member_count"] = message.Thread.MemberCount
+		document["thread_name"] = message.Thread.Name
+		return
+	}
+
+	channel, err := session.State.Channel(message.ChannelID)
+	if err == nil && channel.IsThread() {
+		document["thread_name"] = channel.Name
+	}
+}
+
+// _ThreadUpdateHandler refreshes the thread counts stored on a thread's starter message.
+// Threads started from a message share its ID, so the starter message can be found without a lookup.
+// Discord doesn't send an update for every message in a thread, so the counts may lag behind until the next update.
+// When a thread is renamed, the name stored on its messages is updated too.
+func _ThreadUpdateHandler(_ *discordgo.Session, update *discordgo.ThreadUpdate) {
+	if update.ParentID == "" || !_IsAllowedGuild(update.GuildID) {
+		return
+	}
+	_RefreshIngestedMessage(update.ParentID, update.ID)
+
+	if update.BeforeUpdate == nil || update.BeforeUpdate.Name == update.Name {
+		return
+	}
+	updated, err := _UpdateByQuery(
+		[]string{_ChannelReadIndex("messages", update.ID)},
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": update.ID}},
+		_RefreshThreadNameScript,
+		map[string]interface{}{"name": update.Name},
+		_RefreshThreadNameRequestsPerSecond,
+	)
+	if err != nil {
+		log.Error().Err(err).Str("thread_id", update.ID).Msg("Error updating thread name")
+		return
+	}
+	log.Debug().Str("thread_id", update.ID).Int("updated", updated).Msg("Updated thread name")
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+// Transcripts render a channel's ingested messages as standalone HTML pages, oldest first, for sharing with people
+// who don't have access to Elasticsearch. Large channels are split across several files so that each stays well
+// under Discord's upload limit. Attachments link to the URLs stored when they were ingested, which stop working once
+// Discord expires them.
+
+const _TranscriptMessagesPerFile = 5000
+const _MaxTranscriptFiles = 10
+
+var _errTranscriptLimitReached = errors.New("reached the maximum transcript size")
+
+type _TranscriptAttachment struct {
+	Filename  string `json:"filename"`
+	URL       string `json:"url"`
+	ProxyURL  string `json:"proxy_url"`
+	Height    int    `json:"height"`
+	MessageID string `json:"message_id"`
+}
+
+type _TranscriptMessage struct {
+	ID          string
+	AuthorID    string
+	AuthorName  string
+	Timestamp   time.Time
+	Content     string
+	Attachments []_TranscriptAttachment
+}
+
+type _TranscriptPage struct {
+	ChannelName string
+	GuildName   string
+	Page        int
+	Pages       int
+	Generated   time.Time
+	Messages    []_TranscriptMessage
+}
+
+var _TranscriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>#{{.ChannelName}} transcript{{if gt .Pages 1}} (part {{.Page}} of {{.Pages}}){{end}}</title>
+<style>
+body { font-family: "Segoe UI", Helvetica, Arial, sans-serif; background: #313338; color: #dbdee1; margin: 0; padding: 24px; }
+header { border-bottom: 1px solid #4e5058; margin-bottom: 16px; padding-bottom: 8px; }
+header h1 { margin: 0; font-size: 20px; color: #f2f3f5; }
+header p { margin: 4px 0 0; font-size: 13px; color: #949ba4; }
+.message { padding: 6px 0; }
+.author { font-weight: 600; color: #f2f3f5; }
+.timestamp { font-size: 12px; color: #949ba4; margin-left: 6px; }
+.content { white-space: pre-wrap; word-wrap: break-word; margin-top: 2px; }
+.attachment { display: block; margin-top: 4px; color: #00a8fc; }
+.attachment img { max-width: 400px; max-height: 300px; border-radius: 4px; display: block; }
+</style>
+</head>
+<body>
+<header>
+<h1>#{{.ChannelName}}{{if .GuildName}} in {{.GuildName}}{{end}}</h1>
+<p>{{len .Messages}} messages{{if gt .Pages 1}}, part {{.Page}} of {{.Pages}}{{end}}. Generated by Elkbot on {{.Generated.Format "2006-01-02 15:04 MST"}}.</p>
+</header>
+{{range .Messages}}<div class="message" id="{{.ID}}">
+<span class="author" title="{{.AuthorID}}">{{if .AuthorName}}{{.AuthorName}}{{else}}{{.AuthorID}}{{end}}</span><span class="timestamp">{{.Timestamp.Format "2006-01-02 15:04:05"}}</span>
+{{if .Content}}<div class="content">{{.Content}}</div>{{end}}
+{{range .Attachments}}<a class="attachment" href="{{.URL}}">{{if gt .Height 0}}<img src="{{if .ProxyURL}}{{.ProxyURL}}{{else}}{{.URL}}{{end}}" alt="{{.Filename}}" loading="lazy">{{else}}{{.Filename}}{{end}}</a>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+// _TranscriptAttachments looks up the attachments of a set of messages, grouped by the message they belong to
+func _TranscriptAttachments(channelID string, messageIDs []string) (map[string][]_TranscriptAttachment, error) {
+	attachments := make(map[string][]_TranscriptAttachment)
+	err := _ScanAllRouted([]string{_ChannelReadIndex("attachments", channelID)}, map[string]interface{}{
+		"_source": []string{"filename", "url", "proxy_url", "height", "message_id"},
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{"message_id": messageIDs},
+		},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		for _, hit := range hits {
+			var attachment _TranscriptAttachment
+			if json.Unmarshal(hit.Source, &attachment) != nil {
+				continue
+			}
+			attachments[attachment.MessageID] = append(attachments[attachment.MessageID], attachment)
+		}
+		return nil
+	})
+	return attachments, err
+}
+
+// _TranscriptMessages fetches a channel's ingested messages in chronological order, returning whether it stopped early
+func _TranscriptMessages(channelID string) ([]_TranscriptMessage, bool, error) {
+	messages := make([]_TranscriptMessage, 0)
+	err := _ScanAllRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"_source": []string{"content", "channel_id", "author_id", "author_name", "timestamp"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"channel_id": channelID}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"sort": []interface{}{map[string]interface{}{"timestamp": "asc"}},
+	}, _ChannelRouting(channelID), func(hits []_SearchHit) error {
+		messageIDs := make([]string, 0, len(hits))
+		page := make([]_TranscriptMessage, 0, len(hits))
+		for _, hit := range hits {
+			var document _MessageDocument
+			var author struct {
+				AuthorName string `json:"author_name"`
+			}
+			if json.Unmarshal(hit.Source, &document) != nil || json.Unmarshal(hit.Source, &author) != nil {
+				continue
+			}
+			messageIDs = append(messageIDs, hit.ID)
+			page = append(page, _TranscriptMessage{
+				ID:         hit.ID,
+				AuthorID:   document.AuthorID,
+				AuthorName: author.AuthorName,
+				Timestamp:  document.Timestamp,
+				Content:    document.Content,
+			})
+		}
+
+		attachments, err := _TranscriptAttachments(channelID, messageIDs)
+		if err != nil {
+			return fmt.Errorf("error fetching attachments: %w", err)
+		}
+		for index := range page {
+			page[index].Attachments = attachments[page[index].ID]
+		}
+
+		messages = append(messages, page...)
+		if len(messages) >= _TranscriptMessagesPerFile*_MaxTranscriptFiles {
+			messages = messages[:_TranscriptMessagesPerFile*_MaxTranscriptFiles]
+			return _errTranscriptLimitReached
+		}
+		return nil
+	})
+	limited := errors.Is(err, _errTranscriptLimitReached)
+	if limited {
+		err = nil
+	}
+	return messages, limited, err
+}
+
+type _TranscriptArgs struct {
+	Channel string `description:"Channel to export a transcript of."`
+}
+
+func _TranscriptHandler(message *discordgo.MessageCreate, args _TranscriptArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	messages, limited, err := _TranscriptMessages(channel.ID)
+	if err != nil {
+		log.Error().Err(err).Msg("Error fetching transcript messages")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if len(messages) == 0 {
+		session.ChannelMessageSend(message.ChannelID, "No ingested messages found in that channel.")
+		return
+	}
+
+	guildName := ""
+	if guild, err := session.State.Guild(message.GuildID); err == nil {
+		guildName = guild.Name
+	}
+	pages := (len(messages) + _TranscriptMessagesPerFile - 1) / _TranscriptMessagesPerFile
+	generated := time.Now().UTC()
+
+	for page := 1; page <= pages; page++ {
+		start := (page - 1) * _TranscriptMessagesPerFile
+		end := start + _TranscriptMessagesPerFile
+		if end > len(messages) {
+			end = len(messages)
+		}
+
+		var rendered bytes.Buffer
+		err = _TranscriptTemplate.Execute(&rendered, _TranscriptPage{
+			ChannelName: channel.Name,
+			GuildName:   guildName,
+			Page:        page,
+			Pages:       pages,
+			Generated:   generated,
+			Messages:    messages[start:end],
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error rendering transcript")
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+			return
+		}
+		if rendered.Len() > _MaxReuploadSize {
+			session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("Part %d of the transcript is larger than the upload limit and was skipped.", page))
+			continue
+		}
+
+		filename := fmt.Sprintf("%s-transcript.html", channel.Name)
+		content := fmt.Sprintf("Transcript of <#%s> (%d messages).", channel.ID, len(messages))
+		if pages > 1 {
+			filename = fmt.Sprintf("%s-transcript-%d.html", channel.Name, page)
+			content = fmt.Sprintf("Transcript of <#%s>, part %d of %d.", channel.ID, page, pages)
+		}
+		if limited && page == pages {
+			content += fmt.Sprintf(" Only the oldest %d messages were included.", len(messages))
+		}
+
+		_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+			Content: content,
+			Files: []*discordgo.File{{
+				Name:        filename,
+				ContentType: "text/html",
+				Reader:      &rendered,
+			}},
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Error uploading transcript")
+			return
+		}
+	}
+}
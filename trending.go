@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxTrendingTerms = 25
+const _TrendingMinDocCount = 3
+const _TrendingSampleSize = 1000
+
+// _Stopwords are common English words that are never reported as trending
+var _Stopwords = []string{
+	"a", "about", "all", "also", "am", "an", "and", "any", "are", "as", "at", "be", "because", "been", "but", "by",
+	"can", "could", "did", "do", "does", "don't", "for", "from", "get", "got", "had", "has", "have", "he", "her",
+	"him", "his", "how", "i", "i'm", "if", "in", "is", "it", "it's", "its", "just", "like", "me", "my", "no", "not",
+	"of", "oh", "ok", "on", "one", "or", "our", "out", "she", "so", "some", "that", "that's", "the", "their", "them",
+	"then", "there", "they", "this", "to", "too", "up", "us", "was", "we", "were", "what", "when", "which", "who",
+	"why", "will", "with", "would", "yeah", "yes", "you", "your",
+}
+
+type _TrendingAggregation struct {
+	Terms struct {
+		Buckets []struct {
+			Key      string  `json:"key"`
+			DocCount int     `json:"doc_count"`
+			BgCount  int     `json:"bg_count"`
+			Score    float64 `json:"score"`
+		} `json:"buckets"`
+	} `json:"terms"`
+}
+
+type _TrendingArgs struct {
+	Channel string `description:"Channel to find trending words in."`
+	Hours   int    `default:"24" description:"Number of hours of recent messages to compare against the rest of the channel."`
+	Limit   int    `default:"10" description:"Number of words to show."`
+}
+
+func _TrendingHandler(message *discordgo.MessageCreate, args _TrendingArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Hours < 1 {
+		args.Hours = 1
+	}
+	if args.Limit < 1 || args.Limit > _MaxTrendingTerms {
+		args.Limit = _MaxTrendingTerms
+	}
+
+	channelFilter := map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}}
+	since := time.Now().Add(-time.Duration(args.Hours) * time.Hour)
+
+	// significant_text is used rather than significant_terms, as it works on analyzed text fields without fielddata
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					channelFilter,
+					map[string]interface{}{"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": _FormatTimestamp(since)}}},
+					_NotDeletedFilter,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"trending": map[string]interface{}{
+				"sampler": map[string]interface{}{"shard_size": _TrendingSampleSize},
+				"aggs": map[string]interface{}{
+					"terms": map[string]interface{}{
+						"significant_text": map[string]interface{}{
+							"field":                 "content",
+							"size":                  args.Limit,
+							"min_doc_count":         _TrendingMinDocCount,
+							"exclude":               _Stopwords,
+							"filter_duplicate_text": true,
+							"background_filter":     channelFilter,
+						},
+					},
+				},
+			},
+		},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error finding trending terms")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var trending _TrendingAggregation
+	err = json.Unmarshal(resp.Aggregations["trending"], &trending)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding trending terms")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	lines := make([]string, 0, len(trending.Terms.Buckets))
+	for index, bucket := range trending.Terms.Buckets {
+		lines = append(lines, fmt.Sprintf("%d. **%s** - %d recent messages, %d overall", index+1, bucket.Key, bucket.DocCount, bucket.BgCount))
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Trending in #%s over the last %d hours", channel.Name, args.Hours))
+	embed.Description = strings.Join(lines, "\n")
+	if len(lines) == 0 {
+		embed.Description = "Nothing is trending."
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
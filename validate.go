@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// _RedactedConfigFields lists the config fields that must never be logged
+var _RedactedConfigFields = []string{"Token", "ContentEncryptionKey", "ExternalIngestToken"}
+
+// _RedactURL removes the password from a URL, such as one that embeds Elasticsearch or proxy credentials.
+// URLs that can't be parsed are hidden entirely, as there's no telling which part of them is secret.
+func _RedactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "[redacted]"
+	}
+	return parsed.Redacted()
+}
+
+// _ValidateConfig checks the config for invalid values and combinations of settings that can't work together,
+// reporting every problem found rather than just the first
+func _ValidateConfig(cfg Config) error {
+	problems := make([]string, 0)
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Prefix != "" || cfg.AllowMentionPrefix, "PREFIX must be set unless ALLOW_MENTION_PREFIX is enabled, otherwise no commands can be run")
+	check(cfg.ConfirmationTimeout > 0, "CONFIRMATION_TIMEOUT must be positive, got %s", cfg.ConfirmationTimeout)
+	check(cfg.ActiveNowWindow > 0, "ACTIVE_NOW_WINDOW must be positive, got %s", cfg.ActiveNowWindow)
+	if cfg.EmbedColor != "" {
+		_, ok := _ParseEmbedColor(cfg.EmbedColor)
+		check(ok, "EMBED_COLOR must be a hex color such as #3B82F6, got %q", cfg.EmbedColor)
+	}
+	check(cfg.LogFile != "" || cfg.LogToConsole, "LOG_TO_CONSOLE can only be disabled when LOG_FILE is set, otherwise nothing would be logged")
+
+	check(cfg.IndexShards >= 1, "INDEX_SHARDS must be at least 1, got %d", cfg.IndexShards)
+	check(cfg.IndexReplicas >= 0, "INDEX_REPLICAS must not be negative, got %d", cfg.IndexReplicas)
+	check(!cfg.PerGuildIndices || !cfg.UseTimeBasedIndices, "PER_GUILD_INDICES can't be combined with USE_TIME_BASED_INDICES")
+	check(!cfg.AutoMigrate || (!cfg.UseTimeBasedIndices && !cfg.PerGuildIndices), "AUTO_MIGRATE only supports single indices, not USE_TIME_BASED_INDICES or PER_GUILD_INDICES")
+	check(cfg.ArchiveIndicesAfter == 0 || cfg.UseTimeBasedIndices, "ARCHIVE_INDICES_AFTER requires USE_TIME_BASED_INDICES, as only rolled over indices can be archived")
+	for _, address := range cfg.ElasticsearchURLs {
+		esURL, err := url.Parse(address)
+		check(err == nil && esURL.Host != "", "ELASTICSEARCH_URLS must only contain URLs such as http://localhost:9200, got %q", _RedactURL(address))
+	}
+	check(cfg.ESRetryInterval > 0, "ES_RETRY_INTERVAL must be positive, got %s", cfg.ESRetryInterval)
+	check(cfg.ESMaxRetries >= 0, "ES_MAX_RETRIES must not be negative, got %d", cfg.ESMaxRetries)
+	check(cfg.MaxESConcurrency >= 0, "MAX_ES_CONCURRENCY must not be negative, got %d", cfg.MaxESConcurrency)
+	if cfg.BackupPath != "" {
+		info, err := os.Stat(cfg.BackupPath)
+		check(err == nil && info.IsDir(), "BACKUP_PATH must be an existing directory, got %q", cfg.BackupPath)
+	}
+	check(cfg.SnapshotInterval >= 0, "SNAPSHOT_INTERVAL must not be negative, got %s", cfg.SnapshotInterval)
+	check(cfg.SnapshotInterval == 0 || cfg.SnapshotRepository != "", "SNAPSHOT_REPOSITORY must be set to a registered repository when SNAPSHOT_INTERVAL is set")
+	check(cfg.SnapshotNotifyChannel == "" || cfg.SnapshotInterval > 0, "SNAPSHOT_NOTIFY_CHANNEL requires SNAPSHOT_INTERVAL, as only scheduled snapshots are posted to it")
+	check(_BuiltInAnalyzers[cfg.ContentAnalyzer], "CONTENT_ANALYZER must be a built-in Elasticsearch analyzer such as standard, german or cjk, got %q", cfg.ContentAnalyzer)
+	for guildID, analyzer := range cfg.GuildContentAnalyzers {
+		check(_BuiltInAnalyzers[analyzer], "GUILD_CONTENT_ANALYZERS must only contain built-in Elasticsearch analyzers, got %q for guild %s", analyzer, guildID)
+	}
+	check(len(cfg.GuildContentAnalyzers) == 0 || cfg.PerGuildIndices, "GUILD_CONTENT_ANALYZERS requires PER_GUILD_INDICES, as guilds otherwise share an index")
+	check(!cfg.CreateDefaultPipeline || cfg.IngestPipeline != "", "INGEST_PIPELINE must be set to the name of the pipeline to create when CREATE_DEFAULT_PIPELINE is enabled")
+
+	check(cfg.DiscordFetchMaxAttempts >= 1, "DISCORD_FETCH_MAX_ATTEMPTS must be at least 1, got %d", cfg.DiscordFetchMaxAttempts)
+	check(cfg.PurgeRequestsPerSecond >= 0, "PURGE_REQUESTS_PER_SECOND must not be negative, got %d", cfg.PurgeRequestsPerSecond)
+	if cfg.EncryptContent || cfg.ContentEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.ContentEncryptionKey)
+		check(err == nil && len(key) == 32, "CONTENT_ENCRYPTION_KEY must be 32 bytes encoded as base64 when ENCRYPT_CONTENT is enabled")
+	}
+	for _, enricher := range cfg.Enrichers {
+		_, ok := _Enrichers[enricher]
+		check(ok, "ENRICHERS contains unknown enricher %q", enricher)
+	}
+	for _, field := range cfg.IndexFields {
+		check(_IsKnownDocumentField(field), "INDEX_FIELDS contains unknown field %q", field)
+	}
+	for _, field := range cfg.ExcludeFields {
+		check(_IsKnownDocumentField(field), "EXCLUDE_FIELDS contains unknown field %q", field)
+		check(!_RequiredDocumentFields[field], "EXCLUDE_FIELDS can't contain %q, as it is required", field)
+	}
+	check(cfg.MaxIngestMessages >= 0, "MAX_INGEST_MESSAGES must not be negative, got %d", cfg.MaxIngestMessages)
+	check(cfg.MinContentLength >= 0, "MIN_CONTENT_LENGTH must not be negative, got %d", cfg.MinContentLength)
+	check(cfg.MaxMessageAge >= 0, "MAX_MESSAGE_AGE must not be negative, got %s", cfg.MaxMessageAge)
+	check(cfg.MaxMessageAge == 0 || cfg.RetentionInterval > 0, "RETENTION_INTERVAL must be positive when MAX_MESSAGE_AGE is set, otherwise expired messages are never removed")
+	check(cfg.MessageIndexTimeout >= 0, "MESSAGE_INDEX_TIMEOUT must not be negative, got %s", cfg.MessageIndexTimeout)
+
+	err := _ValidateAttachmentTypes(cfg.AttachmentTypeAllowlist)
+	check(err == nil, "ATTACHMENT_TYPE_ALLOWLIST is invalid: %v", err)
+	err = _ValidatePausedMode(cfg.PausedIngestMode)
+	check(err == nil, "PAUSED_INGEST_MODE is invalid: %v", err)
+	_, err = time.LoadLocation(cfg.Timezone)
+	check(err == nil && cfg.Timezone != "" && cfg.Timezone != "Local", "TIMEZONE must be an IANA timezone name such as Europe/Berlin, got %q", cfg.Timezone)
+	check(cfg.LiveIngestWorkers >= 1, "LIVE_INGEST_WORKERS must be at least 1, got %d", cfg.LiveIngestWorkers)
+	check(cfg.LiveIngestQueueSize >= 1, "LIVE_INGEST_QUEUE_SIZE must be at least 1, got %d", cfg.LiveIngestQueueSize)
+	err = _ValidateOverflowPolicy(cfg.LiveIngestOverflow)
+	check(err == nil, "LIVE_INGEST_OVERFLOW is invalid: %v", err)
+	check(cfg.LiveIngestBlockTimeout >= 0, "LIVE_INGEST_BLOCK_TIMEOUT must not be negative, got %s", cfg.LiveIngestBlockTimeout)
+	check(cfg.LiveChannelMaxShare > 0 && cfg.LiveChannelMaxShare <= 1, "LIVE_CHANNEL_MAX_SHARE must be greater than 0 and at most 1, got %v", cfg.LiveChannelMaxShare)
+	check(cfg.LiveDedupeCacheSize >= 0, "LIVE_DEDUPE_CACHE_SIZE must not be negative, got %d", cfg.LiveDedupeCacheSize)
+	check(cfg.PausedIngestMode != _PausedModeBuffer || cfg.MaxPausedBuffer >= 1, "MAX_PAUSED_BUFFER must be at least 1 when buffering paused messages, got %d", cfg.MaxPausedBuffer)
+
+	check(cfg.MaxSearchResults >= 1, "MAX_SEARCH_RESULTS must be at least 1, got %d", cfg.MaxSearchResults)
+	check(cfg.MaxSearchExportResults >= 1, "MAX_SEARCH_EXPORT_RESULTS must be at least 1, got %d", cfg.MaxSearchExportResults)
+	check(len(cfg.SearchFieldBoosts) > 0, "SEARCH_FIELD_BOOSTS must contain at least one field")
+	for field, boost := range cfg.SearchFieldBoosts {
+		check(boost > 0, "SEARCH_FIELD_BOOSTS must only contain positive boosts, got %g for %s", boost, field)
+	}
+
+	for name, proxy := range map[string]string{"HTTP_PROXY": cfg.HTTPProxy, "HTTPS_PROXY": cfg.HTTPSProxy} {
+		if proxy != "" {
+			proxyURL, err := url.Parse(proxy)
+			check(err == nil && proxyURL.Host != "", "%s must be a URL such as http://proxy:3128, got %q", name, _RedactURL(proxy))
+		}
+	}
+
+	if cfg.HealthAddress != "" {
+		_, _, err = net.SplitHostPort(cfg.HealthAddress)
+		check(err == nil, "HEALTH_ADDRESS must be a host and port such as :8080, got %q", cfg.HealthAddress)
+	}
+	check(cfg.ExternalIngestToken == "" || cfg.HealthAddress != "", "HEALTH_ADDRESS must be set when EXTERNAL_INGEST_TOKEN is set, as external messages are posted to the same HTTP server")
+	check(cfg.ExternalSource != "" && !strings.ContainsAny(cfg.ExternalSource, " \t\n"), "EXTERNAL_SOURCE must be a single word such as irc, got %q", cfg.ExternalSource)
+	check(cfg.ExternalSource != _DiscordSource, "EXTERNAL_SOURCE can't be %s, as that is used to tag messages from Discord", _DiscordSource)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
+
+// _RedactedConfig returns the effective config with secrets removed, so that it can be logged
+func _RedactedConfig(cfg Config) map[string]interface{} {
+	encoded, _ := json.Marshal(cfg)
+	var redacted map[string]interface{}
+	json.Unmarshal(encoded, &redacted)
+
+	for _, field := range _RedactedConfigFields {
+		if value, ok := redacted[field]; ok && value != "" {
+			redacted[field] = "[redacted]"
+		}
+	}
+
+	addresses := make([]string, 0, len(cfg.ElasticsearchURLs))
+	for _, address := range cfg.ElasticsearchURLs {
+		addresses = append(addresses, _RedactURL(address))
+	}
+	redacted["ElasticsearchURLs"] = addresses
+	for field, proxy := range map[string]string{"HTTPProxy": cfg.HTTPProxy, "HTTPSProxy": cfg.HTTPSProxy} {
+		if proxy != "" {
+			redacted[field] = _RedactURL(proxy)
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxVerifySample = 1000
+const _MaxVerifyMissingShown = 5
+
+// _VerifyResult describes how many of a channel's most recent messages have been indexed
+type _VerifyResult struct {
+	Indexed int
+	Sampled int
+	Found   int
+	Missing []*discordgo.Message
+}
+
+// _IsIngestible returns whether a message would be ingested, rather than deliberately skipped
+func _IsIngestible(message *discordgo.Message) bool {
+	return !_IsExcludedChannel(message.ChannelID) && !_IsBlocked(message.Author.ID) && !_IsExpired(message) && !_IsTooShort(message)
+}
+
+// _VerifyChannel compares the most recent messages in a channel on Discord against the ones that have been indexed
+func _VerifyChannel(channelID string, sample int) (*_VerifyResult, error) {
+	indexed, err := _CountRouted([]string{_ChannelReadIndex("messages", channelID)}, map[string]interface{}{
+		"term": map[string]interface{}{"channel_id": channelID},
+	}, _ChannelRouting(channelID))
+	if err != nil {
+		return nil, err
+	}
+	result := &_VerifyResult{Indexed: indexed, Missing: make([]*discordgo.Message, 0)}
+
+	before := ""
+	for result.Sampled < sample {
+		messages, err := _ChannelMessages(channelID, 100, before, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		before = messages[len(messages)-1].ID
+
+		ingestible := make([]*discordgo.Message, 0, len(messages))
+		for _, message := range messages {
+			if _IsIngestible(message) {
+				ingestible = append(ingestible, message)
+			}
+		}
+		if len(ingestible) > sample-result.Sampled {
+			ingestible = ingestible[:sample-result.Sampled]
+		}
+		if len(ingestible) == 0 {
+			continue
+		}
+
+		found, err := _IngestedMessageIDs(channelID, ingestible)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range ingestible {
+			if found[message.ID] {
+				result.Found++
+			} else {
+				result.Missing = append(result.Missing, message)
+			}
+		}
+		result.Sampled += len(ingestible)
+	}
+
+	return result, nil
+}
+
+type _VerifyArgs struct {
+	Channel string `description:"Channel to verify the ingestion of."`
+	Sample  int    `default:"500" description:"Number of recent messages to check."`
+}
+
+func _VerifyHandler(message *discordgo.MessageCreate, args _VerifyArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Sample < 1 || args.Sample > _MaxVerifySample {
+		args.Sample = _MaxVerifySample
+	}
+
+	result, err := _VerifyChannel(channel.ID, args.Sample)
+	if err != nil {
+		log.Error().Err(err).Msg("Error verifying channel")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	coverage := 100.0
+	if result.Sampled > 0 {
+		coverage = float64(result.Found) / float64(result.Sampled) * 100
+	}
+
+	embed := _NewEmbed(fmt.Sprintf("Ingestion coverage for #%s", channel.Name))
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Indexed messages", Value: fmt.Sprint(result.Indexed), Inline: true},
+		{Name: "Recent messages checked", Value: fmt.Sprint(result.Sampled), Inline: true},
+		{Name: "Coverage", Value: fmt.Sprintf("%.1f%%", coverage), Inline: true},
+	}
+	embed.Footer = _EmbedFooter("Messages skipped by the blocklist, retention or minimum length are not counted")
+
+	if len(result.Missing) > 0 {
+		links := make([]string, 0, _MaxVerifyMissingShown)
+		for _, missing := range result.Missing {
+			if len(links) == _MaxVerifyMissingShown {
+				break
+			}
+			links = append(links, fmt.Sprintf("[%s](%s)", missing.Timestamp.Format("2006-01-02 15:04"), _JumpURL(message.GuildID, channel.ID, missing.ID)))
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("Missing messages (%d)", len(result.Missing)),
+			Value: strings.Join(links, "\n"),
+		})
+	}
+
+	session.ChannelMessageSendEmbed(message.ChannelID, embed)
+}
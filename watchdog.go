@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const _WatchdogCheckInterval = 30 * time.Second
+
+// _HeartbeatStatus represents the state of the gateway heartbeat
+type _HeartbeatStatus struct {
+	LastAck    time.Time `json:"last_ack"`
+	AckAge     string    `json:"ack_age"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Overdue    bool      `json:"overdue"`
+	WatchdogOn bool      `json:"watchdog_enabled"`
+}
+
+// _CurrentHeartbeat returns the age of the last heartbeat acknowledged by Discord and the latency of the heartbeat before it
+func _CurrentHeartbeat() _HeartbeatStatus {
+	session.RLock()
+	lastAck := session.LastHeartbeatAck
+	session.RUnlock()
+
+	age := time.Since(lastAck)
+	status := _HeartbeatStatus{
+		LastAck:    lastAck,
+		AckAge:     age.Round(time.Second).String(),
+		LatencyMs:  session.HeartbeatLatency().Milliseconds(),
+		WatchdogOn: config.HeartbeatWatchdogThreshold > 0,
+	}
+	status.Overdue = status.WatchdogOn && !lastAck.IsZero() && age > config.HeartbeatWatchdogThreshold
+	return status
+}
+
+// _HeartbeatWatchdog reconnects to the gateway when Discord stops acknowledging heartbeats,
+// for hosts where idle connections are silently dropped without discordgo noticing
+func _HeartbeatWatchdog() {
+	ticker := time.NewTicker(_WatchdogCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		heartbeat := _CurrentHeartbeat()
+		if !heartbeat.Overdue || !_IsConnected() {
+			continue
+		}
+
+		log.Warn().Str("ack_age", heartbeat.AckAge).Int64("latency_ms", heartbeat.LatencyMs).Msg("Heartbeat overdue, reconnecting to Discord")
+		err := session.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("Error closing Discord session")
+		}
+		_SetConnectionState(_ConnectionConnecting)
+		err = session.Open()
+		if err != nil {
+			log.Error().Err(err).Msg("Error reopening Discord session")
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/rs/zerolog/log"
+)
+
+const _MaxWordCloudWords = 500
+const _WordCloudSampleSize = 5000
+
+// Terms made up of digits are mostly what's left of user, channel and role mentions once they're tokenized,
+// and very short terms and URL schemes don't make for interesting words
+const _WordCloudExclude = `(.*[0-9].*)|(.{1,2})|(https?)`
+
+// _WordCloudAnalysis defines the analyzer used for content.words, which drops common English stopwords
+var _WordCloudAnalysis = map[string]interface{}{
+	"analyzer": map[string]interface{}{
+		"elkbot_words": map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    []string{"lowercase", "stop"},
+		},
+	},
+}
+
+type _WordCloudWord struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+type _WordCloudArgs struct {
+	Channel string `description:"Channel to count words in."`
+	Limit   int    `default:"100" description:"Number of words to include."`
+	Days    int    `default:"0" description:"Only count messages from this many days ago onwards. 0 counts every message."`
+}
+
+func _WordCloudHandler(message *discordgo.MessageCreate, args _WordCloudArgs) {
+	channel, err := _ResolveGuildChannel(args.Channel, message.GuildID)
+	if err != nil {
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	if args.Limit < 1 || args.Limit > _MaxWordCloudWords {
+		args.Limit = _MaxWordCloudWords
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"channel_id": channel.ID}},
+		_NotDeletedFilter,
+	}
+	if args.Days > 0 {
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%dd", args.Days)}},
+		})
+	}
+
+	resp, err := _SearchRouted([]string{_ChannelReadIndex("messages", channel.ID)}, map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"aggs": map[string]interface{}{
+			"sample": map[string]interface{}{
+				"sampler": map[string]interface{}{"shard_size": _WordCloudSampleSize},
+				"aggs": map[string]interface{}{
+					"words": map[string]interface{}{
+						"terms": map[string]interface{}{
+							"field":   "content.words",
+							"size":    args.Limit,
+							"exclude": _WordCloudExclude,
+						},
+					},
+				},
+			},
+		},
+	}, _ChannelRouting(channel.ID))
+	if err != nil {
+		log.Error().Err(err).Msg("Error aggregating word frequencies")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+
+	var sample struct {
+		Words _TermsAggregation `json:"words"`
+	}
+	err = json.Unmarshal(resp.Aggregations["sample"], &sample)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding word aggregation")
+		session.ChannelMessageSend(message.ChannelID, fmt.Sprintf("```\n%s\n```", err.Error()))
+		return
+	}
+	if len(sample.Words.Buckets) == 0 {
+		session.ChannelMessageSend(message.ChannelID, "No words found.")
+		return
+	}
+
+	words := make([]_WordCloudWord, 0, len(sample.Words.Buckets))
+	for _, bucket := range sample.Words.Buckets {
+		words = append(words, _WordCloudWord{Text: fmt.Sprint(bucket.Key), Count: bucket.DocCount})
+	}
+	output, _ := json.MarshalIndent(words, "", "  ")
+
+	_, err = session.ChannelMessageSendComplex(message.ChannelID, &discordgo.MessageSend{
+		Content: fmt.Sprintf("Word frequencies for <#%s>, by the number of messages each word appears in.", channel.ID),
+		Files: []*discordgo.File{{
+			Name:        fmt.Sprintf("%s-words.json", channel.Name),
+			ContentType: "application/json",
+			Reader:      bytes.NewReader(output),
+		}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Error uploading word frequencies")
+	}
+}